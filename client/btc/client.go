@@ -1,10 +1,12 @@
 package btc
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"os"
 	"path"
+	"sync"
 
 	"main/client"
 	"main/electrumx"
@@ -23,6 +25,10 @@ type BtcElectrumClient struct {
 	clientHeaders *Headers
 	// client wallet receive address synchronization with the node
 	walletSynchronizer *AddressSynchronizer
+	// client event stream
+	events *client.EventBus
+	// removes the balance listener of the current wallet
+	unwatchWallet func()
 }
 
 func NewBtcElectrumClient(cfg *client.ClientConfig) client.ElectrumClient {
@@ -33,6 +39,7 @@ func NewBtcElectrumClient(cfg *client.ClientConfig) client.ElectrumClient {
 	}
 	ec.clientHeaders = NewHeaders(cfg)
 	ec.walletSynchronizer = NewWalletSychronizer(cfg)
+	ec.events = client.NewEventBus()
 	return &ec
 }
 
@@ -73,10 +80,14 @@ func (ec *BtcElectrumClient) CreateWallet(pw string) error {
 	cfg.DB = sqliteDatastore
 
 	walletCfg := cfg.MakeWalletConfig()
+	walletCfg.Broadcaster = ec
+	walletCfg.Headers = ec.clientHeaders
+	walletCfg.FeeSources = cfg.MakeFeeSources(ec.feeEstimator)
 	ec.Wallet, err = wltbtc.NewBtcElectrumWallet(walletCfg, pw)
 	if err != nil {
 		return err
 	}
+	ec.watchWallet()
 	return nil
 }
 
@@ -102,10 +113,14 @@ func (ec *BtcElectrumClient) RecreateWallet(pw, mnenomic string) error {
 	cfg.DB = sqliteDatastore
 
 	walletCfg := cfg.MakeWalletConfig()
+	walletCfg.Broadcaster = ec
+	walletCfg.Headers = ec.clientHeaders
+	walletCfg.FeeSources = cfg.MakeFeeSources(ec.feeEstimator)
 	ec.Wallet, err = wltbtc.RecreateElectrumWallet(walletCfg, pw, mnenomic)
 	if err != nil {
 		return err
 	}
+	ec.watchWallet()
 	return nil
 }
 
@@ -122,18 +137,105 @@ func (ec *BtcElectrumClient) LoadWallet(pw string) error {
 	cfg.DB = sqliteDatastore
 
 	walletCfg := cfg.MakeWalletConfig()
+	walletCfg.Broadcaster = ec
+	walletCfg.Headers = ec.clientHeaders
+	walletCfg.FeeSources = cfg.MakeFeeSources(ec.feeEstimator)
 	ec.Wallet, err = wltbtc.LoadBtcElectrumWallet(walletCfg, pw)
 	if err != nil {
 		return err
 	}
+	ec.watchWallet()
 	return nil
 }
 
-// CreateNode creates a single unconnected ElectrumX node
-func (ec *BtcElectrumClient) CreateNode(_ client.NodeType) {
+// CreateNode creates an unconnected ElectrumX node of the type, a single
+// server or several with failover
+func (ec *BtcElectrumClient) CreateNode(nodeType client.NodeType) {
 	nodeCfg := ec.GetConfig().MakeNodeConfig()
-	n := elxbtc.NewSingleNode(nodeCfg)
-	ec.Node = n
+	nodeCfg.ServerSwitched = func(from, to electrumx.ServerAddr) {
+		ec.events.Publish(client.ServerSwitchedEvent{From: from.String(), To: to.String()})
+	}
+	switch nodeType {
+	case client.MultiNode:
+		ec.Node = elxbtc.NewMultiNode(nodeCfg)
+	default:
+		ec.Node = elxbtc.NewSingleNode(nodeCfg)
+	}
+}
+
+// StartNode connects the node to its server
+func (ec *BtcElectrumClient) StartNode() error {
+	node := ec.GetNode()
+	if node == nil {
+		return errors.New("no node")
+	}
+	err := node.Start()
+	if err != nil {
+		return err
+	}
+	svr := node.GetServerConn()
+	ec.events.Publish(client.ServerConnectedEvent{Server: svr.Addr.String()})
+	go ec.watchServer(node, svr)
+	return nil
+}
+
+// watchServer publishes the loss of the node's server. A node that fails over
+// to another server is then watched on that server.
+func (ec *BtcElectrumClient) watchServer(node electrumx.ElectrumXNode, svr *electrumx.ElectrumXSvrConn) {
+	for {
+		<-svr.SvrConn.Done()
+		ec.events.Publish(client.ServerDisconnectedEvent{Server: svr.Addr.String()})
+		next := node.GetServerConn()
+		if next == nil || next == svr {
+			return
+		}
+		svr = next
+		ec.events.Publish(client.ServerConnectedEvent{Server: svr.Addr.String()})
+	}
+}
+
+// serverAddr returns the address of the server the node sends requests to,
+// so it can be banned for invalid data it sends
+func serverAddr(node electrumx.ElectrumXNode) electrumx.ServerAddr {
+	if svr := node.GetServerConn(); svr != nil {
+		return svr.Addr
+	}
+	return electrumx.ServerAddr{}
+}
+
+// feeEstimator returns the client's node for the server fee source
+func (ec *BtcElectrumClient) feeEstimator() client.FeeEstimator {
+	if ec.Node == nil {
+		return nil
+	}
+	return ec.Node
+}
+
+// SubscribeEvents returns a channel of client events that is closed when ctx
+// is done
+func (ec *BtcElectrumClient) SubscribeEvents(ctx context.Context) <-chan client.Event {
+	return ec.events.Subscribe(ctx)
+}
+
+// watchWallet publishes balance changes of the client's wallet in place of
+// those of the wallet it had before
+func (ec *BtcElectrumClient) watchWallet() {
+	if ec.unwatchWallet != nil {
+		ec.unwatchWallet()
+	}
+	w := ec.GetWallet()
+	var mtx sync.Mutex
+	confirmed, unconfirmed := w.Balance()
+	ec.unwatchWallet = w.AddTransactionListener(func(_ wallet.TransactionCallback) {
+		mtx.Lock()
+		defer mtx.Unlock()
+		c, u := w.Balance()
+		if c == confirmed && u == unconfirmed {
+			return
+		}
+		confirmed, unconfirmed = c, u
+		ec.events.Publish(client.BalanceChangedEvent{Confirmed: c, Unconfirmed: u})
+	})
 }
 
 // Interface methods in client_headers.go
@@ -1,10 +1,16 @@
 package btc
 
 import (
+	"bytes"
 	"encoding/hex"
 	"fmt"
 	"log"
 	"time"
+
+	"main/client"
+	"main/electrumx"
+
+	"github.com/btcsuite/btcd/wire"
 )
 
 // SyncHeaders uodates the client headers and then subscribes for new update
@@ -51,6 +57,8 @@ func (ec *BtcElectrumClient) SyncClientHeaders() error {
 	var blockCount = uint32(20)
 
 	node := ec.GetNode()
+	// the server blamed for invalid headers
+	server := serverAddr(node)
 
 	hdrsRes, err := node.BlockHeaders(startHeight, blockCount)
 	if err != nil {
@@ -72,6 +80,7 @@ func (ec *BtcElectrumClient) SyncClientHeaders() error {
 		maybeTip += int32(count)
 
 		fmt.Println(" Appended: ", nh, " headers at ", startHeight, " maybeTip ", maybeTip)
+		ec.events.Publish(client.HeaderSyncEvent{Height: int64(maybeTip)})
 	}
 
 	if count < blockDelta {
@@ -113,6 +122,7 @@ func (ec *BtcElectrumClient) SyncClientHeaders() error {
 				maybeTip += int32(count)
 
 				fmt.Println(" Appended: ", nh, " headers at ", startHeight, " maybeTip ", maybeTip)
+				ec.events.Publish(client.HeaderSyncEvent{Height: int64(maybeTip)})
 			}
 
 			if count < blockDelta {
@@ -134,18 +144,20 @@ func (ec *BtcElectrumClient) SyncClientHeaders() error {
 	if err != nil {
 		return err
 	}
-	h.hdrsTip = maybeTip
+	h.setTip(maybeTip)
 
 	// 5. Verify headers in headers map
 	fmt.Printf("starting verify at height %d\n", h.hdrsTip)
 	err = h.VerifyAll()
 	if err != nil {
+		node.BanServer(server, "invalid headers")
 		return err
 	}
 	fmt.Println("header chain verified")
 
 	h.synced = true
 	fmt.Println("headers synced up to tip ", h.hdrsTip)
+	ec.events.Publish(client.HeaderSyncEvent{Height: int64(h.hdrsTip), Synced: true})
 	return nil
 }
 
@@ -181,7 +193,9 @@ func (ec *BtcElectrumClient) SubscribeClientHeaders() error {
 	fmt.Println("hdrRes.Height", hdrRes.Height, "maybeTip", maybeTip, "diff", hdrRes.Height-maybeTip)
 	fmt.Println("hdrRes.Hex", hdrRes.Hex)
 
-	svrCtx := node.GetServerConn().SvrCtx
+	svr := node.GetServerConn()
+	svrCtx := svr.SvrCtx
+	svrDone := svr.SvrConn.Done()
 
 	go func() {
 		fmt.Println("=== Waiting for headers ===")
@@ -193,6 +207,12 @@ func (ec *BtcElectrumClient) SubscribeClientHeaders() error {
 				node.Stop()
 				return
 
+			case <-svrDone:
+				// the node was stopped or the server went away and the
+				// notify channel is closed
+				fmt.Println("Server disconnected - subscribe headers notify")
+				return
+
 			case <-hdrResNotifyCh:
 				// read whatever is in the queue, usually one header at tip
 				for x := range hdrResNotifyCh {
@@ -219,11 +239,15 @@ func (ec *BtcElectrumClient) SubscribeClientHeaders() error {
 							}
 
 							// update tip / local tip
-							h.hdrsTip = x.Height
+							h.setTip(x.Height)
 							maybeTip = x.Height
 
 							// verify added header back from new tip
-							h.VerifyFromTip(2, false)
+							if err := h.VerifyFromTip(2, false); err != nil {
+								node.BanServer(svr.Addr, "invalid headers")
+							}
+							ec.publishNewTip(x)
+							ec.refreshMempoolOnTip()
 
 						} else {
 							// Server can skip any amount of headers but we should
@@ -260,11 +284,15 @@ func (ec *BtcElectrumClient) SubscribeClientHeaders() error {
 								}
 
 								// update tip / local tip
-								h.hdrsTip = x.Height
+								h.setTip(x.Height)
 								maybeTip = x.Height
 
 								// verify added headers back from new tip
-								h.VerifyFromTip(int32(count+1), false)
+								if err := h.VerifyFromTip(int32(count+1), false); err != nil {
+									node.BanServer(svr.Addr, "invalid headers")
+								}
+								ec.publishNewTip(x)
+								ec.refreshMempoolOnTip()
 							}
 						}
 					} else {
@@ -278,3 +306,34 @@ func (ec *BtcElectrumClient) SubscribeClientHeaders() error {
 
 	return nil
 }
+
+// publishNewTip sends a new tip event for a header notification
+func (ec *BtcElectrumClient) publishNewTip(tip *electrumx.HeadersNotifyResult) {
+	b, err := hex.DecodeString(tip.Hex)
+	if err != nil {
+		return
+	}
+	var hdr wire.BlockHeader
+	err = hdr.Deserialize(bytes.NewReader(b))
+	if err != nil {
+		return
+	}
+	ec.events.Publish(client.NewTipEvent{
+		Height: int64(tip.Height),
+		Hash:   hdr.BlockHash().String(),
+	})
+}
+
+// refreshMempoolOnTip re-checks wallet unconfirmed transactions after a new
+// block which may have mined or conflicted them
+func (ec *BtcElectrumClient) refreshMempoolOnTip() {
+	if ec.GetWallet() == nil {
+		return
+	}
+	go func() {
+		err := ec.RefreshMempool()
+		if err != nil {
+			fmt.Println("refresh mempool:", err)
+		}
+	}()
+}
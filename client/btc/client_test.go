@@ -1,10 +1,14 @@
 package btc
 
 import (
+	"context"
 	"testing"
+	"time"
 
 	"github.com/btcsuite/btcd/chaincfg"
 	"main/client"
+	"main/electrumx"
+	"main/electrumx/electrumxtest"
 	"main/wallet"
 )
 
@@ -58,3 +62,107 @@ func TestElectrumScripthash(t *testing.T) {
 		t.Fatal(err)
 	}
 }
+
+// TestClientSync runs the client against an in-process server: sync the
+// headers, sync a recreated wallet, then receive and confirm a payment
+func TestClientSync(t *testing.T) {
+	srv := electrumxtest.NewServer(&chaincfg.RegressionNetParams)
+	if err := srv.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Close()
+	srv.MineEmptyBlocks(25)
+
+	cfg, err := makeBitcoinRegtestConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg.DataDir = t.TempDir()
+	cfg.TrustedPeer = electrumx.ServerAddr{Net: "tcp", Addr: srv.Addr()}
+	ec := NewBtcElectrumClient(cfg)
+	ec.CreateNode(client.SingleNode)
+	if err = ec.StartNode(); err != nil {
+		t.Fatal(err)
+	}
+	defer ec.GetNode().Stop()
+	if err = ec.SyncHeaders(); err != nil {
+		t.Fatal(err)
+	}
+	if tip := ec.(*BtcElectrumClient).clientHeaders.hdrsTip; tip != 25 {
+		t.Fatalf("synced headers to %d", tip)
+	}
+
+	if err = ec.RecreateWallet("abc", mnemonic); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	events := ec.SubscribeEvents(ctx)
+	if err = ec.SyncWallet(); err != nil {
+		t.Fatal(err)
+	}
+
+	w := ec.GetWallet()
+	script, err := w.AddressToScript(w.CurrentAddress(wallet.EXTERNAL))
+	if err != nil {
+		t.Fatal(err)
+	}
+	waitBalance := func(confirmed, unconfirmed int64) {
+		t.Helper()
+		timeout := time.After(5 * time.Second)
+		for {
+			select {
+			case e := <-events:
+				if bal, ok := e.(client.BalanceChangedEvent); ok &&
+					bal.Confirmed == confirmed && bal.Unconfirmed == unconfirmed {
+					return
+				}
+			case <-timeout:
+				t.Fatalf("no balance changed event for %d/%d", confirmed, unconfirmed)
+			}
+		}
+	}
+
+	fund := srv.Fund(script, 100000)
+	waitBalance(0, 100000)
+
+	srv.MineBlock()
+	waitBalance(100000, 0)
+	txn, err := w.GetTransaction(fund.TxHash())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if txn.Height != 26 {
+		t.Fatalf("transaction confirmed at height %d", txn.Height)
+	}
+
+	// a rescan without the header to verify against fails and keeps the
+	// wallet history
+	if _, ok := ec.(*BtcElectrumClient).clientHeaders.MerkleRoot(26); !ok {
+		if err = ec.RescanWallet(0, nil); err == nil {
+			t.Fatal("rescanned without the headers")
+		}
+		if _, err = w.GetTransaction(fund.TxHash()); err != nil {
+			t.Fatalf("failed rescan dropped the history: %v", err)
+		}
+	}
+
+	// a rescan verifies the transactions against the headers
+	if err = ec.(*BtcElectrumClient).SyncClientHeaders(); err != nil {
+		t.Fatal(err)
+	}
+	var progress client.RescanProgress
+	err = ec.RescanWallet(0, func(p client.RescanProgress) { progress = p })
+	if err != nil {
+		t.Fatal(err)
+	}
+	if progress.TxnsAdded != 1 {
+		t.Fatalf("rescan added %d transactions", progress.TxnsAdded)
+	}
+
+	// fees come from the server's estimates
+	srv.SetFeeEstimate(1, 0.00025)
+	if fee := w.GetFeePerByte(wallet.NORMAL); fee != 25 {
+		t.Fatalf("fee per byte %d", fee)
+	}
+}
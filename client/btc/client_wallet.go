@@ -3,49 +3,35 @@ package btc
 import (
 	"fmt"
 
-	"github.com/btcsuite/btcd/txscript"
+	"main/client"
 )
 
 // Here is the client interface between the node & wallet for transaction
 // broadcast and wallet synchronize
 
-// devdbg: just one known wallet address
+// SyncWallet subscribes all wallet addresses for status change notifications.
+// The history of any address whose status changed since the last sync is
+// fetched and added to the wallet. Then notifications are listened for.
 func (ec *BtcElectrumClient) SyncWallet() error {
-
-	// just get 1st adddress in wallet
 	addresses := ec.GetWallet().ListAddresses()
-	address := addresses[0]
-
-	fmt.Println(address.String())
-
-	err := ec.SubscribeAddressNotify(address)
-	if err != nil {
-		return err
+	for _, address := range addresses {
+		if ec.alreadySubscribed(address) {
+			continue
+		}
+		fmt.Println(address.String())
+		err := ec.SubscribeAddressNotify(address)
+		if err != nil {
+			return err
+		}
 	}
-	script, err := txscript.PayToAddrScript(address)
-	if err != nil {
-		// possibly non-standard: future
-		return err
-	}
-	// AddWatchedScript adds the pay script to db. If it already exists this
-	// is a no-op
-	err = ec.GetWallet().AddWatchedScript(script)
-	if err != nil {
-		return err
-	}
-
-	history, err := ec.GetAddressHistory(address)
-	if err != nil {
-		return err
-	}
-	dumpHistory(address, history)
 
 	// start goroutine to listen for scripthash status change notifications arriving
-	err = ec.addressStatusNotify()
+	err := ec.addressStatusNotify()
 	if err != nil {
 		return err
 	}
 
+	ec.events.Publish(client.WalletSyncedEvent{})
 	return nil
 }
 
@@ -106,3 +92,8 @@ func (ec *BtcElectrumClient) SyncWallet() error {
 func (ec *BtcElectrumClient) Broadcast(rawTx string) (string, error) {
 	return ec.GetNode().Broadcast(rawTx)
 }
+
+// GetRawTransaction returns the hex encoded transaction from the server
+func (ec *BtcElectrumClient) GetRawTransaction(txid string) (string, error) {
+	return ec.GetNode().GetRawTransaction(txid)
+}
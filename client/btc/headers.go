@@ -14,8 +14,10 @@ import (
 	"os"
 	"path/filepath"
 	"sync"
+	"time"
 
 	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
 	"github.com/btcsuite/btcd/wire"
 	"main/client"
 )
@@ -165,6 +167,41 @@ func (h *Headers) Store(b []byte, startHeight int32) error {
 	return nil
 }
 
+// BlockTime returns the timestamp of the stored header at height, if any
+func (h *Headers) BlockTime(height int32) (time.Time, bool) {
+	h.hdrsMtx.RLock()
+	defer h.hdrsMtx.RUnlock()
+	hdr, ok := h.hdrs[height]
+	if !ok {
+		return time.Time{}, false
+	}
+	return hdr.Timestamp, true
+}
+
+// MerkleRoot returns the merkle root of the stored header at height, if any
+func (h *Headers) MerkleRoot(height int32) (chainhash.Hash, bool) {
+	h.hdrsMtx.RLock()
+	defer h.hdrsMtx.RUnlock()
+	hdr, ok := h.hdrs[height]
+	if !ok {
+		return chainhash.Hash{}, false
+	}
+	return hdr.MerkleRoot, true
+}
+
+// Tip returns the height of the best stored header
+func (h *Headers) Tip() int32 {
+	h.hdrsMtx.RLock()
+	defer h.hdrsMtx.RUnlock()
+	return h.hdrsTip
+}
+
+func (h *Headers) setTip(height int32) {
+	h.hdrsMtx.Lock()
+	defer h.hdrsMtx.Unlock()
+	h.hdrsTip = height
+}
+
 // Verify headers prev hash back from tip. If all is true depth is ignored
 // and the whole chain is verified
 func (h *Headers) VerifyFromTip(depth int32, all bool) error {
@@ -1,10 +1,17 @@
 package btc
 
 import (
+	"context"
 	"fmt"
 	"testing"
+	"time"
 
 	"main/client"
+	"main/electrumx"
+	"main/electrumx/electrumxtest"
+	"main/electrumx/elxbtc"
+
+	"github.com/btcsuite/btcd/chaincfg"
 )
 
 func TestNodeCreate(t *testing.T) {
@@ -16,5 +23,76 @@ func TestNodeCreate(t *testing.T) {
 }
 
 func TestMultiNodeCreate(t *testing.T) {
-	fmt.Println("TBD:")
+	c := NewBtcElectrumClient(client.NewDefaultConfig())
+	c.CreateNode(client.MultiNode)
+	if _, ok := c.GetNode().(*elxbtc.MultiNode); !ok {
+		t.Fatalf("created %T", c.GetNode())
+	}
+}
+
+func TestServerEventsFailover(t *testing.T) {
+	var addrs []electrumx.ServerAddr
+	byAddr := make(map[string]*electrumxtest.Server)
+	dataDir := t.TempDir()
+	servers, err := electrumx.NewServerList(dataDir, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		srv := electrumxtest.NewServer(&chaincfg.RegressionNetParams)
+		if err := srv.Start(); err != nil {
+			t.Fatal(err)
+		}
+		defer srv.Close()
+		addr := electrumx.ServerAddr{Net: "tcp", Addr: srv.Addr()}
+		servers.Add(addr, electrumx.SourceUser)
+		addrs = append(addrs, addr)
+		byAddr[srv.Addr()] = srv
+	}
+
+	cfg, err := makeBitcoinRegtestConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg.DataDir = dataDir
+	cfg.TrustedPeer = addrs[0]
+	ec := NewBtcElectrumClient(cfg)
+	ec.CreateNode(client.MultiNode)
+	ec.GetNode().(*elxbtc.MultiNode).Servers = servers
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	events := ec.SubscribeEvents(ctx)
+	if err = ec.StartNode(); err != nil {
+		t.Fatal(err)
+	}
+	defer ec.GetNode().Stop()
+
+	next := func() client.Event {
+		select {
+		case e := <-events:
+			return e
+		case <-time.After(5 * time.Second):
+			t.Fatal("no event")
+			return nil
+		}
+	}
+	first, ok := next().(client.ServerConnectedEvent)
+	if !ok || first.Server != addrs[0].String() {
+		t.Fatalf("expected connection to %s, got %v", addrs[0], first)
+	}
+	byAddr[first.Server].Close()
+	if e, ok := next().(client.ServerDisconnectedEvent); !ok || e.Server != first.Server {
+		t.Fatalf("expected disconnect from %s, got %v", first.Server, e)
+	}
+	if e, ok := next().(client.ServerSwitchedEvent); !ok || e.From != first.Server {
+		t.Fatalf("expected switch from %s, got %v", first.Server, e)
+	}
+	second, ok := next().(client.ServerConnectedEvent)
+	if !ok || second.Server == first.Server {
+		t.Fatalf("expected connection to the other server, got %v", second)
+	}
+	byAddr[second.Server].Close()
+	if e, ok := next().(client.ServerDisconnectedEvent); !ok || e.Server != second.Server {
+		t.Fatalf("expected disconnect from %s, got %v", second.Server, e)
+	}
 }
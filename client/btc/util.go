@@ -3,3 +3,9 @@ package btc
 // /////////////////////////////////////////////////////////////////////////////
 // Helpers
 // ///////
+
+// ElectrumScripthash makes the electrum protocol 'scripthash' of an output
+// script, which the server indexes history and utxos by
+func ElectrumScripthash(pkscript []byte) string {
+	return pkScriptToElectrumScripthash(pkscript)
+}
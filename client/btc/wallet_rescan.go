@@ -0,0 +1,275 @@
+package btc
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"main/client"
+	"main/electrumx"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+)
+
+// rescanTx is a transaction found in the history of a wallet script
+type rescanTx struct {
+	txid   string
+	height int64
+	tx     *wire.MsgTx
+}
+
+// RescanWallet is the recovery path for a wallet whose local history is out of
+// sync with the chain. The history of every wallet and watched script is
+// fetched from the server and each confirmed transaction is verified: the
+// server's merkle proof must lead to the merkle root of the stored header at
+// its height, so the headers must be synced before a rescan. Only then does
+// the wallet drop everything at or above fromHeight, and anything
+// unconfirmed, and the transactions are added back in height order, so a
+// rescan that fails leaves the wallet as it was. Using a key may extend the
+// wallet lookahead window so scanning repeats until no new scripts appear.
+// Progress is reported through the optional progress callback.
+func (ec *BtcElectrumClient) RescanWallet(fromHeight int64, progress func(client.RescanProgress)) error {
+	w := ec.GetWallet()
+	if w == nil {
+		return errors.New("no wallet")
+	}
+	if fromHeight < 0 {
+		fromHeight = 0
+	}
+
+	// no notification driven sync runs meanwhile
+	ec.walletSynchronizer.historyMtx.Lock()
+	defer ec.walletSynchronizer.historyMtx.Unlock()
+
+	report := func(p client.RescanProgress) {
+		if progress != nil {
+			progress(p)
+		}
+	}
+
+	var p client.RescanProgress
+	scanned := make(map[string]bool)
+	added := make(map[string]bool)
+	cleared := false
+	for {
+		scripts, err := ec.rescanScripts()
+		if err != nil {
+			return err
+		}
+		var toScan [][]byte
+		for _, script := range scripts {
+			if !scanned[string(script)] {
+				toScan = append(toScan, script)
+			}
+		}
+		if len(toScan) == 0 {
+			if !cleared {
+				if err = w.ReSyncBlockchain(uint64(fromHeight)); err != nil {
+					return err
+				}
+			}
+			ec.events.Publish(client.WalletSyncedEvent{})
+			return nil
+		}
+		p.ScriptsTotal += len(toScan)
+
+		// gather history
+		var txns []rescanTx
+		seen := make(map[string]bool)
+		histories := make(map[string]electrumx.HistoryResult, len(toScan))
+		for _, script := range toScan {
+			scanned[string(script)] = true
+			scripthash := pkScriptToElectrumScripthash(script)
+			history, err := ec.GetNode().GetHistory(scripthash)
+			if err != nil {
+				return err
+			}
+			histories[scripthash] = history
+			for _, h := range history {
+				height := int64(h.Height)
+				// mempool tx heights are 0, or -1 with unconfirmed inputs
+				if height < 0 {
+					height = 0
+				}
+				if height > 0 && height < fromHeight {
+					continue
+				}
+				if seen[h.TxHash] || added[h.TxHash] {
+					continue
+				}
+				seen[h.TxHash] = true
+				txns = append(txns, rescanTx{txid: h.TxHash, height: height})
+			}
+			p.ScriptsScanned++
+			report(p)
+		}
+
+		// fetch and verify every transaction before the wallet is changed
+		p.TxnsTotal += len(txns)
+		for i := range txns {
+			t := &txns[i]
+			if t.tx, err = ec.getTransaction(t.txid); err != nil {
+				return err
+			}
+			if t.height > 0 {
+				if err = ec.verifyTx(t.tx, t.height); err != nil {
+					return err
+				}
+			}
+		}
+		if !cleared {
+			if err = w.ReSyncBlockchain(uint64(fromHeight)); err != nil {
+				return err
+			}
+			cleared = true
+		}
+
+		// Add the transactions oldest first so spends follow the outputs they
+		// spend. Unconfirmed transactions go last.
+		sort.SliceStable(txns, func(i, j int) bool {
+			hi, hj := txns[i].height, txns[j].height
+			if hi == 0 || hj == 0 {
+				return hj == 0 && hi != 0
+			}
+			return hi < hj
+		})
+		for _, t := range txns {
+			err = w.AddTransaction(t.tx, t.height, ec.blockTime(t.height))
+			if err != nil {
+				return err
+			}
+			added[t.txid] = true
+			p.TxnsAdded++
+			report(p)
+		}
+
+		// the wallet is now up to date with these histories
+		db := ec.GetConfig().DB
+		for scripthash, history := range histories {
+			err = db.History().Put(scripthash, historyEntries(history))
+			if err != nil {
+				return err
+			}
+			err = db.Status().Put(scripthash, historyToStatusHash(history))
+			if err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// rescanScripts returns the output scripts of all wallet addresses and all
+// watched scripts
+func (ec *BtcElectrumClient) rescanScripts() ([][]byte, error) {
+	w := ec.GetWallet()
+	var scripts [][]byte
+	have := make(map[string]bool)
+	for _, addr := range w.ListAddresses() {
+		script, err := txscript.PayToAddrScript(addr)
+		if err != nil {
+			return nil, err
+		}
+		if !have[string(script)] {
+			have[string(script)] = true
+			scripts = append(scripts, script)
+		}
+	}
+	watched, err := w.ListWatchedScripts()
+	if err != nil {
+		return nil, err
+	}
+	for _, script := range watched {
+		if !have[string(script)] {
+			have[string(script)] = true
+			scripts = append(scripts, script)
+		}
+	}
+	return scripts, nil
+}
+
+// getTransaction fetches a transaction from the server and checks it is the
+// transaction asked for
+func (ec *BtcElectrumClient) getTransaction(txid string) (*wire.MsgTx, error) {
+	rawTx, err := ec.GetNode().GetRawTransaction(txid)
+	if err != nil {
+		return nil, err
+	}
+	b, err := hex.DecodeString(rawTx)
+	if err != nil {
+		return nil, err
+	}
+	tx := wire.NewMsgTx(wire.TxVersion)
+	err = tx.Deserialize(bytes.NewReader(b))
+	if err != nil {
+		return nil, err
+	}
+	if tx.TxHash().String() != txid {
+		return nil, errors.New("server sent wrong transaction for " + txid)
+	}
+	return tx, nil
+}
+
+// verifyTx checks the server's merkle proof that tx is in the block at height
+// against the stored header. A server sending an invalid proof is banned.
+func (ec *BtcElectrumClient) verifyTx(tx *wire.MsgTx, height int64) error {
+	txid := tx.TxHash()
+	root, ok := ec.clientHeaders.MerkleRoot(int32(height))
+	if !ok {
+		return fmt.Errorf("no header at height %d to verify %s", height, txid)
+	}
+	node := ec.GetNode()
+	server := serverAddr(node)
+	proof, err := node.GetMerkle(txid.String(), uint32(height))
+	if err != nil {
+		return err
+	}
+	branch := make([]chainhash.Hash, len(proof.Merkle))
+	for i, s := range proof.Merkle {
+		hash, err := chainhash.NewHashFromStr(s)
+		if err != nil {
+			node.BanServer(server, "invalid proof")
+			return fmt.Errorf("invalid merkle proof for %s: %w", txid, err)
+		}
+		branch[i] = *hash
+	}
+	if proof.Pos>>len(branch) != 0 || merkleRoot(txid, proof.Pos, branch) != root {
+		node.BanServer(server, "invalid proof")
+		return fmt.Errorf("invalid merkle proof for %s at height %d", txid, height)
+	}
+	return nil
+}
+
+// merkleRoot hashes txid at position pos in its block up the merkle branch,
+// deepest pairing first, to the merkle root
+func merkleRoot(txid chainhash.Hash, pos uint32, branch []chainhash.Hash) chainhash.Hash {
+	hash := txid
+	var buf [chainhash.HashSize * 2]byte
+	for _, h := range branch {
+		if pos&1 == 0 {
+			copy(buf[:], hash[:])
+			copy(buf[chainhash.HashSize:], h[:])
+		} else {
+			copy(buf[:], h[:])
+			copy(buf[chainhash.HashSize:], hash[:])
+		}
+		hash = chainhash.DoubleHashH(buf[:])
+		pos >>= 1
+	}
+	return hash
+}
+
+// blockTime is the header timestamp at height if the client has the header,
+// else now
+func (ec *BtcElectrumClient) blockTime(height int64) time.Time {
+	if height > 0 {
+		if t, ok := ec.clientHeaders.BlockTime(int32(height)); ok {
+			return t
+		}
+	}
+	return time.Now()
+}
@@ -0,0 +1,38 @@
+package btc
+
+import (
+	"testing"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+)
+
+func TestMerkleRoot(t *testing.T) {
+	// block 100000
+	root, _ := chainhash.NewHashFromStr("f3e94742aca4b5ef85488dc37c06c3282295ffec960994b2c0d5ac2a25a95766")
+	var txids []chainhash.Hash
+	for _, s := range []string{
+		"8c14f0db3df150123e6f3dbbf30f8b955a8249b62ac1d1ff16284aefa3d06d87",
+		"fff2525b8931402dd09222c50775608f75787bd2b87e56995a7bdd30f79702c4",
+		"6359f0868171b1d194cbee1af2f16ea598ae8fad666d9b012c8ed2b79a236ec4",
+		"e9a66845e05d5abc0ad04ec80f774a7e585c6e8db975962d069a522137b80c1d",
+	} {
+		hash, _ := chainhash.NewHashFromStr(s)
+		txids = append(txids, *hash)
+	}
+	pair := func(a, b chainhash.Hash) chainhash.Hash {
+		return chainhash.DoubleHashH(append(a[:], b[:]...))
+	}
+	left, right := pair(txids[0], txids[1]), pair(txids[2], txids[3])
+	for pos, txid := range txids {
+		branch := []chainhash.Hash{txids[pos^1], right}
+		if pos >= 2 {
+			branch[1] = left
+		}
+		if got := merkleRoot(txid, uint32(pos), branch); got != *root {
+			t.Errorf("merkle root of tx %d is %s", pos, got)
+		}
+	}
+	if merkleRoot(txids[0], 1, []chainhash.Hash{txids[1], right}) == *root {
+		t.Error("verified a proof with the wrong position")
+	}
+}
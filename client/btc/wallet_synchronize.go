@@ -4,10 +4,13 @@ import (
 	"encoding/hex"
 	"errors"
 	"fmt"
+	"strconv"
+	"strings"
 	"sync"
 
 	"main/client"
 	"main/electrumx"
+	"main/wallet"
 
 	"github.com/btcsuite/btcd/btcutil"
 	"github.com/btcsuite/btcd/chaincfg"
@@ -28,38 +31,40 @@ import (
 // sha256 hashed. The result has bytes reversed for network send. It is sent
 // to ElectrumX as a string.
 
-// // historyToStatusHash hashes together the stored history list for a subscription
-// func historyToStatusHash(s *subscription) string {
-// 	if s == nil || len(s.historyList) == 0 {
-// 		return ""
-// 	}
-// 	sb := strings.Builder{}
-// 	for _, h := range s.historyList {
-// 		sb.WriteString(h.txHash)
-// 		sb.WriteString(":")
-// 		sb.WriteString(string(h.height))
-// 		sb.WriteString(":")
-// 	}
-// 	// history hash as returned from 'blockchain.scripthash.subscribe'
-// 	return string(chainhash.HashB([]byte(sb.String())))
-// }
-
-// type history struct {
-// 	height int32
-// 	txHash string
-// }
+// ErrStatusMismatch is returned when the status hash a server sends for a
+// scripthash does not match the history it sends for it
+var ErrStatusMismatch = errors.New("server status does not match server history")
+
+// historyToStatusHash hashes together the history list of a scripthash. This
+// is the status returned from 'blockchain.scripthash.subscribe' and status
+// notifications. An empty history has no status.
+func historyToStatusHash(history electrumx.HistoryResult) string {
+	if len(history) == 0 {
+		return ""
+	}
+	sb := strings.Builder{}
+	for _, h := range history {
+		sb.WriteString(h.TxHash)
+		sb.WriteString(":")
+		sb.WriteString(strconv.Itoa(int(h.Height)))
+		sb.WriteString(":")
+	}
+	return hex.EncodeToString(chainhash.HashB([]byte(sb.String())))
+}
 
 // We need a mapping both ways
 type subscription struct {
 	address    btcutil.Address
 	scripthash string
-	lastStatus string // a future optimization
+	lastStatus string // also persisted in the datastore
 }
 
 type AddressSynchronizer struct {
 	subscriptions    map[btcutil.Address]*subscription
 	subscriptionsMtx sync.Mutex
 	network          *chaincfg.Params
+	// serializes updates of the stored address history
+	historyMtx sync.Mutex
 }
 
 func (as *AddressSynchronizer) getAddressForScripthash(scripthash string) btcutil.Address {
@@ -96,6 +101,16 @@ func (as *AddressSynchronizer) removeSubscription(address btcutil.Address) {
 	as.subscriptionsMtx.Unlock()
 }
 
+func (as *AddressSynchronizer) getSubscriptions() []*subscription {
+	as.subscriptionsMtx.Lock()
+	defer as.subscriptionsMtx.Unlock()
+	subs := make([]*subscription, 0, len(as.subscriptions))
+	for _, sub := range as.subscriptions {
+		subs = append(subs, sub)
+	}
+	return subs
+}
+
 func (as *AddressSynchronizer) getSubscriptionForScripthash(scripthash string) *subscription {
 	address := as.getAddressForScripthash(scripthash)
 	return as.subscriptions[address]
@@ -111,6 +126,18 @@ func NewWalletSychronizer(cfg *client.ClientConfig) *AddressSynchronizer {
 
 // addrToScripthash takes a btcutil.Address and makes an electrum 1.4 protocol 'scripthash'
 func (as *AddressSynchronizer) addressToElectrumScripthash(address btcutil.Address, network *chaincfg.Params) (string, error) {
+	pkscript, err := txscript.PayToAddrScript(address)
+	if err != nil {
+		return "", err
+	}
+	fmt.Println("pkscript", hex.EncodeToString(pkscript), " before electrum extra hashing")
+
+	return pkScriptToElectrumScripthash(pkscript), nil
+}
+
+// pkScriptToElectrumScripthash makes an electrum 1.4 protocol 'scripthash'
+// from an output script
+func pkScriptToElectrumScripthash(pkscript []byte) string {
 	revBytes := func(b []byte) []byte {
 		size := len(b)
 		buf := make([]byte, size)
@@ -121,17 +148,9 @@ func (as *AddressSynchronizer) addressToElectrumScripthash(address btcutil.Addre
 		return buf
 	}
 
-	pkscript, err := txscript.PayToAddrScript(address)
-	if err != nil {
-		return "", err
-	}
-	fmt.Println("pkscript", hex.EncodeToString(pkscript), " before electrum extra hashing")
-
 	pkScriptHashBytes := chainhash.HashB(pkscript)
 	revScriptHashBytes := revBytes(pkScriptHashBytes)
-	scripthash := hex.EncodeToString(revScriptHashBytes)
-
-	return scripthash, nil
+	return hex.EncodeToString(revScriptHashBytes)
 }
 
 // addrToElectrumScripthash takes a bech or legacy bitcoin address and makes an electrum
@@ -159,42 +178,20 @@ func (ec *BtcElectrumClient) addressStatusNotify() error {
 	svrCtx := node.GetServerConn().SvrCtx
 
 	go func() {
-		fmt.Println("=== Waiting for address change notifications ===")
 		for {
 			select {
 
 			case <-svrCtx.Done():
-				fmt.Println("Server shutdown - scripthash notify")
 				node.Stop()
 				return
 
-			case status := <-scripthashNotifyCh:
-				fmt.Println("<-scripthashNotifyCh - # items left in buffer", len(scripthashNotifyCh))
-				fmt.Println("scripthash notify")
-				fmt.Println("Scripthash", status.Scripthash)
-				fmt.Println("Status", status.Status)
-				if status.Status == "" {
-					continue
-				}
-				// is status same as last status?
-				sub := ec.walletSynchronizer.getSubscriptionForScripthash(status.Scripthash)
-				if sub == nil {
-					panic("no synchronizer subscription for subscribed scripthash")
-				}
-				if sub.lastStatus == status.Status {
-					continue
-				}
-				sub.lastStatus = status.Status
-
-				// get scripthash history
-				history, err := ec.GetAddressHistory(sub.address)
-				if err != nil {
-					continue
+			case status, ok := <-scripthashNotifyCh:
+				if !ok {
+					return
 				}
-				dumpHistory(sub.address, history)
-
-				// update wallet txstore
-				ec.addTxHistoryToWallet(history)
+				// A failed update keeps the last status so the next
+				// notification syncs the address again.
+				ec.addressStatusChanged(status)
 			}
 		}
 	}()
@@ -202,6 +199,29 @@ func (ec *BtcElectrumClient) addressStatusNotify() error {
 	return nil
 }
 
+// addressStatusChanged syncs the wallet with the history of a subscribed
+// address whose status the server notified. An empty status is an address
+// whose transactions all left the history, such as when the last one was
+// evicted from the mempool or reorged out.
+func (ec *BtcElectrumClient) addressStatusChanged(status *electrumx.ScripthashStatusResult) error {
+	sub := ec.walletSynchronizer.getSubscriptionForScripthash(status.Scripthash)
+	if sub == nil {
+		panic("no synchronizer subscription for subscribed scripthash")
+	}
+	// is status same as last status?
+	if sub.lastStatus == status.Status {
+		return nil
+	}
+	ec.events.Publish(client.AddressStatusEvent{
+		Address:    sub.address.String(),
+		Scripthash: status.Scripthash,
+		Status:     status.Status,
+	})
+
+	// get scripthash history and update wallet txstore
+	return ec.updateAddressHistory(sub, status.Status)
+}
+
 // alreadySubscribed checks if this address is already subscribed
 func (ec *BtcElectrumClient) alreadySubscribed(address btcutil.Address) bool {
 	return ec.walletSynchronizer.isSubscribed(address)
@@ -233,9 +253,186 @@ func (ec *BtcElectrumClient) SubscribeAddressNotify(address btcutil.Address) err
 	fmt.Println("Scripthash", res.Scripthash)
 	fmt.Println("Status", res.Status)
 
+	sub := ec.walletSynchronizer.getSubscriptionForScripthash(scripthash)
+	return ec.updateAddressHistory(sub, res.Status)
+}
+
+// updateAddressHistory brings the wallet up to date with the history of a
+// subscribed address. Nothing is fetched if status is the same as the status
+// stored from the last update. The status hash is recomputed from the history
+// the server sends and must match the status the server sent.
+func (ec *BtcElectrumClient) updateAddressHistory(sub *subscription, status string) error {
+	ec.walletSynchronizer.historyMtx.Lock()
+	defer ec.walletSynchronizer.historyMtx.Unlock()
+	return ec.syncAddressHistory(sub, status)
+}
+
+// syncAddressHistory is updateAddressHistory for callers holding historyMtx
+func (ec *BtcElectrumClient) syncAddressHistory(sub *subscription, status string) error {
+	statusDB := ec.GetConfig().DB.Status()
+	stored, err := statusDB.Get(sub.scripthash)
+	if err != nil {
+		// no stored status is the same as no history
+		stored = ""
+	}
+	if stored == status {
+		sub.lastStatus = status
+		return nil
+	}
+
+	history, err := ec.GetNode().GetHistory(sub.scripthash)
+	if err != nil {
+		return err
+	}
+	dumpHistory(sub.address, history)
+	if historyToStatusHash(history) != status {
+		return fmt.Errorf("%w: address %s", ErrStatusMismatch, sub.address)
+	}
+
+	// only fetch what changed since the stored history
+	historyDB := ec.GetConfig().DB.History()
+	storedHistory, err := historyDB.Get(sub.scripthash)
+	if err != nil {
+		return err
+	}
+	changed, vanished := diffHistory(storedHistory, history)
+	err = ec.addTxHistoryToWallet(changed)
+	if err != nil {
+		return err
+	}
+	for _, txid := range vanished {
+		err = ec.dropTransaction(txid)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = historyDB.Put(sub.scripthash, historyEntries(history))
+	if err != nil {
+		return err
+	}
+	err = statusDB.Put(sub.scripthash, status)
+	if err != nil {
+		return err
+	}
+	sub.lastStatus = status
 	return nil
 }
 
+// RefreshMempool checks the unconfirmed transactions in the stored history of
+// each subscribed address against the server mempool, updating their fees and
+// unconfirmed parents state. If a transaction has left the mempool the address
+// history is synced again, which adds its confirmation or, if it was evicted,
+// marks it dead.
+func (ec *BtcElectrumClient) RefreshMempool() error {
+	for _, sub := range ec.walletSynchronizer.getSubscriptions() {
+		err := ec.refreshMempool(sub)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (ec *BtcElectrumClient) refreshMempool(sub *subscription) error {
+	ec.walletSynchronizer.historyMtx.Lock()
+	defer ec.walletSynchronizer.historyMtx.Unlock()
+
+	historyDB := ec.GetConfig().DB.History()
+	stored, err := historyDB.Get(sub.scripthash)
+	if err != nil {
+		return err
+	}
+	unconfirmed := false
+	for _, e := range stored {
+		if e.Height <= 0 {
+			unconfirmed = true
+			break
+		}
+	}
+	if !unconfirmed {
+		return nil
+	}
+
+	mempool, err := ec.GetNode().GetMempool(sub.scripthash)
+	if err != nil {
+		return err
+	}
+	inMempool := make(map[string]electrumx.History, len(mempool))
+	for _, m := range mempool {
+		inMempool[m.TxHash] = m
+	}
+	for i, e := range stored {
+		if e.Height > 0 {
+			continue
+		}
+		m, ok := inMempool[e.Txid]
+		if !ok {
+			// mined or evicted - the history knows which
+			res, err := ec.GetNode().SubscribeScripthashNotify(sub.scripthash)
+			if err != nil {
+				return err
+			}
+			return ec.syncAddressHistory(sub, res.Status)
+		}
+		stored[i].Height = int64(m.Height)
+		stored[i].Fee = m.Fee
+	}
+	return historyDB.Put(sub.scripthash, stored)
+}
+
+// diffHistory compares the server history of a scripthash with the stored
+// history. changed holds the new transactions and those whose height changed.
+// vanished holds the stored transactions the server no longer has; they were
+// evicted from the mempool or reorged out.
+func diffHistory(stored []wallet.HistoryEntry, history electrumx.HistoryResult) (changed electrumx.HistoryResult, vanished []string) {
+	storedHeights := make(map[string]int64, len(stored))
+	for _, e := range stored {
+		storedHeights[e.Txid] = e.Height
+	}
+	current := make(map[string]bool, len(history))
+	for _, h := range history {
+		current[h.TxHash] = true
+		height, ok := storedHeights[h.TxHash]
+		if !ok || height != int64(h.Height) {
+			changed = append(changed, h)
+		}
+	}
+	for _, e := range stored {
+		if !current[e.Txid] {
+			vanished = append(vanished, e.Txid)
+		}
+	}
+	return changed, vanished
+}
+
+// dropTransaction marks a wallet transaction the server no longer has as dead
+func (ec *BtcElectrumClient) dropTransaction(txid string) error {
+	txhash, err := chainhash.NewHashFromStr(txid)
+	if err != nil {
+		return err
+	}
+	w := ec.GetWallet()
+	if !w.HasTransaction(*txhash) {
+		return nil
+	}
+	fmt.Println("dropping transaction", txid)
+	return w.MarkTransactionDead(*txhash)
+}
+
+// historyEntries converts a server history for storage
+func historyEntries(history electrumx.HistoryResult) []wallet.HistoryEntry {
+	entries := make([]wallet.HistoryEntry, 0, len(history))
+	for _, h := range history {
+		entries = append(entries, wallet.HistoryEntry{
+			Txid:   h.TxHash,
+			Height: int64(h.Height),
+			Fee:    h.Fee,
+		})
+	}
+	return entries
+}
+
 // UnsubscribeAddressNotify unsubscribes from notifications for an address
 func (ec *BtcElectrumClient) UnsubscribeAddressNotify(address btcutil.Address) {
 	if !ec.alreadySubscribed(address) {
@@ -272,22 +469,36 @@ func (ec *BtcElectrumClient) GetAddressHistory(address btcutil.Address) (electru
 	return res, nil
 }
 
-func (ec *BtcElectrumClient) addTxHistoryToWallet(history electrumx.HistoryResult) {
+// addTxHistoryToWallet adds transactions in the history that the wallet does
+// not have, or has at a different height, to the wallet
+func (ec *BtcElectrumClient) addTxHistoryToWallet(history electrumx.HistoryResult) error {
+	w := ec.GetWallet()
 	for _, h := range history {
-		txid, err := hex.DecodeString(h.TxHash)
+		txhash, err := chainhash.NewHashFromStr(h.TxHash)
 		if err != nil {
-			continue
+			return err
 		}
-		txhash, err := chainhash.NewHash(txid)
-		if err != nil {
-			continue
+		height := int64(h.Height)
+		// mempool tx heights are 0, or -1 with unconfirmed inputs
+		if height < 0 {
+			height = 0
 		}
-		if has := ec.GetWallet().HasTransaction(*txhash); has {
+		txn, err := w.GetTransaction(*txhash)
+		if err == nil && txn.Height == height {
 			continue
 		}
 		// add transaction
 		fmt.Println("adding transaction", h.TxHash)
+		tx, err := ec.getTransaction(h.TxHash)
+		if err != nil {
+			return err
+		}
+		err = w.AddTransaction(tx, height, ec.blockTime(height))
+		if err != nil {
+			return err
+		}
 	}
+	return nil
 }
 
 func dumpHistory(address btcutil.Address, history electrumx.HistoryResult) {
@@ -0,0 +1,411 @@
+package btc
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"testing"
+
+	"main/electrumx"
+	"main/wallet"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/wire"
+)
+
+// fakeNode serves scripthash history and transactions from memory
+type fakeNode struct {
+	status       map[string]string
+	history      map[string]electrumx.HistoryResult
+	txs          map[string]string
+	historyCalls int
+	txCalls      int
+}
+
+func newFakeNode() *fakeNode {
+	return &fakeNode{
+		status:  make(map[string]string),
+		history: make(map[string]electrumx.HistoryResult),
+		txs:     make(map[string]string),
+	}
+}
+
+func (n *fakeNode) addTx(scripthash string, tx *wire.MsgTx, height int32) {
+	var buf bytes.Buffer
+	tx.Serialize(&buf)
+	txid := tx.TxHash().String()
+	n.txs[txid] = hex.EncodeToString(buf.Bytes())
+	n.history[scripthash] = append(n.history[scripthash], electrumx.History{Height: height, TxHash: txid})
+	n.status[scripthash] = historyToStatusHash(n.history[scripthash])
+}
+
+// setHeight moves a transaction in the history of scripthash
+func (n *fakeNode) setHeight(scripthash string, txid string, height int32) {
+	for i, h := range n.history[scripthash] {
+		if h.TxHash == txid {
+			n.history[scripthash][i].Height = height
+		}
+	}
+	n.status[scripthash] = historyToStatusHash(n.history[scripthash])
+}
+
+// setFee sets the fee of a mempool transaction
+func (n *fakeNode) setFee(scripthash string, txid string, fee int64) {
+	for i, h := range n.history[scripthash] {
+		if h.TxHash == txid {
+			n.history[scripthash][i].Fee = fee
+		}
+	}
+}
+
+// removeTx drops a transaction from the history of scripthash
+func (n *fakeNode) removeTx(scripthash string, txid string) {
+	var history electrumx.HistoryResult
+	for _, h := range n.history[scripthash] {
+		if h.TxHash != txid {
+			history = append(history, h)
+		}
+	}
+	n.history[scripthash] = history
+	n.status[scripthash] = historyToStatusHash(history)
+}
+
+func (n *fakeNode) Start() error                                  { return nil }
+func (n *fakeNode) Stop()                                         {}
+func (n *fakeNode) GetServerConn() *electrumx.ElectrumXSvrConn    { return nil }
+func (n *fakeNode) UnsubscribeScripthashNotify(scripthash string) {}
+func (n *fakeNode) GetHeadersNotify() (<-chan *electrumx.HeadersNotifyResult, error) {
+	return nil, errors.New("not implemented")
+}
+func (n *fakeNode) SubscribeHeaders() (*electrumx.HeadersNotifyResult, error) {
+	return nil, errors.New("not implemented")
+}
+func (n *fakeNode) BlockHeaders(startHeight, blockCount uint32) (*electrumx.GetBlockHeadersResult, error) {
+	return nil, errors.New("not implemented")
+}
+func (n *fakeNode) GetScripthashNotify() (<-chan *electrumx.ScripthashStatusResult, error) {
+	return nil, errors.New("not implemented")
+}
+func (n *fakeNode) SubscribeScripthashNotify(scripthash string) (*electrumx.ScripthashStatusResult, error) {
+	return &electrumx.ScripthashStatusResult{Scripthash: scripthash, Status: n.status[scripthash]}, nil
+}
+func (n *fakeNode) GetHistory(scripthash string) (electrumx.HistoryResult, error) {
+	n.historyCalls++
+	return n.history[scripthash], nil
+}
+func (n *fakeNode) GetMempool(scripthash string) (electrumx.HistoryResult, error) {
+	var mempool electrumx.HistoryResult
+	for _, h := range n.history[scripthash] {
+		if h.Height <= 0 {
+			mempool = append(mempool, h)
+		}
+	}
+	return mempool, nil
+}
+
+func (n *fakeNode) GetRawTransaction(txid string) (string, error) {
+	n.txCalls++
+	raw, ok := n.txs[txid]
+	if !ok {
+		return "", errors.New("no such transaction")
+	}
+	return raw, nil
+}
+func (n *fakeNode) GetMerkle(txid string, height uint32) (*electrumx.GetMerkleResult, error) {
+	return nil, errors.New("not implemented")
+}
+func (n *fakeNode) EstimateFee(blocks int) (float64, error) {
+	return 0, errors.New("not implemented")
+}
+func (n *fakeNode) RelayFee() (float64, error) {
+	return 0, errors.New("not implemented")
+}
+func (n *fakeNode) FeeHistogram() ([]electrumx.FeeHistogramEntry, error) {
+	return nil, errors.New("not implemented")
+}
+func (n *fakeNode) PeerAddrs() ([]string, []string, error) {
+	return nil, nil, errors.New("not implemented")
+}
+func (n *fakeNode) BanServer(addr electrumx.ServerAddr, reason string) error {
+	return nil
+}
+func (n *fakeNode) Broadcast(rawTx string) (string, error) {
+	return "", errors.New("not implemented")
+}
+
+func TestHistoryToStatusHash(t *testing.T) {
+	if historyToStatusHash(nil) != "" {
+		t.Fatal("empty history should have no status")
+	}
+	history := electrumx.HistoryResult{
+		{Height: 200004, TxHash: "acc3758bd2a26f869fcc67d48ff30b96464d476bca82c1cd6656e7d506816412"},
+		{Height: 0, TxHash: "f3e1bf48975b8d6060a9de8884296abb80be618dc00ae3cb2f6cee3085e09403"},
+	}
+	s := "acc3758bd2a26f869fcc67d48ff30b96464d476bca82c1cd6656e7d506816412:200004:" +
+		"f3e1bf48975b8d6060a9de8884296abb80be618dc00ae3cb2f6cee3085e09403:0:"
+	expected := hex.EncodeToString(chainhash.HashB([]byte(s)))
+	if historyToStatusHash(history) != expected {
+		t.Fatal("wrong status hash")
+	}
+}
+
+func TestUpdateAddressHistory(t *testing.T) {
+	cfg, err := makeBitcoinRegtestConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg.DataDir = t.TempDir()
+	ec := NewBtcElectrumClient(cfg).(*BtcElectrumClient)
+	err = ec.RecreateWallet("abc", mnemonic)
+	if err != nil {
+		t.Fatal(err)
+	}
+	node := newFakeNode()
+	ec.Node = node
+
+	w := ec.GetWallet()
+	address := w.CurrentAddress(wallet.EXTERNAL)
+	script, _ := w.AddressToScript(address)
+	scripthash := pkScriptToElectrumScripthash(script)
+
+	prev, _ := chainhash.NewHashFromStr("a2d6fc5cbe6d43ddd1b36b2dba2e6b4d80e0a8e1cd5ad2d42a6a7f69f83b7b8d")
+	tx := wire.NewMsgTx(wire.TxVersion)
+	tx.AddTxIn(wire.NewTxIn(wire.NewOutPoint(prev, 0), nil, nil))
+	tx.AddTxOut(wire.NewTxOut(12345, script))
+	node.addTx(scripthash, tx, 100)
+
+	err = ec.SubscribeAddressNotify(address)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !w.HasTransaction(tx.TxHash()) {
+		t.Fatal("history not added to wallet")
+	}
+	stored, _ := cfg.DB.Status().Get(scripthash)
+	if stored != node.status[scripthash] {
+		t.Fatal("status not stored")
+	}
+
+	// unchanged status does not fetch history
+	ec.UnsubscribeAddressNotify(address)
+	calls := node.historyCalls
+	err = ec.SubscribeAddressNotify(address)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if node.historyCalls != calls {
+		t.Fatal("history fetched for unchanged status")
+	}
+
+	// a status that does not match the history is rejected
+	sub := ec.walletSynchronizer.getSubscriptionForScripthash(scripthash)
+	err = ec.updateAddressHistory(sub, "00")
+	if !errors.Is(err, ErrStatusMismatch) {
+		t.Fatalf("expected status mismatch, got %v", err)
+	}
+	stored, _ = cfg.DB.Status().Get(scripthash)
+	if stored != node.status[scripthash] {
+		t.Fatal("status stored for lying server")
+	}
+}
+
+func TestDiffHistory(t *testing.T) {
+	stored := []wallet.HistoryEntry{
+		{Txid: "a", Height: 100},
+		{Txid: "b", Height: 0},
+		{Txid: "c", Height: 0},
+	}
+	history := electrumx.HistoryResult{
+		{TxHash: "a", Height: 100},
+		{TxHash: "b", Height: 101},
+		{TxHash: "d", Height: 0},
+	}
+	changed, vanished := diffHistory(stored, history)
+	if len(changed) != 2 || changed[0].TxHash != "b" || changed[1].TxHash != "d" {
+		t.Fatalf("wrong changed history %v", changed)
+	}
+	if len(vanished) != 1 || vanished[0] != "c" {
+		t.Fatalf("wrong vanished history %v", vanished)
+	}
+}
+
+func TestHistorySync(t *testing.T) {
+	cfg, err := makeBitcoinRegtestConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg.DataDir = t.TempDir()
+	ec := NewBtcElectrumClient(cfg).(*BtcElectrumClient)
+	err = ec.RecreateWallet("abc", mnemonic)
+	if err != nil {
+		t.Fatal(err)
+	}
+	node := newFakeNode()
+	ec.Node = node
+
+	w := ec.GetWallet()
+	address := w.CurrentAddress(wallet.EXTERNAL)
+	script, _ := w.AddressToScript(address)
+	scripthash := pkScriptToElectrumScripthash(script)
+
+	prev, _ := chainhash.NewHashFromStr("a2d6fc5cbe6d43ddd1b36b2dba2e6b4d80e0a8e1cd5ad2d42a6a7f69f83b7b8d")
+	var txs []*wire.MsgTx
+	for i := 0; i < 3; i++ {
+		tx := wire.NewMsgTx(wire.TxVersion)
+		tx.AddTxIn(wire.NewTxIn(wire.NewOutPoint(prev, uint32(i)), nil, nil))
+		tx.AddTxOut(wire.NewTxOut(10000, script))
+		txs = append(txs, tx)
+	}
+	node.addTx(scripthash, txs[0], 100)
+	node.addTx(scripthash, txs[1], 0)
+
+	err = ec.SubscribeAddressNotify(address)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if node.txCalls != 2 {
+		t.Fatalf("expected 2 transactions fetched, got %d", node.txCalls)
+	}
+	stored, _ := cfg.DB.History().Get(scripthash)
+	if len(stored) != 2 {
+		t.Fatal("history not stored")
+	}
+
+	// tx 1 confirms and tx 2 arrives: only those are fetched
+	node.setHeight(scripthash, txs[1].TxHash().String(), 101)
+	node.addTx(scripthash, txs[2], 0)
+	sub := ec.walletSynchronizer.getSubscriptionForScripthash(scripthash)
+	err = ec.updateAddressHistory(sub, node.status[scripthash])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if node.txCalls != 4 {
+		t.Fatalf("expected 2 more transactions fetched, got %d", node.txCalls-2)
+	}
+	_, height, _ := w.GetConfirmations(txs[1].TxHash())
+	if height != 101 {
+		t.Fatal("confirmation not added to wallet")
+	}
+
+	// tx 2 is evicted from the mempool
+	node.removeTx(scripthash, txs[2].TxHash().String())
+	err = ec.updateAddressHistory(sub, node.status[scripthash])
+	if err != nil {
+		t.Fatal(err)
+	}
+	txn, err := w.GetTransaction(txs[2].TxHash())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if txn.Height != -1 {
+		t.Fatal("vanished transaction not marked dead")
+	}
+	confirmed, unconfirmed := w.Balance()
+	if confirmed != 20000 || unconfirmed != 0 {
+		t.Fatalf("wrong balance %d %d", confirmed, unconfirmed)
+	}
+}
+
+func TestAddressStatusEmpty(t *testing.T) {
+	cfg, err := makeBitcoinRegtestConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg.DataDir = t.TempDir()
+	ec := NewBtcElectrumClient(cfg).(*BtcElectrumClient)
+	err = ec.RecreateWallet("abc", mnemonic)
+	if err != nil {
+		t.Fatal(err)
+	}
+	node := newFakeNode()
+	ec.Node = node
+
+	w := ec.GetWallet()
+	address := w.CurrentAddress(wallet.EXTERNAL)
+	script, _ := w.AddressToScript(address)
+	scripthash := pkScriptToElectrumScripthash(script)
+
+	prev, _ := chainhash.NewHashFromStr("a2d6fc5cbe6d43ddd1b36b2dba2e6b4d80e0a8e1cd5ad2d42a6a7f69f83b7b8d")
+	tx := wire.NewMsgTx(wire.TxVersion)
+	tx.AddTxIn(wire.NewTxIn(wire.NewOutPoint(prev, 0), nil, nil))
+	tx.AddTxOut(wire.NewTxOut(10000, script))
+	node.addTx(scripthash, tx, 0)
+	err = ec.SubscribeAddressNotify(address)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the only transaction is evicted and the server notifies an empty status
+	node.removeTx(scripthash, tx.TxHash().String())
+	err = ec.addressStatusChanged(&electrumx.ScripthashStatusResult{Scripthash: scripthash, Status: ""})
+	if err != nil {
+		t.Fatal(err)
+	}
+	txn, err := w.GetTransaction(tx.TxHash())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if txn.Height != -1 {
+		t.Fatal("evicted transaction not marked dead")
+	}
+	if status, _ := cfg.DB.Status().Get(scripthash); status != "" {
+		t.Fatal("empty status not stored")
+	}
+}
+
+func TestRefreshMempool(t *testing.T) {
+	cfg, err := makeBitcoinRegtestConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg.DataDir = t.TempDir()
+	ec := NewBtcElectrumClient(cfg).(*BtcElectrumClient)
+	err = ec.RecreateWallet("abc", mnemonic)
+	if err != nil {
+		t.Fatal(err)
+	}
+	node := newFakeNode()
+	ec.Node = node
+
+	w := ec.GetWallet()
+	address := w.CurrentAddress(wallet.EXTERNAL)
+	script, _ := w.AddressToScript(address)
+	scripthash := pkScriptToElectrumScripthash(script)
+
+	prev, _ := chainhash.NewHashFromStr("a2d6fc5cbe6d43ddd1b36b2dba2e6b4d80e0a8e1cd5ad2d42a6a7f69f83b7b8d")
+	tx := wire.NewMsgTx(wire.TxVersion)
+	tx.AddTxIn(wire.NewTxIn(wire.NewOutPoint(prev, 0), nil, nil))
+	tx.AddTxOut(wire.NewTxOut(10000, script))
+	txid := tx.TxHash().String()
+	node.addTx(scripthash, tx, 0)
+	err = ec.SubscribeAddressNotify(address)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the server now reports a fee and an unconfirmed parent
+	node.setHeight(scripthash, txid, -1)
+	node.setFee(scripthash, txid, 226)
+	err = ec.RefreshMempool()
+	if err != nil {
+		t.Fatal(err)
+	}
+	txn, err := w.GetTransaction(tx.TxHash())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if txn.Fee != 226 || !txn.UnconfirmedParents {
+		t.Fatal("mempool state not updated")
+	}
+
+	// evicted from the mempool
+	node.removeTx(scripthash, txid)
+	err = ec.RefreshMempool()
+	if err != nil {
+		t.Fatal(err)
+	}
+	txns, _ := w.Transactions()
+	if len(txns) != 1 || txns[0].Status != wallet.StatusDead {
+		t.Fatal("evicted transaction not dead")
+	}
+}
@@ -1,15 +1,19 @@
 package btc
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"path/filepath"
 	"testing"
+	"time"
 
 	"main/client"
 	"main/wallet"
 
 	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/wire"
 )
 
 func makeBitcoinRegtestConfig() (*client.ClientConfig, error) {
@@ -85,3 +89,56 @@ func TestWalletLoad(t *testing.T) {
 		t.Fatal(err)
 	}
 }
+
+func TestBalanceChangedEvent(t *testing.T) {
+	cfg, err := makeBitcoinRegtestConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg.DataDir = t.TempDir()
+	ec := NewBtcElectrumClient(cfg)
+	err = ec.RecreateWallet("abc", mnemonic)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	events := ec.SubscribeEvents(ctx)
+
+	w := ec.GetWallet()
+	script, _ := w.AddressToScript(w.CurrentAddress(wallet.EXTERNAL))
+	prev, _ := chainhash.NewHashFromStr("a2d6fc5cbe6d43ddd1b36b2dba2e6b4d80e0a8e1cd5ad2d42a6a7f69f83b7b8d")
+	tx := wire.NewMsgTx(wire.TxVersion)
+	tx.AddTxIn(wire.NewTxIn(wire.NewOutPoint(prev, 0), nil, nil))
+	tx.AddTxOut(wire.NewTxOut(12345, script))
+	err = w.AddTransaction(tx, 0, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case e := <-events:
+		bal, ok := e.(client.BalanceChangedEvent)
+		if !ok || bal.Unconfirmed != 12345 {
+			t.Fatalf("unexpected event %v", e)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("no balance changed event")
+	}
+
+	// a loaded wallet replaces the balance listener of the previous one
+	if err = ec.LoadWallet("abc"); err != nil {
+		t.Fatal(err)
+	}
+	tx2 := wire.NewMsgTx(wire.TxVersion)
+	tx2.AddTxIn(wire.NewTxIn(wire.NewOutPoint(prev, 1), nil, nil))
+	tx2.AddTxOut(wire.NewTxOut(1000, script))
+	if err = w.AddTransaction(tx2, 0, time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case e := <-events:
+		t.Fatalf("event from the replaced wallet %v", e)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
@@ -18,8 +18,12 @@ package client
 // It is implemented for each coin asset client.
 
 import (
+	"context"
+
 	"main/electrumx"
 	"main/wallet"
+
+	"github.com/btcsuite/btcd/btcutil"
 )
 
 type NodeType int
@@ -41,6 +45,7 @@ type ElectrumClient interface {
 	GetNode() electrumx.ElectrumXNode
 	//
 	CreateNode(nodeType NodeType)
+	StartNode() error
 	//
 	SyncHeaders() error
 	SubscribeClientHeaders() error
@@ -50,8 +55,24 @@ type ElectrumClient interface {
 	LoadWallet(pw string) error
 	//
 	SyncWallet() error
+	RescanWallet(fromHeight int64, progress func(RescanProgress)) error
+	RefreshMempool() error
 	//
 	// Small subset of electrum python console methods
 	Broadcast(rawTx string) (string, error)
+	GetAddressHistory(address btcutil.Address) (electrumx.HistoryResult, error)
+	GetRawTransaction(txid string) (string, error)
 	//...
+	//
+	// Typed client events until ctx is done. See events.go
+	SubscribeEvents(ctx context.Context) <-chan Event
+}
+
+// RescanProgress is reported to the caller of RescanWallet after each script
+// history is queried and after each transaction is added to the wallet.
+type RescanProgress struct {
+	ScriptsScanned int
+	ScriptsTotal   int
+	TxnsAdded      int
+	TxnsTotal      int
 }
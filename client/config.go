@@ -8,7 +8,6 @@ import (
 
 	"github.com/btcsuite/btcd/btcutil"
 	"github.com/btcsuite/btcd/chaincfg"
-	"golang.org/x/net/proxy"
 
 	"main/electrumx"
 	"main/wallet"
@@ -18,6 +17,14 @@ const (
 	appName = "goele"
 )
 
+// Default fee-per-byte levels used when no fee source is available
+const (
+	DefaultLowFee    = 2
+	DefaultMediumFee = 5
+	DefaultHighFee   = 10
+	DefaultMaxFee    = 200
+)
+
 type ClientConfig struct {
 	// The blockchain, Bitcoin, Dash, etc
 	Chain wallet.CoinType
@@ -41,8 +48,16 @@ type ClientConfig struct {
 	// SingleNode servers will error if not provided
 	TrustedPeer net.Addr
 
-	// A Tor proxy can be set here causing the wallet will use Tor. TODO:
-	Proxy proxy.Dialer
+	// Hex SHA-256 certificate fingerprints of ssl servers keyed by
+	// "host:port". A server with a pin here must present that certificate.
+	// Other servers are trusted if their certificate verifies against the
+	// system CAs, or else pinned in the data dir on first connect.
+	PinnedCerts map[string]string
+
+	// A SOCKS5 proxy, such as Tor, used by every outbound connection: the
+	// ElectrumX server, peers, the fee API and exchange rate providers. Nil
+	// means direct connections.
+	Proxy *electrumx.ProxyConfig
 
 	// The default fee-per-byte for each level
 	LowFee    uint64
@@ -52,13 +67,24 @@ type ClientConfig struct {
 	// The highest allowable fee-per-byte
 	MaxFee uint64
 
-	// External API to query to look up fees. If this field is nil then the default fees will be used.
-	// If the API is unreachable then the default fees will likewise be used. If the API returns a fee
-	// greater than MaxFee then the MaxFee will be used in place. The API response must be formatted as
-	// { "fastestFee": 40, "halfHourFee": 20, "hourFee": 10 }
+	// External API to query to look up fees. If this field is empty the API fee source is skipped.
+	// If the API returns a fee greater than MaxFee then the MaxFee will be used in place. The API
+	// response must be formatted as { "priority": 40, "normal": 20, "economic": 10 }
 	FeeAPI url.URL
 
-	// Disable the exchange rate provider
+	// Fee sources tried in order until one returns fees, see fees.go. If none do
+	// the default fees are used.
+	FeeSources []FeeSourceType
+
+	// HTTP JSON exchange rate APIs tried in order, see rates.go
+	ExchangeRateAPIs []ExchangeRateAPI
+
+	// A JSON file of rates {"USD": 43000, ...} for offline use. It is tried
+	// after the ExchangeRateAPIs.
+	ExchangeRateFile string
+
+	// Disable the exchange rate provider. It is disabled by default since the
+	// rate APIs see every wallet that asks them; set false to opt in.
 	DisableExchangeRates bool
 
 	// If not testing do not overwrite existing wallet files
@@ -72,6 +98,12 @@ func NewDefaultConfig() *ClientConfig {
 		UserAgent:            appName,
 		DataDir:              btcutil.AppDataDir(appName, false),
 		DB:                   nil, // concrete impl
+		LowFee:               DefaultLowFee,
+		MediumFee:            DefaultMediumFee,
+		HighFee:              DefaultHighFee,
+		MaxFee:               DefaultMaxFee,
+		FeeSources:           []FeeSourceType{FeeSourceServer, FeeSourceAPI},
+		ExchangeRateAPIs:     DefaultExchangeRateAPIs,
 		DisableExchangeRates: true,
 	}
 }
@@ -86,8 +118,12 @@ func (cc *ClientConfig) MakeWalletConfig() *wallet.WalletConfig {
 		MediumFee:    cc.MediumFee,
 		HighFee:      cc.HighFee,
 		MaxFee:       cc.MaxFee,
+		Proxy:        cc.Proxy.Dialer(),
 		Testing:      cc.Testing,
 	}
+	if !cc.DisableExchangeRates {
+		wc.RateSources = cc.MakeRateSources()
+	}
 	return &wc
 }
 
@@ -98,6 +134,7 @@ func (cc *ClientConfig) MakeNodeConfig() *electrumx.NodeConfig {
 		UserAgent:   cc.UserAgent,
 		DataDir:     cc.DataDir,
 		TrustedPeer: cc.TrustedPeer,
+		PinnedCerts: cc.PinnedCerts,
 		Proxy:       cc.Proxy,
 		Testing:     cc.Testing,
 	}
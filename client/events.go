@@ -0,0 +1,133 @@
+package client
+
+import (
+	"context"
+	"sync"
+)
+
+// Client event stream
+//
+// The client publishes typed events as the chain, the server connection and
+// the wallet change. Consumers call SubscribeEvents with a context and read
+// from the returned channel until the context is cancelled, at which point the
+// channel is closed. Use a type switch to handle the events of interest.
+
+type EventType string
+
+const (
+	EventNewTip             EventType = "NEW_TIP"
+	EventHeaderSync         EventType = "HEADER_SYNC"
+	EventServerConnected    EventType = "SERVER_CONNECTED"
+	EventServerDisconnected EventType = "SERVER_DISCONNECTED"
+	EventServerSwitched     EventType = "SERVER_SWITCHED"
+	EventAddressStatus      EventType = "ADDRESS_STATUS"
+	EventBalanceChanged     EventType = "BALANCE_CHANGED"
+	EventWalletSynced       EventType = "WALLET_SYNCED"
+)
+
+type Event interface {
+	EventType() EventType
+}
+
+// NewTipEvent is sent when a new block header at the chain tip is stored
+type NewTipEvent struct {
+	Height int64
+	Hash   string
+}
+
+// HeaderSyncEvent reports progress while catching up with the server's
+// headers. Synced is set on the last event when the headers are verified.
+type HeaderSyncEvent struct {
+	Height int64
+	Synced bool
+}
+
+// ServerConnectedEvent is sent when a connection to a server is made
+type ServerConnectedEvent struct {
+	Server string
+}
+
+// ServerDisconnectedEvent is sent when the server connection is lost or shut
+// down
+type ServerDisconnectedEvent struct {
+	Server string
+}
+
+// ServerSwitchedEvent is sent when the client moves to another server than the
+// one it tried first, such as when the trusted peer cannot be reached, or when
+// a MultiNode loses the server it was using
+type ServerSwitchedEvent struct {
+	From string
+	To   string
+}
+
+// AddressStatusEvent is sent when the server notifies a change to the history
+// of a subscribed address
+type AddressStatusEvent struct {
+	Address    string
+	Scripthash string
+	Status     string
+}
+
+// BalanceChangedEvent is sent when a wallet transaction changes the balance
+type BalanceChangedEvent struct {
+	Confirmed   int64
+	Unconfirmed int64
+}
+
+// WalletSyncedEvent is sent when the wallet history is up to date with the
+// server
+type WalletSyncedEvent struct{}
+
+func (NewTipEvent) EventType() EventType             { return EventNewTip }
+func (HeaderSyncEvent) EventType() EventType         { return EventHeaderSync }
+func (ServerConnectedEvent) EventType() EventType    { return EventServerConnected }
+func (ServerDisconnectedEvent) EventType() EventType { return EventServerDisconnected }
+func (ServerSwitchedEvent) EventType() EventType     { return EventServerSwitched }
+func (AddressStatusEvent) EventType() EventType      { return EventAddressStatus }
+func (BalanceChangedEvent) EventType() EventType     { return EventBalanceChanged }
+func (WalletSyncedEvent) EventType() EventType       { return EventWalletSynced }
+
+// Events buffered for each subscriber. A subscriber that falls further behind
+// than this misses events rather than stalling the client.
+const eventBufferSize = 64
+
+// EventBus fans out published events to all subscribers
+type EventBus struct {
+	subsMtx sync.Mutex
+	subs    map[chan Event]struct{}
+}
+
+func NewEventBus() *EventBus {
+	return &EventBus{
+		subs: make(map[chan Event]struct{}),
+	}
+}
+
+// Subscribe returns a channel of events which is closed when ctx is done
+func (b *EventBus) Subscribe(ctx context.Context) <-chan Event {
+	ch := make(chan Event, eventBufferSize)
+	b.subsMtx.Lock()
+	b.subs[ch] = struct{}{}
+	b.subsMtx.Unlock()
+	go func() {
+		<-ctx.Done()
+		b.subsMtx.Lock()
+		delete(b.subs, ch)
+		close(ch)
+		b.subsMtx.Unlock()
+	}()
+	return ch
+}
+
+// Publish sends e to all subscribers without blocking
+func (b *EventBus) Publish(e Event) {
+	b.subsMtx.Lock()
+	defer b.subsMtx.Unlock()
+	for ch := range b.subs {
+		select {
+		case ch <- e:
+		default:
+		}
+	}
+}
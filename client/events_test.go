@@ -0,0 +1,53 @@
+package client
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestEventBus(t *testing.T) {
+	bus := NewEventBus()
+	ctx, cancel := context.WithCancel(context.Background())
+	ch1 := bus.Subscribe(ctx)
+	ch2 := bus.Subscribe(context.Background())
+
+	bus.Publish(NewTipEvent{Height: 100, Hash: "abc"})
+	bus.Publish(WalletSyncedEvent{})
+
+	for _, ch := range []<-chan Event{ch1, ch2} {
+		e := <-ch
+		tip, ok := e.(NewTipEvent)
+		if !ok || tip.Height != 100 || e.EventType() != EventNewTip {
+			t.Fatalf("unexpected event %v", e)
+		}
+		e = <-ch
+		if _, ok := e.(WalletSyncedEvent); !ok {
+			t.Fatalf("unexpected event %v", e)
+		}
+	}
+
+	// cancel closes the channel
+	cancel()
+	select {
+	case _, ok := <-ch1:
+		if ok {
+			t.Fatal("expected closed channel")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("channel not closed on cancel")
+	}
+	bus.Publish(BalanceChangedEvent{Confirmed: 1})
+	e := <-ch2
+	if e.(BalanceChangedEvent).Confirmed != 1 {
+		t.Fatal("remaining subscriber missed event")
+	}
+
+	// a full subscriber does not block publishing
+	for i := 0; i < eventBufferSize*2; i++ {
+		bus.Publish(HeaderSyncEvent{Height: int64(i)})
+	}
+	if len(ch2) != eventBufferSize {
+		t.Fatalf("expected %d buffered events, got %d", eventBufferSize, len(ch2))
+	}
+}
@@ -0,0 +1,131 @@
+package client
+
+import (
+	"errors"
+	"math"
+
+	"main/electrumx"
+	"main/wallet"
+)
+
+// FeeSourceType names a fee source in the ClientConfig FeeSources fallback
+// chain
+type FeeSourceType string
+
+const (
+	// The connected ElectrumX server's fee estimates and mempool histogram
+	FeeSourceServer FeeSourceType = "server"
+	// The ClientConfig FeeAPI
+	FeeSourceAPI FeeSourceType = "api"
+)
+
+// The virtual size of a block used to walk the fee histogram
+const blockVsize = 1_000_000
+
+// FeeEstimator is the part of a node needed to estimate fees
+type FeeEstimator interface {
+	EstimateFee(blocks int) (float64, error)
+	RelayFee() (float64, error)
+	FeeHistogram() ([]electrumx.FeeHistogramEntry, error)
+}
+
+// ServerFeeSource is a wallet.FeeSource asking the connected ElectrumX server
+// for fee estimates. A target the server cannot estimate is taken from the
+// mempool fee histogram instead, and no rate is below the server's relay fee.
+type ServerFeeSource struct {
+	node func() FeeEstimator
+}
+
+// NewServerFeeSource makes a ServerFeeSource using the node returned by the
+// node func at the time fees are requested. The func may return nil when there
+// is no node.
+func NewServerFeeSource(node func() FeeEstimator) *ServerFeeSource {
+	return &ServerFeeSource{node: node}
+}
+
+// Fees asks the server for an estimate for each of the wallet.FeeTargets
+func (s *ServerFeeSource) Fees() (wallet.FeeEstimates, error) {
+	node := s.node()
+	if node == nil {
+		return nil, wallet.ErrNoFeeSource
+	}
+	relay, err := node.RelayFee()
+	if err != nil {
+		return nil, err
+	}
+	floor := BtcPerKBToSatPerByte(relay)
+	if floor == 0 {
+		floor = 1
+	}
+	histogram, err := node.FeeHistogram()
+	if err != nil {
+		histogram = nil
+	}
+
+	estimate := func(target int) uint64 {
+		var fee uint64
+		btcPerKB, err := node.EstimateFee(target)
+		if err == nil && btcPerKB > 0 {
+			fee = BtcPerKBToSatPerByte(btcPerKB)
+		} else if histogram != nil {
+			fee = histogramFee(histogram, target)
+		} else {
+			return 0
+		}
+		if fee < floor {
+			fee = floor
+		}
+		return fee
+	}
+	fees := make(wallet.FeeEstimates, len(wallet.FeeTargets))
+	var found bool
+	for _, target := range wallet.FeeTargets {
+		fees[target] = estimate(target)
+		found = found || fees[target] > 0
+	}
+	if !found {
+		return nil, errors.New("server has no fee estimates")
+	}
+	return fees, nil
+}
+
+// histogramFee returns the fee rate needed to be within the top target blocks
+// of the mempool, or 0 if the mempool would clear within the target.
+func histogramFee(histogram []electrumx.FeeHistogramEntry, target int) uint64 {
+	var vsize int64
+	for _, e := range histogram {
+		vsize += e.VSize
+		if vsize >= int64(target)*blockVsize {
+			return uint64(math.Ceil(e.FeeRate))
+		}
+	}
+	return 0
+}
+
+// BtcPerKBToSatPerByte converts a BTC/kB fee rate as returned by
+// blockchain.estimatefee to sat/vB, rounding up
+func BtcPerKBToSatPerByte(btcPerKB float64) uint64 {
+	if btcPerKB <= 0 {
+		return 0
+	}
+	satPerKB := uint64(math.Round(btcPerKB * 1e8))
+	return (satPerKB + 999) / 1000
+}
+
+// MakeFeeSources builds the wallet fee sources in the order of FeeSources. The
+// node func supplies the node for the server source. The API source is left out
+// if no FeeAPI is set.
+func (cc *ClientConfig) MakeFeeSources(node func() FeeEstimator) []wallet.FeeSource {
+	var sources []wallet.FeeSource
+	for _, t := range cc.FeeSources {
+		switch t {
+		case FeeSourceServer:
+			sources = append(sources, NewServerFeeSource(node))
+		case FeeSourceAPI:
+			if api := cc.FeeAPI.String(); api != "" {
+				sources = append(sources, wallet.NewAPIFeeSource(api, cc.Proxy.Dialer()))
+			}
+		}
+	}
+	return sources
+}
@@ -0,0 +1,146 @@
+package client
+
+import (
+	"errors"
+	"net/url"
+	"reflect"
+	"testing"
+
+	"main/electrumx"
+	"main/wallet"
+)
+
+type stubEstimator struct {
+	estimates map[int]float64
+	relay     float64
+	histogram []electrumx.FeeHistogramEntry
+}
+
+func (s *stubEstimator) EstimateFee(blocks int) (float64, error) {
+	fee, ok := s.estimates[blocks]
+	if !ok {
+		return -1, nil
+	}
+	return fee, nil
+}
+
+func (s *stubEstimator) RelayFee() (float64, error) {
+	return s.relay, nil
+}
+
+func (s *stubEstimator) FeeHistogram() ([]electrumx.FeeHistogramEntry, error) {
+	if s.histogram == nil {
+		return nil, errors.New("no histogram")
+	}
+	return s.histogram, nil
+}
+
+func TestBtcPerKBToSatPerByte(t *testing.T) {
+	tests := []struct {
+		btcPerKB float64
+		want     uint64
+	}{
+		{-1, 0},
+		{0, 0},
+		{0.00001, 1},
+		{0.00012, 12},
+		{0.000121, 13},
+		{0.0002, 20},
+		{0.001, 100},
+	}
+	for _, tt := range tests {
+		if got := BtcPerKBToSatPerByte(tt.btcPerKB); got != tt.want {
+			t.Errorf("BtcPerKBToSatPerByte(%v) = %d, want %d", tt.btcPerKB, got, tt.want)
+		}
+	}
+}
+
+func TestServerFeeSource(t *testing.T) {
+	histogram := []electrumx.FeeHistogramEntry{
+		{FeeRate: 40, VSize: 1_500_000},
+		{FeeRate: 15.5, VSize: 3_000_000},
+		{FeeRate: 3, VSize: 20_000_000},
+	}
+	tests := []struct {
+		name string
+		node *stubEstimator
+		want wallet.FeeEstimates
+	}{{
+		name: "estimates",
+		node: &stubEstimator{
+			estimates: map[int]float64{2: 0.0005, 6: 0.0002, 12: 0.0001, 25: 0.00002},
+			relay:     0.00001,
+		},
+		want: wallet.FeeEstimates{2: 50, 6: 20, 12: 10, 25: 2},
+	}, {
+		name: "relay fee floor",
+		node: &stubEstimator{
+			estimates: map[int]float64{2: 0.0005, 6: 0.0002, 12: 0.00001},
+			relay:     0.00005,
+		},
+		want: wallet.FeeEstimates{2: 50, 6: 20, 12: 5, 25: 0},
+	}, {
+		name: "histogram fallback",
+		node: &stubEstimator{
+			estimates: map[int]float64{2: 0.0005},
+			relay:     0.00001,
+			histogram: histogram,
+		},
+		want: wallet.FeeEstimates{2: 50, 6: 3, 12: 3, 25: 1},
+	}, {
+		name: "histogram clears",
+		node: &stubEstimator{
+			relay:     0.00002,
+			histogram: histogram[:2],
+		},
+		want: wallet.FeeEstimates{2: 16, 6: 2, 12: 2, 25: 2},
+	}, {
+		name: "no estimates",
+		node: &stubEstimator{relay: 0.00001},
+	}}
+	for _, tt := range tests {
+		source := NewServerFeeSource(func() FeeEstimator { return tt.node })
+		fees, err := source.Fees()
+		if tt.want == nil {
+			if err == nil {
+				t.Errorf("%s: expected error, got %+v", tt.name, fees)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(fees, tt.want) {
+			t.Errorf("%s: got %+v, want %+v", tt.name, fees, tt.want)
+		}
+	}
+
+	source := NewServerFeeSource(func() FeeEstimator { return nil })
+	if _, err := source.Fees(); !errors.Is(err, wallet.ErrNoFeeSource) {
+		t.Fatalf("expected ErrNoFeeSource, got %v", err)
+	}
+}
+
+func TestMakeFeeSources(t *testing.T) {
+	cfg := NewDefaultConfig()
+	node := func() FeeEstimator { return nil }
+	sources := cfg.MakeFeeSources(node)
+	if len(sources) != 1 {
+		t.Fatalf("got %d sources without a fee api", len(sources))
+	}
+	if _, ok := sources[0].(*ServerFeeSource); !ok {
+		t.Fatalf("first source is %T", sources[0])
+	}
+
+	api, _ := url.Parse("https://fees.example.com/api")
+	cfg.FeeAPI = *api
+	cfg.FeeSources = []FeeSourceType{FeeSourceAPI, FeeSourceServer}
+	sources = cfg.MakeFeeSources(node)
+	if len(sources) != 2 {
+		t.Fatalf("got %d sources", len(sources))
+	}
+	if s, ok := sources[0].(*wallet.APIFeeSource); !ok || s.URL != "https://fees.example.com/api" {
+		t.Fatalf("first source is %T", sources[0])
+	}
+}
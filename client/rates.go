@@ -0,0 +1,36 @@
+package client
+
+import (
+	"main/wallet"
+)
+
+// ExchangeRateAPI is an HTTP JSON exchange rate source, see
+// wallet.HTTPRateSource for how the rates are found in the response
+type ExchangeRateAPI struct {
+	URL       string
+	RatesPath []string
+	RateField string
+}
+
+// DefaultExchangeRateAPIs are the bitcoin exchange rate sources used unless
+// the config sets others
+var DefaultExchangeRateAPIs = []ExchangeRateAPI{{
+	URL:       "https://api.coingecko.com/api/v3/simple/price?ids=bitcoin&vs_currencies=usd,eur,gbp,jpy,cad,aud,chf,cny",
+	RatesPath: []string{"bitcoin"},
+}, {
+	URL:       "https://blockchain.info/ticker",
+	RateField: "last",
+}}
+
+// MakeRateSources builds the wallet exchange rate sources: the APIs in order,
+// then the ExchangeRateFile if set. The APIs dial through the Proxy.
+func (cc *ClientConfig) MakeRateSources() []wallet.RateSource {
+	var sources []wallet.RateSource
+	for _, api := range cc.ExchangeRateAPIs {
+		sources = append(sources, wallet.NewHTTPRateSource(api.URL, api.RatesPath, api.RateField, cc.Proxy.Dialer()))
+	}
+	if cc.ExchangeRateFile != "" {
+		sources = append(sources, wallet.NewFileRateSource(cc.ExchangeRateFile))
+	}
+	return sources
+}
@@ -0,0 +1,41 @@
+package client
+
+import (
+	"testing"
+
+	"main/wallet"
+)
+
+func TestMakeRateSources(t *testing.T) {
+	cfg := NewDefaultConfig()
+	sources := cfg.MakeRateSources()
+	if len(sources) != len(DefaultExchangeRateAPIs) {
+		t.Fatalf("got %d default sources", len(sources))
+	}
+	// exchange rates are opt in
+	if len(cfg.MakeWalletConfig().RateSources) != 0 {
+		t.Fatal("rate sources by default")
+	}
+	cfg.DisableExchangeRates = false
+	if len(cfg.MakeWalletConfig().RateSources) != len(sources) {
+		t.Fatal("wallet config has no rate sources")
+	}
+
+	cfg.ExchangeRateAPIs = []ExchangeRateAPI{{URL: "https://rates.example.com", RatesPath: []string{"bitcoin"}}}
+	cfg.ExchangeRateFile = "/tmp/rates.json"
+	sources = cfg.MakeRateSources()
+	if len(sources) != 2 {
+		t.Fatalf("got %d sources", len(sources))
+	}
+	if s, ok := sources[0].(*wallet.HTTPRateSource); !ok || s.URL != "https://rates.example.com" || s.RatesPath[0] != "bitcoin" {
+		t.Fatalf("first source is %T", sources[0])
+	}
+	if s, ok := sources[1].(*wallet.FileRateSource); !ok || s.Path != "/tmp/rates.json" {
+		t.Fatalf("second source is %T", sources[1])
+	}
+
+	cfg.DisableExchangeRates = true
+	if len(cfg.MakeWalletConfig().RateSources) != 0 {
+		t.Fatal("rate sources with exchange rates disabled")
+	}
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/wire"
+)
+
+// Coin control: list the wallet coins, freeze the ones not to spend and
+// choose the coins a send spends.
+
+// parseOutpoint parses txid:index
+func parseOutpoint(s string) (wire.OutPoint, error) {
+	txid, index, ok := strings.Cut(s, ":")
+	if !ok {
+		return wire.OutPoint{}, fmt.Errorf("invalid outpoint %q, want txid:index", s)
+	}
+	hash, err := chainhash.NewHashFromStr(txid)
+	if err != nil || len(txid) != chainhash.MaxHashStringSize {
+		return wire.OutPoint{}, fmt.Errorf("invalid outpoint %q, want txid:index", s)
+	}
+	n, err := strconv.ParseUint(index, 10, 32)
+	if err != nil {
+		return wire.OutPoint{}, fmt.Errorf("invalid outpoint %q, want txid:index", s)
+	}
+	return *wire.NewOutPoint(hash, uint32(n)), nil
+}
+
+// parseOutpoints parses a comma separated list of outpoints
+func parseOutpoints(s string) ([]wire.OutPoint, error) {
+	var ops []wire.OutPoint
+	for _, field := range strings.Split(s, ",") {
+		op, err := parseOutpoint(strings.TrimSpace(field))
+		if err != nil {
+			return nil, err
+		}
+		ops = append(ops, op)
+	}
+	return ops, nil
+}
+
+type coinItem struct {
+	Outpoint      string `json:"outpoint"`
+	Address       string `json:"address"`
+	Value         string `json:"value"`
+	Height        int64  `json:"height"`
+	Confirmations int64  `json:"confirmations"`
+	Frozen        bool   `json:"frozen"`
+	LockedBy      string `json:"locked_by,omitempty"`
+	Label         string `json:"label,omitempty"`
+}
+
+type coinsResult []coinItem
+
+func (c coinsResult) String() string {
+	var b strings.Builder
+	for i, item := range c {
+		if i > 0 {
+			b.WriteByte('\n')
+		}
+		frozen := ""
+		if item.Frozen {
+			frozen = "frozen"
+		} else if item.LockedBy != "" {
+			frozen = "locked"
+		}
+		fmt.Fprintf(&b, "%s  %-42s %14s  %5d confs  %-6s  %s", item.Outpoint, item.Address,
+			item.Value, item.Confirmations, frozen, item.Label)
+	}
+	return b.String()
+}
+
+func (a *app) listUnspent(_ []string) (any, error) {
+	coins, err := a.ec.GetWallet().ListUnspentOutputs()
+	if err != nil {
+		return nil, err
+	}
+	result := make(coinsResult, 0, len(coins))
+	for _, coin := range coins {
+		item := coinItem{
+			Outpoint:      coin.Op.String(),
+			Value:         formatBTC(coin.Value),
+			Height:        coin.AtHeight,
+			Confirmations: coin.Confirmations,
+			Frozen:        coin.Frozen,
+			LockedBy:      coin.LockedBy,
+			Label:         coin.Label,
+		}
+		if coin.Address != nil {
+			item.Address = coin.Address.String()
+		}
+		result = append(result, item)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Confirmations != result[j].Confirmations {
+			return result[i].Confirmations > result[j].Confirmations
+		}
+		return result[i].Outpoint < result[j].Outpoint
+	})
+	return result, nil
+}
+
+func (a *app) freeze(args []string) (any, error) {
+	return a.setFrozen(args, true)
+}
+
+func (a *app) unfreeze(args []string) (any, error) {
+	return a.setFrozen(args, false)
+}
+
+// setFrozen freezes or unfreezes each outpoint or address argument
+func (a *app) setFrozen(args []string, frozen bool) (any, error) {
+	if len(args) == 0 {
+		return nil, errors.New("usage: freeze|unfreeze <txid:index|address>...")
+	}
+	w := a.ec.GetWallet()
+	n := 0
+	for _, arg := range args {
+		if strings.Contains(arg, ":") {
+			op, err := parseOutpoint(arg)
+			if err != nil {
+				return nil, err
+			}
+			if err = w.FreezeCoin(op, frozen); err != nil {
+				return nil, err
+			}
+			n++
+			continue
+		}
+		addr, err := w.DecodeAddress(arg)
+		if err != nil || !addr.IsForNet(w.Params()) {
+			return nil, fmt.Errorf("invalid outpoint or address %q", arg)
+		}
+		count, err := w.FreezeAddress(addr, frozen)
+		if err != nil {
+			return nil, err
+		}
+		n += count
+	}
+	if frozen {
+		return fmt.Sprintf("Froze %d coins", n), nil
+	}
+	return fmt.Sprintf("Unfroze %d coins", n), nil
+}
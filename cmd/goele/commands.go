@@ -0,0 +1,666 @@
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"main/client"
+	"main/client/btc"
+	"main/wallet"
+
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/tyler-smith/go-bip39"
+)
+
+// command is a goele subcommand. The node and wallet are made ready as the
+// command needs before run is called.
+type command struct {
+	name  string
+	args  string
+	help  string
+	node  bool // connects to the server and syncs headers first
+	open  bool // loads the wallet first, and syncs it if node is set
+	run   func(a *app, args []string) (any, error)
+	flags func(fs *flag.FlagSet) // optional command flags
+}
+
+var commands = []*command{{
+	name: "create",
+	help: "Create a new wallet with a new seed. Write the seed down.",
+	run:  (*app).create,
+}, {
+	name: "restore",
+	args: "[seed words...]",
+	help: "Restore a wallet from its seed. The seed is asked for if not given.",
+	run:  (*app).restore,
+}, {
+	name: "load",
+	help: "Check the wallet can be loaded with the password.",
+	open: true,
+	run:  (*app).load,
+}, {
+	name: "getbalance",
+	help: "Return the confirmed and unconfirmed balance of the wallet.",
+	open: true,
+	run:  (*app).getBalance,
+}, {
+	name: "listaddresses",
+	help: "List the wallet addresses.",
+	open: true,
+	run:  (*app).listAddresses,
+}, {
+	name: "getnewaddress",
+	help: "Return a new receive address.",
+	open: true,
+	run:  (*app).getNewAddress,
+}, {
+	name: "history",
+	help: "Return the wallet transaction history.",
+	open: true,
+	run:  (*app).history,
+}, {
+	name: "importprices",
+	args: "<file.csv>",
+	help: "Import daily coin prices from CSV for valuing the history.",
+	open: true,
+	run:  (*app).importPrices,
+	flags: func(fs *flag.FlagSet) {
+		fs.String("currency", "", "currency of the prices when the file has no currency column")
+	},
+}, {
+	name: "fiathistory",
+	help: "Return the history valued in a currency at block time.",
+	node: true,
+	open: true,
+	run:  (*app).fiatHistory,
+	flags: func(fs *flag.FlagSet) {
+		fs.String("currency", "USD", "fiat currency")
+	},
+}, {
+	name: "gains",
+	help: "Return the realised gains in a currency and totals per period.",
+	node: true,
+	open: true,
+	run:  (*app).gains,
+	flags: func(fs *flag.FlagSet) {
+		fs.String("currency", "USD", "fiat currency")
+		fs.String("method", "fifo", "lot matching: fifo, lifo")
+		fs.String("period", "year", "totals period: day, month, quarter, year")
+	},
+}, {
+	name: "export",
+	help: "Export the transaction history as CSV or JSON.",
+	node: true,
+	open: true,
+	run:  (*app).export,
+	flags: func(fs *flag.FlagSet) {
+		fs.String("format", "csv", "file format: csv, json")
+		fs.String("o", "", "output file (default stdout)")
+		fs.String("from", "", "first day YYYY-MM-DD of transactions by block time")
+		fs.String("to", "", "last day YYYY-MM-DD of transactions by block time")
+		fs.Int64("fromheight", 0, "first block height")
+		fs.Int64("toheight", 0, "last block height")
+		fs.String("currency", "", "add the fiat value in the currency from the historical prices")
+	},
+}, {
+	name: "listunspent",
+	help: "List the wallet coins with their address, confirmations and label.",
+	node: true,
+	open: true,
+	run:  (*app).listUnspent,
+}, {
+	name: "freeze",
+	args: "<txid:index|address>...",
+	help: "Freeze coins, or all the coins at addresses, so they are not spent.",
+	open: true,
+	run:  (*app).freeze,
+}, {
+	name: "unfreeze",
+	args: "<txid:index|address>...",
+	help: "Unfreeze coins, or all the coins at addresses.",
+	open: true,
+	run:  (*app).unfreeze,
+}, {
+	name: "setlabel",
+	args: "<type> <ref> <label>",
+	help: "Label a tx, addr, output, input, pubkey or xpub reference. An empty label removes it.",
+	open: true,
+	run:  (*app).setLabel,
+}, {
+	name: "labels",
+	help: "List the labels.",
+	open: true,
+	run:  (*app).labels,
+	flags: func(fs *flag.FlagSet) {
+		fs.String("type", "", "only labels of the type")
+	},
+}, {
+	name: "importlabels",
+	args: "<file.jsonl>",
+	help: "Import labels in the BIP329 format.",
+	open: true,
+	run:  (*app).importLabels,
+}, {
+	name: "exportlabels",
+	help: "Export the labels in the BIP329 format.",
+	open: true,
+	run:  (*app).exportLabels,
+	flags: func(fs *flag.FlagSet) {
+		fs.String("o", "", "output file (default stdout)")
+	},
+}, {
+	name: "send",
+	args: "<address> <amount>",
+	help: "Send an amount in BTC to an address.",
+	node: true,
+	open: true,
+	run:  (*app).send,
+	flags: func(fs *flag.FlagSet) {
+		fs.String("fee", "normal", "fee level: priority, normal, economic")
+		fs.String("coins", "", "spend exactly these comma separated txid:index coins")
+	},
+}, {
+	name: "paytomany",
+	args: "<address> <amount>...",
+	help: "Pay many addresses in one transaction, shown for review. An amount of ! sends the maximum.",
+	node: true,
+	open: true,
+	run:  (*app).payToMany,
+	flags: func(fs *flag.FlagSet) {
+		fs.String("fee", "normal", "fee level: priority, normal, economic")
+		fs.Uint64("feerate", 0, "fee rate in sat/vB instead of the fee level")
+		fs.String("coins", "", "spend exactly these comma separated txid:index coins")
+		fs.Int("subtractfee", -1, "index of the output to take the fee from")
+		fs.String("opreturn", "", "hex data for an OP_RETURN output")
+		fs.String("file", "", "CSV file of address,amount rows to pay as well")
+		fs.Bool("broadcast", false, "broadcast the transaction")
+	},
+}, {
+	name: "propose",
+	args: "<address> <amount>...",
+	help: "Create an unsigned transaction proposal, locking its coins. An amount of ! sends the maximum.",
+	node: true,
+	open: true,
+	run:  (*app).propose,
+	flags: func(fs *flag.FlagSet) {
+		fs.String("fee", "normal", "fee level: priority, normal, economic")
+		fs.Uint64("feerate", 0, "fee rate in sat/vB instead of the fee level")
+		fs.String("coins", "", "spend exactly these comma separated txid:index coins")
+		fs.Int("subtractfee", -1, "index of the output to take the fee from")
+		fs.String("opreturn", "", "hex data for an OP_RETURN output")
+		fs.String("file", "", "CSV file of address,amount rows to pay as well")
+	},
+}, {
+	name: "proposals",
+	help: "List the transaction proposals.",
+	open: true,
+	run:  (*app).listProposals,
+}, {
+	name: "proposal",
+	args: "<id>",
+	help: "Show a transaction proposal.",
+	open: true,
+	run:  (*app).showProposal,
+}, {
+	name: "signproposal",
+	args: "<id>",
+	help: "Sign a transaction proposal with the wallet keys.",
+	open: true,
+	run:  (*app).signProposal,
+	flags: func(fs *flag.FlagSet) {
+		fs.String("signed", "", "hex of the proposal transaction signed elsewhere, to use instead")
+	},
+}, {
+	name: "broadcastproposal",
+	args: "<id>",
+	help: "Broadcast a signed transaction proposal.",
+	node: true,
+	open: true,
+	run:  (*app).broadcastProposal,
+}, {
+	name: "cancelproposal",
+	args: "<id>",
+	help: "Cancel a transaction proposal, unlocking its coins.",
+	open: true,
+	run:  (*app).cancelProposal,
+}, {
+	name: "bumpfee",
+	args: "<txid>",
+	help: "Speed up an unconfirmed transaction by spending its wallet outputs with a fee for both (child pays for parent).",
+	node: true,
+	open: true,
+	run:  (*app).bumpFee,
+}, {
+	name: "broadcast",
+	args: "<rawtx>",
+	help: "Broadcast a hex encoded signed transaction.",
+	node: true,
+	run:  (*app).broadcast,
+}, {
+	name: "daemon",
+	help: "Keep the wallet synced and serve the JSON-RPC on localhost until stopped.",
+	node: true,
+	open: true,
+	run:  (*app).daemon,
+	flags: func(fs *flag.FlagSet) {
+		fs.Int("rpcport", 0, "JSON-RPC port (default the saved port, or any free port)")
+		fs.String("rpcuser", "", "JSON-RPC user (default the saved user)")
+		fs.String("rpcpassword", "", "JSON-RPC password (default the saved or a random password)")
+	},
+}, {
+	name: "console",
+	help: "Open an interactive console on the synced wallet and server.",
+	node: true,
+	open: true,
+	run:  (*app).console,
+}, {
+	name: "sync",
+	help: "Sync the headers and the wallet with the server.",
+	node: true,
+	open: true,
+	run:  (*app).sync,
+}, {
+	name: "headers",
+	help: "Sync the headers with the server and return the tip.",
+	node: true,
+	run:  (*app).headers,
+}}
+
+func findCommand(name string) *command {
+	for _, cmd := range commands {
+		if cmd.name == name {
+			return cmd
+		}
+	}
+	return nil
+}
+
+// app runs commands against a client
+type app struct {
+	cfg       *client.ClientConfig
+	ec        client.ElectrumClient
+	passwords *passwordReader
+	// result output for interactive commands
+	stdout io.Writer
+	json   bool
+	// command flags, set by execute
+	flags *flag.FlagSet
+}
+
+func newApp(cfg *client.ClientConfig, passwords *passwordReader, stdout io.Writer, asJSON bool) *app {
+	return &app{
+		cfg:       cfg,
+		ec:        btc.NewBtcElectrumClient(cfg),
+		passwords: passwords,
+		stdout:    stdout,
+		json:      asJSON,
+	}
+}
+
+// execute parses the command flags, readies the node and wallet for the
+// command and runs it
+func (a *app) execute(cmd *command, args []string) (any, error) {
+	a.flags = flag.NewFlagSet(cmd.name, flag.ContinueOnError)
+	if cmd.flags != nil {
+		cmd.flags(a.flags)
+	}
+	if err := a.flags.Parse(args); err != nil {
+		return nil, err
+	}
+	args = a.flags.Args()
+
+	if cmd.node {
+		if err := a.startNode(); err != nil {
+			return nil, err
+		}
+		defer a.ec.GetNode().Stop()
+	}
+	if cmd.open {
+		if err := a.openWallet(cmd.node); err != nil {
+			return nil, err
+		}
+	}
+	return cmd.run(a, args)
+}
+
+func (a *app) startNode() error {
+	a.ec.CreateNode(client.SingleNode)
+	if err := a.ec.StartNode(); err != nil {
+		return err
+	}
+	return a.ec.SyncHeaders()
+}
+
+func (a *app) walletExists() bool {
+	_, err := os.Stat(filepath.Join(a.cfg.DataDir, "wallet.db"))
+	return err == nil
+}
+
+func (a *app) openWallet(sync bool) error {
+	if !a.walletExists() {
+		return fmt.Errorf("no wallet in %s, use create or restore", a.cfg.DataDir)
+	}
+	pw, err := a.passwords.password()
+	if err != nil {
+		return err
+	}
+	if err = a.ec.LoadWallet(pw); err != nil {
+		return err
+	}
+	if sync {
+		return a.ec.SyncWallet()
+	}
+	return nil
+}
+
+type createResult struct {
+	Seed string `json:"seed"`
+	Path string `json:"path"`
+}
+
+func (r *createResult) String() string {
+	return fmt.Sprintf("Wallet created in %s\n\nYour seed is:\n\n  %s\n\n"+
+		"Write it down and keep it safe. It is the only way to restore the wallet.",
+		r.Path, r.Seed)
+}
+
+func (a *app) create(_ []string) (any, error) {
+	if a.walletExists() {
+		return nil, fmt.Errorf("a wallet already exists in %s", a.cfg.DataDir)
+	}
+	pw, err := a.passwords.newPassword()
+	if err != nil {
+		return nil, err
+	}
+	ent, err := bip39.NewEntropy(128)
+	if err != nil {
+		return nil, err
+	}
+	seed, err := bip39.NewMnemonic(ent)
+	if err != nil {
+		return nil, err
+	}
+	if err = a.ec.RecreateWallet(pw, seed); err != nil {
+		return nil, err
+	}
+	return &createResult{Seed: seed, Path: a.cfg.DataDir}, nil
+}
+
+func (a *app) restore(args []string) (any, error) {
+	if a.walletExists() {
+		return nil, fmt.Errorf("a wallet already exists in %s", a.cfg.DataDir)
+	}
+	seed := strings.Join(args, " ")
+	if seed == "" {
+		var err error
+		if seed, err = a.passwords.read("Seed: "); err != nil {
+			return nil, err
+		}
+	}
+	seed = strings.Join(strings.Fields(seed), " ")
+	if !bip39.IsMnemonicValid(seed) {
+		return nil, errors.New("invalid seed")
+	}
+	pw, err := a.passwords.newPassword()
+	if err != nil {
+		return nil, err
+	}
+	if err = a.ec.RecreateWallet(pw, seed); err != nil {
+		return nil, err
+	}
+	return fmt.Sprintf("Wallet restored in %s. Use sync to fetch its history.", a.cfg.DataDir), nil
+}
+
+func (a *app) load(_ []string) (any, error) {
+	return "Wallet loaded", nil
+}
+
+// formatBTC formats satoshis as a BTC decimal string without trailing zeros
+func formatBTC(sats int64) string {
+	s := btcutil.Amount(sats).Format(btcutil.AmountBTC)
+	s = strings.TrimSuffix(s, " BTC")
+	if strings.Contains(s, ".") {
+		s = strings.TrimRight(strings.TrimRight(s, "0"), ".")
+	}
+	return s
+}
+
+type balanceResult struct {
+	Confirmed   string `json:"confirmed"`
+	Unconfirmed string `json:"unconfirmed"`
+}
+
+func (r *balanceResult) String() string {
+	return fmt.Sprintf("confirmed:   %s BTC\nunconfirmed: %s BTC", r.Confirmed, r.Unconfirmed)
+}
+
+func (a *app) getBalance(_ []string) (any, error) {
+	confirmed, unconfirmed := a.ec.GetWallet().Balance()
+	return &balanceResult{
+		Confirmed:   formatBTC(confirmed),
+		Unconfirmed: formatBTC(unconfirmed),
+	}, nil
+}
+
+func (a *app) listAddresses(_ []string) (any, error) {
+	addresses := a.ec.GetWallet().ListAddresses()
+	list := make([]string, 0, len(addresses))
+	for _, addr := range addresses {
+		list = append(list, addr.String())
+	}
+	return list, nil
+}
+
+func (a *app) getNewAddress(_ []string) (any, error) {
+	return a.ec.GetWallet().NewAddress(wallet.EXTERNAL).String(), nil
+}
+
+type historyItem struct {
+	Txid          string `json:"txid"`
+	Height        int64  `json:"height"`
+	Confirmations int64  `json:"confirmations"`
+	Value         string `json:"value"`
+	Fee           int64  `json:"fee,omitempty"`
+	Timestamp     string `json:"timestamp"`
+	Status        string `json:"status"`
+}
+
+type historyResult []historyItem
+
+func (h historyResult) String() string {
+	var b strings.Builder
+	for i, item := range h {
+		if i > 0 {
+			b.WriteByte('\n')
+		}
+		fmt.Fprintf(&b, "%s  %-20s %7d  %14s  %s", item.Txid, item.Timestamp,
+			item.Height, item.Value, item.Status)
+	}
+	return b.String()
+}
+
+func (a *app) history(_ []string) (any, error) {
+	txns, err := a.ec.GetWallet().Transactions()
+	if err != nil {
+		return nil, err
+	}
+	sort.SliceStable(txns, func(i, j int) bool {
+		return txns[i].Timestamp.Before(txns[j].Timestamp)
+	})
+	history := make(historyResult, 0, len(txns))
+	for _, txn := range txns {
+		history = append(history, historyItem{
+			Txid:          txn.Txid,
+			Height:        txn.Height,
+			Confirmations: txn.Confirmations,
+			Value:         formatBTC(txn.Value),
+			Fee:           txn.Fee,
+			Timestamp:     txn.Timestamp.UTC().Format(time.RFC3339),
+			Status:        string(txn.Status),
+		})
+	}
+	return history, nil
+}
+
+func parseFeeLevel(level string) (wallet.FeeLevel, error) {
+	switch level {
+	case "priority":
+		return wallet.PRIOIRTY, nil
+	case "normal":
+		return wallet.NORMAL, nil
+	case "economic":
+		return wallet.ECONOMIC, nil
+	}
+	return 0, fmt.Errorf("invalid fee level %q", level)
+}
+
+// parseAmount parses a BTC decimal amount into satoshis
+func parseAmount(s string) (int64, error) {
+	btc, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid amount %q", s)
+	}
+	amt, err := btcutil.NewAmount(btc)
+	if err != nil {
+		return 0, err
+	}
+	if amt <= 0 {
+		return 0, fmt.Errorf("invalid amount %q", s)
+	}
+	return int64(amt), nil
+}
+
+func (a *app) send(args []string) (any, error) {
+	if len(args) != 2 {
+		return nil, errors.New("usage: send <address> <amount>")
+	}
+	w := a.ec.GetWallet()
+	addr, err := w.DecodeAddress(args[0])
+	if err != nil {
+		return nil, err
+	}
+	amount, err := parseAmount(args[1])
+	if err != nil {
+		return nil, err
+	}
+	level, err := parseFeeLevel(a.flags.Lookup("fee").Value.String())
+	if err != nil {
+		return nil, err
+	}
+	var coins []wire.OutPoint
+	if s := a.flags.Lookup("coins").Value.String(); s != "" {
+		if coins, err = parseOutpoints(s); err != nil {
+			return nil, err
+		}
+	}
+	var txid *chainhash.Hash
+	if coins != nil {
+		txid, err = w.SpendCoins(amount, addr, level, coins)
+	} else {
+		txid, err = w.Spend(amount, addr, level)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return txid.String(), nil
+}
+
+func (a *app) bumpFee(args []string) (any, error) {
+	if len(args) != 1 {
+		return nil, errors.New("usage: bumpfee <txid>")
+	}
+	txid, err := chainhash.NewHashFromStr(args[0])
+	if err != nil {
+		return nil, err
+	}
+	newTxid, err := a.ec.GetWallet().BumpFee(*txid)
+	if err != nil {
+		return nil, err
+	}
+	return newTxid.String(), nil
+}
+
+func (a *app) broadcast(args []string) (any, error) {
+	if len(args) != 1 {
+		return nil, errors.New("usage: broadcast <rawtx>")
+	}
+	b, err := hex.DecodeString(args[0])
+	if err != nil {
+		return nil, fmt.Errorf("invalid transaction hex: %w", err)
+	}
+	var tx wire.MsgTx
+	if err = tx.Deserialize(bytes.NewReader(b)); err != nil {
+		return nil, fmt.Errorf("invalid transaction: %w", err)
+	}
+	w := a.ec.GetWallet()
+	if w == nil {
+		return a.ec.Broadcast(args[0])
+	}
+	// through the wallet to release the coins the transaction locks
+	txid, err := w.BroadcastTx(&tx)
+	if txid == nil {
+		return nil, err
+	}
+	return txid.String(), nil
+}
+
+type syncResult struct {
+	Height  int64          `json:"height"`
+	Balance *balanceResult `json:"balance"`
+}
+
+func (r *syncResult) String() string {
+	return fmt.Sprintf("synced to height %d\n%s", r.Height, r.Balance)
+}
+
+func (a *app) sync(_ []string) (any, error) {
+	tip, err := a.ec.GetNode().SubscribeHeaders()
+	if err != nil {
+		return nil, err
+	}
+	balance, _ := a.getBalance(nil)
+	return &syncResult{Height: int64(tip.Height), Balance: balance.(*balanceResult)}, nil
+}
+
+type headersResult struct {
+	Height int64  `json:"height"`
+	Hash   string `json:"hash"`
+	Server string `json:"server"`
+}
+
+func (r *headersResult) String() string {
+	return fmt.Sprintf("tip %d %s from %s", r.Height, r.Hash, r.Server)
+}
+
+func (a *app) headers(_ []string) (any, error) {
+	node := a.ec.GetNode()
+	tip, err := node.SubscribeHeaders()
+	if err != nil {
+		return nil, err
+	}
+	b, err := hex.DecodeString(tip.Hex)
+	if err != nil {
+		return nil, err
+	}
+	var hdr wire.BlockHeader
+	if err = hdr.Deserialize(bytes.NewReader(b)); err != nil {
+		return nil, err
+	}
+	return &headersResult{
+		Height: int64(tip.Height),
+		Hash:   hdr.BlockHash().String(),
+		Server: node.GetServerConn().Addr.String(),
+	}, nil
+}
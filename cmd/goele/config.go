@@ -0,0 +1,131 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"main/client"
+	"main/electrumx"
+	"main/wallet"
+
+	"github.com/btcsuite/btcd/chaincfg"
+)
+
+var (
+	coins = []string{"btc"} // add as implemented
+	nets  = []string{"mainnet", "testnet", "regtest", "simnet"}
+)
+
+// options are the global command line flags
+type options struct {
+	coin      string
+	net       string
+	datadir   string
+	server    string
+	proxy     string
+	isolation bool
+	rates     bool
+	ratesFile string
+	json      bool
+}
+
+func contains(s []string, str string) bool {
+	for _, v := range s {
+		if v == str {
+			return true
+		}
+	}
+	return false
+}
+
+// parseServer parses an Electrum style server "host:port:s" for ssl or
+// "host:port:t" for tcp. Without a protocol letter ssl is assumed.
+func parseServer(server string) (electrumx.ServerAddr, error) {
+	addr, proto := server, "s"
+	if i := strings.LastIndex(server, ":"); i >= 0 && (server[i+1:] == "s" || server[i+1:] == "t") {
+		addr, proto = server[:i], server[i+1:]
+	}
+	if _, _, err := net.SplitHostPort(addr); err != nil {
+		return electrumx.ServerAddr{}, fmt.Errorf("invalid server %q: %w", server, err)
+	}
+	if proto == "t" {
+		return electrumx.ServerAddr{Net: "tcp", Addr: addr}, nil
+	}
+	return electrumx.ServerAddr{Net: "ssl", Addr: addr}, nil
+}
+
+// makeConfig makes the client config for the options. Without a server the
+// node picks one from its server list, except on regtest where a local server
+// is assumed.
+func makeConfig(opts *options) (*client.ClientConfig, error) {
+	if !contains(coins, opts.coin) {
+		return nil, errors.New("invalid coin")
+	}
+	if !contains(nets, opts.net) {
+		return nil, errors.New("invalid net")
+	}
+	cfg := client.NewDefaultConfig()
+	switch opts.coin {
+	case "btc":
+		cfg.Chain = wallet.Bitcoin
+	default:
+		return nil, errors.New("invalid coin")
+	}
+	cfg.StoreEncSeed = true
+
+	coinNetDir := opts.datadir
+	if coinNetDir == "" {
+		appDir, err := client.GetConfigPath()
+		if err != nil {
+			return nil, err
+		}
+		coinNetDir = filepath.Join(appDir, opts.coin, opts.net)
+	}
+	err := os.MkdirAll(coinNetDir, os.ModeDir|0777)
+	if err != nil {
+		return nil, err
+	}
+	cfg.DataDir = coinNetDir
+
+	server := opts.server
+	switch opts.net {
+	case "regtest", "simnet":
+		cfg.Params = &chaincfg.RegressionNetParams
+		if server == "" {
+			server = "127.0.0.1:53002:t"
+		}
+	case "testnet":
+		cfg.Params = &chaincfg.TestNet3Params
+	case "mainnet":
+		cfg.Params = &chaincfg.MainNetParams
+	}
+	if server != "" {
+		addr, err := parseServer(server)
+		if err != nil {
+			return nil, err
+		}
+		cfg.TrustedPeer = addr
+	}
+
+	// exchange rates are only fetched from the rate APIs if asked for
+	if !opts.rates {
+		cfg.ExchangeRateAPIs = nil
+	}
+	cfg.ExchangeRateFile = opts.ratesFile
+	cfg.DisableExchangeRates = !opts.rates && opts.ratesFile == ""
+
+	if opts.proxy != "" {
+		if _, _, err := net.SplitHostPort(opts.proxy); err != nil {
+			return nil, fmt.Errorf("invalid proxy %q: %w", opts.proxy, err)
+		}
+		cfg.Proxy = &electrumx.ProxyConfig{
+			Addr:         opts.proxy,
+			TorIsolation: opts.isolation,
+		}
+	}
+	return cfg, nil
+}
@@ -0,0 +1,542 @@
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"main/client/btc"
+	"main/electrumx"
+	"main/wallet"
+
+	"github.com/btcsuite/btcd/wire"
+	"golang.org/x/term"
+)
+
+// The console is a REPL over the loaded client, as the Electrum python console
+// is. Wallet, node and client methods are called by their Go names and the
+// daemon's Electrum commands by theirs. Calls are written either way:
+//
+//	GetHistory bcrt1q...
+//	BlockHeaders(100, 5)
+//	signmessage("bcrt1q...", "hello")
+
+type consoleCommand struct {
+	name string
+	args string
+	help string
+	run  func(c *console, args []string) (any, error)
+}
+
+var (
+	consoleCommandsOnce sync.Once
+	consoleCommands     []*consoleCommand
+)
+
+// consoleCommandList makes the commands on first use, as help refers to them
+// and the daemon methods are set in init
+func consoleCommandList() []*consoleCommand {
+	consoleCommandsOnce.Do(makeConsoleCommands)
+	return consoleCommands
+}
+
+func makeConsoleCommands() {
+	consoleCommands = []*consoleCommand{
+		{name: "help", args: "[command]", help: "List the commands, or show the help for one.", run: (*console).help},
+		{name: "exit", help: "Leave the console.", run: (*console).exit},
+		{name: "quit", help: "Leave the console.", run: (*console).exit},
+		// wallet
+		{name: "Balance", help: "Wallet confirmed and unconfirmed balance in satoshis.", run: (*console).balance},
+		{name: "ListAddresses", help: "Wallet addresses, including imported.", run: (*console).listAddresses},
+		{name: "ListUnspent", help: "Wallet unspent outputs.", run: (*console).listUnspent},
+		{name: "Transactions", help: "Wallet transactions.", run: (*console).transactions},
+		{name: "CurrentAddress", args: "[internal]", help: "First unused receive, or change, address.", run: (*console).currentAddress},
+		{name: "GetFeePerByte", args: "[priority|normal|economic]", help: "Wallet fee rate in sat/vB.", run: (*console).getFeePerByte},
+		// node
+		{name: "GetHistory", args: "<address|scripthash>", help: "Server history of an address or scripthash.", run: (*console).getHistory},
+		{name: "GetMempool", args: "<address|scripthash>", help: "Server mempool transactions of an address or scripthash.", run: (*console).getMempool},
+		{name: "BlockHeaders", args: "<start height> <count>", help: "Decoded block headers from the server.", run: (*console).blockHeaders},
+		{name: "SubscribeHeaders", help: "Server chain tip.", run: (*console).subscribeHeaders},
+		{name: "GetRawTransaction", args: "<txid>", help: "Hex encoded transaction from the server.", run: (*console).getRawTransaction},
+		{name: "EstimateFee", args: "<blocks>", help: "Server fee estimate in BTC/kB to confirm within blocks.", run: (*console).estimateFee},
+		{name: "PeerAddrs", help: "Peers the server knows of.", run: (*console).peerAddrs},
+		{name: "Server", help: "Address of the connected server.", run: (*console).server},
+		// client
+		{name: "Broadcast", args: "<rawtx>", help: "Broadcast a hex encoded signed transaction.", run: (*console).broadcast},
+	}
+	// the daemon's Electrum commands, except those the console has its own of
+	for _, m := range rpcMethods {
+		if m.name == "help" || m.name == "stop" {
+			continue
+		}
+		m := m
+		args := make([]string, len(m.params))
+		for i, p := range m.params {
+			args[i] = "<" + p + ">"
+		}
+		consoleCommands = append(consoleCommands, &consoleCommand{
+			name: m.name,
+			args: strings.Join(args, " "),
+			help: m.help,
+			run: func(c *console, args []string) (any, error) {
+				return c.callRPC(m, args)
+			},
+		})
+	}
+}
+
+func findConsoleCommand(name string) *consoleCommand {
+	for _, cmd := range consoleCommandList() {
+		if cmd.name == name {
+			return cmd
+		}
+	}
+	return nil
+}
+
+var errExit = errors.New("exit")
+
+type console struct {
+	app *app
+	rpc *rpcServer
+	out io.Writer
+}
+
+// console runs the REPL until exit or the end of input. On a terminal lines
+// are edited with history and tab completion, otherwise they are read from
+// stdin so that the console can be scripted.
+func (a *app) console(_ []string) (any, error) {
+	c := &console{
+		app: a,
+		rpc: newRPCServer(a, "", "", func() {}),
+		out: a.stdout,
+	}
+	stdin := a.passwords.in
+	fd := int(stdin.Fd())
+	if !term.IsTerminal(fd) {
+		lines := a.passwords.lineReader()
+		for {
+			line, err := lines.ReadString('\n')
+			if line != "" && c.exec(line) == errExit {
+				return nil, nil
+			}
+			if err == io.EOF {
+				return nil, nil
+			}
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	state, err := term.MakeRaw(fd)
+	if err != nil {
+		return nil, err
+	}
+	defer term.Restore(fd, state)
+	t := term.NewTerminal(struct {
+		io.Reader
+		io.Writer
+	}{stdin, a.stdout}, "goele> ")
+	if w, h, err := term.GetSize(fd); err == nil {
+		t.SetSize(w, h)
+	}
+	t.AutoCompleteCallback = completeCommand
+	c.out = t
+	fmt.Fprintln(t, "goele console. Type help for the commands, tab to complete, exit to leave.")
+	for {
+		line, err := t.ReadLine()
+		if err == io.EOF {
+			return nil, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if c.exec(line) == errExit {
+			return nil, nil
+		}
+	}
+}
+
+// exec runs a console line writing its result or error
+func (c *console) exec(line string) error {
+	args, err := splitCommandLine(line)
+	if err != nil {
+		fmt.Fprintln(c.out, "error:", err)
+		return err
+	}
+	if len(args) == 0 {
+		return nil
+	}
+	cmd := findConsoleCommand(args[0])
+	if cmd == nil {
+		err = fmt.Errorf("unknown command %q, type help for the commands", args[0])
+		fmt.Fprintln(c.out, "error:", err)
+		return err
+	}
+	result, err := cmd.run(c, args[1:])
+	if err == errExit {
+		return err
+	}
+	if err == nil {
+		err = writeResult(c.out, result, c.app.json)
+	}
+	if err != nil {
+		fmt.Fprintln(c.out, "error:", err)
+	}
+	return err
+}
+
+// splitCommandLine splits a line into words. Spaces, commas and parentheses
+// separate words so both "name a b" and name("a", "b") are calls. Single or
+// double quotes group words and backslash escapes within quotes.
+func splitCommandLine(line string) ([]string, error) {
+	var words []string
+	var word strings.Builder
+	inWord := false
+	var quote rune
+	escaped := false
+	for _, r := range line {
+		switch {
+		case escaped:
+			word.WriteRune(r)
+			escaped = false
+		case quote != 0 && r == '\\':
+			escaped = true
+		case quote != 0 && r == quote:
+			quote = 0
+		case quote != 0:
+			word.WriteRune(r)
+		case r == '"' || r == '\'':
+			quote = r
+			inWord = true
+		case r == ' ' || r == '\t' || r == '\r' || r == '\n' || r == ',' || r == '(' || r == ')':
+			if inWord {
+				words = append(words, word.String())
+				word.Reset()
+				inWord = false
+			}
+		default:
+			word.WriteRune(r)
+			inWord = true
+		}
+	}
+	if quote != 0 {
+		return nil, errors.New("unterminated quote")
+	}
+	if inWord {
+		words = append(words, word.String())
+	}
+	return words, nil
+}
+
+// completeCommand completes the command name at the start of the line on tab,
+// to the longest prefix common to the commands that match
+func completeCommand(line string, pos int, key rune) (string, int, bool) {
+	if key != '\t' {
+		return "", 0, false
+	}
+	prefix := line[:pos]
+	if strings.ContainsAny(prefix, " (\"'") {
+		return "", 0, false
+	}
+	var matches []string
+	for _, cmd := range consoleCommandList() {
+		if strings.HasPrefix(cmd.name, prefix) {
+			matches = append(matches, cmd.name)
+		}
+	}
+	if len(matches) == 0 {
+		// GetHistory from gethistory
+		for _, cmd := range consoleCommandList() {
+			if strings.HasPrefix(strings.ToLower(cmd.name), strings.ToLower(prefix)) {
+				matches = append(matches, cmd.name)
+			}
+		}
+	}
+	if len(matches) == 0 {
+		return "", 0, false
+	}
+	common := matches[0]
+	for _, m := range matches[1:] {
+		for !strings.HasPrefix(m, common) {
+			common = common[:len(common)-1]
+		}
+	}
+	if len(common) < len(prefix) {
+		return "", 0, false
+	}
+	if len(matches) == 1 && pos == len(line) {
+		common += " "
+	}
+	return common + line[pos:], len(common), true
+}
+
+func (c *console) help(args []string) (any, error) {
+	if len(args) > 0 {
+		cmd := findConsoleCommand(args[0])
+		if cmd == nil {
+			return nil, fmt.Errorf("unknown command %q", args[0])
+		}
+		usage := cmd.name
+		if cmd.args != "" {
+			usage += " " + cmd.args
+		}
+		return usage + "\n  " + cmd.help, nil
+	}
+	var b strings.Builder
+	for _, cmd := range consoleCommandList() {
+		fmt.Fprintf(&b, "  %-20s %s\n", cmd.name, cmd.help)
+	}
+	b.WriteString("\nCall as name arg... or name(arg, ...). help <command> shows its args.")
+	return b.String(), nil
+}
+
+func (c *console) exit(_ []string) (any, error) {
+	return nil, errExit
+}
+
+func wantArgs(args []string, min, max int, usage string) error {
+	if len(args) < min || len(args) > max {
+		return errors.New("usage: " + usage)
+	}
+	return nil
+}
+
+// callRPC runs a daemon method with positional string params
+func (c *console) callRPC(m *rpcMethod, args []string) (any, error) {
+	list := make([]json.RawMessage, len(args))
+	for i, arg := range args {
+		list[i], _ = json.Marshal(arg)
+	}
+	raw, _ := json.Marshal(list)
+	params, err := m.parseParams(raw)
+	if err != nil {
+		return nil, err
+	}
+	return m.run(c.rpc, params)
+}
+
+type consoleBalance struct {
+	Confirmed   int64 `json:"confirmed"`
+	Unconfirmed int64 `json:"unconfirmed"`
+}
+
+func (c *console) balance(args []string) (any, error) {
+	if err := wantArgs(args, 0, 0, "Balance"); err != nil {
+		return nil, err
+	}
+	confirmed, unconfirmed := c.app.ec.GetWallet().Balance()
+	return &consoleBalance{Confirmed: confirmed, Unconfirmed: unconfirmed}, nil
+}
+
+func (c *console) listAddresses(args []string) (any, error) {
+	if err := wantArgs(args, 0, 0, "ListAddresses"); err != nil {
+		return nil, err
+	}
+	return c.app.listAddresses(nil)
+}
+
+func (c *console) listUnspent(args []string) (any, error) {
+	if err := wantArgs(args, 0, 0, "ListUnspent"); err != nil {
+		return nil, err
+	}
+	return c.rpc.listUnspent(nil)
+}
+
+func (c *console) transactions(args []string) (any, error) {
+	if err := wantArgs(args, 0, 0, "Transactions"); err != nil {
+		return nil, err
+	}
+	return c.app.history(nil)
+}
+
+func (c *console) currentAddress(args []string) (any, error) {
+	if err := wantArgs(args, 0, 1, "CurrentAddress [internal]"); err != nil {
+		return nil, err
+	}
+	purpose := wallet.EXTERNAL
+	if len(args) == 1 {
+		if args[0] != "internal" {
+			return nil, errors.New("usage: CurrentAddress [internal]")
+		}
+		purpose = wallet.INTERNAL
+	}
+	return c.app.ec.GetWallet().CurrentAddress(purpose).String(), nil
+}
+
+func (c *console) getFeePerByte(args []string) (any, error) {
+	if err := wantArgs(args, 0, 1, "GetFeePerByte [priority|normal|economic]"); err != nil {
+		return nil, err
+	}
+	level := wallet.NORMAL
+	if len(args) == 1 {
+		var err error
+		if level, err = parseFeeLevel(args[0]); err != nil {
+			return nil, err
+		}
+	}
+	return c.app.ec.GetWallet().GetFeePerByte(level), nil
+}
+
+// scripthash takes an address of the wallet network or a scripthash
+func (c *console) scripthash(arg string) (string, error) {
+	w := c.app.ec.GetWallet()
+	if addr, err := w.DecodeAddress(arg); err == nil && addr.IsForNet(w.Params()) {
+		script, err := w.AddressToScript(addr)
+		if err != nil {
+			return "", err
+		}
+		return btc.ElectrumScripthash(script), nil
+	}
+	if b, err := hex.DecodeString(arg); err != nil || len(b) != 32 {
+		return "", fmt.Errorf("%s is not an address or scripthash", arg)
+	}
+	return arg, nil
+}
+
+func (c *console) getHistory(args []string) (any, error) {
+	if err := wantArgs(args, 1, 1, "GetHistory <address|scripthash>"); err != nil {
+		return nil, err
+	}
+	scripthash, err := c.scripthash(args[0])
+	if err != nil {
+		return nil, err
+	}
+	history, err := c.app.ec.GetNode().GetHistory(scripthash)
+	if err != nil {
+		return nil, err
+	}
+	if history == nil {
+		history = electrumx.HistoryResult{}
+	}
+	return history, nil
+}
+
+func (c *console) getMempool(args []string) (any, error) {
+	if err := wantArgs(args, 1, 1, "GetMempool <address|scripthash>"); err != nil {
+		return nil, err
+	}
+	scripthash, err := c.scripthash(args[0])
+	if err != nil {
+		return nil, err
+	}
+	mempool, err := c.app.ec.GetNode().GetMempool(scripthash)
+	if err != nil {
+		return nil, err
+	}
+	if mempool == nil {
+		mempool = electrumx.HistoryResult{}
+	}
+	return mempool, nil
+}
+
+type consoleHeader struct {
+	Height    int64  `json:"height"`
+	Hash      string `json:"hash"`
+	PrevBlock string `json:"prev_block"`
+	Merkle    string `json:"merkle_root"`
+	Time      string `json:"time"`
+	Bits      string `json:"bits"`
+	Nonce     uint32 `json:"nonce"`
+}
+
+func (c *console) blockHeaders(args []string) (any, error) {
+	if err := wantArgs(args, 2, 2, "BlockHeaders <start height> <count>"); err != nil {
+		return nil, err
+	}
+	start, err := strconv.ParseUint(args[0], 10, 32)
+	if err != nil {
+		return nil, fmt.Errorf("invalid start height %q", args[0])
+	}
+	count, err := strconv.ParseUint(args[1], 10, 32)
+	if err != nil || count == 0 {
+		return nil, fmt.Errorf("invalid count %q", args[1])
+	}
+	res, err := c.app.ec.GetNode().BlockHeaders(uint32(start), uint32(count))
+	if err != nil {
+		return nil, err
+	}
+	b, err := hex.DecodeString(res.HexConcat)
+	if err != nil {
+		return nil, err
+	}
+	r := bytes.NewReader(b)
+	headers := make([]consoleHeader, 0, res.Count)
+	for i := uint32(0); i < res.Count; i++ {
+		var hdr wire.BlockHeader
+		if err = hdr.Deserialize(r); err != nil {
+			return nil, err
+		}
+		headers = append(headers, consoleHeader{
+			Height:    int64(start) + int64(i),
+			Hash:      hdr.BlockHash().String(),
+			PrevBlock: hdr.PrevBlock.String(),
+			Merkle:    hdr.MerkleRoot.String(),
+			Time:      hdr.Timestamp.UTC().Format(time.RFC3339),
+			Bits:      strconv.FormatUint(uint64(hdr.Bits), 16),
+			Nonce:     hdr.Nonce,
+		})
+	}
+	return headers, nil
+}
+
+func (c *console) subscribeHeaders(args []string) (any, error) {
+	if err := wantArgs(args, 0, 0, "SubscribeHeaders"); err != nil {
+		return nil, err
+	}
+	return c.app.headers(nil)
+}
+
+func (c *console) getRawTransaction(args []string) (any, error) {
+	if err := wantArgs(args, 1, 1, "GetRawTransaction <txid>"); err != nil {
+		return nil, err
+	}
+	return c.app.ec.GetRawTransaction(args[0])
+}
+
+func (c *console) estimateFee(args []string) (any, error) {
+	if err := wantArgs(args, 1, 1, "EstimateFee <blocks>"); err != nil {
+		return nil, err
+	}
+	blocks, err := strconv.Atoi(args[0])
+	if err != nil || blocks < 1 {
+		return nil, fmt.Errorf("invalid blocks %q", args[0])
+	}
+	return c.app.ec.GetNode().EstimateFee(blocks)
+}
+
+func (c *console) peerAddrs(args []string) (any, error) {
+	if err := wantArgs(args, 0, 0, "PeerAddrs"); err != nil {
+		return nil, err
+	}
+	ssl, onion, err := c.app.ec.GetNode().PeerAddrs()
+	if err != nil {
+		return nil, err
+	}
+	peers := append(ssl, onion...)
+	sort.Strings(peers)
+	return peers, nil
+}
+
+func (c *console) server(args []string) (any, error) {
+	if err := wantArgs(args, 0, 0, "Server"); err != nil {
+		return nil, err
+	}
+	return c.app.ec.GetNode().GetServerConn().Addr.String(), nil
+}
+
+func (c *console) broadcast(args []string) (any, error) {
+	if err := wantArgs(args, 1, 1, "Broadcast <rawtx>"); err != nil {
+		return nil, err
+	}
+	return c.app.broadcast(args)
+}
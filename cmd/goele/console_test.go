@@ -0,0 +1,141 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+
+	"main/electrumx/electrumxtest"
+
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/txscript"
+)
+
+func TestSplitCommandLine(t *testing.T) {
+	tests := []struct {
+		line    string
+		want    []string
+		wantErr bool
+	}{
+		{"", nil, false},
+		{"  Balance  ", []string{"Balance"}, false},
+		{"BlockHeaders 100 5", []string{"BlockHeaders", "100", "5"}, false},
+		{"BlockHeaders(100, 5)", []string{"BlockHeaders", "100", "5"}, false},
+		{`signmessage("bc1q", "hello, world")`, []string{"signmessage", "bc1q", "hello, world"}, false},
+		{`signmessage bc1q 'say "hi"'`, []string{"signmessage", "bc1q", `say "hi"`}, false},
+		{`signmessage bc1q "a \"b\" \\ c"`, []string{"signmessage", "bc1q", `a "b" \ c`}, false},
+		{`signmessage bc1q ""`, []string{"signmessage", "bc1q", ""}, false},
+		{`signmessage("bc1q`, nil, true},
+	}
+	for _, tt := range tests {
+		got, err := splitCommandLine(tt.line)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: error %v", tt.line, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: got %q", tt.line, got)
+		}
+	}
+}
+
+func TestCompleteCommand(t *testing.T) {
+	tests := []struct {
+		line string
+		pos  int
+		want string
+		ok   bool
+	}{
+		{"GetHis", 6, "GetHistory ", true},
+		{"gethis", 6, "GetHistory ", true},
+		{"Get", 3, "Get", true},
+		{"listu", 5, "listunspent ", true},
+		{"GetHis(x)", 6, "GetHistory(x)", true},
+		{"nosuch", 6, "", false},
+		{"GetHistory ad", 13, "", false},
+	}
+	for _, tt := range tests {
+		got, pos, ok := completeCommand(tt.line, tt.pos, '\t')
+		if ok != tt.ok || got != tt.want {
+			t.Errorf("%s: got %q %v", tt.line, got, ok)
+			continue
+		}
+		if ok && pos > len(got) {
+			t.Errorf("%s: pos %d", tt.line, pos)
+		}
+	}
+	if _, _, ok := completeCommand("GetHis", 6, 'x'); ok {
+		t.Error("completed on a key other than tab")
+	}
+}
+
+func TestConsole(t *testing.T) {
+	srv := electrumxtest.NewServer(&chaincfg.RegressionNetParams)
+	if err := srv.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Close()
+	srv.MineEmptyBlocks(5)
+
+	dir := t.TempDir()
+	flags := []string{"-net", "regtest", "-datadir", dir, "-server", srv.Addr() + ":t"}
+	var addrs []string
+	if code := goele(t, append(flags, "create"), "pw\npw\n", nil); code != 0 {
+		t.Fatalf("create exit %d", code)
+	}
+	if code := goele(t, append(flags, "listaddresses"), "pw\n", &addrs); code != 0 {
+		t.Fatalf("listaddresses exit %d", code)
+	}
+	decoded, _ := btcutil.DecodeAddress(addrs[0], &chaincfg.RegressionNetParams)
+	script, _ := txscript.PayToAddrScript(decoded)
+	fund := srv.Fund(script, 100000)
+	srv.MineBlock()
+	genesis := chaincfg.RegressionNetParams.GenesisHash.String()
+
+	input := strings.Join([]string{
+		"pw",
+		"Balance",
+		"GetHistory(\"" + addrs[0] + "\")",
+		"BlockHeaders 0 2",
+		"help GetHistory",
+		"nosuchcommand",
+		"getbalance",
+		"exit",
+		"ListAddresses",
+	}, "\n") + "\n"
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.WriteString(input)
+	w.Close()
+	defer r.Close()
+	var stdout, stderr bytes.Buffer
+	if code := run(append(flags, "console"), r, &stdout, &stderr); code != 0 {
+		t.Fatalf("console exit %d: %s", code, stderr.String())
+	}
+	out := stdout.String()
+	for _, want := range []string{
+		`"confirmed": 100000`,
+		`"tx_hash": "` + fund.TxHash().String() + `"`,
+		`"height": 0,`,
+		`"hash": "` + genesis + `"`,
+		`"prev_block": "` + genesis + `"`,
+		"GetHistory <address|scripthash>",
+		`error: unknown command "nosuchcommand"`,
+		`"confirmed": "0.001"`,
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("console output has no %s", want)
+		}
+	}
+	if strings.Contains(out, addrs[1]) {
+		t.Error("console ran a command after exit")
+	}
+	if t.Failed() {
+		t.Log(out)
+	}
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strconv"
+	"syscall"
+	"time"
+)
+
+// The daemon keeps the wallet synced and serves the JSON-RPC on localhost. The
+// RPC credentials and port are kept in the data dir so that scripts can find
+// them, as Electrum keeps rpcuser, rpcpassword and rpcport in its config.
+
+const DAEMON_FILE_NAME = "daemon.json"
+
+type daemonConfig struct {
+	RPCUser     string `json:"rpcuser"`
+	RPCPassword string `json:"rpcpassword"`
+	RPCPort     int    `json:"rpcport"`
+}
+
+func loadDaemonConfig(dataDir string) (*daemonConfig, error) {
+	dc := new(daemonConfig)
+	b, err := os.ReadFile(filepath.Join(dataDir, DAEMON_FILE_NAME))
+	if errors.Is(err, os.ErrNotExist) {
+		return dc, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err = json.Unmarshal(b, dc); err != nil {
+		return nil, fmt.Errorf("%s: %w", DAEMON_FILE_NAME, err)
+	}
+	return dc, nil
+}
+
+func (dc *daemonConfig) save(dataDir string) error {
+	b, err := json.MarshalIndent(dc, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(dataDir, DAEMON_FILE_NAME), b, 0600)
+}
+
+func randomPassword() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// daemonSettings merges the command flags into the saved daemon config,
+// generating a password on first use
+func (a *app) daemonSettings() (*daemonConfig, error) {
+	dc, err := loadDaemonConfig(a.cfg.DataDir)
+	if err != nil {
+		return nil, err
+	}
+	if user := a.flags.Lookup("rpcuser").Value.String(); user != "" {
+		dc.RPCUser = user
+	}
+	if dc.RPCUser == "" {
+		dc.RPCUser = "user"
+	}
+	if pw := a.flags.Lookup("rpcpassword").Value.String(); pw != "" {
+		dc.RPCPassword = pw
+	}
+	if dc.RPCPassword == "" {
+		if dc.RPCPassword, err = randomPassword(); err != nil {
+			return nil, err
+		}
+	}
+	port, err := strconv.Atoi(a.flags.Lookup("rpcport").Value.String())
+	if err != nil || port < 0 || port > 65535 {
+		return nil, errors.New("invalid rpcport")
+	}
+	if port != 0 {
+		dc.RPCPort = port
+	}
+	return dc, nil
+}
+
+// daemon serves the JSON-RPC until the stop method is called or the process
+// is interrupted. The headers and wallet were synced and subscribed for
+// notifications when the command started.
+func (a *app) daemon(_ []string) (any, error) {
+	dc, err := a.daemonSettings()
+	if err != nil {
+		return nil, err
+	}
+	ln, err := net.Listen("tcp", net.JoinHostPort("127.0.0.1", strconv.Itoa(dc.RPCPort)))
+	if err != nil {
+		return nil, err
+	}
+	dc.RPCPort = ln.Addr().(*net.TCPAddr).Port
+	if err = dc.save(a.cfg.DataDir); err != nil {
+		ln.Close()
+		return nil, err
+	}
+
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer cancel()
+	rpc := newRPCServer(a, dc.RPCUser, dc.RPCPassword, cancel)
+	srv := &http.Server{Handler: rpc, ReadHeaderTimeout: 10 * time.Second}
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, done := context.WithTimeout(context.Background(), 5*time.Second)
+		defer done()
+		srv.Shutdown(shutdownCtx)
+	}()
+
+	fmt.Fprintf(os.Stderr, "goele daemon listening on http://%s user %s, credentials in %s\n",
+		ln.Addr(), dc.RPCUser, filepath.Join(a.cfg.DataDir, DAEMON_FILE_NAME))
+	if err = srv.Serve(ln); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return nil, err
+	}
+	return "Daemon stopped", nil
+}
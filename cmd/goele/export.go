@@ -0,0 +1,79 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	"main/wallet"
+)
+
+// parseDay parses a YYYY-MM-DD date as the start of the UTC day
+func parseDay(s string) (time.Time, error) {
+	t, err := time.Parse(wallet.PriceDateLayout, s)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid date %q, want YYYY-MM-DD", s)
+	}
+	return t, nil
+}
+
+// exportOptions makes the export options from the command flags. The -to date
+// is included.
+func (a *app) exportOptions() (*wallet.ExportOptions, error) {
+	format, err := wallet.ParseExportFormat(a.flags.Lookup("format").Value.String())
+	if err != nil {
+		return nil, err
+	}
+	opts := &wallet.ExportOptions{
+		Format:   format,
+		Currency: a.flags.Lookup("currency").Value.String(),
+	}
+	if from := a.flags.Lookup("from").Value.String(); from != "" {
+		if opts.From, err = parseDay(from); err != nil {
+			return nil, err
+		}
+	}
+	if to := a.flags.Lookup("to").Value.String(); to != "" {
+		day, err := parseDay(to)
+		if err != nil {
+			return nil, err
+		}
+		opts.Until = day.AddDate(0, 0, 1)
+	}
+	for name, height := range map[string]*int64{"fromheight": &opts.FromHeight, "toheight": &opts.ToHeight} {
+		*height, err = strconv.ParseInt(a.flags.Lookup(name).Value.String(), 10, 64)
+		if err != nil || *height < 0 {
+			return nil, fmt.Errorf("invalid %s", name)
+		}
+	}
+	return opts, nil
+}
+
+func (a *app) export(args []string) (any, error) {
+	if len(args) != 0 {
+		return nil, errors.New("usage: export [flags]")
+	}
+	opts, err := a.exportOptions()
+	if err != nil {
+		return nil, err
+	}
+	path := a.flags.Lookup("o").Value.String()
+	if path == "" {
+		_, err = a.ec.GetWallet().ExportHistory(a.stdout, *opts)
+		return nil, err
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return nil, err
+	}
+	n, err := a.ec.GetWallet().ExportHistory(f, *opts)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return nil, err
+	}
+	return fmt.Sprintf("Exported %d transactions to %s", n, path), nil
+}
@@ -0,0 +1,209 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"main/wallet"
+)
+
+// Fiat valuation of the wallet history with the historical prices imported
+// into the wallet db, for tax reporting.
+
+func formatFiat(v float64) string {
+	return strconv.FormatFloat(v, 'f', 2, 64)
+}
+
+func (a *app) importPrices(args []string) (any, error) {
+	if len(args) != 1 {
+		return nil, errors.New("usage: importprices <file.csv>")
+	}
+	f, err := os.Open(args[0])
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	currency := a.flags.Lookup("currency").Value.String()
+	n, err := wallet.ImportPricesCSV(a.ec.GetWallet().HistoricalPrices(), f, currency)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", args[0], err)
+	}
+	return fmt.Sprintf("Imported %d prices", n), nil
+}
+
+type fiatHistoryItem struct {
+	Txid      string `json:"txid"`
+	Height    int64  `json:"height"`
+	BlockTime string `json:"block_time"`
+	Value     string `json:"value"`
+	Currency  string `json:"currency"`
+	Price     string `json:"price,omitempty"`
+	PriceDate string `json:"price_date,omitempty"`
+	FiatValue string `json:"fiat_value,omitempty"`
+	FiatFee   string `json:"fiat_fee,omitempty"`
+}
+
+type fiatHistoryResult []fiatHistoryItem
+
+func (h fiatHistoryResult) String() string {
+	var b strings.Builder
+	for i, item := range h {
+		if i > 0 {
+			b.WriteByte('\n')
+		}
+		fiat := "no price"
+		if item.FiatValue != "" {
+			fiat = item.FiatValue + " " + item.Currency
+		}
+		fmt.Fprintf(&b, "%s  %-20s %7d  %14s  %s", item.Txid, item.BlockTime,
+			item.Height, item.Value, fiat)
+	}
+	return b.String()
+}
+
+func (a *app) fiatHistory(_ []string) (any, error) {
+	currency := a.flags.Lookup("currency").Value.String()
+	txns, err := a.ec.GetWallet().FiatTransactions(currency)
+	if err != nil {
+		return nil, err
+	}
+	history := make(fiatHistoryResult, 0, len(txns))
+	for _, txn := range txns {
+		item := fiatHistoryItem{
+			Txid:      txn.Txid,
+			Height:    txn.Height,
+			BlockTime: txn.BlockTime.UTC().Format(time.RFC3339),
+			Value:     formatBTC(txn.Value),
+			Currency:  txn.Currency,
+		}
+		if txn.Priced() {
+			item.Price = formatFiat(txn.Price)
+			item.PriceDate = txn.PriceDate.Format(wallet.PriceDateLayout)
+			item.FiatValue = formatFiat(txn.FiatValue)
+			if txn.Fee > 0 {
+				item.FiatFee = formatFiat(txn.FiatFee)
+			}
+		}
+		history = append(history, item)
+	}
+	return history, nil
+}
+
+type lotItem struct {
+	Outpoint  string `json:"outpoint"`
+	Acquired  string `json:"acquired"`
+	Amount    string `json:"amount"`
+	CostBasis string `json:"cost_basis"`
+}
+
+type disposalItem struct {
+	Txid      string    `json:"txid"`
+	Height    int64     `json:"height"`
+	Disposed  string    `json:"disposed"`
+	Amount    string    `json:"amount"`
+	Proceeds  string    `json:"proceeds"`
+	CostBasis string    `json:"cost_basis"`
+	Gain      string    `json:"gain"`
+	Lots      []lotItem `json:"lots"`
+}
+
+type periodItem struct {
+	Start         string `json:"start"`
+	End           string `json:"end"`
+	Transactions  int    `json:"transactions"`
+	Received      string `json:"received"`
+	Sent          string `json:"sent"`
+	ReceivedValue string `json:"received_value"`
+	SentValue     string `json:"sent_value"`
+	Proceeds      string `json:"proceeds"`
+	CostBasis     string `json:"cost_basis"`
+	Gain          string `json:"gain"`
+}
+
+type gainsResult struct {
+	Currency  string         `json:"currency"`
+	Method    string         `json:"method"`
+	Disposals []disposalItem `json:"disposals"`
+	Holdings  []lotItem      `json:"holdings"`
+	Periods   []periodItem   `json:"periods"`
+	Gain      string         `json:"gain"`
+}
+
+func (r *gainsResult) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s realised gains in %s\n", r.Method, r.Currency)
+	for _, p := range r.Periods {
+		fmt.Fprintf(&b, "%s  %3d txs  received %s (%s)  sent %s (%s)  gain %s\n",
+			p.Start, p.Transactions, p.Received, p.ReceivedValue, p.Sent, p.SentValue, p.Gain)
+	}
+	fmt.Fprintf(&b, "total gain %s", r.Gain)
+	return b.String()
+}
+
+func makeLotItems(lots []wallet.Lot) []lotItem {
+	items := make([]lotItem, 0, len(lots))
+	for _, lot := range lots {
+		items = append(items, lotItem{
+			Outpoint:  fmt.Sprintf("%s:%d", lot.Txid, lot.Index),
+			Acquired:  lot.Acquired.UTC().Format(time.RFC3339),
+			Amount:    formatBTC(lot.Amount),
+			CostBasis: formatFiat(lot.CostBasis),
+		})
+	}
+	return items
+}
+
+func (a *app) gains(_ []string) (any, error) {
+	currency := a.flags.Lookup("currency").Value.String()
+	method, err := wallet.ParseLotMethod(a.flags.Lookup("method").Value.String())
+	if err != nil {
+		return nil, err
+	}
+	period, err := wallet.ParsePeriod(a.flags.Lookup("period").Value.String())
+	if err != nil {
+		return nil, err
+	}
+	report, err := a.ec.GetWallet().RealisedGains(currency, method, period)
+	if err != nil {
+		return nil, err
+	}
+	result := &gainsResult{
+		Currency:  report.Currency,
+		Method:    string(report.Method),
+		Disposals: make([]disposalItem, 0, len(report.Disposals)),
+		Holdings:  makeLotItems(report.Holdings),
+		Periods:   make([]periodItem, 0, len(report.Totals)),
+		Gain:      formatFiat(report.Gain),
+	}
+	for _, d := range report.Disposals {
+		result.Disposals = append(result.Disposals, disposalItem{
+			Txid:      d.Txid,
+			Height:    d.Height,
+			Disposed:  d.Disposed.UTC().Format(time.RFC3339),
+			Amount:    formatBTC(d.Amount),
+			Proceeds:  formatFiat(d.Proceeds),
+			CostBasis: formatFiat(d.CostBasis),
+			Gain:      formatFiat(d.Gain),
+			Lots:      makeLotItems(d.Lots),
+		})
+	}
+	for _, p := range report.Totals {
+		result.Periods = append(result.Periods, periodItem{
+			Start:         p.Start.Format(wallet.PriceDateLayout),
+			End:           p.End.Format(wallet.PriceDateLayout),
+			Transactions:  p.Transactions,
+			Received:      formatBTC(p.Received),
+			Sent:          formatBTC(p.Sent),
+			ReceivedValue: formatFiat(p.ReceivedValue),
+			SentValue:     formatFiat(p.SentValue),
+			Proceeds:      formatFiat(p.Proceeds),
+			CostBasis:     formatFiat(p.CostBasis),
+			Gain:          formatFiat(p.Gain),
+		})
+	}
+	return result, nil
+}
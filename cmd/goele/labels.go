@@ -0,0 +1,115 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"main/wallet"
+)
+
+// User labels of transactions, addresses, outputs and xpubs, moved between
+// wallets in the BIP329 format.
+
+func (a *app) setLabel(args []string) (any, error) {
+	if len(args) != 3 {
+		return nil, errors.New("usage: setlabel <type> <ref> <label>")
+	}
+	labelType, err := wallet.ParseLabelType(args[0])
+	if err != nil {
+		return nil, err
+	}
+	if err = a.ec.GetWallet().SetLabel(labelType, args[1], args[2]); err != nil {
+		return nil, err
+	}
+	if args[2] == "" {
+		return fmt.Sprintf("Removed the label of %s %s", labelType, args[1]), nil
+	}
+	return fmt.Sprintf("Labelled %s %s", labelType, args[1]), nil
+}
+
+type labelItem struct {
+	Type   string `json:"type"`
+	Ref    string `json:"ref"`
+	Label  string `json:"label"`
+	Origin string `json:"origin,omitempty"`
+}
+
+type labelsResult []labelItem
+
+func (l labelsResult) String() string {
+	var b strings.Builder
+	for i, item := range l {
+		if i > 0 {
+			b.WriteByte('\n')
+		}
+		fmt.Fprintf(&b, "%-6s %s  %s", item.Type, item.Ref, item.Label)
+	}
+	return b.String()
+}
+
+func (a *app) labels(_ []string) (any, error) {
+	labels, err := a.ec.GetWallet().Labels()
+	if err != nil {
+		return nil, err
+	}
+	var filter wallet.LabelType
+	if t := a.flags.Lookup("type").Value.String(); t != "" {
+		if filter, err = wallet.ParseLabelType(t); err != nil {
+			return nil, err
+		}
+	}
+	result := make(labelsResult, 0, len(labels))
+	for _, label := range labels {
+		if filter != "" && label.Type != filter {
+			continue
+		}
+		result = append(result, labelItem{
+			Type:   string(label.Type),
+			Ref:    label.Ref,
+			Label:  label.Label,
+			Origin: label.Origin,
+		})
+	}
+	return result, nil
+}
+
+func (a *app) importLabels(args []string) (any, error) {
+	if len(args) != 1 {
+		return nil, errors.New("usage: importlabels <file.jsonl>")
+	}
+	f, err := os.Open(args[0])
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	n, err := a.ec.GetWallet().ImportLabels(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", args[0], err)
+	}
+	return fmt.Sprintf("Imported %d labels", n), nil
+}
+
+func (a *app) exportLabels(args []string) (any, error) {
+	if len(args) != 0 {
+		return nil, errors.New("usage: exportlabels [flags]")
+	}
+	path := a.flags.Lookup("o").Value.String()
+	if path == "" {
+		_, err := a.ec.GetWallet().ExportLabels(a.stdout)
+		return nil, err
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return nil, err
+	}
+	n, err := a.ec.GetWallet().ExportLabels(f)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return nil, err
+	}
+	return fmt.Sprintf("Exported %d labels to %s", n, path), nil
+}
@@ -0,0 +1,136 @@
+package main
+
+// goele is the command line Electrum client
+//
+//	goele [flags] <command> [command flags] [args]
+//
+// Commands run against the wallet in the data dir. Those that need the
+// network connect to the server, sync the headers and the wallet first. The
+// result is written to stdout, as JSON with -json. Progress and diagnostics go
+// to stderr.
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+func usage(fs *flag.FlagSet) func() {
+	return func() {
+		w := fs.Output()
+		fmt.Fprintln(w, "usage: goele [flags] <command> [command flags] [args]")
+		fmt.Fprintln(w, "\ncommands:")
+		for _, cmd := range commands {
+			name := cmd.name
+			if cmd.args != "" {
+				name += " " + cmd.args
+			}
+			fmt.Fprintf(w, "  %-28s %s\n", name, cmd.help)
+		}
+		fmt.Fprintln(w, "\nflags:")
+		fs.PrintDefaults()
+	}
+}
+
+func parseFlags(args []string, stderr io.Writer) (*options, []string, error) {
+	opts := new(options)
+	fs := flag.NewFlagSet("goele", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.StringVar(&opts.coin, "coin", "btc", "coin name")
+	fs.StringVar(&opts.net, "net", "mainnet", "network type; mainnet, testnet, regtest")
+	fs.StringVar(&opts.datadir, "datadir", "", "wallet data directory (default <config dir>/goele/<coin>/<net>)")
+	fs.StringVar(&opts.server, "server", "", "ElectrumX server host:port:s for ssl or host:port:t for tcp")
+	fs.StringVar(&opts.proxy, "proxy", "", "SOCKS5 proxy host:port, e.g. 127.0.0.1:9050 for Tor")
+	fs.BoolVar(&opts.isolation, "torisolation", true, "use a separate Tor circuit for each connection")
+	fs.BoolVar(&opts.rates, "rates", false, "fetch exchange rates from the rate APIs")
+	fs.StringVar(&opts.ratesFile, "ratesfile", "", "JSON file of exchange rates {\"USD\": 43000, ...} used when the rate APIs fail or are not used")
+	fs.BoolVar(&opts.json, "json", false, "write results as JSON")
+	fs.Usage = usage(fs)
+	if err := fs.Parse(args); err != nil {
+		return nil, nil, err
+	}
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return nil, nil, flag.ErrHelp
+	}
+	return opts, fs.Args(), nil
+}
+
+// writeResult writes a command result as indented JSON, or as text using its
+// String method, one line per element for lists
+func writeResult(w io.Writer, result any, asJSON bool) error {
+	if result == nil {
+		return nil
+	}
+	if !asJSON {
+		switch r := result.(type) {
+		case string:
+			_, err := fmt.Fprintln(w, r)
+			return err
+		case []string:
+			_, err := fmt.Fprintln(w, strings.Join(r, "\n"))
+			return err
+		case fmt.Stringer:
+			_, err := fmt.Fprintln(w, r.String())
+			return err
+		}
+	}
+	b, err := json.MarshalIndent(result, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintln(w, string(b))
+	return err
+}
+
+func writeError(w io.Writer, err error, asJSON bool) {
+	if asJSON {
+		b, _ := json.Marshal(map[string]string{"error": err.Error()})
+		fmt.Fprintln(w, string(b))
+		return
+	}
+	fmt.Fprintln(w, "error:", err)
+}
+
+func run(args []string, stdin *os.File, stdout, stderr io.Writer) int {
+	opts, args, err := parseFlags(args, stderr)
+	if err != nil {
+		return 2
+	}
+	cmd := findCommand(args[0])
+	if cmd == nil {
+		writeError(stderr, fmt.Errorf("unknown command %q, see goele -h", args[0]), false)
+		return 2
+	}
+	cfg, err := makeConfig(opts)
+	if err != nil {
+		writeError(stderr, err, false)
+		return 2
+	}
+	a := newApp(cfg, newPasswordReader(stdin, stderr), stdout, opts.json)
+	result, err := a.execute(cmd, args[1:])
+	if err != nil {
+		if opts.json {
+			writeError(stdout, err, true)
+		} else {
+			writeError(stderr, err, false)
+		}
+		return 1
+	}
+	if err = writeResult(stdout, result, opts.json); err != nil {
+		writeError(stderr, err, false)
+		return 1
+	}
+	return 0
+}
+
+func main() {
+	// The client and wallet print progress to stdout. Send it to stderr so
+	// that stdout only has the command result.
+	stdout := os.Stdout
+	os.Stdout = os.Stderr
+	os.Exit(run(os.Args[1:], os.Stdin, stdout, os.Stderr))
+}
@@ -0,0 +1,409 @@
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"main/electrumx"
+	"main/electrumx/electrumxtest"
+
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/txscript"
+)
+
+func TestParseServer(t *testing.T) {
+	tests := []struct {
+		server  string
+		want    electrumx.ServerAddr
+		wantErr bool
+	}{
+		{"example.com:50002:s", electrumx.ServerAddr{Net: "ssl", Addr: "example.com:50002"}, false},
+		{"example.com:50001:t", electrumx.ServerAddr{Net: "tcp", Addr: "example.com:50001"}, false},
+		{"example.com:50002", electrumx.ServerAddr{Net: "ssl", Addr: "example.com:50002"}, false},
+		{"[::1]:50001:t", electrumx.ServerAddr{Net: "tcp", Addr: "[::1]:50001"}, false},
+		{"example.com", electrumx.ServerAddr{}, true},
+	}
+	for _, tt := range tests {
+		got, err := parseServer(tt.server)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: error %v", tt.server, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("%s: got %+v", tt.server, got)
+		}
+	}
+}
+
+func TestRatesFlags(t *testing.T) {
+	tests := []struct {
+		args     []string
+		disabled bool
+		sources  int
+	}{
+		{nil, true, 0},
+		{[]string{"-rates"}, false, 2},
+		{[]string{"-ratesfile", "rates.json"}, false, 1},
+		{[]string{"-rates", "-ratesfile", "rates.json"}, false, 3},
+	}
+	for _, tt := range tests {
+		args := append([]string{"-net", "regtest", "-datadir", t.TempDir()}, tt.args...)
+		opts, _, err := parseFlags(append(args, "getbalance"), new(bytes.Buffer))
+		if err != nil {
+			t.Fatal(err)
+		}
+		cfg, err := makeConfig(opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if cfg.DisableExchangeRates != tt.disabled || len(cfg.MakeWalletConfig().RateSources) != tt.sources {
+			t.Errorf("%v: disabled %v with %d sources", tt.args, cfg.DisableExchangeRates,
+				len(cfg.MakeWalletConfig().RateSources))
+		}
+	}
+}
+
+func TestAmounts(t *testing.T) {
+	for _, tt := range []struct {
+		s    string
+		sats int64
+	}{{"1", 1e8}, {"0.001", 100000}, {"0.00000001", 1}, {"21.5", 2150000000}} {
+		sats, err := parseAmount(tt.s)
+		if err != nil || sats != tt.sats {
+			t.Errorf("parseAmount(%s) = %d, %v", tt.s, sats, err)
+		}
+		if s := formatBTC(tt.sats); s != tt.s {
+			t.Errorf("formatBTC(%d) = %s", tt.sats, s)
+		}
+	}
+	for _, s := range []string{"", "abc", "0", "-1"} {
+		if _, err := parseAmount(s); err == nil {
+			t.Errorf("parseAmount(%q) succeeded", s)
+		}
+	}
+	if s := formatBTC(0); s != "0" {
+		t.Errorf("formatBTC(0) = %s", s)
+	}
+}
+
+// goele runs a command with the lines of input on stdin and decodes its JSON
+// result into v
+func goele(t *testing.T, args []string, input string, v any) int {
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.WriteString(input)
+	w.Close()
+	defer r.Close()
+	var stdout, stderr bytes.Buffer
+	code := run(append([]string{"-json"}, args...), r, &stdout, &stderr)
+	if v != nil && stdout.Len() > 0 {
+		if err = json.Unmarshal(stdout.Bytes(), v); err != nil {
+			t.Fatalf("%v: %v: %s", args, err, stdout.String())
+		}
+	}
+	return code
+}
+
+func TestCommands(t *testing.T) {
+	srv := electrumxtest.NewServer(&chaincfg.RegressionNetParams)
+	if err := srv.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Close()
+	srv.MineEmptyBlocks(5)
+
+	dir := t.TempDir()
+	flags := []string{"-net", "regtest", "-datadir", dir, "-server", srv.Addr() + ":t"}
+	cmd := func(args ...string) []string {
+		return append(append([]string(nil), flags...), args...)
+	}
+
+	var errRes struct{ Error string }
+	if code := goele(t, cmd("getbalance"), "pw\n", &errRes); code != 1 || errRes.Error == "" {
+		t.Fatalf("getbalance without a wallet: %d %+v", code, errRes)
+	}
+	if code := goele(t, cmd("create"), "pw\nother\n", &errRes); code != 1 || errRes.Error != "passwords do not match" {
+		t.Fatalf("create with mismatched passwords: %d %+v", code, errRes)
+	}
+
+	var created createResult
+	if code := goele(t, cmd("create"), "pw\npw\n", &created); code != 0 {
+		t.Fatalf("create exit %d", code)
+	}
+	if len(created.Seed) == 0 || created.Path != dir {
+		t.Fatalf("created %+v", created)
+	}
+	if code := goele(t, cmd("create"), "pw\npw\n", nil); code != 1 {
+		t.Fatal("created over an existing wallet")
+	}
+	if code := goele(t, cmd("load"), "wrong\n", nil); code != 1 {
+		t.Fatal("loaded with the wrong password")
+	}
+
+	var addr string
+	if code := goele(t, cmd("getnewaddress"), "pw\n", &addr); code != 0 {
+		t.Fatalf("getnewaddress exit %d", code)
+	}
+	var addrs []string
+	if code := goele(t, cmd("listaddresses"), "pw\n", &addrs); code != 0 || len(addrs) == 0 {
+		t.Fatalf("listaddresses exit %d: %v", code, addrs)
+	}
+
+	// fund the first address and sync
+	decoded, err := btcutil.DecodeAddress(addrs[0], &chaincfg.RegressionNetParams)
+	if err != nil {
+		t.Fatal(err)
+	}
+	script, err := txscript.PayToAddrScript(decoded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fund := srv.Fund(script, 150000)
+	srv.MineBlock()
+
+	var synced syncResult
+	if code := goele(t, cmd("sync"), "pw\n", &synced); code != 0 {
+		t.Fatalf("sync exit %d", code)
+	}
+	if synced.Height != 6 || synced.Balance.Confirmed != "0.0015" {
+		t.Fatalf("synced %+v %+v", synced, synced.Balance)
+	}
+
+	var balance balanceResult
+	if code := goele(t, cmd("getbalance"), "pw\n", &balance); code != 0 {
+		t.Fatalf("getbalance exit %d", code)
+	}
+	if balance.Confirmed != "0.0015" || balance.Unconfirmed != "0" {
+		t.Fatalf("balance %+v", balance)
+	}
+	var history []historyItem
+	if code := goele(t, cmd("history"), "pw\n", &history); code != 0 {
+		t.Fatalf("history exit %d", code)
+	}
+	if len(history) != 1 || history[0].Txid != fund.TxHash().String() || history[0].Value != "0.0015" {
+		t.Fatalf("history %+v", history)
+	}
+
+	// value the history with prices from the day before the regtest genesis
+	pricesFile := filepath.Join(dir, "prices.csv")
+	if err = os.WriteFile(pricesFile, []byte("date,price\n2011-02-01,1000000\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	var imported string
+	if code := goele(t, cmd("importprices", "-currency", "usd", pricesFile), "pw\n", &imported); code != 0 {
+		t.Fatalf("importprices exit %d", code)
+	}
+	var fiatHistory []fiatHistoryItem
+	if code := goele(t, cmd("fiathistory"), "pw\n", &fiatHistory); code != 0 {
+		t.Fatalf("fiathistory exit %d", code)
+	}
+	blockTime := chaincfg.RegressionNetParams.GenesisBlock.Header.Timestamp.Add(6 * 10 * time.Minute)
+	if len(fiatHistory) != 1 || fiatHistory[0].FiatValue != "1500.00" || fiatHistory[0].PriceDate != "2011-02-01" ||
+		fiatHistory[0].BlockTime != blockTime.UTC().Format(time.RFC3339) {
+		t.Fatalf("fiat history %+v", fiatHistory)
+	}
+	var gains gainsResult
+	if code := goele(t, cmd("gains", "-method", "lifo", "-period", "month"), "pw\n", &gains); code != 0 {
+		t.Fatalf("gains exit %d", code)
+	}
+	if gains.Method != "LIFO" || gains.Currency != "USD" || len(gains.Disposals) != 0 || len(gains.Holdings) != 1 ||
+		gains.Holdings[0].CostBasis != "1500.00" || len(gains.Periods) != 1 || gains.Periods[0].Start != "2011-02-01" {
+		t.Fatalf("gains %+v", gains)
+	}
+	if code := goele(t, cmd("gains", "-currency", "EUR"), "pw\n", &errRes); code != 1 {
+		t.Fatal("gains without prices")
+	}
+
+	var labelled string
+	if code := goele(t, cmd("setlabel", "tx", fund.TxHash().String(), "funding"), "pw\n", &labelled); code != 0 {
+		t.Fatalf("setlabel exit %d", code)
+	}
+	if code := goele(t, cmd("setlabel", "addr", "nosuchaddress", "x"), "pw\n", &errRes); code != 1 {
+		t.Fatal("labelled an invalid address")
+	}
+	labelsFile := filepath.Join(dir, "labels.jsonl")
+	if code := goele(t, cmd("exportlabels", "-o", labelsFile), "pw\n", &labelled); code != 0 {
+		t.Fatalf("exportlabels exit %d", code)
+	}
+	if b, err := os.ReadFile(labelsFile); err != nil ||
+		string(b) != `{"type":"tx","ref":"`+fund.TxHash().String()+`","label":"funding"}`+"\n" {
+		t.Fatalf("exported labels %q %v", b, err)
+	}
+	if code := goele(t, cmd("importlabels", labelsFile), "pw\n", &labelled); code != 0 || labelled != "Imported 1 labels" {
+		t.Fatalf("importlabels exit %d %s", code, labelled)
+	}
+	var labels []labelItem
+	if code := goele(t, cmd("labels", "-type", "tx"), "pw\n", &labels); code != 0 {
+		t.Fatalf("labels exit %d", code)
+	}
+	if len(labels) != 1 || labels[0].Label != "funding" {
+		t.Fatalf("labels %+v", labels)
+	}
+
+	var exported []map[string]any
+	if code := goele(t, cmd("export", "-format", "json", "-currency", "usd", "-from", "2011-02-02"), "pw\n", &exported); code != 0 {
+		t.Fatalf("export exit %d", code)
+	}
+	if len(exported) != 1 || exported[0]["txid"] != fund.TxHash().String() || exported[0]["confirmations"] != 1.0 ||
+		exported[0]["value"] != "0.00150000" || exported[0]["fiat_value"] != "1500.00" ||
+		exported[0]["label"] != "funding" {
+		t.Fatalf("exported %v", exported)
+	}
+	exportFile := filepath.Join(dir, "history.csv")
+	var exportedMsg string
+	if code := goele(t, cmd("export", "-o", exportFile, "-toheight", "5"), "pw\n", &exportedMsg); code != 0 {
+		t.Fatalf("export to file exit %d", code)
+	}
+	if b, err := os.ReadFile(exportFile); err != nil || string(b) != "txid,height,block_time,confirmations,status,value,fee,counterparties,label\n" {
+		t.Fatalf("exported csv %q %v", b, err)
+	}
+	if code := goele(t, cmd("export", "-from", "2011-2-2"), "pw\n", &errRes); code != 1 {
+		t.Fatal("export with an invalid date")
+	}
+
+	// coin control
+	outpoint := fund.TxHash().String() + ":0"
+	var coins []coinItem
+	if code := goele(t, cmd("listunspent"), "pw\n", &coins); code != 0 {
+		t.Fatalf("listunspent exit %d", code)
+	}
+	if len(coins) != 1 || coins[0].Outpoint != outpoint || coins[0].Address != addrs[0] ||
+		coins[0].Confirmations != 1 || coins[0].Frozen {
+		t.Fatalf("coins %+v", coins)
+	}
+	var froze string
+	if code := goele(t, cmd("freeze", outpoint), "pw\n", &froze); code != 0 || froze != "Froze 1 coins" {
+		t.Fatalf("freeze exit %d %s", code, froze)
+	}
+	payee := "bcrt1q3fx029uese6mrhvq68u4l6me49refj8maqxvfv"
+	if code := goele(t, cmd("send", "-coins", outpoint, payee, "0.001"), "pw\n", &errRes); code != 1 ||
+		!strings.Contains(errRes.Error, "frozen") {
+		t.Fatalf("sent a frozen coin: %d %+v", code, errRes)
+	}
+	if code := goele(t, cmd("unfreeze", addrs[0]), "pw\n", &froze); code != 0 || froze != "Unfroze 1 coins" {
+		t.Fatalf("unfreeze exit %d %s", code, froze)
+	}
+	var sent string
+	if code := goele(t, cmd("send", "-coins", outpoint, payee, "0.001"), "pw\n", &sent); code != 0 {
+		t.Fatalf("send exit %d", code)
+	}
+	if mempool := srv.Mempool(); len(mempool) != 1 || mempool[0].String() != sent {
+		t.Fatalf("sent %s, mempool %v", sent, mempool)
+	}
+
+	// pay many from the unconfirmed change, reviewing before broadcasting
+	payoutsFile := filepath.Join(dir, "payouts.csv")
+	if err = os.WriteFile(payoutsFile, []byte("address,amount\n"+payee+",0.0001\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	var review txReviewResult
+	if code := goele(t, cmd("paytomany", "-file", payoutsFile, "-feerate", "2", addrs[1], "!"), "pw\n", &review); code != 0 {
+		t.Fatalf("paytomany exit %d", code)
+	}
+	if review.Broadcast || len(review.Inputs) != 1 || len(review.Outputs) != 2 || review.FeeRate != 2 ||
+		len(srv.Mempool()) != 1 || review.Proposal == "" {
+		t.Fatalf("review %+v", review)
+	}
+	// the reviewed transaction locks the change until its proposal is cancelled
+	if code := goele(t, cmd("paytomany", payee, "0.0001"), "pw\n", &errRes); code != 1 {
+		t.Fatal("paytomany spent a locked coin")
+	}
+	if code := goele(t, cmd("cancelproposal", review.Proposal), "pw\n", nil); code != 0 {
+		t.Fatalf("cancelproposal exit %d", code)
+	}
+	if code := goele(t, cmd("paytomany", "-subtractfee", "0", "-opreturn", "6869", "-broadcast", payee, "0.0002"), "pw\n", &review); code != 0 {
+		t.Fatalf("paytomany -broadcast exit %d", code)
+	}
+	if mempool := srv.Mempool(); !review.Broadcast || len(mempool) != 2 || mempool[1].String() != review.Txid ||
+		len(review.Outputs) != 3 {
+		t.Fatalf("broadcast %+v, mempool %v", review, mempool)
+	}
+	if code := goele(t, cmd("paytomany", payee, "!", addrs[1], "!"), "pw\n", &errRes); code != 1 {
+		t.Fatal("paytomany with two maximum outputs")
+	}
+
+	// spend in steps with a proposal, which locks the only coin
+	var proposal proposalResult
+	if code := goele(t, cmd("propose", payee, "0.0001"), "pw\n", &proposal); code != 0 {
+		t.Fatalf("propose exit %d", code)
+	}
+	if proposal.Status != "unsigned" || proposal.Signed || len(proposal.Inputs) != 1 {
+		t.Fatalf("proposal %+v", proposal)
+	}
+	// with the input script for signing elsewhere
+	if script, err := hex.DecodeString(proposal.Inputs[0].Script); err != nil ||
+		outputAddress(script, &chaincfg.RegressionNetParams) != proposal.Inputs[0].Address {
+		t.Fatalf("proposal input %+v", proposal.Inputs[0])
+	}
+	if code := goele(t, cmd("propose", payee, "0.0001"), "pw\n", &errRes); code != 1 {
+		t.Fatal("proposed spending a locked coin")
+	}
+	if code := goele(t, cmd("listunspent"), "pw\n", &coins); code != 0 || len(coins) != 1 || coins[0].LockedBy != proposal.ID {
+		t.Fatalf("listunspent with a proposal %d %+v", code, coins)
+	}
+	var cancelled string
+	if code := goele(t, cmd("cancelproposal", proposal.ID), "pw\n", &cancelled); code != 0 {
+		t.Fatalf("cancelproposal exit %d", code)
+	}
+	if code := goele(t, cmd("propose", "-feerate", "3", payee, "0.0001"), "pw\n", &proposal); code != 0 {
+		t.Fatalf("propose after cancel exit %d", code)
+	}
+	if code := goele(t, cmd("broadcastproposal", proposal.ID), "pw\n", &errRes); code != 1 {
+		t.Fatal("broadcast an unsigned proposal")
+	}
+	if code := goele(t, cmd("signproposal", proposal.ID), "pw\n", &proposal); code != 0 || proposal.Status != "signed" {
+		t.Fatalf("signproposal exit %d %+v", code, proposal)
+	}
+	// with the broadcast payout, kept until it confirms
+	var proposals []proposalResult
+	if code := goele(t, cmd("proposals"), "pw\n", &proposals); code != 0 || len(proposals) != 2 {
+		t.Fatalf("proposals exit %d %+v", code, proposals)
+	}
+	for _, p := range proposals {
+		if p.ID == proposal.ID && p.Hex != proposal.Hex || p.ID != proposal.ID && p.Txid != review.Txid {
+			t.Fatalf("proposals %+v", proposals)
+		}
+	}
+	if code := goele(t, cmd("broadcastproposal", proposal.ID), "pw\n", &sent); code != 0 {
+		t.Fatalf("broadcastproposal exit %d", code)
+	}
+	if mempool := srv.Mempool(); len(mempool) != 3 || mempool[2].String() != sent || sent != proposal.Txid {
+		t.Fatalf("broadcast proposal %s, mempool %v", sent, mempool)
+	}
+	if code := goele(t, cmd("proposal", proposal.ID), "pw\n", &proposal); code != 0 || proposal.Status != "broadcast" {
+		t.Fatalf("proposal exit %d %+v", code, proposal)
+	}
+
+	// speed up the last payment by spending its change
+	var bumped string
+	if code := goele(t, cmd("bumpfee", sent), "pw\n", &bumped); code != 0 {
+		t.Fatalf("bumpfee exit %d", code)
+	}
+	if mempool := srv.Mempool(); len(mempool) != 4 || mempool[3].String() != bumped {
+		t.Fatalf("bumped %s, mempool %v", bumped, mempool)
+	}
+
+	var tip headersResult
+	if code := goele(t, cmd("headers"), "", &tip); code != 0 {
+		t.Fatalf("headers exit %d", code)
+	}
+	if hash, _ := srv.BlockHash(6); tip.Height != 6 || tip.Hash != hash.String() {
+		t.Fatalf("tip %+v", tip)
+	}
+
+	if code := goele(t, cmd("broadcast", "00"), "", &errRes); code != 1 {
+		t.Fatal("broadcast invalid transaction")
+	}
+	if code := goele(t, cmd("nosuchcommand"), "", nil); code != 2 {
+		t.Fatal("ran unknown command")
+	}
+}
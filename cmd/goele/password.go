@@ -0,0 +1,79 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"golang.org/x/term"
+)
+
+// passwordReader reads passwords from a terminal without echo, or a line at a
+// time from a pipe so that scripts can supply them on stdin
+type passwordReader struct {
+	in     *os.File
+	prompt io.Writer
+	lines  *bufio.Reader
+}
+
+func newPasswordReader(in *os.File, prompt io.Writer) *passwordReader {
+	return &passwordReader{in: in, prompt: prompt}
+}
+
+func (p *passwordReader) read(prompt string) (string, error) {
+	fmt.Fprint(p.prompt, prompt)
+	fd := int(p.in.Fd())
+	if term.IsTerminal(fd) {
+		b, err := term.ReadPassword(fd)
+		fmt.Fprintln(p.prompt)
+		if err != nil {
+			return "", err
+		}
+		return string(b), nil
+	}
+	line, err := p.lineReader().ReadString('\n')
+	if err != nil && (err != io.EOF || line == "") {
+		return "", err
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+// lineReader buffers stdin when it is not a terminal. Anything else reading
+// stdin lines, such as the console, shares it.
+func (p *passwordReader) lineReader() *bufio.Reader {
+	if p.lines == nil {
+		p.lines = bufio.NewReader(p.in)
+	}
+	return p.lines
+}
+
+// password asks for the wallet password
+func (p *passwordReader) password() (string, error) {
+	pw, err := p.read("Password: ")
+	if err != nil {
+		return "", err
+	}
+	if pw == "" {
+		return "", errors.New("empty password")
+	}
+	return pw, nil
+}
+
+// newPassword asks for a new wallet password twice
+func (p *passwordReader) newPassword() (string, error) {
+	pw, err := p.password()
+	if err != nil {
+		return "", err
+	}
+	confirm, err := p.read("Confirm password: ")
+	if err != nil {
+		return "", err
+	}
+	if pw != confirm {
+		return "", errors.New("passwords do not match")
+	}
+	return pw, nil
+}
@@ -0,0 +1,267 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"main/wallet"
+
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/txscript"
+)
+
+// Paying many recipients in one transaction. The transaction is built and
+// signed for review and only broadcast when asked.
+
+// sendMaxAmount in place of an amount sends all that is left, as in Electrum
+const sendMaxAmount = "!"
+
+// makeOutputs parses address and amount pairs into outputs. One amount may
+// be sendMaxAmount, which sets opts to send the maximum to that output.
+func (a *app) makeOutputs(pairs [][2]string, opts *wallet.SpendOptions) ([]wallet.TransactionOutput, error) {
+	w := a.ec.GetWallet()
+	outs := make([]wallet.TransactionOutput, 0, len(pairs))
+	for i, pair := range pairs {
+		addr, err := w.DecodeAddress(pair[0])
+		if err != nil || !addr.IsForNet(w.Params()) {
+			return nil, fmt.Errorf("invalid address %q", pair[0])
+		}
+		out := wallet.TransactionOutput{Address: addr}
+		if pair[1] == sendMaxAmount {
+			if opts.SendMax {
+				return nil, errors.New("only one output can send the maximum")
+			}
+			opts.SendMax = true
+			opts.MaxOutput = i
+		} else if out.Value, err = parseAmount(pair[1]); err != nil {
+			return nil, err
+		}
+		outs = append(outs, out)
+	}
+	return outs, nil
+}
+
+// readPayouts reads address,amount rows of a CSV file. A first row with the
+// column names and lines starting with # are skipped.
+func readPayouts(r io.Reader) ([][2]string, error) {
+	cr := csv.NewReader(r)
+	cr.Comment = '#'
+	cr.FieldsPerRecord = 2
+	cr.TrimLeadingSpace = true
+	var pairs [][2]string
+	for {
+		record, err := cr.Read()
+		if err == io.EOF {
+			return pairs, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if len(pairs) == 0 && strings.EqualFold(record[0], "address") {
+			continue
+		}
+		pairs = append(pairs, [2]string{strings.TrimSpace(record[0]), strings.TrimSpace(record[1])})
+	}
+}
+
+// txInputItem is a coin spent by a transaction. The value and script are
+// what a signer elsewhere needs to sign the input.
+type txInputItem struct {
+	Outpoint string `json:"outpoint"`
+	Address  string `json:"address"`
+	Value    string `json:"value"`
+	Script   string `json:"script"`
+}
+
+type txOutputItem struct {
+	Address string `json:"address"`
+	Value   string `json:"value"`
+	Change  bool   `json:"change,omitempty"`
+}
+
+// txReviewResult shows a built transaction for review before it is
+// broadcast
+type txReviewResult struct {
+	Txid      string         `json:"txid"`
+	Hex       string         `json:"hex"`
+	Inputs    []txInputItem  `json:"inputs"`
+	Outputs   []txOutputItem `json:"outputs"`
+	Fee       string         `json:"fee"`
+	Vsize     int64          `json:"vsize"`
+	FeeRate   uint64         `json:"fee_rate"`
+	Signed    bool           `json:"signed"`
+	Broadcast bool           `json:"broadcast"`
+	Proposal  string         `json:"proposal,omitempty"`
+}
+
+func (r *txReviewResult) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "txid %s\ninputs:\n", r.Txid)
+	for _, in := range r.Inputs {
+		if r.Signed {
+			fmt.Fprintf(&b, "  %s  %14s\n", in.Outpoint, in.Value)
+		} else {
+			// to sign elsewhere
+			fmt.Fprintf(&b, "  %s  %14s  script %s\n", in.Outpoint, in.Value, in.Script)
+		}
+	}
+	b.WriteString("outputs:\n")
+	for _, out := range r.Outputs {
+		change := ""
+		if out.Change {
+			change = "change"
+		}
+		fmt.Fprintf(&b, "  %-62s %14s  %s\n", out.Address, out.Value, change)
+	}
+	fmt.Fprintf(&b, "fee %s BTC for %d vB at %d sat/vB\n", r.Fee, r.Vsize, r.FeeRate)
+	switch {
+	case r.Broadcast:
+		b.WriteString("broadcast")
+	case r.Signed:
+		fmt.Fprintf(&b, "not broadcast, its coins are locked until it is broadcast or\n"+
+			"proposal %s is cancelled, the signed transaction is\n%s", r.Proposal, r.Hex)
+	default:
+		fmt.Fprintf(&b, "the unsigned transaction is\n%s", r.Hex)
+	}
+	return b.String()
+}
+
+// outputAddress is the address an output pays, the data of an OP_RETURN
+// output, or else the script in hex
+func outputAddress(pkScript []byte, params *chaincfg.Params) string {
+	if txscript.GetScriptClass(pkScript) == txscript.NullDataTy {
+		data, _ := txscript.PushedData(pkScript)
+		return "OP_RETURN " + hex.EncodeToString(bytes.Join(data, nil))
+	}
+	_, addrs, _, err := txscript.ExtractPkScriptAddrs(pkScript, params)
+	if err != nil || len(addrs) != 1 {
+		return hex.EncodeToString(pkScript)
+	}
+	return addrs[0].String()
+}
+
+func makeTxReview(res *wallet.SpendResult, params *chaincfg.Params) (*txReviewResult, error) {
+	var buf bytes.Buffer
+	if err := res.Tx.Serialize(&buf); err != nil {
+		return nil, err
+	}
+	r := &txReviewResult{
+		Txid:    res.Tx.TxHash().String(),
+		Hex:     hex.EncodeToString(buf.Bytes()),
+		Inputs:  make([]txInputItem, 0, len(res.Inputs)),
+		Outputs: make([]txOutputItem, 0, len(res.Tx.TxOut)),
+		Fee:     formatBTC(res.Fee),
+		Vsize:   res.Vsize,
+		FeeRate: res.FeePerByte,
+	}
+	for _, u := range res.Inputs {
+		r.Inputs = append(r.Inputs, txInputItem{
+			Outpoint: u.Op.String(),
+			Address:  outputAddress(u.ScriptPubkey, params),
+			Value:    formatBTC(u.Value),
+			Script:   hex.EncodeToString(u.ScriptPubkey),
+		})
+	}
+	for i, out := range res.Tx.TxOut {
+		r.Outputs = append(r.Outputs, txOutputItem{
+			Address: outputAddress(out.PkScript, params),
+			Value:   formatBTC(out.Value),
+			Change:  i == res.ChangeIndex,
+		})
+	}
+	return r, nil
+}
+
+// spendOptions makes the spend options from the command flags
+func (a *app) spendOptions() (*wallet.SpendOptions, error) {
+	opts := &wallet.SpendOptions{}
+	var err error
+	if s := a.flags.Lookup("coins").Value.String(); s != "" {
+		if opts.Coins, err = parseOutpoints(s); err != nil {
+			return nil, err
+		}
+	}
+	feeRate := a.flags.Lookup("feerate").Value.String()
+	if opts.FeePerByte, err = strconv.ParseUint(feeRate, 10, 64); err != nil {
+		return nil, fmt.Errorf("invalid fee rate %q", feeRate)
+	}
+	feeOutput := a.flags.Lookup("subtractfee").Value.String()
+	if opts.FeeOutput, err = strconv.Atoi(feeOutput); err != nil {
+		return nil, fmt.Errorf("invalid output index %q", feeOutput)
+	}
+	opts.SubtractFee = opts.FeeOutput >= 0
+	if s := a.flags.Lookup("opreturn").Value.String(); s != "" {
+		if opts.OpReturn, err = hex.DecodeString(s); err != nil {
+			return nil, fmt.Errorf("invalid OP_RETURN hex: %w", err)
+		}
+	}
+	return opts, nil
+}
+
+// spendArgs makes the outputs, fee level and options of a spend from the
+// address and amount arguments and the command flags
+func (a *app) spendArgs(args []string, usage string) ([]wallet.TransactionOutput, wallet.FeeLevel, *wallet.SpendOptions, error) {
+	var pairs [][2]string
+	if path := a.flags.Lookup("file").Value.String(); path != "" {
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, 0, nil, err
+		}
+		pairs, err = readPayouts(f)
+		f.Close()
+		if err != nil {
+			return nil, 0, nil, fmt.Errorf("%s: %w", path, err)
+		}
+	}
+	if len(args)%2 != 0 || len(args)+len(pairs) == 0 {
+		return nil, 0, nil, errors.New(usage)
+	}
+	for i := 0; i < len(args); i += 2 {
+		pairs = append(pairs, [2]string{args[i], args[i+1]})
+	}
+	level, err := parseFeeLevel(a.flags.Lookup("fee").Value.String())
+	if err != nil {
+		return nil, 0, nil, err
+	}
+	opts, err := a.spendOptions()
+	if err != nil {
+		return nil, 0, nil, err
+	}
+	outs, err := a.makeOutputs(pairs, opts)
+	if err != nil {
+		return nil, 0, nil, err
+	}
+	return outs, level, opts, nil
+}
+
+func (a *app) payToMany(args []string) (any, error) {
+	outs, level, opts, err := a.spendArgs(args, "usage: paytomany <address> <amount> [<address> <amount>...]")
+	if err != nil {
+		return nil, err
+	}
+	w := a.ec.GetWallet()
+	res, err := w.SpendMany(outs, level, *opts)
+	if err != nil {
+		return nil, err
+	}
+	review, err := makeTxReview(res, w.Params())
+	if err != nil {
+		return nil, err
+	}
+	review.Signed = true
+	review.Proposal = wallet.ProposalID(res.Tx)
+	if a.flags.Lookup("broadcast").Value.String() == "true" {
+		if _, err = w.BroadcastTx(res.Tx); err != nil {
+			return nil, err
+		}
+		review.Broadcast = true
+	}
+	return review, nil
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"main/wallet"
+
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/wire"
+)
+
+// Transaction proposals: spending in steps. A proposal is created unsigned
+// and saved in the wallet, locking its coins, then signed, here or by
+// another signer, and broadcast, or else cancelled.
+
+// proposalResult shows a proposal and its transaction
+type proposalResult struct {
+	ID      string `json:"id"`
+	Status  string `json:"status"`
+	Created string `json:"created"`
+	txReviewResult
+}
+
+func (r *proposalResult) String() string {
+	return fmt.Sprintf("proposal %s %s, created %s\n%s", r.ID, r.Status, r.Created, r.txReviewResult.String())
+}
+
+func makeProposalResult(p *wallet.TxProposal, params *chaincfg.Params) (*proposalResult, error) {
+	review, err := makeTxReview(&p.SpendResult, params)
+	if err != nil {
+		return nil, err
+	}
+	review.Signed = p.Status != wallet.ProposalUnsigned
+	review.Broadcast = p.Status == wallet.ProposalBroadcast
+	return &proposalResult{
+		ID:             p.ID,
+		Status:         string(p.Status),
+		Created:        p.Created.UTC().Format(time.RFC3339),
+		txReviewResult: *review,
+	}, nil
+}
+
+type proposalsResult []*proposalResult
+
+func (r proposalsResult) String() string {
+	var b strings.Builder
+	for i, p := range r {
+		if i > 0 {
+			b.WriteByte('\n')
+		}
+		fmt.Fprintf(&b, "%s  %-9s  %s  %d in  %d out  fee %s", p.ID, p.Status, p.Created,
+			len(p.Inputs), len(p.Outputs), p.Fee)
+	}
+	return b.String()
+}
+
+func (a *app) propose(args []string) (any, error) {
+	outs, level, opts, err := a.spendArgs(args, "usage: propose <address> <amount> [<address> <amount>...]")
+	if err != nil {
+		return nil, err
+	}
+	w := a.ec.GetWallet()
+	p, err := w.CreateProposal(outs, level, *opts)
+	if err != nil {
+		return nil, err
+	}
+	return makeProposalResult(p, w.Params())
+}
+
+func (a *app) listProposals(_ []string) (any, error) {
+	w := a.ec.GetWallet()
+	proposals, err := w.Proposals()
+	if err != nil {
+		return nil, err
+	}
+	result := make(proposalsResult, 0, len(proposals))
+	for i := range proposals {
+		p, err := makeProposalResult(&proposals[i], w.Params())
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, p)
+	}
+	return result, nil
+}
+
+func (a *app) showProposal(args []string) (any, error) {
+	if len(args) != 1 {
+		return nil, errors.New("usage: proposal <id>")
+	}
+	w := a.ec.GetWallet()
+	p, err := w.Proposal(args[0])
+	if err != nil {
+		return nil, err
+	}
+	return makeProposalResult(p, w.Params())
+}
+
+// decodeTx decodes a hex encoded transaction
+func decodeTx(s string) (*wire.MsgTx, error) {
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		return nil, fmt.Errorf("invalid transaction hex: %w", err)
+	}
+	tx := wire.NewMsgTx(wire.TxVersion)
+	if err = tx.Deserialize(bytes.NewReader(b)); err != nil {
+		return nil, fmt.Errorf("invalid transaction: %w", err)
+	}
+	return tx, nil
+}
+
+func (a *app) signProposal(args []string) (any, error) {
+	if len(args) != 1 {
+		return nil, errors.New("usage: signproposal <id>")
+	}
+	w := a.ec.GetWallet()
+	var p *wallet.TxProposal
+	var err error
+	if s := a.flags.Lookup("signed").Value.String(); s != "" {
+		var tx *wire.MsgTx
+		if tx, err = decodeTx(s); err != nil {
+			return nil, err
+		}
+		p, err = w.ImportSignedProposal(args[0], tx)
+	} else {
+		p, err = w.SignProposal(args[0])
+	}
+	if err != nil {
+		return nil, err
+	}
+	return makeProposalResult(p, w.Params())
+}
+
+func (a *app) broadcastProposal(args []string) (any, error) {
+	if len(args) != 1 {
+		return nil, errors.New("usage: broadcastproposal <id>")
+	}
+	txid, err := a.ec.GetWallet().BroadcastProposal(args[0])
+	if err != nil {
+		return nil, err
+	}
+	return txid.String(), nil
+}
+
+func (a *app) cancelProposal(args []string) (any, error) {
+	if len(args) != 1 {
+		return nil, errors.New("usage: cancelproposal <id>")
+	}
+	if err := a.ec.GetWallet().CancelProposal(args[0]); err != nil {
+		return nil, err
+	}
+	return fmt.Sprintf("Cancelled proposal %s", args[0]), nil
+}
@@ -0,0 +1,809 @@
+package main
+
+import (
+	"bytes"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"main/electrumx"
+	"main/wallet"
+
+	"github.com/btcsuite/btcd/btcutil"
+)
+
+// The JSON-RPC 2.0 methods are named as Electrum's commands and return the
+// same shapes so that scripts written for the Electrum daemon work unchanged.
+// Amounts are BTC decimal strings as Electrum returns them.
+
+const goeleVersion = "0.1.0"
+
+// JSON-RPC error codes
+const (
+	rpcParseError     = -32700
+	rpcInvalidRequest = -32600
+	rpcMethodNotFound = -32601
+	rpcInvalidParams  = -32602
+	rpcServerError    = -32000
+)
+
+type rpcRequest struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params"`
+}
+
+type rpcError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *rpcError) Error() string {
+	return e.Message
+}
+
+type rpcResponse struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id"`
+	Result  any             `json:"result"`
+	Error   *rpcError       `json:"error,omitempty"`
+}
+
+// rpcParams are the method params by name. Positional params are named in the
+// order of the method's params list.
+type rpcParams map[string]json.RawMessage
+
+func invalidParams(format string, a ...any) error {
+	return &rpcError{Code: rpcInvalidParams, Message: fmt.Sprintf(format, a...)}
+}
+
+func (p rpcParams) optString(name string) (string, bool, error) {
+	raw, ok := p[name]
+	if !ok || string(raw) == "null" {
+		return "", false, nil
+	}
+	var s string
+	if err := json.Unmarshal(raw, &s); err != nil {
+		// Electrum accepts numbers for amounts
+		var n json.Number
+		if json.Unmarshal(raw, &n) != nil {
+			return "", false, invalidParams("%s: expected a string", name)
+		}
+		s = n.String()
+	}
+	return s, true, nil
+}
+
+func (p rpcParams) string(name string) (string, error) {
+	s, ok, err := p.optString(name)
+	if err != nil {
+		return "", err
+	}
+	if !ok {
+		return "", invalidParams("missing param %s", name)
+	}
+	return s, nil
+}
+
+type rpcMethod struct {
+	name   string
+	params []string // required params first, then optional
+	help   string
+	run    func(s *rpcServer, p rpcParams) (any, error)
+}
+
+// rpcMethods is set in init as help refers to it
+var rpcMethods []*rpcMethod
+
+func init() {
+	rpcMethods = []*rpcMethod{
+		{name: "version", help: "Return the goele version.", run: (*rpcServer).version},
+		{name: "getinfo", help: "Return network and server information.", run: (*rpcServer).getInfo},
+		{name: "help", params: []string{"command"}, help: "List the commands, or show the help for one.", run: (*rpcServer).help},
+		{name: "stop", help: "Stop the daemon.", run: (*rpcServer).stop},
+		{name: "is_synchronized", help: "Return true if the wallet is synced with the server.", run: (*rpcServer).isSynchronized},
+		{name: "getbalance", help: "Return the balance of the wallet.", run: (*rpcServer).getBalance},
+		{name: "listaddresses", help: "List the wallet addresses.", run: (*rpcServer).listAddresses},
+		{name: "getunusedaddress", help: "Return the first unused receive address.", run: (*rpcServer).getUnusedAddress},
+		{name: "createnewaddress", help: "Create a new receive address beyond the gap limit.", run: (*rpcServer).createNewAddress},
+		{name: "listunspent", help: "List the unspent outputs of the wallet.", run: (*rpcServer).listUnspent},
+		{name: "history", help: "Return the wallet transaction history.", run: (*rpcServer).history},
+		{name: "onchain_history", help: "Return the wallet transaction history.", run: (*rpcServer).history},
+		{name: "getaddresshistory", params: []string{"address"}, help: "Return the server history of any address.", run: (*rpcServer).getAddressHistory},
+		{name: "gettransaction", params: []string{"txid"}, help: "Return a hex encoded transaction from the server.", run: (*rpcServer).getTransaction},
+		{name: "broadcast", params: []string{"tx"}, help: "Broadcast a hex encoded signed transaction.", run: (*rpcServer).broadcast},
+		{name: "payto", params: []string{"destination", "amount", "fee", "feerate", "from_coins"}, help: "Build and sign a transaction paying an amount in BTC to an address and return its hex without broadcasting it. An amount of ! sends the maximum. fee is in BTC, feerate in sat/vB, from_coins is a comma separated list of txid:index coins to spend.", run: (*rpcServer).payTo},
+		{name: "paytomany", params: []string{"outputs", "feelevel", "feerate", "from_coins"}, help: "Build and sign a transaction paying a list of [address, amount] outputs and return its hex without broadcasting it. An amount of ! sends the maximum. feerate is in sat/vB.", run: (*rpcServer).payToMany},
+		{name: "createproposal", params: []string{"outputs", "feelevel", "feerate", "from_coins"}, help: "Create an unsigned transaction proposal paying a list of [address, amount] outputs, locking its coins.", run: (*rpcServer).createProposal},
+		{name: "listproposals", help: "List the transaction proposals.", run: (*rpcServer).listProposals},
+		{name: "getproposal", params: []string{"id"}, help: "Return a transaction proposal.", run: (*rpcServer).getProposal},
+		{name: "signproposal", params: []string{"id", "tx"}, help: "Sign a proposal with the wallet keys, or take tx, the proposal transaction signed elsewhere.", run: (*rpcServer).signProposal},
+		{name: "broadcastproposal", params: []string{"id"}, help: "Broadcast a signed proposal and return the txid.", run: (*rpcServer).broadcastProposal},
+		{name: "cancelproposal", params: []string{"id"}, help: "Cancel a proposal, unlocking its coins.", run: (*rpcServer).cancelProposal},
+		{name: "freeze", params: []string{"address"}, help: "Freeze the coins at a wallet address.", run: (*rpcServer).freeze},
+		{name: "unfreeze", params: []string{"address"}, help: "Unfreeze the coins at a wallet address.", run: (*rpcServer).unfreeze},
+		{name: "freeze_utxo", params: []string{"coin"}, help: "Freeze a txid:index coin.", run: (*rpcServer).freezeUtxo},
+		{name: "unfreeze_utxo", params: []string{"coin"}, help: "Unfreeze a txid:index coin.", run: (*rpcServer).unfreezeUtxo},
+		{name: "setlabel", params: []string{"key", "label"}, help: "Label a txid or an address. An empty label removes it.", run: (*rpcServer).setLabel},
+		{name: "signmessage", params: []string{"address", "message"}, help: "Sign a message with the key of a wallet address.", run: (*rpcServer).signMessage},
+		{name: "verifymessage", params: []string{"address", "signature", "message"}, help: "Verify a signed message.", run: (*rpcServer).verifyMessage},
+		{name: "validateaddress", params: []string{"address"}, help: "Check an address is valid for the network.", run: (*rpcServer).validateAddress},
+		{name: "ismine", params: []string{"address"}, help: "Check an address belongs to the wallet.", run: (*rpcServer).isMine},
+		{name: "getfeerate", help: "Return the normal fee rate in sat/kvB.", run: (*rpcServer).getFeeRate},
+	}
+}
+
+func findRPCMethod(name string) *rpcMethod {
+	for _, m := range rpcMethods {
+		if m.name == name {
+			return m
+		}
+	}
+	return nil
+}
+
+// rpcServer serves the JSON-RPC with HTTP basic auth. Calls are run one at a
+// time as the wallet and node are not safe for concurrent commands.
+type rpcServer struct {
+	app      *app
+	user     []byte
+	password []byte
+	stopFn   func()
+
+	mtx sync.Mutex
+}
+
+func newRPCServer(a *app, user, password string, stop func()) *rpcServer {
+	return &rpcServer{
+		app:      a,
+		user:     []byte(user),
+		password: []byte(password),
+		stopFn:   stop,
+	}
+}
+
+func (s *rpcServer) authorized(r *http.Request) bool {
+	user, pw, ok := r.BasicAuth()
+	if !ok {
+		return false
+	}
+	userOK := subtle.ConstantTimeCompare([]byte(user), s.user) == 1
+	pwOK := subtle.ConstantTimeCompare([]byte(pw), s.password) == 1
+	return userOK && pwOK
+}
+
+func (s *rpcServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !s.authorized(r) {
+		w.Header().Set("WWW-Authenticate", `Basic realm="goele"`)
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	var req rpcRequest
+	var resp *rpcResponse
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<20)).Decode(&req); err != nil {
+		resp = &rpcResponse{Error: &rpcError{Code: rpcParseError, Message: err.Error()}}
+	} else {
+		resp = s.call(&req)
+	}
+	resp.JSONRPC = "2.0"
+	if resp.ID == nil {
+		resp.ID = json.RawMessage("null")
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+func (s *rpcServer) call(req *rpcRequest) *rpcResponse {
+	resp := &rpcResponse{ID: req.ID}
+	if req.Method == "" {
+		resp.Error = &rpcError{Code: rpcInvalidRequest, Message: "missing method"}
+		return resp
+	}
+	m := findRPCMethod(req.Method)
+	if m == nil {
+		resp.Error = &rpcError{Code: rpcMethodNotFound, Message: fmt.Sprintf("unknown method %q", req.Method)}
+		return resp
+	}
+	params, err := m.parseParams(req.Params)
+	if err == nil {
+		s.mtx.Lock()
+		resp.Result, err = m.run(s, params)
+		s.mtx.Unlock()
+	}
+	if err != nil {
+		var rpcErr *rpcError
+		if !errors.As(err, &rpcErr) {
+			rpcErr = &rpcError{Code: rpcServerError, Message: err.Error()}
+		}
+		resp.Result = nil
+		resp.Error = rpcErr
+	}
+	return resp
+}
+
+// parseParams accepts params as a list in the order of the method params or
+// as an object of named params
+func (m *rpcMethod) parseParams(raw json.RawMessage) (rpcParams, error) {
+	params := make(rpcParams)
+	if len(raw) == 0 || string(raw) == "null" {
+		return params, nil
+	}
+	var list []json.RawMessage
+	if err := json.Unmarshal(raw, &list); err == nil {
+		if len(list) > len(m.params) {
+			return nil, invalidParams("%s takes at most %d params", m.name, len(m.params))
+		}
+		for i, v := range list {
+			params[m.params[i]] = v
+		}
+		return params, nil
+	}
+	if err := json.Unmarshal(raw, &params); err != nil {
+		return nil, invalidParams("params must be a list or an object")
+	}
+	for name := range params {
+		if !contains(m.params, name) {
+			return nil, invalidParams("%s has no param %s", m.name, name)
+		}
+	}
+	return params, nil
+}
+
+// decodeAddress parses an address for the wallet network
+func (s *rpcServer) decodeAddress(p rpcParams) (btcutil.Address, error) {
+	str, err := p.string("address")
+	if err != nil {
+		return nil, err
+	}
+	w := s.app.ec.GetWallet()
+	addr, err := w.DecodeAddress(str)
+	if err != nil || !addr.IsForNet(w.Params()) {
+		return nil, invalidParams("invalid address %s", str)
+	}
+	return addr, nil
+}
+
+// tipHeight returns the height of the server chain tip
+func (s *rpcServer) tipHeight() (int64, error) {
+	tip, err := s.app.ec.GetNode().SubscribeHeaders()
+	if err != nil {
+		return 0, err
+	}
+	return int64(tip.Height), nil
+}
+
+func (s *rpcServer) version(_ rpcParams) (any, error) {
+	return goeleVersion, nil
+}
+
+func (s *rpcServer) connected() bool {
+	sc := s.app.ec.GetNode().GetServerConn()
+	return sc != nil && sc.SvrCtx.Err() == nil
+}
+
+func (s *rpcServer) getInfo(_ rpcParams) (any, error) {
+	node := s.app.ec.GetNode()
+	info := map[string]any{
+		"version":    goeleVersion,
+		"path":       s.app.cfg.DataDir,
+		"network":    s.app.cfg.Params.Name,
+		"connected":  s.connected(),
+		"fee_per_kb": s.app.ec.GetWallet().GetFeePerByte(wallet.NORMAL) * 1000,
+	}
+	if info["connected"] == true {
+		info["server"] = node.GetServerConn().Addr.String()
+		height, err := s.tipHeight()
+		if err != nil {
+			return nil, err
+		}
+		info["blockchain_height"] = height
+		info["server_height"] = height
+	}
+	return info, nil
+}
+
+func (s *rpcServer) help(p rpcParams) (any, error) {
+	name, ok, err := p.optString("command")
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		names := make([]string, 0, len(rpcMethods))
+		for _, m := range rpcMethods {
+			names = append(names, m.name)
+		}
+		sort.Strings(names)
+		return names, nil
+	}
+	m := findRPCMethod(name)
+	if m == nil {
+		return nil, invalidParams("unknown command %s", name)
+	}
+	usage := m.name
+	if len(m.params) > 0 {
+		usage += " " + strings.Join(m.params, " ")
+	}
+	return usage + "\n" + m.help, nil
+}
+
+func (s *rpcServer) stop(_ rpcParams) (any, error) {
+	// shut down after the response is written
+	time.AfterFunc(100*time.Millisecond, s.stopFn)
+	return "Daemon stopped", nil
+}
+
+func (s *rpcServer) isSynchronized(_ rpcParams) (any, error) {
+	return s.connected(), nil
+}
+
+func (s *rpcServer) getBalance(_ rpcParams) (any, error) {
+	confirmed, unconfirmed := s.app.ec.GetWallet().Balance()
+	balance := map[string]string{"confirmed": formatBTC(confirmed)}
+	if unconfirmed != 0 {
+		balance["unconfirmed"] = formatBTC(unconfirmed)
+	}
+	return balance, nil
+}
+
+func (s *rpcServer) listAddresses(_ rpcParams) (any, error) {
+	return s.app.listAddresses(nil)
+}
+
+func (s *rpcServer) getUnusedAddress(_ rpcParams) (any, error) {
+	return s.app.ec.GetWallet().CurrentAddress(wallet.EXTERNAL).String(), nil
+}
+
+func (s *rpcServer) createNewAddress(_ rpcParams) (any, error) {
+	return s.app.getNewAddress(nil)
+}
+
+type rpcUnspent struct {
+	Address     string `json:"address"`
+	Value       string `json:"value"`
+	PrevoutHash string `json:"prevout_hash"`
+	PrevoutN    uint32 `json:"prevout_n"`
+	Height      int64  `json:"height"`
+	Coinbase    bool   `json:"coinbase"`
+	Frozen      bool   `json:"frozen"`
+	Label       string `json:"label"`
+}
+
+func (s *rpcServer) listUnspent(_ rpcParams) (any, error) {
+	coins, err := s.app.ec.GetWallet().ListUnspentOutputs()
+	if err != nil {
+		return nil, err
+	}
+	list := make([]rpcUnspent, 0, len(coins))
+	for _, coin := range coins {
+		var address string
+		if coin.Address != nil {
+			address = coin.Address.String()
+		}
+		list = append(list, rpcUnspent{
+			Address:     address,
+			Value:       formatBTC(coin.Value),
+			PrevoutHash: coin.Op.Hash.String(),
+			PrevoutN:    coin.Op.Index,
+			Height:      coin.AtHeight,
+			Frozen:      coin.Frozen,
+			Label:       coin.Label,
+		})
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].Height != list[j].Height {
+			return list[i].Height < list[j].Height
+		}
+		if list[i].PrevoutHash != list[j].PrevoutHash {
+			return list[i].PrevoutHash < list[j].PrevoutHash
+		}
+		return list[i].PrevoutN < list[j].PrevoutN
+	})
+	return list, nil
+}
+
+type rpcHistoryItem struct {
+	Txid          string `json:"txid"`
+	Height        int64  `json:"height"`
+	Confirmations int64  `json:"confirmations"`
+	Timestamp     int64  `json:"timestamp"`
+	Date          string `json:"date"`
+	BcValue       string `json:"bc_value"`
+	Incoming      bool   `json:"incoming"`
+	FeeSat        *int64 `json:"fee_sat"`
+	Label         string `json:"label"`
+}
+
+func (s *rpcServer) history(_ rpcParams) (any, error) {
+	w := s.app.ec.GetWallet()
+	txns, err := w.Transactions()
+	if err != nil {
+		return nil, err
+	}
+	tip, err := s.tipHeight()
+	if err != nil {
+		return nil, err
+	}
+	sort.SliceStable(txns, func(i, j int) bool {
+		return txns[i].Timestamp.Before(txns[j].Timestamp)
+	})
+	items := make([]rpcHistoryItem, 0, len(txns))
+	for _, txn := range txns {
+		item := rpcHistoryItem{
+			Txid:      txn.Txid,
+			Height:    txn.Height,
+			Timestamp: txn.Timestamp.Unix(),
+			Date:      txn.Timestamp.UTC().Format("2006-01-02 15:04"),
+			BcValue:   formatBTC(txn.Value),
+			Incoming:  txn.Value > 0,
+			Label:     w.Label(wallet.LabelTx, txn.Txid),
+		}
+		if txn.Height > 0 && tip >= txn.Height {
+			item.Confirmations = tip - txn.Height + 1
+		}
+		if txn.Fee > 0 {
+			fee := txn.Fee
+			item.FeeSat = &fee
+		}
+		items = append(items, item)
+	}
+	return map[string]any{"transactions": items}, nil
+}
+
+func (s *rpcServer) getAddressHistory(p rpcParams) (any, error) {
+	addr, err := s.decodeAddress(p)
+	if err != nil {
+		return nil, err
+	}
+	history, err := s.app.ec.GetAddressHistory(addr)
+	if err != nil {
+		return nil, err
+	}
+	if history == nil {
+		history = electrumx.HistoryResult{}
+	}
+	return history, nil
+}
+
+func (s *rpcServer) getTransaction(p rpcParams) (any, error) {
+	txid, err := p.string("txid")
+	if err != nil {
+		return nil, err
+	}
+	if b, err := hex.DecodeString(txid); err != nil || len(b) != 32 {
+		return nil, invalidParams("invalid txid %s", txid)
+	}
+	return s.app.ec.GetRawTransaction(txid)
+}
+
+func (s *rpcServer) broadcast(p rpcParams) (any, error) {
+	tx, err := p.string("tx")
+	if err != nil {
+		return nil, err
+	}
+	return s.app.broadcast([]string{tx})
+}
+
+// payTo builds and signs a transaction paying destination, as Electrum's
+// payto, and returns its hex without broadcasting it
+func (s *rpcServer) payTo(p rpcParams) (any, error) {
+	dest, err := p.string("destination")
+	if err != nil {
+		return nil, err
+	}
+	amount, err := p.string("amount")
+	if err != nil {
+		return nil, err
+	}
+	outs, level, opts, err := s.spendOptions([][2]string{{dest, amount}}, p)
+	if err != nil {
+		return nil, err
+	}
+	return s.signSpend(outs, level, opts)
+}
+
+// spendParams makes the outputs, fee level and options of a spend from a
+// list of [address, amount] outputs and the optional params read by
+// spendOptions
+func (s *rpcServer) spendParams(p rpcParams) ([]wallet.TransactionOutput, wallet.FeeLevel, *wallet.SpendOptions, error) {
+	raw, ok := p["outputs"]
+	if !ok {
+		return nil, 0, nil, invalidParams("missing param outputs")
+	}
+	var list [][]json.RawMessage
+	if err := json.Unmarshal(raw, &list); err != nil || len(list) == 0 {
+		return nil, 0, nil, invalidParams("outputs: expected a list of [address, amount]")
+	}
+	pairs := make([][2]string, 0, len(list))
+	for _, item := range list {
+		if len(item) != 2 {
+			return nil, 0, nil, invalidParams("outputs: expected a list of [address, amount]")
+		}
+		pair := rpcParams{"address": item[0], "amount": item[1]}
+		addr, err := pair.string("address")
+		if err != nil {
+			return nil, 0, nil, err
+		}
+		amount, err := pair.string("amount")
+		if err != nil {
+			return nil, 0, nil, err
+		}
+		pairs = append(pairs, [2]string{addr, amount})
+	}
+	return s.spendOptions(pairs, p)
+}
+
+// spendOptions makes the outputs of address and amount pairs and the fee
+// level and options from the optional feelevel, fee in BTC, feerate in
+// sat/vB and from_coins params
+func (s *rpcServer) spendOptions(pairs [][2]string, p rpcParams) ([]wallet.TransactionOutput, wallet.FeeLevel, *wallet.SpendOptions, error) {
+	opts := &wallet.SpendOptions{}
+	outs, err := s.app.makeOutputs(pairs, opts)
+	if err != nil {
+		return nil, 0, nil, invalidParams("%v", err)
+	}
+	level := wallet.NORMAL
+	if l, ok, err := p.optString("feelevel"); err != nil {
+		return nil, 0, nil, err
+	} else if ok {
+		if level, err = parseFeeLevel(l); err != nil {
+			return nil, 0, nil, invalidParams("%v", err)
+		}
+	}
+	if f, ok, err := p.optString("fee"); err != nil {
+		return nil, 0, nil, err
+	} else if ok {
+		if opts.Fee, err = parseAmount(f); err != nil {
+			return nil, 0, nil, invalidParams("invalid fee %s", f)
+		}
+	}
+	if r, ok, err := p.optString("feerate"); err != nil {
+		return nil, 0, nil, err
+	} else if ok {
+		if opts.FeePerByte, err = strconv.ParseUint(r, 10, 64); err != nil {
+			return nil, 0, nil, invalidParams("invalid fee rate %s", r)
+		}
+	}
+	if c, ok, err := p.optString("from_coins"); err != nil {
+		return nil, 0, nil, err
+	} else if ok {
+		if opts.Coins, err = parseOutpoints(c); err != nil {
+			return nil, 0, nil, invalidParams("%v", err)
+		}
+	}
+	return outs, level, opts, nil
+}
+
+// signSpend builds and signs a transaction paying the outputs and returns
+// its hex
+func (s *rpcServer) signSpend(outs []wallet.TransactionOutput, level wallet.FeeLevel, opts *wallet.SpendOptions) (any, error) {
+	res, err := s.app.ec.GetWallet().SpendMany(outs, level, *opts)
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	if err = res.Tx.Serialize(&buf); err != nil {
+		return nil, err
+	}
+	return hex.EncodeToString(buf.Bytes()), nil
+}
+
+func (s *rpcServer) payToMany(p rpcParams) (any, error) {
+	outs, level, opts, err := s.spendParams(p)
+	if err != nil {
+		return nil, err
+	}
+	return s.signSpend(outs, level, opts)
+}
+
+func (s *rpcServer) createProposal(p rpcParams) (any, error) {
+	outs, level, opts, err := s.spendParams(p)
+	if err != nil {
+		return nil, err
+	}
+	w := s.app.ec.GetWallet()
+	proposal, err := w.CreateProposal(outs, level, *opts)
+	if err != nil {
+		return nil, err
+	}
+	return makeProposalResult(proposal, w.Params())
+}
+
+func (s *rpcServer) listProposals(_ rpcParams) (any, error) {
+	return s.app.listProposals(nil)
+}
+
+func (s *rpcServer) getProposal(p rpcParams) (any, error) {
+	id, err := p.string("id")
+	if err != nil {
+		return nil, err
+	}
+	return s.app.showProposal([]string{id})
+}
+
+func (s *rpcServer) signProposal(p rpcParams) (any, error) {
+	id, err := p.string("id")
+	if err != nil {
+		return nil, err
+	}
+	w := s.app.ec.GetWallet()
+	var proposal *wallet.TxProposal
+	if signed, ok, err := p.optString("tx"); err != nil {
+		return nil, err
+	} else if ok {
+		tx, err := decodeTx(signed)
+		if err != nil {
+			return nil, invalidParams("%v", err)
+		}
+		if proposal, err = w.ImportSignedProposal(id, tx); err != nil {
+			return nil, err
+		}
+	} else if proposal, err = w.SignProposal(id); err != nil {
+		return nil, err
+	}
+	return makeProposalResult(proposal, w.Params())
+}
+
+func (s *rpcServer) broadcastProposal(p rpcParams) (any, error) {
+	id, err := p.string("id")
+	if err != nil {
+		return nil, err
+	}
+	return s.app.broadcastProposal([]string{id})
+}
+
+func (s *rpcServer) cancelProposal(p rpcParams) (any, error) {
+	id, err := p.string("id")
+	if err != nil {
+		return nil, err
+	}
+	if err = s.app.ec.GetWallet().CancelProposal(id); err != nil {
+		return nil, err
+	}
+	return true, nil
+}
+
+func (s *rpcServer) freeze(p rpcParams) (any, error) {
+	return s.freezeAddress(p, true)
+}
+
+func (s *rpcServer) unfreeze(p rpcParams) (any, error) {
+	return s.freezeAddress(p, false)
+}
+
+// freezeAddress returns false, as Electrum does, when the address is not
+// the wallet's
+func (s *rpcServer) freezeAddress(p rpcParams, frozen bool) (any, error) {
+	addr, err := s.decodeAddress(p)
+	if err != nil {
+		return nil, err
+	}
+	w := s.app.ec.GetWallet()
+	if !w.HasKey(addr) {
+		return false, nil
+	}
+	if _, err = w.FreezeAddress(addr, frozen); err != nil {
+		return nil, err
+	}
+	return true, nil
+}
+
+func (s *rpcServer) freezeUtxo(p rpcParams) (any, error) {
+	return s.freezeCoin(p, true)
+}
+
+func (s *rpcServer) unfreezeUtxo(p rpcParams) (any, error) {
+	return s.freezeCoin(p, false)
+}
+
+func (s *rpcServer) freezeCoin(p rpcParams, frozen bool) (any, error) {
+	coin, err := p.string("coin")
+	if err != nil {
+		return nil, err
+	}
+	op, err := parseOutpoint(coin)
+	if err != nil {
+		return nil, invalidParams("%v", err)
+	}
+	if err = s.app.ec.GetWallet().FreezeCoin(op, frozen); err != nil {
+		return nil, err
+	}
+	return true, nil
+}
+
+// setLabel labels a txid, or else an address, as Electrum's setlabel does
+func (s *rpcServer) setLabel(p rpcParams) (any, error) {
+	key, err := p.string("key")
+	if err != nil {
+		return nil, err
+	}
+	label, err := p.string("label")
+	if err != nil {
+		return nil, err
+	}
+	w := s.app.ec.GetWallet()
+	labelType := wallet.LabelAddr
+	if wallet.ValidateLabelRef(wallet.LabelTx, key, w.Params()) == nil {
+		labelType = wallet.LabelTx
+	}
+	if err = w.SetLabel(labelType, key, label); err != nil {
+		return nil, invalidParams("%s", err)
+	}
+	return true, nil
+}
+
+func (s *rpcServer) signMessage(p rpcParams) (any, error) {
+	addr, err := s.decodeAddress(p)
+	if err != nil {
+		return nil, err
+	}
+	message, err := p.string("message")
+	if err != nil {
+		return nil, err
+	}
+	sig, err := s.app.ec.GetWallet().SignMessage(addr, message)
+	if err != nil {
+		return nil, err
+	}
+	return base64.StdEncoding.EncodeToString(sig), nil
+}
+
+func (s *rpcServer) verifyMessage(p rpcParams) (any, error) {
+	addr, err := s.decodeAddress(p)
+	if err != nil {
+		return nil, err
+	}
+	sigStr, err := p.string("signature")
+	if err != nil {
+		return nil, err
+	}
+	message, err := p.string("message")
+	if err != nil {
+		return nil, err
+	}
+	sig, err := base64.StdEncoding.DecodeString(sigStr)
+	if err != nil {
+		return false, nil
+	}
+	ok, err := s.app.ec.GetWallet().VerifyMessage(addr, sig, message)
+	if err != nil {
+		return false, nil
+	}
+	return ok, nil
+}
+
+func (s *rpcServer) validateAddress(p rpcParams) (any, error) {
+	str, err := p.string("address")
+	if err != nil {
+		return nil, err
+	}
+	w := s.app.ec.GetWallet()
+	addr, err := w.DecodeAddress(str)
+	return err == nil && addr.IsForNet(w.Params()), nil
+}
+
+func (s *rpcServer) isMine(p rpcParams) (any, error) {
+	addr, err := s.decodeAddress(p)
+	if err != nil {
+		return nil, err
+	}
+	return s.app.ec.GetWallet().HasKey(addr), nil
+}
+
+func (s *rpcServer) getFeeRate(_ rpcParams) (any, error) {
+	return s.app.ec.GetWallet().GetFeePerByte(wallet.NORMAL) * 1000, nil
+}
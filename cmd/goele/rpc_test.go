@@ -0,0 +1,328 @@
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"main/electrumx/electrumxtest"
+	"main/wallet"
+
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+)
+
+type rpcClient struct {
+	t        *testing.T
+	url      string
+	user, pw string
+	id       int
+}
+
+// call makes a JSON-RPC call and decodes the result into v. It returns the
+// error object of a failed call.
+func (c *rpcClient) call(method string, params any, v any) *rpcError {
+	c.t.Helper()
+	c.id++
+	body, _ := json.Marshal(map[string]any{
+		"jsonrpc": "2.0", "id": c.id, "method": method, "params": params,
+	})
+	req, _ := http.NewRequest(http.MethodPost, c.url, bytes.NewReader(body))
+	req.SetBasicAuth(c.user, c.pw)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		c.t.Fatalf("%s: %v", method, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		c.t.Fatalf("%s: status %s", method, resp.Status)
+	}
+	var res struct {
+		ID     int             `json:"id"`
+		Result json.RawMessage `json:"result"`
+		Error  *rpcError       `json:"error"`
+	}
+	if err = json.NewDecoder(resp.Body).Decode(&res); err != nil {
+		c.t.Fatalf("%s: %v", method, err)
+	}
+	if res.ID != c.id {
+		c.t.Fatalf("%s: response id %d", method, res.ID)
+	}
+	if res.Error != nil {
+		return res.Error
+	}
+	if v != nil {
+		if err = json.Unmarshal(res.Result, v); err != nil {
+			c.t.Fatalf("%s: %v: %s", method, err, res.Result)
+		}
+	}
+	return nil
+}
+
+func TestDaemon(t *testing.T) {
+	srv := electrumxtest.NewServer(&chaincfg.RegressionNetParams)
+	if err := srv.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Close()
+	srv.MineEmptyBlocks(5)
+
+	dir := t.TempDir()
+	flags := []string{"-net", "regtest", "-datadir", dir, "-server", srv.Addr() + ":t"}
+	var addrs []string
+	if code := goele(t, append(flags, "create"), "pw\npw\n", nil); code != 0 {
+		t.Fatalf("create exit %d", code)
+	}
+	if code := goele(t, append(flags, "listaddresses"), "pw\n", &addrs); code != 0 {
+		t.Fatalf("listaddresses exit %d", code)
+	}
+	decoded, _ := btcutil.DecodeAddress(addrs[0], &chaincfg.RegressionNetParams)
+	script, _ := txscript.PayToAddrScript(decoded)
+	fund := srv.Fund(script, 250000)
+	srv.MineBlock()
+
+	done := make(chan int)
+	go func() {
+		done <- goele(t, append(flags, "daemon", "-rpcpassword", "secret"), "pw\n", nil)
+	}()
+	var dc *daemonConfig
+	for i := 0; ; i++ {
+		if i == 100 {
+			t.Fatal("daemon did not start")
+		}
+		time.Sleep(50 * time.Millisecond)
+		if _, err := os.Stat(filepath.Join(dir, DAEMON_FILE_NAME)); err != nil {
+			continue
+		}
+		// the file may be part written
+		var err error
+		if dc, err = loadDaemonConfig(dir); err == nil && dc.RPCPort != 0 {
+			break
+		}
+	}
+	if dc.RPCUser != "user" || dc.RPCPassword != "secret" || dc.RPCPort == 0 {
+		t.Fatalf("daemon config %+v", dc)
+	}
+	url := fmt.Sprintf("http://127.0.0.1:%d", dc.RPCPort)
+
+	// unauthorized
+	req, _ := http.NewRequest(http.MethodPost, url, bytes.NewReader([]byte(`{"method":"version"}`)))
+	req.SetBasicAuth("user", "wrong")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("wrong password: status %s", resp.Status)
+	}
+
+	c := &rpcClient{t: t, url: url, user: "user", pw: "secret"}
+
+	var version string
+	if e := c.call("version", nil, &version); e != nil || version != goeleVersion {
+		t.Fatalf("version %q %v", version, e)
+	}
+	if e := c.call("nosuchmethod", nil, nil); e == nil || e.Code != rpcMethodNotFound {
+		t.Fatalf("unknown method: %v", e)
+	}
+	if e := c.call("signmessage", []string{addrs[0]}, nil); e == nil || e.Code != rpcInvalidParams {
+		t.Fatalf("missing param: %v", e)
+	}
+
+	var balance map[string]string
+	if e := c.call("getbalance", nil, &balance); e != nil {
+		t.Fatal(e)
+	}
+	if len(balance) != 1 || balance["confirmed"] != "0.0025" {
+		t.Fatalf("balance %v", balance)
+	}
+
+	var unspent []rpcUnspent
+	if e := c.call("listunspent", nil, &unspent); e != nil {
+		t.Fatal(e)
+	}
+	if len(unspent) != 1 || unspent[0].Address != addrs[0] || unspent[0].Value != "0.0025" ||
+		unspent[0].PrevoutHash != fund.TxHash().String() || unspent[0].Height != 6 {
+		t.Fatalf("listunspent %+v", unspent)
+	}
+	var frozen bool
+	if e := c.call("freeze_utxo", []string{fund.TxHash().String() + ":0"}, &frozen); e != nil || !frozen {
+		t.Fatalf("freeze_utxo %v", e)
+	}
+	if e := c.call("listunspent", nil, &unspent); e != nil || len(unspent) != 1 || !unspent[0].Frozen {
+		t.Fatalf("listunspent after freeze_utxo %+v %v", unspent, e)
+	}
+	if e := c.call("unfreeze", []string{addrs[0]}, &frozen); e != nil || !frozen {
+		t.Fatalf("unfreeze %v", e)
+	}
+	if e := c.call("listunspent", nil, &unspent); e != nil || len(unspent) != 1 || unspent[0].Frozen {
+		t.Fatalf("listunspent after unfreeze %+v %v", unspent, e)
+	}
+	if e := c.call("freeze", []string{"bcrt1q3fx029uese6mrhvq68u4l6me49refj8maqxvfv"}, &frozen); e != nil || frozen {
+		t.Fatalf("froze an address not in the wallet %v", e)
+	}
+
+	var labelled bool
+	if e := c.call("setlabel", []string{fund.TxHash().String(), "funding"}, &labelled); e != nil || !labelled {
+		t.Fatalf("setlabel %v", e)
+	}
+	if e := c.call("setlabel", []string{"nosuchaddress", "x"}, &labelled); e == nil || e.Code != rpcInvalidParams {
+		t.Fatalf("setlabel of an invalid key %v", e)
+	}
+
+	var history struct{ Transactions []rpcHistoryItem }
+	if e := c.call("onchain_history", nil, &history); e != nil {
+		t.Fatal(e)
+	}
+	if len(history.Transactions) != 1 || !history.Transactions[0].Incoming ||
+		history.Transactions[0].Confirmations != 1 || history.Transactions[0].BcValue != "0.0025" ||
+		history.Transactions[0].Label != "funding" {
+		t.Fatalf("history %+v", history)
+	}
+
+	var addrHistory []map[string]any
+	if e := c.call("getaddresshistory", map[string]string{"address": addrs[0]}, &addrHistory); e != nil {
+		t.Fatal(e)
+	}
+	if len(addrHistory) != 1 || addrHistory[0]["tx_hash"] != fund.TxHash().String() {
+		t.Fatalf("getaddresshistory %v", addrHistory)
+	}
+	if e := c.call("getaddresshistory", []string{addrs[1]}, &addrHistory); e != nil || len(addrHistory) != 0 {
+		t.Fatalf("getaddresshistory of an unused address %v %v", addrHistory, e)
+	}
+
+	var rawTx string
+	if e := c.call("gettransaction", []string{fund.TxHash().String()}, &rawTx); e != nil || rawTx == "" {
+		t.Fatalf("gettransaction %v", e)
+	}
+
+	var sig string
+	if e := c.call("signmessage", []string{addrs[0], "hello"}, &sig); e != nil {
+		t.Fatal(e)
+	}
+	var ok bool
+	if e := c.call("verifymessage", []string{addrs[0], sig, "hello"}, &ok); e != nil || !ok {
+		t.Fatalf("verifymessage %v %v", ok, e)
+	}
+	if e := c.call("verifymessage", []string{addrs[0], sig, "goodbye"}, &ok); e != nil || ok {
+		t.Fatalf("verified another message %v %v", ok, e)
+	}
+	if e := c.call("ismine", []string{addrs[0]}, &ok); e != nil || !ok {
+		t.Fatalf("ismine %v %v", ok, e)
+	}
+	mainnet := "bc1qar0srrr7xfkvy5l643lydnw9re59gtzzwf5mdq"
+	if e := c.call("validateaddress", []string{mainnet}, &ok); e != nil || ok {
+		t.Fatalf("validated a mainnet address %v %v", ok, e)
+	}
+	if e := c.call("broadcast", []string{"00"}, nil); e == nil {
+		t.Fatal("broadcast an invalid transaction")
+	}
+
+	payee := "bcrt1q3fx029uese6mrhvq68u4l6me49refj8maqxvfv"
+	var proposal proposalResult
+	if e := c.call("createproposal", []any{[]any{[]any{payee, "0.001"}}}, &proposal); e != nil {
+		t.Fatal(e)
+	}
+	if proposal.Status != "unsigned" || len(proposal.Outputs) != 2 {
+		t.Fatalf("createproposal %+v", proposal)
+	}
+	if e := c.call("createproposal", []any{[]any{[]any{payee, "0.001"}}}, nil); e == nil {
+		t.Fatal("proposed spending a locked coin")
+	}
+	if e := c.call("signproposal", []string{proposal.ID}, &proposal); e != nil || proposal.Status != "signed" {
+		t.Fatalf("signproposal %+v %v", proposal, e)
+	}
+	var proposals []proposalResult
+	if e := c.call("listproposals", nil, &proposals); e != nil || len(proposals) != 1 || proposals[0].ID != proposal.ID {
+		t.Fatalf("listproposals %+v %v", proposals, e)
+	}
+	var cancelled bool
+	if e := c.call("cancelproposal", map[string]string{"id": proposal.ID}, &cancelled); e != nil || !cancelled {
+		t.Fatalf("cancelproposal %v", e)
+	}
+	if e := c.call("getproposal", []string{proposal.ID}, nil); e == nil {
+		t.Fatal("got a cancelled proposal")
+	}
+
+	var signed string
+	outputs := []any{[]any{payee, 0.0005}, []any{addrs[1], "!"}}
+	if e := c.call("paytomany", map[string]any{"outputs": outputs, "feerate": 3}, &signed); e != nil {
+		t.Fatal(e)
+	}
+	b, err := hex.DecodeString(signed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var tx wire.MsgTx
+	if err = tx.Deserialize(bytes.NewReader(b)); err != nil || len(tx.TxIn) != 1 || len(tx.TxOut) != 2 {
+		t.Fatalf("paytomany %v %s", err, signed)
+	}
+	if len(srv.Mempool()) != 0 {
+		t.Fatal("paytomany broadcast the transaction")
+	}
+	var txid string
+	if e := c.call("broadcast", []string{signed}, &txid); e != nil || txid != tx.TxHash().String() {
+		t.Fatalf("broadcast %s %v", txid, e)
+	}
+	if e := c.call("paytomany", []any{[]any{[]any{payee}}}, nil); e == nil || e.Code != rpcInvalidParams {
+		t.Fatalf("paytomany without an amount %v", e)
+	}
+
+	// payto takes Electrum's positional fee in BTC and returns the hex
+	if e := c.call("payto", []any{payee, "0.0001", "0.00002"}, &signed); e != nil {
+		t.Fatal(e)
+	}
+	if b, err = hex.DecodeString(signed); err != nil {
+		t.Fatal(err)
+	}
+	tx = wire.MsgTx{}
+	if err = tx.Deserialize(bytes.NewReader(b)); err != nil || len(tx.TxOut) != 2 {
+		t.Fatalf("payto %v %s", err, signed)
+	}
+	if len(srv.Mempool()) != 1 {
+		t.Fatal("payto broadcast the transaction")
+	}
+	// the unbroadcast transaction locks its coin until cancelled
+	if e := c.call("payto", []any{payee, "0.0001"}, nil); e == nil {
+		t.Fatal("payto spent a locked coin")
+	}
+	if e := c.call("cancelproposal", []string{wallet.ProposalID(&tx)}, nil); e != nil {
+		t.Fatalf("cancelproposal %v", e)
+	}
+	if e := c.call("payto", map[string]any{"destination": payee, "amount": "0.0001", "feerate": 2}, &signed); e != nil {
+		t.Fatalf("payto with a fee rate %v", e)
+	}
+	if e := c.call("payto", map[string]any{"destination": payee, "amount": "0.0001", "feelevel": "ECONOMIC"}, nil); e == nil || e.Code != rpcInvalidParams {
+		t.Fatalf("payto with a fee level %v", e)
+	}
+
+	var info map[string]any
+	if e := c.call("getinfo", nil, &info); e != nil {
+		t.Fatal(e)
+	}
+	if info["connected"] != true || info["blockchain_height"] != float64(6) {
+		t.Fatalf("getinfo %v", info)
+	}
+
+	var stopped string
+	if e := c.call("stop", nil, &stopped); e != nil {
+		t.Fatal(e)
+	}
+	select {
+	case code := <-done:
+		if code != 0 {
+			t.Fatalf("daemon exit %d", code)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("daemon did not stop")
+	}
+}
@@ -0,0 +1,200 @@
+package electrumx
+
+// Trust-on-first-use pinning of ElectrumX server certificates. Most servers
+// use self-signed certificates that cannot be verified against a CA, so the
+// SHA-256 fingerprint of the certificate first seen for a server is stored in
+// the data dir and any later certificate must match it. Certificates that
+// verify against the system CAs for the server's host name are accepted
+// without pinning their fingerprint so that routine CA renewals do not break
+// the connection, but the server is recorded as CA verified and from then on
+// only CA verified certificates are accepted for it. Pins set by the operator
+// are always enforced.
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+const CERTS_FILE_NAME = "server_certs.json"
+
+// CAVerified is stored in place of a fingerprint for a server that presented
+// a certificate verified against the CAs
+const CAVerified = "ca"
+
+// CertMismatchError is returned when a server presents a certificate that
+// does not match its pinned fingerprint. It may be a man-in-the-middle attack
+// or the operator may have replaced the certificate; in the latter case remove
+// the pin from the certs file in the data dir.
+type CertMismatchError struct {
+	Addr   string
+	Pinned string
+	Got    string
+}
+
+func (e *CertMismatchError) Error() string {
+	if e.Pinned == CAVerified {
+		return fmt.Sprintf("certificate of server %s is not verified by a CA as before: got %s",
+			e.Addr, e.Got)
+	}
+	return fmt.Sprintf("certificate of server %s does not match the pinned certificate: "+
+		"pinned fingerprint %s, got %s", e.Addr, e.Pinned, e.Got)
+}
+
+// CertFingerprint returns the hex SHA-256 fingerprint of a DER certificate
+func CertFingerprint(der []byte) string {
+	sum := sha256.Sum256(der)
+	return hex.EncodeToString(sum[:])
+}
+
+// normalizeFingerprint accepts hex fingerprints in any case with optional
+// colon separators, e.g. as printed by openssl
+func normalizeFingerprint(fp string) string {
+	return strings.ToLower(strings.ReplaceAll(fp, ":", ""))
+}
+
+// CertStore persists the pinned certificate fingerprints of servers keyed by
+// "host:port", or CAVerified for servers with CA verified certificates. It is
+// safe for concurrent use.
+type CertStore struct {
+	path string
+
+	// The CAs that verify server certificates, the system CAs if nil
+	RootCAs *x509.CertPool
+
+	mtx  sync.Mutex
+	pins map[string]string
+}
+
+// NewCertStore opens the certs file in the data dir, which need not exist
+// yet. An empty dir makes an in-memory store.
+func NewCertStore(dataDir string) (*CertStore, error) {
+	cs := &CertStore{pins: make(map[string]string)}
+	if dataDir == "" {
+		return cs, nil
+	}
+	cs.path = filepath.Join(dataDir, CERTS_FILE_NAME)
+	b, err := os.ReadFile(cs.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return cs, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err = json.Unmarshal(b, &cs.pins); err != nil {
+		return nil, fmt.Errorf("certs file %s: %w", cs.path, err)
+	}
+	return cs, nil
+}
+
+// Get returns the pinned fingerprint of the server, if any
+func (cs *CertStore) Get(addr string) (string, bool) {
+	cs.mtx.Lock()
+	defer cs.mtx.Unlock()
+	fp, ok := cs.pins[addr]
+	return fp, ok
+}
+
+// Pin stores the fingerprint of the server, or CAVerified
+func (cs *CertStore) Pin(addr, fingerprint string) error {
+	cs.mtx.Lock()
+	defer cs.mtx.Unlock()
+	cs.pins[addr] = normalizeFingerprint(fingerprint)
+	return cs.save()
+}
+
+// Remove forgets the pinned certificate of the server, e.g. after the
+// operator has replaced it
+func (cs *CertStore) Remove(addr string) error {
+	cs.mtx.Lock()
+	defer cs.mtx.Unlock()
+	delete(cs.pins, addr)
+	return cs.save()
+}
+
+func (cs *CertStore) save() error {
+	if cs.path == "" {
+		return nil
+	}
+	b, err := json.MarshalIndent(cs.pins, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := cs.path + ".tmp"
+	if err = os.WriteFile(tmp, b, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, cs.path)
+}
+
+// PinnedTLSConfig returns a client TLS config for the server at addr. The
+// certificate must match the operator's pin in pinned if there is one.
+// Otherwise it is accepted if it verifies against the CAs, or if it matches
+// the pin in the store, which is made on first use. A server that was CA
+// verified is recorded so a certificate that is not is refused later.
+func PinnedTLSConfig(addr string, store *CertStore, pinned map[string]string) (*tls.Config, error) {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, err
+	}
+	rootCAs := store.RootCAs
+	if rootCAs == nil {
+		rootCAs, _ = x509.SystemCertPool()
+	}
+	operatorPin, hasOperatorPin := pinned[addr]
+
+	verify := func(cs tls.ConnectionState) error {
+		if len(cs.PeerCertificates) == 0 {
+			return errors.New("server sent no certificate")
+		}
+		leaf := cs.PeerCertificates[0]
+		fp := CertFingerprint(leaf.Raw)
+		if hasOperatorPin {
+			if want := normalizeFingerprint(operatorPin); fp != want {
+				return &CertMismatchError{Addr: addr, Pinned: want, Got: fp}
+			}
+			return nil
+		}
+		intermediates := x509.NewCertPool()
+		for _, cert := range cs.PeerCertificates[1:] {
+			intermediates.AddCert(cert)
+		}
+		_, err := leaf.Verify(x509.VerifyOptions{
+			DNSName:       host,
+			Roots:         rootCAs,
+			Intermediates: intermediates,
+		})
+		want, stored := store.Get(addr)
+		if err == nil {
+			if want == CAVerified {
+				return nil
+			}
+			return store.Pin(addr, CAVerified)
+		}
+		if stored {
+			if fp != want {
+				return &CertMismatchError{Addr: addr, Pinned: want, Got: fp}
+			}
+			return nil
+		}
+		return store.Pin(addr, fp)
+	}
+
+	return &tls.Config{
+		// The chain is verified in VerifyConnection instead so self-signed
+		// certificates can be pinned.
+		InsecureSkipVerify: true,
+		VerifyConnection:   verify,
+		MinVersion:         tls.VersionTLS12,
+		ServerName:         host,
+	}, nil
+}
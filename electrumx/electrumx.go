@@ -7,7 +7,6 @@ import (
 	"main/wallet"
 
 	"github.com/btcsuite/btcd/chaincfg"
-	"golang.org/x/net/proxy"
 )
 
 type ServerAddr struct {
@@ -37,11 +36,22 @@ type NodeConfig struct {
 	// Location of the data directory
 	DataDir string
 
-	// If you wish to connect to a single trusted electrumX peer set this.
+	// If you wish to connect to a single trusted electrumX peer set this. It is
+	// tried before the servers of the server list in the data dir.
 	TrustedPeer net.Addr
 
-	// A Tor proxy can be set here causing the wallet will use Tor. TODO:
-	Proxy proxy.Dialer
+	// Certificate fingerprints of ssl servers keyed by "host:port", see
+	// PinnedTLSConfig. Other ssl servers are pinned on first use.
+	PinnedCerts map[string]string
+
+	// A SOCKS5 proxy, such as Tor, for all server and peer connections. Nil
+	// means direct connections.
+	Proxy *ProxyConfig
+
+	// Called when the node moves to another server than the one it tried
+	// first, such as when the trusted peer cannot be reached, or when a
+	// MultiNode loses its leader. Optional.
+	ServerSwitched func(from, to ServerAddr)
 
 	// If not testing do not overwrite existing wallet files
 	Testing bool
@@ -66,6 +76,16 @@ type ElectrumXNode interface {
 	SubscribeScripthashNotify(scripthash string) (*ScripthashStatusResult, error)
 	UnsubscribeScripthashNotify(scripthash string)
 	GetHistory(scripthash string) (HistoryResult, error)
+	GetMempool(scripthash string) (HistoryResult, error)
+	GetRawTransaction(txid string) (string, error)
+	GetMerkle(txid string, height uint32) (*GetMerkleResult, error)
+	//
+	EstimateFee(blocks int) (float64, error)
+	RelayFee() (float64, error)
+	FeeHistogram() ([]FeeHistogramEntry, error)
+	//
+	PeerAddrs() (ssl, tcpOnlyOnion []string, err error)
+	BanServer(addr ServerAddr, reason string) error
 	//
 	Broadcast(rawTx string) (string, error)
 }
@@ -73,5 +93,6 @@ type ElectrumXNode interface {
 type ElectrumXSvrConn struct {
 	SvrCtx  context.Context
 	SvrConn *ServerConn
+	Addr    ServerAddr
 	Running bool
 }
@@ -0,0 +1,356 @@
+package electrumxtest
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+
+	"main/electrumx"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/wire"
+)
+
+// block is a block of the in-memory chain. The first transaction is the
+// coinbase.
+type block struct {
+	header wire.BlockHeader
+	txs    []*wire.MsgTx
+}
+
+// txEntry locates a known transaction. height is -1 while it is in the
+// mempool.
+type txEntry struct {
+	tx     *wire.MsgTx
+	height int32
+	pos    int
+}
+
+// Scripthash returns the electrum scripthash of an output script, the reversed
+// sha256 hash as a hex string.
+func Scripthash(pkScript []byte) string {
+	h := sha256.Sum256(pkScript)
+	for i, j := 0, len(h)-1; i < j; i, j = i+1, j-1 {
+		h[i], h[j] = h[j], h[i]
+	}
+	return hex.EncodeToString(h[:])
+}
+
+// statusHash is the electrum status of a history, the sha256 of the
+// concatenated "txid:height:" strings, or empty for no history.
+func statusHash(history electrumx.HistoryResult) string {
+	if len(history) == 0 {
+		return ""
+	}
+	var buf bytes.Buffer
+	for _, h := range history {
+		fmt.Fprintf(&buf, "%s:%d:", h.TxHash, h.Height)
+	}
+	sum := sha256.Sum256(buf.Bytes())
+	return hex.EncodeToString(sum[:])
+}
+
+func serializeTx(tx *wire.MsgTx) []byte {
+	var buf bytes.Buffer
+	tx.Serialize(&buf)
+	return buf.Bytes()
+}
+
+func serializeHeader(hdr *wire.BlockHeader) []byte {
+	var buf bytes.Buffer
+	hdr.Serialize(&buf)
+	return buf.Bytes()
+}
+
+// merkleBranch returns the merkle root of the txids and the branch of the
+// txid at pos, deepest pairing first.
+func merkleBranch(txids []chainhash.Hash, pos int) (chainhash.Hash, []chainhash.Hash) {
+	var branch []chainhash.Hash
+	level := append([]chainhash.Hash(nil), txids...)
+	for len(level) > 1 {
+		if len(level)%2 == 1 {
+			level = append(level, level[len(level)-1])
+		}
+		branch = append(branch, level[pos^1])
+		next := make([]chainhash.Hash, len(level)/2)
+		for i := range next {
+			var buf [chainhash.HashSize * 2]byte
+			copy(buf[:], level[2*i][:])
+			copy(buf[chainhash.HashSize:], level[2*i+1][:])
+			next[i] = chainhash.DoubleHashH(buf[:])
+		}
+		level = next
+		pos /= 2
+	}
+	return level[0], branch
+}
+
+func blockTxids(b *block) []chainhash.Hash {
+	txids := make([]chainhash.Hash, len(b.txs))
+	for i, tx := range b.txs {
+		txids[i] = tx.TxHash()
+	}
+	return txids
+}
+
+// newCoinbase makes a unique coinbase paying value to pkScript.
+func newCoinbase(height int32, pkScript []byte, value int64) *wire.MsgTx {
+	sigScript := make([]byte, 5)
+	sigScript[0] = 4
+	binary.LittleEndian.PutUint32(sigScript[1:], uint32(height))
+	tx := wire.NewMsgTx(wire.TxVersion)
+	tx.AddTxIn(wire.NewTxIn(wire.NewOutPoint(&chainhash.Hash{}, wire.MaxPrevOutIndex), sigScript, nil))
+	tx.AddTxOut(wire.NewTxOut(value, pkScript))
+	return tx
+}
+
+func (s *Server) tip() *block {
+	return s.blocks[len(s.blocks)-1]
+}
+
+// height returns the tip height.
+func (s *Server) height() int32 {
+	return int32(len(s.blocks) - 1)
+}
+
+// connectBlock mines a block with the given transactions on the tip.
+func (s *Server) connectBlock(txs []*wire.MsgTx) *block {
+	height := s.height() + 1
+	prev := s.tip().header
+	s.nonce++
+	b := &block{
+		txs: append([]*wire.MsgTx{newCoinbase(height, s.coinbaseScript, 50e8)}, txs...),
+	}
+	root, _ := merkleBranch(blockTxids(b), 0)
+	b.header = wire.BlockHeader{
+		Version:    4,
+		PrevBlock:  prev.BlockHash(),
+		MerkleRoot: root,
+		Timestamp:  prev.Timestamp.Add(10 * time.Minute),
+		Bits:       prev.Bits,
+		Nonce:      s.nonce,
+	}
+	s.blocks = append(s.blocks, b)
+	for pos, tx := range b.txs {
+		s.txs[tx.TxHash()] = &txEntry{tx: tx, height: height, pos: pos}
+	}
+	return b
+}
+
+// disconnectBlock removes the tip, returning its transactions other than the
+// coinbase to the mempool ahead of those already there.
+func (s *Server) disconnectBlock() {
+	b := s.tip()
+	s.blocks = s.blocks[:len(s.blocks)-1]
+	delete(s.txs, b.txs[0].TxHash())
+	var back []chainhash.Hash
+	for _, tx := range b.txs[1:] {
+		txid := tx.TxHash()
+		s.txs[txid] = &txEntry{tx: tx, height: -1}
+		back = append(back, txid)
+	}
+	s.mempool = append(back, s.mempool...)
+}
+
+// removeFromMempool removes a transaction and those spending its outputs from
+// the mempool.
+func (s *Server) removeFromMempool(txid chainhash.Hash) {
+	for i, h := range s.mempool {
+		if h == txid {
+			s.mempool = append(s.mempool[:i:i], s.mempool[i+1:]...)
+			delete(s.txs, txid)
+			break
+		}
+	}
+	for _, h := range append([]chainhash.Hash(nil), s.mempool...) {
+		e, ok := s.txs[h]
+		if !ok {
+			continue
+		}
+		for _, in := range e.tx.TxIn {
+			if in.PreviousOutPoint.Hash == txid {
+				s.removeFromMempool(h)
+				break
+			}
+		}
+	}
+}
+
+// acceptTx adds a transaction to the mempool. It is rejected if it is known
+// or spends an output already spent by another transaction.
+func (s *Server) acceptTx(tx *wire.MsgTx) error {
+	txid := tx.TxHash()
+	if _, ok := s.txs[txid]; ok {
+		return errors.New("transaction already in block chain or mempool")
+	}
+	if len(tx.TxIn) == 0 || len(tx.TxOut) == 0 {
+		return errors.New("bad-txns-empty")
+	}
+	for _, in := range tx.TxIn {
+		if s.spender(in.PreviousOutPoint) != nil {
+			return errors.New("txn-mempool-conflict")
+		}
+	}
+	s.txs[txid] = &txEntry{tx: tx, height: -1}
+	s.mempool = append(s.mempool, txid)
+	return nil
+}
+
+// spender returns the known transaction spending an outpoint, if any.
+func (s *Server) spender(op wire.OutPoint) *txEntry {
+	for _, e := range s.txs {
+		for _, in := range e.tx.TxIn {
+			if in.PreviousOutPoint == op {
+				return e
+			}
+		}
+	}
+	return nil
+}
+
+// prevOut returns the output spent by an input if the funding transaction is
+// known.
+func (s *Server) prevOut(op wire.OutPoint) (*wire.TxOut, bool) {
+	e, ok := s.txs[op.Hash]
+	if !ok || int(op.Index) >= len(e.tx.TxOut) {
+		return nil, false
+	}
+	return e.tx.TxOut[op.Index], true
+}
+
+// touches reports whether a transaction pays to or spends from a scripthash.
+func (s *Server) touches(tx *wire.MsgTx, scripthash string) bool {
+	for _, out := range tx.TxOut {
+		if Scripthash(out.PkScript) == scripthash {
+			return true
+		}
+	}
+	for _, in := range tx.TxIn {
+		if out, ok := s.prevOut(in.PreviousOutPoint); ok && Scripthash(out.PkScript) == scripthash {
+			return true
+		}
+	}
+	return false
+}
+
+// fee returns the fee of a transaction, or 0 if a spent output is unknown.
+func (s *Server) fee(tx *wire.MsgTx) int64 {
+	var in int64
+	for _, txIn := range tx.TxIn {
+		out, ok := s.prevOut(txIn.PreviousOutPoint)
+		if !ok {
+			return 0
+		}
+		in += out.Value
+	}
+	for _, out := range tx.TxOut {
+		in -= out.Value
+	}
+	return in
+}
+
+// mempoolHeight is 0 for a mempool transaction with confirmed inputs and -1
+// if it spends the outputs of other mempool transactions.
+func (s *Server) mempoolHeight(tx *wire.MsgTx) int32 {
+	for _, in := range tx.TxIn {
+		if e, ok := s.txs[in.PreviousOutPoint.Hash]; ok && e.height < 0 {
+			return -1
+		}
+	}
+	return 0
+}
+
+// mempoolHistory returns the mempool transactions of a scripthash.
+func (s *Server) mempoolHistory(scripthash string) electrumx.HistoryResult {
+	var history electrumx.HistoryResult
+	for _, txid := range s.mempool {
+		tx := s.txs[txid].tx
+		if s.touches(tx, scripthash) {
+			history = append(history, electrumx.History{
+				Height: s.mempoolHeight(tx),
+				TxHash: txid.String(),
+				Fee:    s.fee(tx),
+			})
+		}
+	}
+	return history
+}
+
+// history returns the confirmed transactions of a scripthash in block order
+// followed by its mempool transactions.
+func (s *Server) history(scripthash string) electrumx.HistoryResult {
+	var history electrumx.HistoryResult
+	for height, b := range s.blocks {
+		for _, tx := range b.txs {
+			if s.touches(tx, scripthash) {
+				history = append(history, electrumx.History{
+					Height: int32(height),
+					TxHash: tx.TxHash().String(),
+				})
+			}
+		}
+	}
+	return append(history, s.mempoolHistory(scripthash)...)
+}
+
+func (s *Server) status(scripthash string) string {
+	return statusHash(s.history(scripthash))
+}
+
+// unspent returns the unspent outputs paying a scripthash.
+func (s *Server) unspent(scripthash string) []electrumx.ListUnspentResult {
+	var unspent []electrumx.ListUnspentResult
+	add := func(tx *wire.MsgTx, height int32) {
+		txid := tx.TxHash()
+		for i, out := range tx.TxOut {
+			if Scripthash(out.PkScript) != scripthash {
+				continue
+			}
+			if s.spender(wire.OutPoint{Hash: txid, Index: uint32(i)}) != nil {
+				continue
+			}
+			unspent = append(unspent, electrumx.ListUnspentResult{
+				Height: height,
+				TxPos:  uint32(i),
+				TxHash: txid.String(),
+				Value:  out.Value,
+			})
+		}
+	}
+	for height, b := range s.blocks {
+		for _, tx := range b.txs {
+			add(tx, int32(height))
+		}
+	}
+	for _, txid := range s.mempool {
+		add(s.txs[txid].tx, 0)
+	}
+	return unspent
+}
+
+// balance returns the confirmed balance of a scripthash and the change to it
+// made by mempool transactions.
+func (s *Server) balance(scripthash string) electrumx.GetBalanceResult {
+	var bal electrumx.GetBalanceResult
+	for _, e := range s.txs {
+		delta := &bal.Confirmed
+		if e.height < 0 {
+			delta = &bal.Unconfirmed
+		}
+		for _, out := range e.tx.TxOut {
+			if Scripthash(out.PkScript) == scripthash {
+				*delta += out.Value
+			}
+		}
+		for _, in := range e.tx.TxIn {
+			if out, ok := s.prevOut(in.PreviousOutPoint); ok && Scripthash(out.PkScript) == scripthash {
+				*delta -= out.Value
+			}
+		}
+	}
+	return bal
+}
@@ -0,0 +1,856 @@
+// Package electrumxtest provides an in-process ElectrumX server for tests. It
+// speaks newline delimited JSON-RPC over TCP or TLS and serves the methods used
+// by electrumx.ServerConn from an in-memory chain of blocks and a mempool that
+// the test drives by mining blocks, adding transactions and triggering reorgs.
+// Subscribed clients are notified of new tips and scripthash status changes as
+// a real server would.
+package electrumxtest
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/tls"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+
+	"main/electrumx"
+
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+)
+
+// HandlerFunc answers a request given its positional params. Returning an
+// *electrumx.RPCError sends that error object, any other error is sent with
+// code 1.
+type HandlerFunc func(params []json.RawMessage) (any, error)
+
+// Server is a fake ElectrumX server. Construct it with NewServer and start it
+// with Start or StartTLS.
+type Server struct {
+	params *chaincfg.Params
+	ln     net.Listener
+	wg     sync.WaitGroup
+
+	mtx            sync.Mutex
+	blocks         []*block
+	txs            map[chainhash.Hash]*txEntry
+	mempool        []chainhash.Hash
+	coinbaseScript []byte
+	nonce          uint32
+	fundings       uint32
+	proto          string
+	banner         string
+	fees           map[int]float64
+	relayFee       float64
+	histogram      []electrumx.FeeHistogramEntry
+	peers          [][]any
+	handlers       map[string]HandlerFunc
+	requests       map[string]int
+	conns          map[*conn]struct{}
+	closed         bool
+	certPEM        []byte
+}
+
+// conn is a client connection. headers and subs are guarded by the server
+// mutex.
+type conn struct {
+	net.Conn
+	writeMtx sync.Mutex
+	headers  bool
+	tip      chainhash.Hash    // last tip sent
+	subs     map[string]string // scripthash => last status sent
+}
+
+// NewServer creates a server with a chain holding only the genesis block of
+// the network.
+func NewServer(params *chaincfg.Params) *Server {
+	s := &Server{
+		params:         params,
+		txs:            make(map[chainhash.Hash]*txEntry),
+		coinbaseScript: []byte{txscript.OP_TRUE},
+		proto:          "1.4.2",
+		banner:         "electrumxtest",
+		fees:           make(map[int]float64),
+		relayFee:       0.00001,
+		handlers:       make(map[string]HandlerFunc),
+		requests:       make(map[string]int),
+		conns:          make(map[*conn]struct{}),
+	}
+	genesis := &block{
+		header: params.GenesisBlock.Header,
+		txs:    params.GenesisBlock.Transactions,
+	}
+	s.blocks = []*block{genesis}
+	for pos, tx := range genesis.txs {
+		s.txs[tx.TxHash()] = &txEntry{tx: tx, pos: pos}
+	}
+	return s
+}
+
+// Start listens for plain tcp connections on a random localhost port.
+func (s *Server) Start() error {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return err
+	}
+	s.serve(ln)
+	return nil
+}
+
+// StartTLS listens for TLS connections on a random localhost port using a
+// newly generated self-signed certificate. See CertPEM and ClientTLSConfig.
+func (s *Server) StartTLS() error {
+	cert, certPEM, err := selfSignedCert()
+	if err != nil {
+		return err
+	}
+	s.mtx.Lock()
+	s.certPEM = certPEM
+	s.mtx.Unlock()
+	ln, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+	})
+	if err != nil {
+		return err
+	}
+	s.serve(ln)
+	return nil
+}
+
+func (s *Server) serve(ln net.Listener) {
+	s.ln = ln
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		for {
+			nc, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			c := &conn{Conn: nc, subs: make(map[string]string)}
+			s.mtx.Lock()
+			if s.closed {
+				s.mtx.Unlock()
+				nc.Close()
+				return
+			}
+			s.conns[c] = struct{}{}
+			s.mtx.Unlock()
+			s.wg.Add(1)
+			go func() {
+				defer s.wg.Done()
+				s.handleConn(c)
+			}()
+		}
+	}()
+}
+
+// Addr returns the "host:port" address the server is listening on.
+func (s *Server) Addr() string {
+	return s.ln.Addr().String()
+}
+
+// Close stops the server, disconnecting all clients.
+func (s *Server) Close() {
+	s.mtx.Lock()
+	s.closed = true
+	s.mtx.Unlock()
+	s.ln.Close()
+	s.DropConnections()
+	s.wg.Wait()
+}
+
+// DropConnections disconnects all clients while continuing to accept new
+// connections.
+func (s *Server) DropConnections() {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	for c := range s.conns {
+		c.Close()
+	}
+}
+
+// Handle sets a handler for a method, replacing the built-in one if any. A nil
+// handler restores the built-in behavior.
+func (s *Server) Handle(method string, h HandlerFunc) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	if h == nil {
+		delete(s.handlers, method)
+		return
+	}
+	s.handlers[method] = h
+}
+
+// RequestCount returns the number of requests received for a method.
+func (s *Server) RequestCount(method string) int {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	return s.requests[method]
+}
+
+// SetProtocol sets the protocol version the server negotiates, "1.4.2" by
+// default.
+func (s *Server) SetProtocol(version string) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	s.proto = version
+}
+
+// SetBanner sets the server banner.
+func (s *Server) SetBanner(banner string) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	s.banner = banner
+}
+
+// SetFeeEstimate sets the fee rate in BTC/kB returned by blockchain.estimatefee
+// for the target number of blocks. Requests for a target without an estimate
+// use the estimate of the nearest lower target, or -1 if there is none.
+func (s *Server) SetFeeEstimate(blocks int, btcPerKB float64) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	s.fees[blocks] = btcPerKB
+}
+
+// SetRelayFee sets the fee rate in BTC/kB returned by blockchain.relayfee.
+func (s *Server) SetRelayFee(btcPerKB float64) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	s.relayFee = btcPerKB
+}
+
+// SetFeeHistogram sets the result of mempool.get_fee_histogram.
+func (s *Server) SetFeeHistogram(histogram []electrumx.FeeHistogramEntry) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	s.histogram = histogram
+}
+
+// AddPeer adds a peer to the server.peers.subscribe result, e.g.
+// AddPeer("1.2.3.4", "peer.example.com", "v1.4", "s50002", "t50001").
+func (s *Server) AddPeer(addr, host string, features ...string) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	feats := make([]any, len(features))
+	for i, f := range features {
+		feats[i] = f
+	}
+	s.peers = append(s.peers, []any{addr, host, feats})
+}
+
+// SetCoinbaseScript sets the output script paid by the coinbase of blocks mined
+// from now on, OP_TRUE by default.
+func (s *Server) SetCoinbaseScript(pkScript []byte) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	s.coinbaseScript = pkScript
+}
+
+// Height returns the height of the chain tip.
+func (s *Server) Height() int32 {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	return s.height()
+}
+
+// BlockHash returns the hash of the block at a height.
+func (s *Server) BlockHash(height int32) (chainhash.Hash, bool) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	if height < 0 || height > s.height() {
+		return chainhash.Hash{}, false
+	}
+	return s.blocks[height].header.BlockHash(), true
+}
+
+// Transaction returns a known transaction and its height, -1 for a mempool
+// transaction.
+func (s *Server) Transaction(txid chainhash.Hash) (*wire.MsgTx, int32, bool) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	e, ok := s.txs[txid]
+	if !ok {
+		return nil, 0, false
+	}
+	return e.tx, e.height, true
+}
+
+// Mempool returns the txids of the mempool transactions in arrival order.
+func (s *Server) Mempool() []chainhash.Hash {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	return append([]chainhash.Hash(nil), s.mempool...)
+}
+
+// AddMempoolTx adds a transaction to the mempool as if it was broadcast.
+func (s *Server) AddMempoolTx(tx *wire.MsgTx) error {
+	s.mtx.Lock()
+	defer s.notify()
+	defer s.mtx.Unlock()
+	return s.acceptTx(tx)
+}
+
+// Fund adds a mempool transaction paying value to an output script and returns
+// it. Its single input spends an unknown outpoint so it has no fee.
+func (s *Server) Fund(pkScript []byte, value int64) *wire.MsgTx {
+	s.mtx.Lock()
+	defer s.notify()
+	defer s.mtx.Unlock()
+	s.fundings++
+	prev := chainhash.HashH([]byte(fmt.Sprintf("electrumxtest funding %d", s.fundings)))
+	tx := wire.NewMsgTx(wire.TxVersion)
+	tx.AddTxIn(wire.NewTxIn(wire.NewOutPoint(&prev, 0), nil, nil))
+	tx.AddTxOut(wire.NewTxOut(value, pkScript))
+	s.acceptTx(tx) // cannot conflict
+	return tx
+}
+
+// RemoveMempoolTx evicts a transaction and its mempool descendants from the
+// mempool as if it expired or was replaced.
+func (s *Server) RemoveMempoolTx(txid chainhash.Hash) {
+	s.mtx.Lock()
+	defer s.notify()
+	defer s.mtx.Unlock()
+	s.removeFromMempool(txid)
+}
+
+// MineBlock mines a block on the tip and returns its hash. With no arguments
+// the block includes the whole mempool, otherwise just the given transactions,
+// which are removed from the mempool if there.
+func (s *Server) MineBlock(txs ...*wire.MsgTx) chainhash.Hash {
+	s.mtx.Lock()
+	defer s.notify()
+	defer s.mtx.Unlock()
+	return s.mineBlock(txs)
+}
+
+func (s *Server) mineBlock(txs []*wire.MsgTx) chainhash.Hash {
+	if len(txs) == 0 {
+		for _, txid := range s.mempool {
+			txs = append(txs, s.txs[txid].tx)
+		}
+		s.mempool = nil
+	} else {
+		for _, tx := range txs {
+			txid := tx.TxHash()
+			for i, h := range s.mempool {
+				if h == txid {
+					s.mempool = append(s.mempool[:i:i], s.mempool[i+1:]...)
+					break
+				}
+			}
+		}
+	}
+	return s.connectBlock(txs).header.BlockHash()
+}
+
+// MineEmptyBlocks mines n blocks with only a coinbase.
+func (s *Server) MineEmptyBlocks(n int) {
+	s.mtx.Lock()
+	defer s.notify()
+	defer s.mtx.Unlock()
+	for i := 0; i < n; i++ {
+		s.connectBlock(nil)
+	}
+}
+
+// Reorg replaces the top depth blocks of the chain with newBlocks empty blocks.
+// The transactions of the disconnected blocks return to the mempool, from
+// where MineBlock can confirm them again.
+func (s *Server) Reorg(depth, newBlocks int) error {
+	s.mtx.Lock()
+	defer s.notify()
+	defer s.mtx.Unlock()
+	if depth < 1 || depth > int(s.height()) {
+		return fmt.Errorf("invalid reorg depth %d at height %d", depth, s.height())
+	}
+	for i := 0; i < depth; i++ {
+		s.disconnectBlock()
+	}
+	for i := 0; i < newBlocks; i++ {
+		s.connectBlock(nil)
+	}
+	return nil
+}
+
+// Notify sends a notification to all connected clients.
+func (s *Server) Notify(method string, params any) error {
+	msg, err := notification(method, params)
+	if err != nil {
+		return err
+	}
+	s.mtx.Lock()
+	conns := make([]*conn, 0, len(s.conns))
+	for c := range s.conns {
+		conns = append(conns, c)
+	}
+	s.mtx.Unlock()
+	for _, c := range conns {
+		c.write(msg)
+	}
+	return nil
+}
+
+func notification(method string, params any) ([]byte, error) {
+	b, err := json.Marshal(params)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(map[string]any{
+		"jsonrpc": "2.0",
+		"method":  method,
+		"params":  json.RawMessage(b),
+	})
+}
+
+// notify sends the new tip to header subscribers and the new status of
+// changed scripthashes to their subscribers. It must be called after the
+// state change without the server mutex held.
+func (s *Server) notify() {
+	type pending struct {
+		c    *conn
+		msgs [][]byte
+	}
+	var out []pending
+	s.mtx.Lock()
+	tipHash := s.tip().header.BlockHash()
+	tip, _ := notification("blockchain.headers.subscribe", []any{s.tipResult()})
+	for c := range s.conns {
+		p := pending{c: c}
+		if c.headers && c.tip != tipHash {
+			c.tip = tipHash
+			p.msgs = append(p.msgs, tip)
+		}
+		for sh, last := range c.subs {
+			status := s.status(sh)
+			if status == last {
+				continue
+			}
+			c.subs[sh] = status
+			var st any
+			if status != "" {
+				st = status
+			}
+			msg, _ := notification("blockchain.scripthash.subscribe", []any{sh, st})
+			p.msgs = append(p.msgs, msg)
+		}
+		out = append(out, p)
+	}
+	s.mtx.Unlock()
+	for _, p := range out {
+		for _, msg := range p.msgs {
+			p.c.write(msg)
+		}
+	}
+}
+
+func (c *conn) write(msg []byte) error {
+	c.writeMtx.Lock()
+	defer c.writeMtx.Unlock()
+	_, err := c.Write(append(msg, '\n'))
+	return err
+}
+
+type request struct {
+	ID     uint64          `json:"id"`
+	Method string          `json:"method"`
+	Params json.RawMessage `json:"params"`
+}
+
+type rpcError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+type response struct {
+	Jsonrpc string    `json:"jsonrpc"`
+	ID      uint64    `json:"id"`
+	Result  any       `json:"result"`
+	Error   *rpcError `json:"error,omitempty"`
+}
+
+func (s *Server) handleConn(c *conn) {
+	defer func() {
+		s.mtx.Lock()
+		delete(s.conns, c)
+		s.mtx.Unlock()
+		c.Close()
+	}()
+	reader := bufio.NewReader(c)
+	for {
+		msg, err := reader.ReadBytes('\n')
+		if err != nil {
+			return
+		}
+		var req request
+		if err = json.Unmarshal(msg, &req); err != nil {
+			return
+		}
+		var params []json.RawMessage
+		if len(req.Params) > 0 {
+			json.Unmarshal(req.Params, &params)
+		}
+		resp := &response{Jsonrpc: "2.0", ID: req.ID}
+		result, err := s.dispatch(c, req.Method, params)
+		if err != nil {
+			var rpcErr *electrumx.RPCError
+			if errors.As(err, &rpcErr) {
+				resp.Error = &rpcError{Code: rpcErr.Code, Message: rpcErr.Message}
+			} else {
+				resp.Error = &rpcError{Code: 1, Message: err.Error()}
+			}
+		} else {
+			resp.Result = result
+		}
+		b, err := json.Marshal(resp)
+		if err != nil {
+			return
+		}
+		if err = c.write(b); err != nil {
+			return
+		}
+	}
+}
+
+func (s *Server) dispatch(c *conn, method string, params []json.RawMessage) (any, error) {
+	s.mtx.Lock()
+	s.requests[method]++
+	h, ok := s.handlers[method]
+	s.mtx.Unlock()
+	if ok {
+		return h(params)
+	}
+
+	switch method {
+	case "blockchain.transaction.broadcast":
+		var rawTx string
+		if err := parseParams(params, &rawTx); err != nil {
+			return nil, err
+		}
+		tx, err := decodeTx(rawTx)
+		if err != nil {
+			return nil, err
+		}
+		if err = s.AddMempoolTx(tx); err != nil {
+			return nil, err
+		}
+		return tx.TxHash().String(), nil
+	}
+
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	switch method {
+	case "server.version":
+		return []string{"ElectrumX 1.16.0", s.proto}, nil
+	case "server.ping":
+		return nil, nil
+	case "server.banner":
+		return s.banner, nil
+	case "server.donation_address":
+		return "", nil
+	case "server.features":
+		return &electrumx.ServerFeatures{
+			Genesis:  s.params.GenesisHash.String(),
+			Hosts:    map[string]map[string]uint32{},
+			ProtoMax: "1.5",
+			ProtoMin: "1.4",
+			Version:  "ElectrumX 1.16.0",
+			HashFunc: "sha256",
+		}, nil
+	case "server.peers.subscribe":
+		if s.peers == nil {
+			return []any{}, nil
+		}
+		return s.peers, nil
+	case "server.add_peer":
+		return false, nil
+
+	case "blockchain.headers.subscribe":
+		c.headers = true
+		c.tip = s.tip().header.BlockHash()
+		return s.tipResult(), nil
+	case "blockchain.block.header":
+		var height int32
+		if err := parseParams(params, &height); err != nil {
+			return nil, err
+		}
+		if height < 0 || height > s.height() {
+			return nil, fmt.Errorf("height %d out of range", height)
+		}
+		return hex.EncodeToString(serializeHeader(&s.blocks[height].header)), nil
+	case "blockchain.block.headers":
+		var start, count int32
+		if err := parseParams(params, &start, &count); err != nil {
+			return nil, err
+		}
+		return s.headersResult(start, count), nil
+
+	case "blockchain.scripthash.subscribe":
+		var sh string
+		if err := parseParams(params, &sh); err != nil {
+			return nil, err
+		}
+		status := s.status(sh)
+		c.subs[sh] = status
+		if status == "" {
+			return nil, nil
+		}
+		return status, nil
+	case "blockchain.scripthash.unsubscribe":
+		var sh string
+		if err := parseParams(params, &sh); err != nil {
+			return nil, err
+		}
+		_, ok := c.subs[sh]
+		delete(c.subs, sh)
+		return ok, nil
+	case "blockchain.scripthash.get_history":
+		var sh string
+		if err := parseParams(params, &sh); err != nil {
+			return nil, err
+		}
+		return nonNil(s.history(sh)), nil
+	case "blockchain.scripthash.get_mempool":
+		var sh string
+		if err := parseParams(params, &sh); err != nil {
+			return nil, err
+		}
+		return nonNil(s.mempoolHistory(sh)), nil
+	case "blockchain.scripthash.get_balance":
+		var sh string
+		if err := parseParams(params, &sh); err != nil {
+			return nil, err
+		}
+		return s.balance(sh), nil
+	case "blockchain.scripthash.listunspent":
+		var sh string
+		if err := parseParams(params, &sh); err != nil {
+			return nil, err
+		}
+		unspent := s.unspent(sh)
+		if unspent == nil {
+			return []any{}, nil
+		}
+		return unspent, nil
+
+	case "blockchain.transaction.get":
+		var txid string
+		var verbose bool
+		if err := parseParams(params, &txid, &verbose); err != nil {
+			return nil, err
+		}
+		hash, err := chainhash.NewHashFromStr(txid)
+		if err != nil {
+			return nil, err
+		}
+		e, ok := s.txs[*hash]
+		if !ok {
+			return nil, &electrumx.RPCError{Code: 2, Message: "No such mempool or blockchain transaction"}
+		}
+		if verbose {
+			return s.verboseTx(e), nil
+		}
+		return hex.EncodeToString(serializeTx(e.tx)), nil
+	case "blockchain.transaction.get_merkle":
+		var txid string
+		var height int32
+		if err := parseParams(params, &txid, &height); err != nil {
+			return nil, err
+		}
+		hash, err := chainhash.NewHashFromStr(txid)
+		if err != nil {
+			return nil, err
+		}
+		e, ok := s.txs[*hash]
+		if !ok || e.height != height {
+			return nil, fmt.Errorf("tx %s not in block at height %d", txid, height)
+		}
+		_, branch := merkleBranch(blockTxids(s.blocks[height]), e.pos)
+		return &electrumx.GetMerkleResult{
+			BlockHeight: uint32(height),
+			Merkle:      hashStrings(branch),
+			Pos:         uint32(e.pos),
+		}, nil
+	case "blockchain.transaction.id_from_pos":
+		var height, pos int32
+		var merkle bool
+		if err := parseParams(params, &height, &pos, &merkle); err != nil {
+			return nil, err
+		}
+		if height < 0 || height > s.height() || pos < 0 || int(pos) >= len(s.blocks[height].txs) {
+			return nil, fmt.Errorf("no tx at position %d in block at height %d", pos, height)
+		}
+		txids := blockTxids(s.blocks[height])
+		if !merkle {
+			return txids[pos].String(), nil
+		}
+		_, branch := merkleBranch(txids, int(pos))
+		return &electrumx.IDFromPosResult{
+			TxHash: txids[pos].String(),
+			Merkle: hashStrings(branch),
+		}, nil
+
+	case "blockchain.estimatefee":
+		var blocks int
+		if err := parseParams(params, &blocks); err != nil {
+			return nil, err
+		}
+		return s.feeEstimate(blocks), nil
+	case "blockchain.relayfee":
+		return s.relayFee, nil
+	case "mempool.get_fee_histogram":
+		histogram := make([][2]float64, len(s.histogram))
+		for i, e := range s.histogram {
+			histogram[i] = [2]float64{e.FeeRate, float64(e.VSize)}
+		}
+		return histogram, nil
+	}
+	return nil, &electrumx.RPCError{Code: -32601, Message: "unknown method " + method}
+}
+
+func (s *Server) tipResult() *electrumx.HeadersNotifyResult {
+	return &electrumx.HeadersNotifyResult{
+		Height: s.height(),
+		Hex:    hex.EncodeToString(serializeHeader(&s.tip().header)),
+	}
+}
+
+func (s *Server) headersResult(start, count int32) map[string]any {
+	const maxHeaders = 2016
+	if count > maxHeaders {
+		count = maxHeaders
+	}
+	var hdrs []string
+	for h := start; h >= 0 && h <= s.height() && h < start+count; h++ {
+		hdrs = append(hdrs, hex.EncodeToString(serializeHeader(&s.blocks[h].header)))
+	}
+	res := map[string]any{
+		"count": len(hdrs),
+		"max":   maxHeaders,
+	}
+	if headersList(s.proto) {
+		if hdrs == nil {
+			hdrs = []string{}
+		}
+		res["headers"] = hdrs
+	} else {
+		res["hex"] = strings.Join(hdrs, "")
+	}
+	return res
+}
+
+// headersList reports whether blockchain.block.headers returns a list of
+// headers, as it does from protocol 1.5.
+func headersList(proto string) bool {
+	var major, minor int
+	fmt.Sscanf(proto, "%d.%d", &major, &minor)
+	return major > 1 || (major == 1 && minor >= 5)
+}
+
+func (s *Server) feeEstimate(blocks int) float64 {
+	best := -1
+	for target := range s.fees {
+		if target <= blocks && target > best {
+			best = target
+		}
+	}
+	if best < 0 {
+		return -1
+	}
+	return s.fees[best]
+}
+
+func (s *Server) verboseTx(e *txEntry) *electrumx.GetTransactionResult {
+	tx := e.tx
+	res := &electrumx.GetTransactionResult{
+		TxID:     tx.TxHash().String(),
+		Version:  uint32(tx.Version),
+		Size:     uint32(tx.SerializeSize()),
+		VSize:    uint32((tx.SerializeSizeStripped()*3 + tx.SerializeSize() + 3) / 4),
+		Weight:   uint32(tx.SerializeSizeStripped()*3 + tx.SerializeSize()),
+		LockTime: tx.LockTime,
+		Hex:      hex.EncodeToString(serializeTx(tx)),
+	}
+	for _, in := range tx.TxIn {
+		vin := electrumx.Vin{
+			TxID:      in.PreviousOutPoint.Hash.String(),
+			Vout:      in.PreviousOutPoint.Index,
+			SigScript: &electrumx.SigScript{Hex: hex.EncodeToString(in.SignatureScript)},
+			Sequence:  in.Sequence,
+		}
+		for _, w := range in.Witness {
+			vin.Witness = append(vin.Witness, hex.EncodeToString(w))
+		}
+		res.Vin = append(res.Vin, vin)
+	}
+	for i, out := range tx.TxOut {
+		res.Vout = append(res.Vout, electrumx.Vout{
+			Value:    btcutil.Amount(out.Value).ToBTC(),
+			N:        uint32(i),
+			PkScript: electrumx.PkScript{Hex: hex.EncodeToString(out.PkScript)},
+		})
+	}
+	if e.height >= 0 {
+		hdr := &s.blocks[e.height].header
+		res.BlockHash = hdr.BlockHash().String()
+		res.Confirmations = s.height() - e.height + 1
+		res.Time = hdr.Timestamp.Unix()
+		res.BlockTime = res.Time
+	}
+	return res
+}
+
+// parseParams unmarshals the positional params into args. Missing trailing
+// params leave their args unchanged.
+func parseParams(params []json.RawMessage, args ...any) error {
+	if len(params) > len(args) {
+		params = params[:len(args)]
+	}
+	if len(params) == 0 && len(args) > 0 {
+		return errors.New("missing params")
+	}
+	for i, p := range params {
+		if err := json.Unmarshal(p, args[i]); err != nil {
+			return fmt.Errorf("invalid param %d: %w", i, err)
+		}
+	}
+	return nil
+}
+
+func decodeTx(rawTx string) (*wire.MsgTx, error) {
+	b, err := hex.DecodeString(rawTx)
+	if err != nil {
+		return nil, err
+	}
+	tx := new(wire.MsgTx)
+	if err = tx.Deserialize(bytes.NewReader(b)); err != nil {
+		return nil, err
+	}
+	return tx, nil
+}
+
+func hashStrings(hashes []chainhash.Hash) []string {
+	strs := make([]string, len(hashes))
+	for i, h := range hashes {
+		strs[i] = h.String()
+	}
+	return strs
+}
+
+func nonNil(history electrumx.HistoryResult) electrumx.HistoryResult {
+	if history == nil {
+		return electrumx.HistoryResult{}
+	}
+	return history
+}
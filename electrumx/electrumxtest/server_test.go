@@ -0,0 +1,361 @@
+package electrumxtest
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"main/electrumx"
+
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+)
+
+var testScript = []byte{txscript.OP_DUP, txscript.OP_HASH160, txscript.OP_DATA_20,
+	1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16, 17, 18, 19, 20,
+	txscript.OP_EQUALVERIFY, txscript.OP_CHECKSIG}
+
+func startServer(t *testing.T, tls bool) (*Server, *electrumx.ServerConn) {
+	s := NewServer(&chaincfg.RegressionNetParams)
+	opts := &electrumx.ConnectOpts{}
+	if tls {
+		if err := s.StartTLS(); err != nil {
+			t.Fatal(err)
+		}
+		opts.TLSConfig = s.ClientTLSConfig()
+	} else if err := s.Start(); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	sc, err := electrumx.ConnectServer(ctx, s.Addr(), opts)
+	if err != nil {
+		cancel()
+		s.Close()
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		cancel()
+		<-sc.Done()
+		s.Close()
+	})
+	return s, sc
+}
+
+func spend(prev *wire.MsgTx, index uint32, value int64, pkScript []byte) *wire.MsgTx {
+	txid := prev.TxHash()
+	tx := wire.NewMsgTx(wire.TxVersion)
+	tx.AddTxIn(wire.NewTxIn(wire.NewOutPoint(&txid, index), nil, nil))
+	tx.AddTxOut(wire.NewTxOut(value, pkScript))
+	return tx
+}
+
+func waitHeaders(t *testing.T, sc *electrumx.ServerConn) *electrumx.HeadersNotifyResult {
+	select {
+	case n := <-sc.GetHeadersNotify(context.Background()):
+		return n
+	case <-time.After(time.Second):
+		t.Fatal("no headers notification")
+		return nil
+	}
+}
+
+func waitStatus(t *testing.T, sc *electrumx.ServerConn) *electrumx.ScripthashStatusResult {
+	select {
+	case n := <-sc.GetScripthashNotify(context.Background()):
+		return n
+	case <-time.After(time.Second):
+		t.Fatal("no scripthash notification")
+		return nil
+	}
+}
+
+func TestHeaders(t *testing.T) {
+	s, sc := startServer(t, false)
+	ctx := context.Background()
+
+	feats, err := sc.Features(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if feats.Genesis != chaincfg.RegressionNetParams.GenesisHash.String() {
+		t.Fatalf("wrong genesis %s", feats.Genesis)
+	}
+
+	tip, err := sc.SubscribeHeaders(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tip.Height != 0 {
+		t.Fatalf("tip height %d", tip.Height)
+	}
+
+	s.MineEmptyBlocks(3)
+	if n := waitHeaders(t, sc); n.Height != 3 {
+		t.Fatalf("notified height %d", n.Height)
+	}
+
+	res, err := sc.BlockHeaders(ctx, 0, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Count != 4 {
+		t.Fatalf("got %d headers", res.Count)
+	}
+	b, _ := hex.DecodeString(res.HexConcat)
+	var prev chainhash.Hash
+	for i := 0; i < 4; i++ {
+		var hdr wire.BlockHeader
+		if err = hdr.Deserialize(bytes.NewReader(b[i*80:])); err != nil {
+			t.Fatal(err)
+		}
+		if i > 0 && hdr.PrevBlock != prev {
+			t.Fatalf("header %d does not connect", i)
+		}
+		prev = hdr.BlockHash()
+	}
+	if hash, _ := s.BlockHash(3); hash != prev {
+		t.Fatal("tip hash mismatch")
+	}
+
+	// a mempool change does not notify a new tip
+	s.Fund(testScript, 1000)
+	s.MineBlock()
+	if n := waitHeaders(t, sc); n.Height != 4 {
+		t.Fatalf("notified height %d", n.Height)
+	}
+}
+
+func TestScripthash(t *testing.T) {
+	s, sc := startServer(t, false)
+	ctx := context.Background()
+	sh := Scripthash(testScript)
+
+	sub, err := sc.SubscribeScripthash(ctx, sh)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sub.Status != "" {
+		t.Fatalf("status of unused scripthash %q", sub.Status)
+	}
+
+	fund := s.Fund(testScript, 5000)
+	n := waitStatus(t, sc)
+	history, err := sc.GetHistory(ctx, sh)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(history) != 1 || history[0].Height != 0 || history[0].TxHash != fund.TxHash().String() {
+		t.Fatalf("history %+v", history)
+	}
+	if n.Status != statusHash(history) {
+		t.Fatal("notified status does not match history")
+	}
+
+	// spend the funding output in the mempool: its child has unconfirmed parents
+	spendTx := spend(fund, 0, 4000, []byte{txscript.OP_TRUE})
+	var buf bytes.Buffer
+	spendTx.Serialize(&buf)
+	txid, err := sc.Broadcast(ctx, hex.EncodeToString(buf.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if txid != spendTx.TxHash().String() {
+		t.Fatalf("broadcast returned %s", txid)
+	}
+	waitStatus(t, sc)
+	mempool, err := sc.GetMempool(ctx, sh)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(mempool) != 2 || mempool[1].Height != -1 || mempool[1].Fee != 1000 {
+		t.Fatalf("mempool %+v", mempool)
+	}
+	bal, err := sc.GetBalance(ctx, sh)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bal.Confirmed != 0 || bal.Unconfirmed != 0 {
+		t.Fatalf("balance %+v", bal)
+	}
+
+	// a double spend is rejected
+	buf.Reset()
+	spend(fund, 0, 3000, []byte{txscript.OP_TRUE}).Serialize(&buf)
+	if _, err = sc.Broadcast(ctx, hex.EncodeToString(buf.Bytes())); err == nil {
+		t.Fatal("double spend accepted")
+	}
+
+	s.MineBlock(fund)
+	waitStatus(t, sc)
+	bal, err = sc.GetBalance(ctx, sh)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bal.Confirmed != 5000 || bal.Unconfirmed != -5000 {
+		t.Fatalf("balance %+v", bal)
+	}
+	unspent, err := sc.ListUnspent(ctx, sh)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(unspent) != 0 {
+		t.Fatalf("unspent %+v", unspent)
+	}
+
+	// evicting the spend makes the funding output unspent again
+	s.RemoveMempoolTx(spendTx.TxHash())
+	waitStatus(t, sc)
+	unspent, err = sc.ListUnspent(ctx, sh)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(unspent) != 1 || unspent[0].Height != 1 || unspent[0].Value != 5000 {
+		t.Fatalf("unspent %+v", unspent)
+	}
+}
+
+func TestReorg(t *testing.T) {
+	s, sc := startServer(t, false)
+	ctx := context.Background()
+	sh := Scripthash(testScript)
+
+	fund := s.Fund(testScript, 5000)
+	s.MineBlock()
+	s.MineEmptyBlocks(2)
+	if _, err := sc.SubscribeHeaders(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := sc.SubscribeScripthash(ctx, sh); err != nil {
+		t.Fatal(err)
+	}
+	oldTip, _ := s.BlockHash(3)
+
+	if err := s.Reorg(3, 4); err != nil {
+		t.Fatal(err)
+	}
+	if n := waitHeaders(t, sc); n.Height != 4 {
+		t.Fatalf("notified height %d", n.Height)
+	}
+	if hash, _ := s.BlockHash(3); hash == oldTip {
+		t.Fatal("block 3 not replaced")
+	}
+	waitStatus(t, sc)
+	if _, height, _ := s.Transaction(fund.TxHash()); height != -1 {
+		t.Fatalf("reorged tx at height %d", height)
+	}
+
+	s.MineBlock()
+	waitStatus(t, sc)
+	history, err := sc.GetHistory(ctx, sh)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(history) != 1 || history[0].Height != 5 {
+		t.Fatalf("history %+v", history)
+	}
+}
+
+func TestMerkle(t *testing.T) {
+	s, sc := startServer(t, true)
+	ctx := context.Background()
+
+	var txs []*wire.MsgTx
+	for i := 0; i < 4; i++ {
+		txs = append(txs, s.Fund(testScript, int64(1000+i)))
+	}
+	s.MineBlock()
+
+	for pos := 1; pos <= 4; pos++ {
+		txid := txs[pos-1].TxHash()
+		res, err := sc.GetMerkle(ctx, txid.String(), 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if res.Pos != uint32(pos) {
+			t.Fatalf("pos %d, want %d", res.Pos, pos)
+		}
+		// fold the branch into the merkle root of the header
+		root := txid
+		idx := pos
+		for _, str := range res.Merkle {
+			h, err := chainhash.NewHashFromStr(str)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var buf []byte
+			if idx%2 == 0 {
+				buf = append(root[:], h[:]...)
+			} else {
+				buf = append(h[:], root[:]...)
+			}
+			root = chainhash.DoubleHashH(buf)
+			idx /= 2
+		}
+		hdrHex, err := sc.BlockHeader(ctx, 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, _ := hex.DecodeString(hdrHex)
+		var hdr wire.BlockHeader
+		hdr.Deserialize(bytes.NewReader(b))
+		if hdr.MerkleRoot != root {
+			t.Fatalf("merkle branch of tx %d does not match the header", pos)
+		}
+
+		id, err := sc.IDFromPos(ctx, 1, uint32(pos))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if id != txid.String() {
+			t.Fatalf("id_from_pos %d got %s", pos, id)
+		}
+	}
+}
+
+func TestHandle(t *testing.T) {
+	s, sc := startServer(t, false)
+	ctx := context.Background()
+
+	s.SetFeeEstimate(2, 0.0002)
+	s.SetFeeEstimate(6, 0.0001)
+	for _, tt := range []struct {
+		blocks uint32
+		want   float64
+	}{{1, -1}, {2, 0.0002}, {5, 0.0002}, {25, 0.0001}} {
+		fee, err := sc.EstimateFee(ctx, tt.blocks)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if fee != tt.want {
+			t.Errorf("estimatefee %d got %v, want %v", tt.blocks, fee, tt.want)
+		}
+	}
+
+	s.Handle("blockchain.relayfee", func(params []json.RawMessage) (any, error) {
+		return nil, &electrumx.RPCError{Code: 2, Message: "daemon error"}
+	})
+	_, err := sc.RelayFee(ctx)
+	rpcErr, ok := err.(*electrumx.RPCError)
+	if !ok || rpcErr.Code != 2 || rpcErr.Message != "daemon error" {
+		t.Fatalf("got error %v", err)
+	}
+	if s.RequestCount("blockchain.relayfee") != 1 {
+		t.Fatal("request not counted")
+	}
+	s.Handle("blockchain.relayfee", nil)
+	if fee, err := sc.RelayFee(ctx); err != nil || fee != 0.00001 {
+		t.Fatalf("relayfee %v %v", fee, err)
+	}
+
+	if err = s.Notify("blockchain.headers.subscribe", []any{map[string]any{"height": 7, "hex": "00"}}); err != nil {
+		t.Fatal(err)
+	}
+	if n := waitHeaders(t, sc); n.Height != 7 {
+		t.Fatalf("notified height %d", n.Height)
+	}
+}
@@ -2,21 +2,20 @@ package elxbtc
 
 import (
 	"context"
-	"crypto/tls"
-	"crypto/x509"
 	"errors"
 	"fmt"
-	"log"
-	"net"
 	"os"
 	"os/signal"
+	"sync"
 
 	"main/electrumx"
 )
 
 type SingleNode struct {
-	Config *electrumx.NodeConfig
-	Server *electrumx.ElectrumXSvrConn
+	Config  *electrumx.NodeConfig
+	Server  *electrumx.ElectrumXSvrConn
+	Servers *electrumx.ServerList
+	Certs   *electrumx.CertStore
 }
 
 func NewSingleNode(cfg *electrumx.NodeConfig) *SingleNode {
@@ -27,32 +26,23 @@ func NewSingleNode(cfg *electrumx.NodeConfig) *SingleNode {
 	return &n
 }
 
+// Start connects to the trusted peer. If there is none, or it cannot be
+// reached or serves another chain, the best scored servers of the server list
+// are tried instead.
 func (s *SingleNode) Start() error {
-	trustedServer := s.Config.TrustedPeer
-	if trustedServer == nil {
-		return errors.New("SingleNode requires a trusted ElectrumX server")
-	}
-	netProto := trustedServer.Network()
-	addr := trustedServer.String()
-	host, _, err := net.SplitHostPort(addr)
-	if err != nil {
-		log.Fatal(err)
-	}
-
-	var tlsConfig *tls.Config = nil
-	if netProto == "ssl" {
-		rootCAs, _ := x509.SystemCertPool()
-		tlsConfig = &tls.Config{
-			InsecureSkipVerify: true,
-			RootCAs:            rootCAs,
-			MinVersion:         tls.VersionTLS12, // works ok
-			ServerName:         host,
+	if s.Servers == nil {
+		servers, err := OpenServerList(s.Config)
+		if err != nil {
+			return err
 		}
+		s.Servers = servers
 	}
-
-	opts := &electrumx.ConnectOpts{
-		TLSConfig:   tlsConfig,
-		DebugLogger: electrumx.StderrPrinter,
+	if s.Certs == nil {
+		certs, err := electrumx.NewCertStore(s.Config.DataDir)
+		if err != nil {
+			return err
+		}
+		s.Certs = certs
 	}
 
 	network := s.Config.Params.Name
@@ -65,31 +55,21 @@ func (s *SingleNode) Start() error {
 	// dev
 	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
 
-	sc, err := electrumx.ConnectServer(ctx, addr, opts)
+	candidates := candidateServers(s.Config, s.Servers, maxServerTries)
+	server, err := connectBest(ctx, s.Config, s.Servers, s.Certs, candidates)
 	if err != nil {
 		cancel()
 		return err
 	}
-	s.Server = &electrumx.ElectrumXSvrConn{
-		SvrConn: sc,
-		SvrCtx:  ctx,
-		Running: true,
+	s.Server = server
+	if server.Addr != candidates[0] && s.Config.ServerSwitched != nil {
+		s.Config.ServerSwitched(candidates[0], server.Addr)
 	}
 
-	fmt.Println(sc.Proto())
-
-	fmt.Printf("\n ** Connected to %s **\n", network)
-
-	feats, err := sc.Features(ctx)
-	if err != nil {
-		cancel()
-		return err
-	}
+	fmt.Println(server.SvrConn.Proto())
 
-	if feats.Genesis != genesis {
-		return errors.New("wrong genesis hash for Bitcoin")
-	}
-	fmt.Println("Genesis correct: ", "0x"+feats.Genesis)
+	fmt.Printf("\n ** Connected to %s on %s **\n", server.Addr, network)
+	fmt.Println("Genesis correct: ", "0x"+genesis)
 
 	return nil
 }
@@ -168,6 +148,91 @@ func (s *SingleNode) GetHistory(scripthash string) (electrumx.HistoryResult, err
 	return server.SvrConn.GetHistory(server.SvrCtx, scripthash)
 }
 
+func (s *SingleNode) GetMempool(scripthash string) (electrumx.HistoryResult, error) {
+	server := s.Server
+	if !server.Running {
+		return nil, ErrServerNotRunning
+	}
+	return server.SvrConn.GetMempool(server.SvrCtx, scripthash)
+}
+
+func (s *SingleNode) GetRawTransaction(txid string) (string, error) {
+	server := s.Server
+	if !server.Running {
+		return "", ErrServerNotRunning
+	}
+	return server.SvrConn.GetRawTransaction(server.SvrCtx, txid)
+}
+
+func (s *SingleNode) GetMerkle(txid string, height uint32) (*electrumx.GetMerkleResult, error) {
+	server := s.Server
+	if !server.Running {
+		return nil, ErrServerNotRunning
+	}
+	return server.SvrConn.GetMerkle(server.SvrCtx, txid, height)
+}
+
+func (s *SingleNode) EstimateFee(blocks int) (float64, error) {
+	server := s.Server
+	if !server.Running {
+		return 0, ErrServerNotRunning
+	}
+	return server.SvrConn.EstimateFee(server.SvrCtx, uint32(blocks))
+}
+
+func (s *SingleNode) RelayFee() (float64, error) {
+	server := s.Server
+	if !server.Running {
+		return 0, ErrServerNotRunning
+	}
+	return server.SvrConn.RelayFee(server.SvrCtx)
+}
+
+func (s *SingleNode) FeeHistogram() ([]electrumx.FeeHistogramEntry, error) {
+	server := s.Server
+	if !server.Running {
+		return nil, ErrServerNotRunning
+	}
+	return server.SvrConn.FeeHistogram(server.SvrCtx)
+}
+
+// PeerAddrs returns the server's peers that can be dialed, including onion
+// peers if the node connects through a proxy
+func (s *SingleNode) PeerAddrs() (ssl, tcpOnlyOnion []string, err error) {
+	server := s.Server
+	if !server.Running {
+		return nil, nil, ErrServerNotRunning
+	}
+	return server.SvrConn.PeerAddrs(server.SvrCtx, s.Config.Proxy)
+}
+
+// BanServer bans a server for misbehaviour such as sending invalid headers or
+// proofs, so it is not picked again until the ban expires. If it is the
+// connected server the node connects to another and calls ServerSwitched
+// before dropping the banned server's connection.
+func (s *SingleNode) BanServer(addr electrumx.ServerAddr, reason string) error {
+	err := s.Servers.Misbehaved(addr, reason)
+	if err != nil {
+		return err
+	}
+	server := s.Server
+	if server == nil || server.Addr != addr || !server.Running {
+		return nil
+	}
+	candidates := candidateServers(s.Config, s.Servers, maxServerTries)
+	next, err := connectBest(server.SvrCtx, s.Config, s.Servers, s.Certs, candidates)
+	if err == nil {
+		s.Server = next
+		if s.Config.ServerSwitched != nil {
+			s.Config.ServerSwitched(addr, next.Addr)
+		}
+	}
+	server.Running = false
+	server.SvrConn.Shutdown()
+	<-server.SvrConn.Done()
+	return err
+}
+
 func (s *SingleNode) Broadcast(rawTx string) (string, error) {
 	server := s.Server
 	if !server.Running {
@@ -183,17 +248,299 @@ func (s *SingleNode) Broadcast(rawTx string) (string, error) {
 // /////////////////////////////////////////////////////////////////////////////
 // MultiNode
 // //////////
+
+// MultiNode connects to several of the best scored servers of the server list.
+// Requests go to the leader, at first the best server connected. The first
+// request after the leader's connection is lost makes the next connected
+// server the leader and calls ServerSwitched. Notifications subscribed from a lost leader stop,
+// so subscribe again after a switch.
 type MultiNode struct {
 	NodeConfig *electrumx.NodeConfig
 	ServerMap  map[string]*electrumx.ElectrumXSvrConn
+	Servers    *electrumx.ServerList
+	Certs      *electrumx.CertStore
+
+	mtx sync.Mutex
+	// the connected servers best first
+	order  []*electrumx.ElectrumXSvrConn
+	leader *electrumx.ElectrumXSvrConn
+}
+
+// The number of servers a MultiNode connects to
+const multiNodeConns = 3
+
+func NewMultiNode(cfg *electrumx.NodeConfig) *MultiNode {
+	return &MultiNode{
+		NodeConfig: cfg,
+		ServerMap:  make(map[string]*electrumx.ElectrumXSvrConn),
+	}
 }
 
+// Start connects to the best scored servers of the server list, up to
+// multiNodeConns of them, trying the trusted peer first
 func (m *MultiNode) Start() error {
 	fmt.Println("starting multi node")
-	// TODO:
+	if m.Servers == nil {
+		servers, err := OpenServerList(m.NodeConfig)
+		if err != nil {
+			return err
+		}
+		m.Servers = servers
+	}
+	if m.Certs == nil {
+		certs, err := electrumx.NewCertStore(m.NodeConfig.DataDir)
+		if err != nil {
+			return err
+		}
+		m.Certs = certs
+	}
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	if m.ServerMap == nil {
+		m.ServerMap = make(map[string]*electrumx.ElectrumXSvrConn)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	candidates := candidateServers(m.NodeConfig, m.Servers, maxServerTries+multiNodeConns)
+	for _, addr := range candidates {
+		if len(m.ServerMap) == multiNodeConns {
+			break
+		}
+		server, err := connectServer(ctx, m.NodeConfig, m.Servers, m.Certs, addr)
+		if err != nil {
+			fmt.Printf("could not connect to %s: %v\n", addr, err)
+			continue
+		}
+		m.ServerMap[addr.Addr] = server
+		m.order = append(m.order, server)
+	}
+	if len(m.order) == 0 {
+		cancel()
+		return errors.New("could not connect to any ElectrumX server")
+	}
+	m.leader = m.order[0]
+	if m.leader.Addr != candidates[0] && m.NodeConfig.ServerSwitched != nil {
+		m.NodeConfig.ServerSwitched(candidates[0], m.leader.Addr)
+	}
+	conns := make([]*electrumx.ServerConn, 0, len(m.order))
+	for _, server := range m.order {
+		conns = append(conns, server.SvrConn)
+	}
+	go func() {
+		// cancel once all connections are done
+		for _, sc := range conns {
+			<-sc.Done()
+		}
+		cancel()
+	}()
 	return nil
 }
+
 func (m *MultiNode) Stop() {
 	fmt.Println("stopping multi node")
-	// TODO:
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	for addr, server := range m.ServerMap {
+		if server.Running {
+			server.Running = false
+			server.SvrConn.Shutdown()
+			<-server.SvrConn.Done()
+		}
+		delete(m.ServerMap, addr)
+	}
+	m.order = nil
 }
+
+// connected is true until the server is stopped or its connection is lost
+func connected(server *electrumx.ElectrumXSvrConn) bool {
+	if !server.Running {
+		return false
+	}
+	select {
+	case <-server.SvrConn.Done():
+		return false
+	default:
+		return true
+	}
+}
+
+// server returns the leader, first moving the lead to the next connected
+// server if the leader's connection is lost
+func (m *MultiNode) server() (*electrumx.ElectrumXSvrConn, error) {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	if m.leader != nil && connected(m.leader) {
+		return m.leader, nil
+	}
+	for _, server := range m.order {
+		if !connected(server) {
+			continue
+		}
+		if m.leader != nil && m.NodeConfig.ServerSwitched != nil {
+			m.NodeConfig.ServerSwitched(m.leader.Addr, server.Addr)
+		}
+		m.leader = server
+		return server, nil
+	}
+	return nil, ErrServerNotRunning
+}
+
+// GetServerConn returns the leader, which may have lost its connection if no
+// server is left
+func (m *MultiNode) GetServerConn() *electrumx.ElectrumXSvrConn {
+	if server, err := m.server(); err == nil {
+		return server
+	}
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	return m.leader
+}
+
+func (m *MultiNode) GetHeadersNotify() (<-chan *electrumx.HeadersNotifyResult, error) {
+	server, err := m.server()
+	if err != nil {
+		return nil, err
+	}
+	return server.SvrConn.GetHeadersNotify(server.SvrCtx), nil
+}
+
+func (m *MultiNode) SubscribeHeaders() (*electrumx.HeadersNotifyResult, error) {
+	server, err := m.server()
+	if err != nil {
+		return nil, err
+	}
+	return server.SvrConn.SubscribeHeaders(server.SvrCtx)
+}
+
+func (m *MultiNode) BlockHeaders(startHeight, blockCount uint32) (*electrumx.GetBlockHeadersResult, error) {
+	server, err := m.server()
+	if err != nil {
+		return nil, err
+	}
+	return server.SvrConn.BlockHeaders(server.SvrCtx, startHeight, blockCount)
+}
+
+func (m *MultiNode) GetScripthashNotify() (<-chan *electrumx.ScripthashStatusResult, error) {
+	server, err := m.server()
+	if err != nil {
+		return nil, err
+	}
+	return server.SvrConn.GetScripthashNotify(server.SvrCtx), nil
+}
+
+func (m *MultiNode) SubscribeScripthashNotify(scripthash string) (*electrumx.ScripthashStatusResult, error) {
+	server, err := m.server()
+	if err != nil {
+		return nil, err
+	}
+	return server.SvrConn.SubscribeScripthash(server.SvrCtx, scripthash)
+}
+
+func (m *MultiNode) UnsubscribeScripthashNotify(scripthash string) {
+	server, err := m.server()
+	if err != nil {
+		return
+	}
+	server.SvrConn.UnsubscribeScripthash(server.SvrCtx, scripthash)
+}
+
+func (m *MultiNode) GetHistory(scripthash string) (electrumx.HistoryResult, error) {
+	server, err := m.server()
+	if err != nil {
+		return nil, err
+	}
+	return server.SvrConn.GetHistory(server.SvrCtx, scripthash)
+}
+
+func (m *MultiNode) GetMempool(scripthash string) (electrumx.HistoryResult, error) {
+	server, err := m.server()
+	if err != nil {
+		return nil, err
+	}
+	return server.SvrConn.GetMempool(server.SvrCtx, scripthash)
+}
+
+func (m *MultiNode) GetRawTransaction(txid string) (string, error) {
+	server, err := m.server()
+	if err != nil {
+		return "", err
+	}
+	return server.SvrConn.GetRawTransaction(server.SvrCtx, txid)
+}
+
+func (m *MultiNode) GetMerkle(txid string, height uint32) (*electrumx.GetMerkleResult, error) {
+	server, err := m.server()
+	if err != nil {
+		return nil, err
+	}
+	return server.SvrConn.GetMerkle(server.SvrCtx, txid, height)
+}
+
+func (m *MultiNode) EstimateFee(blocks int) (float64, error) {
+	server, err := m.server()
+	if err != nil {
+		return 0, err
+	}
+	return server.SvrConn.EstimateFee(server.SvrCtx, uint32(blocks))
+}
+
+func (m *MultiNode) RelayFee() (float64, error) {
+	server, err := m.server()
+	if err != nil {
+		return 0, err
+	}
+	return server.SvrConn.RelayFee(server.SvrCtx)
+}
+
+func (m *MultiNode) FeeHistogram() ([]electrumx.FeeHistogramEntry, error) {
+	server, err := m.server()
+	if err != nil {
+		return nil, err
+	}
+	return server.SvrConn.FeeHistogram(server.SvrCtx)
+}
+
+// PeerAddrs returns the leader's peers that can be dialed, including onion
+// peers if the node connects through a proxy
+func (m *MultiNode) PeerAddrs() (ssl, tcpOnlyOnion []string, err error) {
+	server, err := m.server()
+	if err != nil {
+		return nil, nil, err
+	}
+	return server.SvrConn.PeerAddrs(server.SvrCtx, m.NodeConfig.Proxy)
+}
+
+// BanServer bans a server for misbehaviour such as sending invalid headers or
+// proofs and drops its connection. If it is the leader the lead moves to the
+// next connected server.
+func (m *MultiNode) BanServer(addr electrumx.ServerAddr, reason string) error {
+	err := m.Servers.Misbehaved(addr, reason)
+	if err != nil {
+		return err
+	}
+	m.mtx.Lock()
+	server, ok := m.ServerMap[addr.Addr]
+	if !ok || !server.Running {
+		m.mtx.Unlock()
+		return nil
+	}
+	server.Running = false
+	m.mtx.Unlock()
+	server.SvrConn.Shutdown()
+	<-server.SvrConn.Done()
+	_, err = m.server()
+	return err
+}
+
+func (m *MultiNode) Broadcast(rawTx string) (string, error) {
+	server, err := m.server()
+	if err != nil {
+		return "", err
+	}
+	return server.SvrConn.Broadcast(server.SvrCtx, rawTx)
+}
+
+// Ensure both nodes implement the electrumx.ElectrumXNode interface.
+var (
+	_ electrumx.ElectrumXNode = (*SingleNode)(nil)
+	_ electrumx.ElectrumXNode = (*MultiNode)(nil)
+)
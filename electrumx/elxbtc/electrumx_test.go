@@ -1,5 +1,3 @@
-///go:build harness
-
 package elxbtc
 
 import (
@@ -32,6 +30,10 @@ var (
 	mainGenesis = "000000000019d6689c085ae165831e934ff763ae46a2a6c172b3f1b60a8ce26f"
 )
 
+// liveServersEnv opts in to the tests against public servers, which need the
+// network. The in-process electrumxtest server covers the node otherwise.
+const liveServersEnv = "GOELE_LIVE_SERVERS"
+
 func TestRunMainnetNode(t *testing.T) {
 	RunNode(t, ex.Mainnet, mainServerAddr, mainTx, mainGenesis, true)
 }
@@ -41,6 +43,9 @@ func TestRunTestnetNode(t *testing.T) {
 }
 
 func RunNode(t *testing.T, network ex.Network, addr, tx, genesis string, useTls bool) {
+	if os.Getenv(liveServersEnv) == "" {
+		t.Skipf("set %s=1 to test against public servers", liveServersEnv)
+	}
 	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
 	// ctx, cancel := context.WithTimeout(context.Background(), 45*time.Second)
 	defer cancel()
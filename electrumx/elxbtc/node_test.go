@@ -0,0 +1,338 @@
+package elxbtc
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"main/electrumx"
+	"main/electrumx/electrumxtest"
+
+	"github.com/btcsuite/btcd/chaincfg"
+)
+
+func startTLSServer(t *testing.T) (*electrumxtest.Server, string) {
+	srv := electrumxtest.NewServer(&chaincfg.RegressionNetParams)
+	if err := srv.StartTLS(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(srv.Close)
+	block, _ := pem.Decode(srv.CertPEM())
+	return srv, electrumx.CertFingerprint(block.Bytes)
+}
+
+func sslNodeConfig(dataDir, addr string) *electrumx.NodeConfig {
+	return &electrumx.NodeConfig{
+		Params:      &chaincfg.RegressionNetParams,
+		DataDir:     dataDir,
+		TrustedPeer: electrumx.ServerAddr{Net: "ssl", Addr: addr},
+	}
+}
+
+func TestSingleNodeCertPinning(t *testing.T) {
+	srvA, fpA := startTLSServer(t)
+	srvB, fpB := startTLSServer(t)
+	dataDir := t.TempDir()
+
+	// first use pins the certificate in the data dir
+	node := NewSingleNode(sslNodeConfig(dataDir, srvA.Addr()))
+	if err := node.Start(); err != nil {
+		t.Fatal(err)
+	}
+	node.Stop()
+	certs, err := electrumx.NewCertStore(dataDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fp, ok := certs.Get(srvA.Addr()); !ok || fp != fpA {
+		t.Fatalf("pinned %q, want %q", fp, fpA)
+	}
+	if _, err = os.Stat(filepath.Join(dataDir, electrumx.CERTS_FILE_NAME)); err != nil {
+		t.Fatal(err)
+	}
+
+	// the pinned certificate is accepted again
+	node = NewSingleNode(sslNodeConfig(dataDir, srvA.Addr()))
+	if err = node.Start(); err != nil {
+		t.Fatal(err)
+	}
+	node.Stop()
+
+	// a different certificate for a pinned server is refused
+	if err = certs.Pin(srvB.Addr(), fpA); err != nil {
+		t.Fatal(err)
+	}
+	node = NewSingleNode(sslNodeConfig(dataDir, srvB.Addr()))
+	// without servers to fall back on
+	node.Servers, _ = electrumx.NewServerList("", nil)
+	err = node.Start()
+	var mismatch *electrumx.CertMismatchError
+	if !errors.As(err, &mismatch) {
+		t.Fatalf("expected CertMismatchError, got %v", err)
+	}
+	if mismatch.Pinned != fpA || mismatch.Got != fpB {
+		t.Fatalf("mismatch %+v", mismatch)
+	}
+
+	// until the stale pin is removed
+	if err = certs.Remove(srvB.Addr()); err != nil {
+		t.Fatal(err)
+	}
+	node = NewSingleNode(sslNodeConfig(dataDir, srvB.Addr()))
+	if err = node.Start(); err != nil {
+		t.Fatal(err)
+	}
+	node.Stop()
+}
+
+func TestSingleNodeOperatorPin(t *testing.T) {
+	srv, fp := startTLSServer(t)
+	dataDir := t.TempDir()
+
+	// operator pins override the data dir and accept openssl style fingerprints
+	var colons []string
+	for i := 0; i < len(fp); i += 2 {
+		colons = append(colons, strings.ToUpper(fp[i:i+2]))
+	}
+	cfg := sslNodeConfig(dataDir, srv.Addr())
+	cfg.PinnedCerts = map[string]string{srv.Addr(): strings.Join(colons, ":")}
+	node := NewSingleNode(cfg)
+	if err := node.Start(); err != nil {
+		t.Fatal(err)
+	}
+	node.Stop()
+	certs, err := electrumx.NewCertStore(dataDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := certs.Get(srv.Addr()); ok {
+		t.Fatal("operator pinned certificate stored")
+	}
+
+	cfg.PinnedCerts[srv.Addr()] = strings.Repeat("00", 32)
+	node = NewSingleNode(cfg)
+	var mismatch *electrumx.CertMismatchError
+	if err = node.Start(); !errors.As(err, &mismatch) {
+		t.Fatalf("expected CertMismatchError, got %v", err)
+	}
+}
+
+func parseCert(t *testing.T, srv *electrumxtest.Server) *x509.Certificate {
+	block, _ := pem.Decode(srv.CertPEM())
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert
+}
+
+func TestSingleNodeCAVerified(t *testing.T) {
+	srvA, _ := startTLSServer(t)
+	srvB, fpB := startTLSServer(t)
+	certA, certB := parseCert(t, srvA), parseCert(t, srvB)
+	dataDir := t.TempDir()
+
+	// a CA verified certificate is accepted and the server recorded
+	certs, err := electrumx.NewCertStore(dataDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certs.RootCAs = x509.NewCertPool()
+	certs.RootCAs.AddCert(certA)
+	node := NewSingleNode(sslNodeConfig(dataDir, srvA.Addr()))
+	node.Certs = certs
+	if err = node.Start(); err != nil {
+		t.Fatal(err)
+	}
+	node.Stop()
+	if fp, _ := certs.Get(srvA.Addr()); fp != electrumx.CAVerified {
+		t.Fatalf("stored %q for a CA verified server", fp)
+	}
+
+	// a self-signed certificate for the same server is then refused, also
+	// after the store is opened again
+	reopened, err := electrumx.NewCertStore(dataDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reopened.RootCAs = certs.RootCAs
+	for _, store := range []*electrumx.CertStore{certs, reopened} {
+		tlsConfig, err := electrumx.PinnedTLSConfig(srvA.Addr(), store, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = tlsConfig.VerifyConnection(tls.ConnectionState{PeerCertificates: []*x509.Certificate{certB}})
+		var mismatch *electrumx.CertMismatchError
+		if !errors.As(err, &mismatch) || mismatch.Pinned != electrumx.CAVerified || mismatch.Got != fpB {
+			t.Fatalf("expected CertMismatchError, got %v", err)
+		}
+		if err = tlsConfig.VerifyConnection(tls.ConnectionState{PeerCertificates: []*x509.Certificate{certA}}); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func startServer(t *testing.T, params *chaincfg.Params) *electrumxtest.Server {
+	srv := electrumxtest.NewServer(params)
+	if err := srv.Start(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestSingleNodeFallback(t *testing.T) {
+	good := startServer(t, &chaincfg.RegressionNetParams)
+	good.AddPeer("1.2.3.4", "peer.example.com", "v1.4", "s50002")
+	wrongChain := startServer(t, &chaincfg.TestNet3Params)
+	dead := startServer(t, &chaincfg.RegressionNetParams)
+	deadAddr := electrumx.ServerAddr{Net: "tcp", Addr: dead.Addr()}
+	dead.Close()
+
+	dataDir := t.TempDir()
+	servers, err := electrumx.NewServerList(dataDir, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wrongAddr := electrumx.ServerAddr{Net: "tcp", Addr: wrongChain.Addr()}
+	goodAddr := electrumx.ServerAddr{Net: "tcp", Addr: good.Addr()}
+	servers.Add(wrongAddr, electrumx.SourceUser)
+	servers.Add(goodAddr, electrumx.SourceUser)
+	// prefer the wrong chain server so it is tried first
+	servers.RecordConnect(wrongAddr, time.Millisecond, "1.4")
+
+	cfg := &electrumx.NodeConfig{
+		Params:      &chaincfg.RegressionNetParams,
+		DataDir:     dataDir,
+		TrustedPeer: deadAddr,
+	}
+	var switched []electrumx.ServerAddr
+	cfg.ServerSwitched = func(from, to electrumx.ServerAddr) {
+		switched = append(switched, from, to)
+	}
+	node := NewSingleNode(cfg)
+	node.Servers = servers
+	if err = node.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer node.Stop()
+	if node.Server.Addr != goodAddr {
+		t.Fatalf("connected to %s", node.Server.Addr)
+	}
+	if len(switched) != 2 || switched[0] != deadAddr || switched[1] != goodAddr {
+		t.Fatalf("switched %v", switched)
+	}
+
+	if rec, _ := servers.Get(deadAddr.Addr); rec.Failures != 1 {
+		t.Fatalf("dead trusted peer %+v", rec)
+	}
+	if rec, _ := servers.Get(wrongAddr.Addr); !rec.BannedForever {
+		t.Fatalf("wrong chain server %+v", rec)
+	}
+	rec, _ := servers.Get(goodAddr.Addr)
+	if rec.Connects != 1 || !rec.GenesisOK || rec.Proto == "" {
+		t.Fatalf("good server %+v", rec)
+	}
+
+	// peers of the connected server are added in the background
+	deadline := time.Now().Add(time.Second)
+	for {
+		if _, ok := servers.Get("peer.example.com:50002"); ok {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("peer not added")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// a banned server is dropped for another
+	other := startServer(t, &chaincfg.RegressionNetParams)
+	otherAddr := electrumx.ServerAddr{Net: "tcp", Addr: other.Addr()}
+	servers.Add(otherAddr, electrumx.SourceUser)
+	servers.RecordConnect(otherAddr, time.Millisecond, "1.4")
+	banned := node.Server
+	if err = node.BanServer(goodAddr, "invalid headers"); err != nil {
+		t.Fatal(err)
+	}
+	if rec, _ = servers.Get(goodAddr.Addr); !rec.Banned(time.Now()) {
+		t.Fatal("server not banned")
+	}
+	select {
+	case <-banned.SvrConn.Done():
+	default:
+		t.Fatal("banned server still connected")
+	}
+	if node.Server.Addr != otherAddr || len(switched) != 4 || switched[2] != goodAddr || switched[3] != otherAddr {
+		t.Fatalf("switched %v to %s", switched, node.Server.Addr)
+	}
+}
+
+func TestMultiNodeStart(t *testing.T) {
+	dataDir := t.TempDir()
+	servers, err := electrumx.NewServerList(dataDir, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	byAddr := make(map[string]*electrumxtest.Server)
+	for i := 0; i < 4; i++ {
+		srv := startServer(t, &chaincfg.RegressionNetParams)
+		srv.MineEmptyBlocks(3)
+		servers.Add(electrumx.ServerAddr{Net: "tcp", Addr: srv.Addr()}, electrumx.SourceUser)
+		byAddr[srv.Addr()] = srv
+	}
+	var switched []electrumx.ServerAddr
+	node := NewMultiNode(&electrumx.NodeConfig{
+		Params:  &chaincfg.RegressionNetParams,
+		DataDir: dataDir,
+		ServerSwitched: func(from, to electrumx.ServerAddr) {
+			switched = append(switched, from, to)
+		},
+	})
+	node.Servers = servers
+	if err = node.Start(); err != nil {
+		t.Fatal(err)
+	}
+	if len(node.ServerMap) != multiNodeConns {
+		t.Fatalf("connected to %d servers", len(node.ServerMap))
+	}
+	tip, err := node.SubscribeHeaders()
+	if err != nil || tip.Height != 3 {
+		t.Fatalf("subscribe headers %+v %v", tip, err)
+	}
+
+	// losing the leader moves requests to another server
+	leader := node.GetServerConn()
+	byAddr[leader.Addr.Addr].Close()
+	<-leader.SvrConn.Done()
+	if _, err = node.BlockHeaders(0, 2); err != nil {
+		t.Fatal(err)
+	}
+	next := node.GetServerConn()
+	if next == leader || len(switched) != 2 || switched[0] != leader.Addr || switched[1] != next.Addr {
+		t.Fatalf("switched %v from %s to %s", switched, leader.Addr, next.Addr)
+	}
+
+	// banning a server drops it and moves the lead if it led
+	if err = node.BanServer(next.Addr, "invalid proof"); err != nil {
+		t.Fatal(err)
+	}
+	<-next.SvrConn.Done()
+	last := node.GetServerConn()
+	if last == next || len(switched) != 4 || switched[2] != next.Addr || switched[3] != last.Addr {
+		t.Fatalf("switched %v from %s to %s", switched, next.Addr, last.Addr)
+	}
+	if rec, _ := servers.Get(next.Addr.Addr); !rec.Banned(time.Now()) {
+		t.Fatal("server not banned")
+	}
+	node.Stop()
+	if len(node.ServerMap) != 0 {
+		t.Fatal("servers left after stop")
+	}
+}
@@ -0,0 +1,154 @@
+package elxbtc
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"time"
+
+	"main/electrumx"
+
+	"github.com/btcsuite/btcd/chaincfg"
+)
+
+// The number of servers from the server list tried by Start before giving up
+const maxServerTries = 5
+
+// Built-in servers seeding the server list of each network
+var seedServers = map[string][]electrumx.ServerAddr{
+	chaincfg.MainNetParams.Name: {
+		{Net: "ssl", Addr: "electrum.blockstream.info:50002"},
+		{Net: "ssl", Addr: "electrum.emzy.de:50002"},
+		{Net: "ssl", Addr: "electrum.bitaroo.net:50002"},
+		{Net: "ssl", Addr: "fortress.qtornado.com:443"},
+		{Net: "ssl", Addr: "electrumx.erbium.eu:50002"},
+		{Net: "ssl", Addr: "bitcoin.aranguren.org:50002"},
+		{Net: "ssl", Addr: "elx.bitske.com:50002"},
+	},
+	chaincfg.TestNet3Params.Name: {
+		{Net: "ssl", Addr: "testnet.aranguren.org:51002"},
+		{Net: "ssl", Addr: "electrum.blockstream.info:60002"},
+		{Net: "ssl", Addr: "testnet.qtornado.com:51002"},
+	},
+}
+
+// SeedServers returns the built-in servers for the network, none for regtest
+func SeedServers(params *chaincfg.Params) []electrumx.ServerAddr {
+	return seedServers[params.Name]
+}
+
+// OpenServerList opens the server list in the node's data dir seeded with the
+// built-in servers for the network
+func OpenServerList(cfg *electrumx.NodeConfig) (*electrumx.ServerList, error) {
+	return electrumx.NewServerList(cfg.DataDir, SeedServers(cfg.Params))
+}
+
+// candidateServers returns the servers to try in order: the trusted peer, if
+// any and not banned, then the best scored servers of the list
+func candidateServers(cfg *electrumx.NodeConfig, servers *electrumx.ServerList, n int) []electrumx.ServerAddr {
+	var candidates []electrumx.ServerAddr
+	var exclude []string
+	if cfg.TrustedPeer != nil {
+		trusted := electrumx.ServerAddr{
+			Net:  cfg.TrustedPeer.Network(),
+			Addr: cfg.TrustedPeer.String(),
+		}
+		if rec, ok := servers.Get(trusted.Addr); !ok || !rec.Banned(time.Now()) {
+			candidates = append(candidates, trusted)
+		}
+		exclude = append(exclude, trusted.Addr)
+	}
+	return append(candidates, servers.Pick(n, cfg.Proxy.IsSet(), exclude...)...)
+}
+
+// connectServer connects to a server and checks it serves the chain of the
+// network, recording the outcome in the server list. The certificate of an
+// ssl server is checked against the cert store. The server's peers are added
+// to the list in the background.
+func connectServer(ctx context.Context, cfg *electrumx.NodeConfig, servers *electrumx.ServerList,
+	certs *electrumx.CertStore, addr electrumx.ServerAddr) (*electrumx.ElectrumXSvrConn, error) {
+
+	if _, _, err := net.SplitHostPort(addr.Addr); err != nil {
+		return nil, err
+	}
+	var tlsConfig *tls.Config = nil
+	if addr.Net == "ssl" {
+		var err error
+		tlsConfig, err = electrumx.PinnedTLSConfig(addr.Addr, certs, cfg.PinnedCerts)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	opts := &electrumx.ConnectOpts{
+		TLSConfig:   tlsConfig,
+		Proxy:       cfg.Proxy,
+		DebugLogger: electrumx.StderrPrinter,
+	}
+
+	start := time.Now()
+	sc, err := electrumx.ConnectServer(ctx, addr.Addr, opts)
+	if err != nil {
+		servers.RecordFailure(addr)
+		return nil, err
+	}
+	servers.RecordConnect(addr, time.Since(start), sc.Proto())
+
+	feats, err := sc.Features(ctx)
+	if err != nil {
+		sc.Shutdown()
+		servers.RecordFailure(addr)
+		return nil, err
+	}
+	genesis := cfg.Params.GenesisHash.String()
+	if feats.Genesis != genesis {
+		sc.Shutdown()
+		servers.RecordGenesis(addr, false)
+		return nil, fmt.Errorf("wrong genesis hash %s for %s", feats.Genesis, cfg.Params.Name)
+	}
+	servers.RecordGenesis(addr, true)
+
+	connected := time.Now()
+	go func() {
+		<-sc.Done()
+		servers.RecordUptime(addr, time.Since(connected))
+	}()
+	go func() {
+		peers, err := sc.Peers(ctx)
+		if err != nil {
+			return
+		}
+		servers.AddPeers(peers, cfg.Proxy.IsSet())
+	}()
+
+	return &electrumx.ElectrumXSvrConn{
+		SvrConn: sc,
+		SvrCtx:  ctx,
+		Addr:    addr,
+		Running: true,
+	}, nil
+}
+
+// connectBest connects to the first server of the candidates that works
+func connectBest(ctx context.Context, cfg *electrumx.NodeConfig, servers *electrumx.ServerList,
+	certs *electrumx.CertStore, candidates []electrumx.ServerAddr) (*electrumx.ElectrumXSvrConn, error) {
+
+	if len(candidates) == 0 {
+		return nil, errors.New("no ElectrumX servers to connect to")
+	}
+	var errs []error
+	for _, addr := range candidates {
+		server, err := connectServer(ctx, cfg, servers, certs, addr)
+		if err == nil {
+			return server, nil
+		}
+		fmt.Printf("could not connect to %s: %v\n", addr, err)
+		errs = append(errs, fmt.Errorf("%s: %w", addr, err))
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	return nil, errors.Join(errs...)
+}
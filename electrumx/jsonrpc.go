@@ -31,8 +31,8 @@ type RPCError struct {
 // unsupported" for some requests on both mainnet and testnet.
 func (e *RPCError) UnmarshalJSON(b []byte) error {
 	type maybeRPCErr struct {
-		I int
-		S string
+		I int    `json:"code"`
+		S string `json:"message"`
 	}
 	var good maybeRPCErr
 	err := json.Unmarshal(b, &good)
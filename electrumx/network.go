@@ -21,8 +21,6 @@ import (
 	"sync"
 	"sync/atomic"
 	"time"
-
-	"github.com/decred/go-socks/socks"
 )
 
 // Printer is a function with the signature of a logger method.
@@ -171,10 +169,18 @@ func (sc *ServerConn) pinger(ctx context.Context) {
 	}
 }
 
+// The range of electrum protocol versions offered to the server. The server
+// picks the highest version it supports within the range.
+const (
+	protoMin = "1.4"
+	protoMax = "1.5"
+)
+
 // negotiateVersion should only be called once, and before starting the listen
 // read loop. As such, this does not use the Request method.
 func (sc *ServerConn) negotiateVersion() (string, error) {
-	reqMsg, err := prepareRequest(sc.nextID(), "server.version", positional{"Electrum", "1.4"})
+	reqMsg, err := prepareRequest(sc.nextID(), "server.version",
+		positional{"Electrum", positional{protoMin, protoMax}})
 	if err != nil {
 		return "", err
 	}
@@ -213,8 +219,8 @@ func (sc *ServerConn) negotiateVersion() (string, error) {
 }
 
 type ConnectOpts struct {
-	TLSConfig   *tls.Config // nil means plain
-	TorProxy    string
+	TLSConfig   *tls.Config  // nil means plain
+	Proxy       *ProxyConfig // nil means direct
 	DebugLogger Printer
 }
 
@@ -225,19 +231,9 @@ type ConnectOpts struct {
 // reconnection functionality, as the caller should handle dropped connections
 // by potentially cycling to a different server.
 func ConnectServer(ctx context.Context, addr string, opts *ConnectOpts) (*ServerConn, error) {
-	var dial func(ctx context.Context, network, addr string) (net.Conn, error)
-	if opts.TorProxy != "" {
-		proxy := &socks.Proxy{
-			Addr: opts.TorProxy,
-		}
-		dial = proxy.DialContext
-	} else {
-		dial = new(net.Dialer).DialContext
-	}
-
 	dialCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
 	defer cancel()
-	conn, err := dial(dialCtx, "tcp", addr)
+	conn, err := opts.Proxy.DialContext(dialCtx, "tcp", addr)
 	if err != nil {
 		return nil, err
 	}
@@ -296,6 +292,34 @@ func (sc *ServerConn) Proto() string {
 	return sc.proto
 }
 
+// ProtoAtLeast reports whether the negotiated protocol version is at least the
+// given version, e.g. sc.ProtoAtLeast("1.5").
+func (sc *ServerConn) ProtoAtLeast(version string) bool {
+	return compareVersions(sc.proto, version) >= 0
+}
+
+// compareVersions compares two dotted version strings numerically, returning
+// -1, 0 or 1. Missing components count as zero so "1.4" equals "1.4.0".
+func compareVersions(a, b string) int {
+	as, bs := strings.Split(a, "."), strings.Split(b, ".")
+	for i := 0; i < len(as) || i < len(bs); i++ {
+		var x, y int
+		if i < len(as) {
+			x, _ = strconv.Atoi(as[i])
+		}
+		if i < len(bs) {
+			y, _ = strconv.Atoi(bs[i])
+		}
+		switch {
+		case x < y:
+			return -1
+		case x > y:
+			return 1
+		}
+	}
+	return 0
+}
+
 // Shutdown begins shutting down the connection and request handling goroutines.
 // Receive on the channel from Done() to wait for shutdown to complete.
 func (sc *ServerConn) Shutdown() {
@@ -596,6 +620,29 @@ peerloop:
 	return
 }
 
+// DonationAddress requests the server operator's donation address. It may be
+// empty and, like the banner, is untrusted.
+func (sc *ServerConn) DonationAddress(ctx context.Context) (string, error) {
+	var resp string
+	err := sc.Request(ctx, "server.donation_address", nil, &resp)
+	if err != nil {
+		return "", err
+	}
+	return resp, nil
+}
+
+// AddPeer asks the server to add a peer server to its peers list. The features
+// should be those the peer returns from server.features. The server returns
+// false if it has ignored the request.
+func (sc *ServerConn) AddPeer(ctx context.Context, features *ServerFeatures) (bool, error) {
+	var resp bool
+	err := sc.Request(ctx, "server.add_peer", positional{features}, &resp)
+	if err != nil {
+		return false, err
+	}
+	return resp, nil
+}
+
 // SigScript represents the signature script in a Vin returned by a transaction
 // request.
 type SigScript struct {
@@ -659,6 +706,65 @@ func (sc *ServerConn) GetTransaction(ctx context.Context, txid string) (*GetTran
 	return &resp, nil
 }
 
+// GetRawTransaction requests a transaction returning the hexadecimal encoded
+// serialized transaction.
+func (sc *ServerConn) GetRawTransaction(ctx context.Context, txid string) (string, error) {
+	var resp string
+	err := sc.Request(ctx, "blockchain.transaction.get", positional{txid, false}, &resp)
+	if err != nil {
+		return "", err
+	}
+	return resp, nil
+}
+
+// GetMerkleResult is the merkle branch of a confirmed transaction returned by a
+// GetMerkle request. Pos is the zero-based index of the transaction in the
+// block and Merkle the hexadecimal encoded branch, deepest pairing first.
+type GetMerkleResult struct {
+	BlockHeight uint32   `json:"block_height"`
+	Merkle      []string `json:"merkle"`
+	Pos         uint32   `json:"pos"`
+}
+
+// GetMerkle requests the merkle branch of a transaction confirmed in the block
+// at the given height.
+func (sc *ServerConn) GetMerkle(ctx context.Context, txid string, height uint32) (*GetMerkleResult, error) {
+	var resp GetMerkleResult
+	err := sc.Request(ctx, "blockchain.transaction.get_merkle", positional{txid, height}, &resp)
+	if err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// IDFromPosResult is the result of an IDFromPosMerkle request.
+type IDFromPosResult struct {
+	TxHash string   `json:"tx_hash"`
+	Merkle []string `json:"merkle"`
+}
+
+// IDFromPos requests the txid of the transaction at the zero-based position
+// pos in the block at the given height.
+func (sc *ServerConn) IDFromPos(ctx context.Context, height, pos uint32) (string, error) {
+	var resp string
+	err := sc.Request(ctx, "blockchain.transaction.id_from_pos", positional{height, pos, false}, &resp)
+	if err != nil {
+		return "", err
+	}
+	return resp, nil
+}
+
+// IDFromPosMerkle is IDFromPos also returning the merkle branch of the
+// transaction.
+func (sc *ServerConn) IDFromPosMerkle(ctx context.Context, height, pos uint32) (*IDFromPosResult, error) {
+	var resp IDFromPosResult
+	err := sc.Request(ctx, "blockchain.transaction.id_from_pos", positional{height, pos, true}, &resp)
+	if err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
 // ////////////////////////////////////////////////////////////////////////////
 // block headers methods
 // /////////////////////
@@ -681,6 +787,9 @@ type GetBlockHeadersResult struct {
 	Count     uint32 `json:"count"`
 	HexConcat string `json:"hex"`
 	Max       uint32 `json:"max"`
+	// Protocol 1.5 returns a list of headers in place of the concatenated hex.
+	// BlockHeaders joins them into HexConcat.
+	Headers []string `json:"headers,omitempty"`
 }
 
 // BlockHeaders requests a batch of block headers beginning at the given height.
@@ -692,6 +801,9 @@ func (sc *ServerConn) BlockHeaders(ctx context.Context, startHeight, count uint3
 	if err != nil {
 		return nil, err
 	}
+	if resp.HexConcat == "" && len(resp.Headers) > 0 {
+		resp.HexConcat = strings.Join(resp.Headers, "")
+	}
 	return &resp, nil
 }
 
@@ -791,6 +903,56 @@ func (sc *ServerConn) GetHistory(ctx context.Context, scripthash string) (Histor
 	return resp, nil
 }
 
+// GetMempool gets the unconfirmed transactions of the scripthash of an address
+// of interest to the client. A height of 0 means all the transaction inputs
+// are confirmed, -1 means it has unconfirmed inputs.
+func (sc *ServerConn) GetMempool(ctx context.Context, scripthash string) (HistoryResult, error) {
+	var resp HistoryResult
+	err := sc.Request(ctx, "blockchain.scripthash.get_mempool", positional{scripthash}, &resp)
+	if err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// GetBalanceResult is the balance of a scripthash in satoshis. Unconfirmed may
+// be negative when mempool transactions spend confirmed outputs.
+type GetBalanceResult struct {
+	Confirmed   int64 `json:"confirmed"`
+	Unconfirmed int64 `json:"unconfirmed"`
+}
+
+// GetBalance gets the confirmed and unconfirmed balance of the scripthash of an
+// address of interest to the client.
+func (sc *ServerConn) GetBalance(ctx context.Context, scripthash string) (*GetBalanceResult, error) {
+	var resp GetBalanceResult
+	err := sc.Request(ctx, "blockchain.scripthash.get_balance", positional{scripthash}, &resp)
+	if err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// ListUnspentResult is an unspent output of a scripthash. Height is 0 for an
+// output of an unconfirmed transaction.
+type ListUnspentResult struct {
+	Height int32  `json:"height"`
+	TxPos  uint32 `json:"tx_pos"`
+	TxHash string `json:"tx_hash"`
+	Value  int64  `json:"value"` // satoshis
+}
+
+// ListUnspent gets the unspent outputs of the scripthash of an address of
+// interest to the client, including those in the mempool.
+func (sc *ServerConn) ListUnspent(ctx context.Context, scripthash string) ([]ListUnspentResult, error) {
+	var resp []ListUnspentResult
+	err := sc.Request(ctx, "blockchain.scripthash.listunspent", positional{scripthash}, &resp)
+	if err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
 // ////////////////////////////////////////////////////////////////////////////
 // other wallet methods
 // ////////////////////
@@ -805,3 +967,77 @@ func (sc *ServerConn) Broadcast(ctx context.Context, rawTx string) (string, erro
 	}
 	return resp, nil
 }
+
+// ////////////////////////////////////////////////////////////////////////////
+// fee methods
+// ///////////
+
+// Fee estimate modes passed to the daemon's estimatesmartfee by servers
+// implementing protocol 1.5 or later.
+const (
+	EstimateModeConservative = "CONSERVATIVE"
+	EstimateModeEconomical   = "ECONOMICAL"
+)
+
+// EstimateFee requests the fee rate in BTC/kB needed for a transaction to be
+// confirmed within the given number of blocks. The server returns -1 if the
+// daemon does not have enough information to make an estimate.
+func (sc *ServerConn) EstimateFee(ctx context.Context, blocks uint32) (float64, error) {
+	return sc.EstimateFeeMode(ctx, blocks, "")
+}
+
+// EstimateFeeMode is EstimateFee using the given estimate mode. The mode is
+// ignored when the server protocol is older than 1.5 or the mode is empty.
+func (sc *ServerConn) EstimateFeeMode(ctx context.Context, blocks uint32, mode string) (float64, error) {
+	args := positional{blocks}
+	if mode != "" && sc.ProtoAtLeast("1.5") {
+		args = append(args, mode)
+	}
+	var resp float64
+	err := sc.Request(ctx, "blockchain.estimatefee", args, &resp)
+	if err != nil {
+		return 0, err
+	}
+	return resp, nil
+}
+
+// RelayFee requests the minimum fee rate in BTC/kB a transaction must pay to
+// be accepted into the daemon's mempool.
+func (sc *ServerConn) RelayFee(ctx context.Context) (float64, error) {
+	var resp float64
+	err := sc.Request(ctx, "blockchain.relayfee", nil, &resp)
+	if err != nil {
+		return 0, err
+	}
+	return resp, nil
+}
+
+// FeeHistogramEntry is a point of the mempool fee histogram. VSize is the
+// virtual size in vbytes of mempool transactions paying a fee rate in sat/vB
+// of FeeRate or higher, and less than the previous entry's FeeRate.
+type FeeHistogramEntry struct {
+	FeeRate float64
+	VSize   int64
+}
+
+// UnmarshalJSON unmarshals a [fee_rate, vsize] pair.
+func (e *FeeHistogramEntry) UnmarshalJSON(b []byte) error {
+	var pair [2]float64
+	if err := json.Unmarshal(b, &pair); err != nil {
+		return err
+	}
+	e.FeeRate = pair[0]
+	e.VSize = int64(pair[1])
+	return nil
+}
+
+// FeeHistogram requests the mempool fee histogram, ordered by decreasing fee
+// rate.
+func (sc *ServerConn) FeeHistogram(ctx context.Context) ([]FeeHistogramEntry, error) {
+	var resp []FeeHistogramEntry
+	err := sc.Request(ctx, "mempool.get_fee_histogram", nil, &resp)
+	if err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
@@ -0,0 +1,292 @@
+package electrumx
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// fakeServer answers newline delimited JSON-RPC requests on a local tcp port
+// with canned results keyed by method
+type fakeServer struct {
+	ln      net.Listener
+	proto   string
+	results map[string]any
+	params  chan *request
+}
+
+func newFakeServer(t *testing.T, proto string) *fakeServer {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &fakeServer{
+		ln:      ln,
+		proto:   proto,
+		results: make(map[string]any),
+		params:  make(chan *request, 16),
+	}
+	go s.serve()
+	t.Cleanup(func() { ln.Close() })
+	return s
+}
+
+func (s *fakeServer) serve() {
+	for {
+		conn, err := s.ln.Accept()
+		if err != nil {
+			return
+		}
+		go s.handle(conn)
+	}
+}
+
+func (s *fakeServer) handle(conn net.Conn) {
+	defer conn.Close()
+	reader := bufio.NewReader(conn)
+	for {
+		msg, err := reader.ReadBytes(newline)
+		if err != nil {
+			return
+		}
+		var req request
+		if err = json.Unmarshal(msg, &req); err != nil {
+			return
+		}
+		var result any
+		switch req.Method {
+		case "server.version":
+			result = []string{"FakeX 1.0", s.proto}
+		case "server.ping":
+		default:
+			select {
+			case s.params <- &req:
+			default:
+			}
+			result = s.results[req.Method]
+		}
+		b, _ := json.Marshal(result)
+		resp, _ := json.Marshal(&response{ID: req.ID, Result: b})
+		if _, err = conn.Write(append(resp, newline)); err != nil {
+			return
+		}
+	}
+}
+
+func (s *fakeServer) connect(t *testing.T) *ServerConn {
+	ctx, cancel := context.WithCancel(context.Background())
+	sc, err := ConnectServer(ctx, s.ln.Addr().String(), &ConnectOpts{})
+	if err != nil {
+		cancel()
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		cancel()
+		<-sc.Done()
+	})
+	return sc
+}
+
+// lastParams returns the params of the last request for a method with a canned
+// result
+func (s *fakeServer) lastParams(t *testing.T) []any {
+	select {
+	case req := <-s.params:
+		var params []any
+		if err := json.Unmarshal(req.Params, &params); err != nil {
+			t.Fatal(err)
+		}
+		return params
+	case <-time.After(time.Second):
+		t.Fatal("no request received")
+		return nil
+	}
+}
+
+func TestCompareVersions(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"1.4", "1.4", 0},
+		{"1.4", "1.4.0", 0},
+		{"1.4.2", "1.4", 1},
+		{"1.4.2", "1.5", -1},
+		{"1.10", "1.5", 1},
+	}
+	for _, tt := range tests {
+		if got := compareVersions(tt.a, tt.b); got != tt.want {
+			t.Errorf("compareVersions(%q, %q) = %d, want %d", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
+
+func TestServerConnMethods(t *testing.T) {
+	s := newFakeServer(t, "1.4.2")
+	s.results["blockchain.estimatefee"] = 0.00012
+	s.results["blockchain.relayfee"] = 0.00001
+	s.results["blockchain.scripthash.get_balance"] = map[string]int64{"confirmed": 103873966, "unconfirmed": -23684}
+	s.results["blockchain.scripthash.listunspent"] = []map[string]any{
+		{"tx_pos": 0, "value": 45318048, "tx_hash": "9f2c45a12db0144909b5db269415f7319179105982ac70ed80d76ea79d923ebf", "height": 437146},
+		{"tx_pos": 2, "value": 1000, "tx_hash": "f3e1bf48975b8d6060a9de8884296abb80be618dc00ae3cb2f6cee3085e09403", "height": 0},
+	}
+	s.results["blockchain.transaction.get_merkle"] = map[string]any{
+		"block_height": 450538,
+		"merkle":       []string{"713d6c7e6ce7bbea708d61162231eaa8ecb31c4c5dd84f81c20409a90069cb24"},
+		"pos":          710,
+	}
+	s.results["blockchain.transaction.id_from_pos"] = "fc12dfcb4723715a456c6984e298e00c479706067da81be969e8085544b0ba08"
+	s.results["mempool.get_fee_histogram"] = [][2]float64{{12.5, 9736}, {10, 2800}, {1, 300000}}
+	s.results["server.donation_address"] = "1BWwXJH3q6PRsizBkSGm2Uw4Sz1urZ5sCj"
+	s.results["server.add_peer"] = true
+
+	sc := s.connect(t)
+	ctx := context.Background()
+	if sc.Proto() != "1.4.2" || sc.ProtoAtLeast("1.5") || !sc.ProtoAtLeast("1.4") {
+		t.Fatalf("unexpected protocol %s", sc.Proto())
+	}
+
+	fee, err := sc.EstimateFeeMode(ctx, 6, EstimateModeEconomical)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fee != 0.00012 {
+		t.Errorf("estimatefee got %v", fee)
+	}
+	// the mode argument is not sent to a 1.4 server
+	if params := s.lastParams(t); len(params) != 1 || params[0] != float64(6) {
+		t.Errorf("estimatefee params %v", params)
+	}
+
+	relay, err := sc.RelayFee(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if relay != 0.00001 {
+		t.Errorf("relayfee got %v", relay)
+	}
+	s.lastParams(t)
+
+	bal, err := sc.GetBalance(ctx, "sh")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *bal != (GetBalanceResult{Confirmed: 103873966, Unconfirmed: -23684}) {
+		t.Errorf("get_balance got %+v", bal)
+	}
+	s.lastParams(t)
+
+	unspent, err := sc.ListUnspent(ctx, "sh")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(unspent) != 2 || unspent[0].Value != 45318048 || unspent[0].Height != 437146 ||
+		unspent[1].TxPos != 2 || unspent[1].Height != 0 {
+		t.Errorf("listunspent got %+v", unspent)
+	}
+	s.lastParams(t)
+
+	merkle, err := sc.GetMerkle(ctx, "txid", 450538)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if merkle.BlockHeight != 450538 || merkle.Pos != 710 || len(merkle.Merkle) != 1 {
+		t.Errorf("get_merkle got %+v", merkle)
+	}
+	if params := s.lastParams(t); !reflect.DeepEqual(params, []any{"txid", float64(450538)}) {
+		t.Errorf("get_merkle params %v", params)
+	}
+
+	txid, err := sc.IDFromPos(ctx, 1000, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if txid != "fc12dfcb4723715a456c6984e298e00c479706067da81be969e8085544b0ba08" {
+		t.Errorf("id_from_pos got %s", txid)
+	}
+	if params := s.lastParams(t); !reflect.DeepEqual(params, []any{float64(1000), float64(2), false}) {
+		t.Errorf("id_from_pos params %v", params)
+	}
+
+	hist, err := sc.FeeHistogram(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantHist := []FeeHistogramEntry{{12.5, 9736}, {10, 2800}, {1, 300000}}
+	if !reflect.DeepEqual(hist, wantHist) {
+		t.Errorf("fee histogram got %+v", hist)
+	}
+	s.lastParams(t)
+
+	addr, err := sc.DonationAddress(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if addr != "1BWwXJH3q6PRsizBkSGm2Uw4Sz1urZ5sCj" {
+		t.Errorf("donation address got %s", addr)
+	}
+	s.lastParams(t)
+
+	added, err := sc.AddPeer(ctx, &ServerFeatures{Genesis: "00", ProtoMax: "1.5", ProtoMin: "1.4"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !added {
+		t.Error("add_peer not accepted")
+	}
+	params := s.lastParams(t)
+	if feats, ok := params[0].(map[string]any); !ok || feats["genesis_hash"] != "00" {
+		t.Errorf("add_peer params %v", params)
+	}
+}
+
+func TestServerConnProto15(t *testing.T) {
+	s := newFakeServer(t, "1.5")
+	s.results["blockchain.estimatefee"] = 0.0002
+	s.results["blockchain.block.headers"] = map[string]any{
+		"count":   2,
+		"headers": []string{"aa", "bb"},
+		"max":     2016,
+	}
+	s.results["blockchain.transaction.id_from_pos"] = map[string]any{
+		"tx_hash": "fc12dfcb4723715a456c6984e298e00c479706067da81be969e8085544b0ba08",
+		"merkle":  []string{"713d6c7e6ce7bbea708d61162231eaa8ecb31c4c5dd84f81c20409a90069cb24"},
+	}
+
+	sc := s.connect(t)
+	ctx := context.Background()
+	if !sc.ProtoAtLeast("1.5") {
+		t.Fatalf("unexpected protocol %s", sc.Proto())
+	}
+
+	if _, err := sc.EstimateFeeMode(ctx, 2, EstimateModeConservative); err != nil {
+		t.Fatal(err)
+	}
+	if params := s.lastParams(t); !reflect.DeepEqual(params, []any{float64(2), EstimateModeConservative}) {
+		t.Errorf("estimatefee params %v", params)
+	}
+
+	hdrs, err := sc.BlockHeaders(ctx, 0, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hdrs.Count != 2 || hdrs.HexConcat != "aabb" {
+		t.Errorf("block headers got %+v", hdrs)
+	}
+	s.lastParams(t)
+
+	res, err := sc.IDFromPosMerkle(ctx, 1000, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.TxHash != "fc12dfcb4723715a456c6984e298e00c479706067da81be969e8085544b0ba08" || len(res.Merkle) != 1 {
+		t.Errorf("id_from_pos got %+v", res)
+	}
+	if params := s.lastParams(t); !reflect.DeepEqual(params, []any{float64(1000), float64(2), true}) {
+		t.Errorf("id_from_pos params %v", params)
+	}
+}
@@ -0,0 +1,88 @@
+package electrumx
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strings"
+
+	"github.com/decred/go-socks/socks"
+	"golang.org/x/net/proxy"
+)
+
+// ErrOnionNeedsProxy is returned when dialing a .onion address without a proxy.
+var ErrOnionNeedsProxy = errors.New("onion address requires a Tor proxy")
+
+// ProxyConfig is a SOCKS5 proxy, such as Tor, through which all outbound
+// connections are made: ElectrumX servers, peers and HTTP APIs. Host names are
+// resolved by the proxy so no DNS lookups leak.
+type ProxyConfig struct {
+	// The proxy address, e.g. 127.0.0.1:9050
+	Addr string
+
+	// Optional credentials for the proxy. Ignored if TorIsolation is set.
+	Username string
+	Password string
+
+	// Use random credentials for every connection so that Tor puts each on a
+	// separate circuit (stream isolation), e.g. the ElectrumX server and the
+	// fee API cannot be linked by their exit node.
+	TorIsolation bool
+}
+
+// IsSet returns whether a proxy is configured. It is safe on a nil config.
+func (p *ProxyConfig) IsSet() bool {
+	return p != nil && p.Addr != ""
+}
+
+func (p *ProxyConfig) socks() *socks.Proxy {
+	return &socks.Proxy{
+		Addr:         p.Addr,
+		Username:     p.Username,
+		Password:     p.Password,
+		TorIsolation: p.TorIsolation,
+	}
+}
+
+// Dialer returns a proxy.Dialer for HTTP clients and other connections, or nil
+// if no proxy is set.
+func (p *ProxyConfig) Dialer() proxy.Dialer {
+	if !p.IsSet() {
+		return nil
+	}
+	return p.socks()
+}
+
+// DialContext connects to addr through the proxy if one is set and otherwise
+// directly. Onion addresses can only be dialed through a proxy.
+func (p *ProxyConfig) DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	if !p.IsSet() {
+		if IsOnion(addr) {
+			return nil, ErrOnionNeedsProxy
+		}
+		return new(net.Dialer).DialContext(ctx, network, addr)
+	}
+	return p.socks().DialContext(ctx, network, addr)
+}
+
+// IsOnion returns whether the host of a "host:port" or bare host address is a
+// Tor hidden service.
+func IsOnion(addr string) bool {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		host = addr
+	}
+	return strings.HasSuffix(host, ".onion")
+}
+
+// PeerAddrs requests the server's peers and returns the addresses that can be
+// dialed with the proxy, see SSLPeerAddrs. Onion peers are only included when
+// a proxy is set.
+func (sc *ServerConn) PeerAddrs(ctx context.Context, p *ProxyConfig) (ssl, tcpOnlyOnion []string, err error) {
+	peers, err := sc.Peers(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	ssl, tcpOnlyOnion = SSLPeerAddrs(peers, p.IsSet())
+	return ssl, tcpOnlyOnion, nil
+}
@@ -0,0 +1,291 @@
+package electrumx
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strconv"
+	"sync"
+	"testing"
+
+	"main/wallet"
+)
+
+// socksServer is a SOCKS5 proxy recording the credentials and destination of
+// each connection. It dials ".onion" destinations at onionAddr.
+type socksServer struct {
+	ln        net.Listener
+	onionAddr string
+
+	mtx   sync.Mutex
+	conns []socksConn
+}
+
+type socksConn struct {
+	user, pass, dest string
+}
+
+func newSocksServer(t *testing.T) *socksServer {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &socksServer{ln: ln}
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go s.handle(conn)
+		}
+	}()
+	t.Cleanup(func() { ln.Close() })
+	return s
+}
+
+func (s *socksServer) config(isolate bool) *ProxyConfig {
+	return &ProxyConfig{Addr: s.ln.Addr().String(), TorIsolation: isolate}
+}
+
+func (s *socksServer) recorded() []socksConn {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	return append([]socksConn(nil), s.conns...)
+}
+
+func (s *socksServer) handle(conn net.Conn) {
+	defer conn.Close()
+	rc, err := s.negotiate(conn)
+	if err != nil {
+		return
+	}
+	dest := rc.dest
+	if IsOnion(dest) {
+		dest = s.onionAddr
+	}
+	target, err := net.Dial("tcp", dest)
+	if err != nil {
+		conn.Write([]byte{5, 5, 0, 1, 0, 0, 0, 0, 0, 0})
+		return
+	}
+	defer target.Close()
+	s.mtx.Lock()
+	s.conns = append(s.conns, *rc)
+	s.mtx.Unlock()
+	if _, err = conn.Write([]byte{5, 0, 0, 1, 127, 0, 0, 1, 0, 0}); err != nil {
+		return
+	}
+	go io.Copy(target, conn)
+	io.Copy(conn, target)
+}
+
+func (s *socksServer) negotiate(conn net.Conn) (*socksConn, error) {
+	var rc socksConn
+	hdr := make([]byte, 2)
+	if _, err := io.ReadFull(conn, hdr); err != nil {
+		return nil, err
+	}
+	methods := make([]byte, hdr[1])
+	if _, err := io.ReadFull(conn, methods); err != nil {
+		return nil, err
+	}
+	method := byte(0)
+	for _, m := range methods {
+		if m == 2 {
+			method = 2
+		}
+	}
+	if _, err := conn.Write([]byte{5, method}); err != nil {
+		return nil, err
+	}
+	if method == 2 {
+		readString := func() (string, error) {
+			l := make([]byte, 1)
+			if _, err := io.ReadFull(conn, l); err != nil {
+				return "", err
+			}
+			b := make([]byte, l[0])
+			_, err := io.ReadFull(conn, b)
+			return string(b), err
+		}
+		ver := make([]byte, 1)
+		if _, err := io.ReadFull(conn, ver); err != nil {
+			return nil, err
+		}
+		var err error
+		if rc.user, err = readString(); err != nil {
+			return nil, err
+		}
+		if rc.pass, err = readString(); err != nil {
+			return nil, err
+		}
+		if _, err = conn.Write([]byte{1, 0}); err != nil {
+			return nil, err
+		}
+	}
+	req := make([]byte, 4)
+	if _, err := io.ReadFull(conn, req); err != nil {
+		return nil, err
+	}
+	var host string
+	switch req[3] {
+	case 1:
+		ip := make([]byte, 4)
+		if _, err := io.ReadFull(conn, ip); err != nil {
+			return nil, err
+		}
+		host = net.IP(ip).String()
+	case 3:
+		l := make([]byte, 1)
+		if _, err := io.ReadFull(conn, l); err != nil {
+			return nil, err
+		}
+		b := make([]byte, l[0])
+		if _, err := io.ReadFull(conn, b); err != nil {
+			return nil, err
+		}
+		host = string(b)
+	default:
+		return nil, fmt.Errorf("address type %d", req[3])
+	}
+	port := make([]byte, 2)
+	if _, err := io.ReadFull(conn, port); err != nil {
+		return nil, err
+	}
+	rc.dest = net.JoinHostPort(host, strconv.Itoa(int(binary.BigEndian.Uint16(port))))
+	return &rc, nil
+}
+
+func TestIsOnion(t *testing.T) {
+	tests := map[string]bool{
+		"abcdef.onion:50001": true,
+		"abcdef.onion":       true,
+		"example.com:50002":  false,
+		"127.0.0.1:50001":    false,
+		"onion.example.com":  false,
+	}
+	for addr, want := range tests {
+		if got := IsOnion(addr); got != want {
+			t.Errorf("IsOnion(%q) = %v", addr, got)
+		}
+	}
+}
+
+func TestProxyConnectServer(t *testing.T) {
+	srv := newFakeServer(t, "1.4")
+	socks := newSocksServer(t)
+	socks.onionAddr = srv.ln.Addr().String()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// onion servers are not dialed directly
+	_, err := ConnectServer(ctx, "abcdef.onion:50001", &ConnectOpts{})
+	if !errors.Is(err, ErrOnionNeedsProxy) {
+		t.Fatalf("expected ErrOnionNeedsProxy, got %v", err)
+	}
+
+	// each connection gets its own isolation credentials
+	opts := &ConnectOpts{Proxy: socks.config(true)}
+	for _, addr := range []string{srv.ln.Addr().String(), "abcdef.onion:50001"} {
+		sc, err := ConnectServer(ctx, addr, opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if sc.Proto() != "1.4" {
+			t.Fatalf("proto %s", sc.Proto())
+		}
+		sc.Shutdown()
+		<-sc.Done()
+	}
+	conns := socks.recorded()
+	if len(conns) != 2 {
+		t.Fatalf("proxy saw %d connections", len(conns))
+	}
+	if conns[1].dest != "abcdef.onion:50001" {
+		t.Fatalf("onion host resolved locally: %s", conns[1].dest)
+	}
+	if conns[0].user == "" || conns[0].pass == "" {
+		t.Fatal("no isolation credentials")
+	}
+	if conns[0].user == conns[1].user {
+		t.Fatal("connections share isolation credentials")
+	}
+
+	// fixed credentials without isolation
+	cfg := &ProxyConfig{Addr: socks.ln.Addr().String(), Username: "alice", Password: "pw"}
+	sc, err := ConnectServer(ctx, srv.ln.Addr().String(), &ConnectOpts{Proxy: cfg})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sc.Shutdown()
+	<-sc.Done()
+	conns = socks.recorded()
+	if last := conns[len(conns)-1]; last.user != "alice" || last.pass != "pw" {
+		t.Fatalf("credentials %+v", last)
+	}
+}
+
+func TestProxyDialer(t *testing.T) {
+	var nilCfg *ProxyConfig
+	if nilCfg.IsSet() || nilCfg.Dialer() != nil {
+		t.Fatal("nil config is set")
+	}
+	if (&ProxyConfig{}).Dialer() != nil {
+		t.Fatal("empty config has a dialer")
+	}
+
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"priority":45,"normal":20,"economic":10}`))
+	}))
+	defer api.Close()
+	socks := newSocksServer(t)
+
+	source := wallet.NewAPIFeeSource(api.URL, socks.config(true).Dialer())
+	for i := 0; i < 2; i++ {
+		fees, err := source.Fees()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if fees.ForTarget(6) != 20 {
+			t.Fatalf("fees %+v", fees)
+		}
+	}
+	if len(socks.recorded()) == 0 {
+		t.Fatal("fee api not fetched through the proxy")
+	}
+}
+
+func TestPeerAddrs(t *testing.T) {
+	srv := newFakeServer(t, "1.4")
+	srv.results["server.peers.subscribe"] = [][]any{
+		{"1.2.3.4", "ssl.example.com", []string{"v1.4", "s50002", "t50001"}},
+		{"abcdef.onion", "abcdef.onion", []string{"v1.4", "t50001"}},
+		{"ghijkl.onion", "ghijkl.onion", []string{"v1.4", "s50002"}},
+	}
+	sc := srv.connect(t)
+	ctx := context.Background()
+
+	ssl, onion, err := sc.PeerAddrs(ctx, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(ssl, []string{"ssl.example.com:50002"}) || len(onion) != 0 {
+		t.Fatalf("direct peers %v %v", ssl, onion)
+	}
+
+	ssl, onion, err = sc.PeerAddrs(ctx, &ProxyConfig{Addr: "127.0.0.1:9050"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(ssl, []string{"ssl.example.com:50002", "ghijkl.onion:50002"}) ||
+		!reflect.DeepEqual(onion, []string{"abcdef.onion:50001"}) {
+		t.Fatalf("proxied peers %v %v", ssl, onion)
+	}
+}
@@ -0,0 +1,325 @@
+package electrumx
+
+// A persistent list of known ElectrumX servers with their connection history.
+// It is seeded from a built-in list for the network and grows from the
+// server.peers.subscribe results of connected servers. Servers are scored on
+// reliability, latency and uptime, and banned for misbehaviour such as sending
+// invalid headers or proofs or serving the wrong chain.
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+const SERVERS_FILE_NAME = "servers.json"
+
+// How long a server is banned for misbehaving
+const BanDuration = 24 * time.Hour
+
+// How a server came to be in the list
+type ServerSource string
+
+const (
+	SourceSeed ServerSource = "seed"
+	SourcePeer ServerSource = "peer"
+	SourceUser ServerSource = "user"
+)
+
+// ServerRecord is what is known about a server
+type ServerRecord struct {
+	Addr   string       `json:"addr"` // host:port
+	Net    string       `json:"net"`  // ssl or tcp
+	Source ServerSource `json:"source"`
+
+	// Protocol version negotiated on the last connect
+	Proto string `json:"proto,omitempty"`
+	// Smoothed time to connect and negotiate the protocol version
+	Latency time.Duration `json:"latency,omitempty"`
+	// Whether the genesis hash of the server's chain has been checked
+	GenesisOK bool `json:"genesisOk,omitempty"`
+
+	Connects    int           `json:"connects,omitempty"`
+	Failures    int           `json:"failures,omitempty"`
+	Uptime      time.Duration `json:"uptime,omitempty"`
+	LastConnect time.Time     `json:"lastConnect,omitempty"`
+	LastFailure time.Time     `json:"lastFailure,omitempty"`
+
+	Misbehaviour int       `json:"misbehaviour,omitempty"`
+	BanReason    string    `json:"banReason,omitempty"`
+	BannedUntil  time.Time `json:"bannedUntil,omitempty"`
+	// Banned for good, e.g. for serving another chain
+	BannedForever bool `json:"bannedForever,omitempty"`
+}
+
+// ServerAddr returns the net.Addr to connect to the server
+func (r *ServerRecord) ServerAddr() ServerAddr {
+	return ServerAddr{Net: r.Net, Addr: r.Addr}
+}
+
+// Banned returns whether the server is banned at the time now
+func (r *ServerRecord) Banned(now time.Time) bool {
+	return r.BannedForever || now.Before(r.BannedUntil)
+}
+
+// Score ranks servers for selection, higher is better. Untried servers score
+// between reliable and unreliable ones so new peers get a chance.
+func (r *ServerRecord) Score(now time.Time) float64 {
+	attempts := r.Connects + r.Failures
+	reliability := 0.5
+	if attempts > 0 {
+		reliability = float64(r.Connects) / float64(attempts)
+	}
+	score := 100 * reliability
+	if r.Latency > 0 {
+		// up to -20 for a slow server
+		score -= min(float64(r.Latency)/float64(time.Second)*10, 20)
+	}
+	// up to +10 for a day of uptime
+	score += min(r.Uptime.Hours()/24*10, 10)
+	score -= 25 * float64(r.Misbehaviour)
+	if !r.LastFailure.IsZero() && now.Sub(r.LastFailure) < time.Hour {
+		score -= 30
+	}
+	return score
+}
+
+// ServerList is the persistent list of known servers. It is safe for
+// concurrent use.
+type ServerList struct {
+	path string
+
+	mtx     sync.Mutex
+	servers map[string]*ServerRecord
+	now     func() time.Time
+}
+
+// NewServerList opens the servers file in the data dir, which need not exist
+// yet, and adds any seed servers not already known. An empty dir makes an
+// in-memory list.
+func NewServerList(dataDir string, seeds []ServerAddr) (*ServerList, error) {
+	sl := &ServerList{
+		servers: make(map[string]*ServerRecord),
+		now:     time.Now,
+	}
+	if dataDir != "" {
+		sl.path = filepath.Join(dataDir, SERVERS_FILE_NAME)
+		b, err := os.ReadFile(sl.path)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return nil, err
+		}
+		if err == nil {
+			var records []*ServerRecord
+			if err = json.Unmarshal(b, &records); err != nil {
+				return nil, fmt.Errorf("servers file %s: %w", sl.path, err)
+			}
+			for _, r := range records {
+				sl.servers[r.Addr] = r
+			}
+		}
+	}
+	sl.mtx.Lock()
+	defer sl.mtx.Unlock()
+	for _, seed := range seeds {
+		sl.add(seed, SourceSeed)
+	}
+	return sl, sl.save()
+}
+
+func (sl *ServerList) add(addr ServerAddr, source ServerSource) bool {
+	if _, ok := sl.servers[addr.Addr]; ok {
+		return false
+	}
+	sl.servers[addr.Addr] = &ServerRecord{
+		Addr:   addr.Addr,
+		Net:    addr.Net,
+		Source: source,
+	}
+	return true
+}
+
+// Add adds a server if it is not known and returns whether it was added
+func (sl *ServerList) Add(addr ServerAddr, source ServerSource) (bool, error) {
+	sl.mtx.Lock()
+	defer sl.mtx.Unlock()
+	if !sl.add(addr, source) {
+		return false, nil
+	}
+	return true, sl.save()
+}
+
+// AddPeers adds the usable peers from a server.peers.subscribe result, see
+// SSLPeerAddrs, and returns the number added. Onion peers are only added if
+// includeOnion is set, i.e. when connecting through a proxy.
+func (sl *ServerList) AddPeers(peers []*PeersResult, includeOnion bool) (int, error) {
+	ssl, tcpOnlyOnion := SSLPeerAddrs(peers, includeOnion)
+	sl.mtx.Lock()
+	defer sl.mtx.Unlock()
+	var added int
+	for _, addr := range ssl {
+		if sl.add(ServerAddr{Net: "ssl", Addr: addr}, SourcePeer) {
+			added++
+		}
+	}
+	for _, addr := range tcpOnlyOnion {
+		if sl.add(ServerAddr{Net: "tcp", Addr: addr}, SourcePeer) {
+			added++
+		}
+	}
+	if added == 0 {
+		return 0, nil
+	}
+	return added, sl.save()
+}
+
+// update applies fn to the record of a server, adding it if unknown, then
+// saves the list
+func (sl *ServerList) update(addr ServerAddr, fn func(r *ServerRecord)) error {
+	sl.mtx.Lock()
+	defer sl.mtx.Unlock()
+	sl.add(addr, SourceUser)
+	fn(sl.servers[addr.Addr])
+	return sl.save()
+}
+
+// RecordConnect records a successful connection with the time taken to
+// connect and the negotiated protocol version
+func (sl *ServerList) RecordConnect(addr ServerAddr, latency time.Duration, proto string) error {
+	return sl.update(addr, func(r *ServerRecord) {
+		if r.Latency == 0 {
+			r.Latency = latency
+		} else {
+			r.Latency = (3*r.Latency + latency) / 4
+		}
+		r.Proto = proto
+		r.Connects++
+		r.LastConnect = sl.now()
+	})
+}
+
+// RecordFailure records a failed connection attempt
+func (sl *ServerList) RecordFailure(addr ServerAddr) error {
+	return sl.update(addr, func(r *ServerRecord) {
+		r.Failures++
+		r.LastFailure = sl.now()
+	})
+}
+
+// RecordGenesis records the result of checking the server's genesis hash. A
+// server on another chain is banned for good.
+func (sl *ServerList) RecordGenesis(addr ServerAddr, ok bool) error {
+	return sl.update(addr, func(r *ServerRecord) {
+		r.GenesisOK = ok
+		if !ok {
+			r.BannedForever = true
+			r.BanReason = "wrong genesis hash"
+		}
+	})
+}
+
+// RecordUptime adds the duration of a connection that has ended
+func (sl *ServerList) RecordUptime(addr ServerAddr, uptime time.Duration) error {
+	return sl.update(addr, func(r *ServerRecord) {
+		r.Uptime += uptime
+	})
+}
+
+// Misbehaved bans the server for BanDuration, e.g. for sending invalid headers
+// or proofs
+func (sl *ServerList) Misbehaved(addr ServerAddr, reason string) error {
+	return sl.update(addr, func(r *ServerRecord) {
+		r.Misbehaviour++
+		r.BanReason = reason
+		r.BannedUntil = sl.now().Add(BanDuration)
+	})
+}
+
+// Unban lifts the ban of a server
+func (sl *ServerList) Unban(addr ServerAddr) error {
+	return sl.update(addr, func(r *ServerRecord) {
+		r.BanReason = ""
+		r.BannedUntil = time.Time{}
+		r.BannedForever = false
+	})
+}
+
+// Get returns a copy of the record of a server
+func (sl *ServerList) Get(addr string) (ServerRecord, bool) {
+	sl.mtx.Lock()
+	defer sl.mtx.Unlock()
+	r, ok := sl.servers[addr]
+	if !ok {
+		return ServerRecord{}, false
+	}
+	return *r, true
+}
+
+// Servers returns copies of all records, best scored first
+func (sl *ServerList) Servers() []ServerRecord {
+	sl.mtx.Lock()
+	defer sl.mtx.Unlock()
+	now := sl.now()
+	records := make([]ServerRecord, 0, len(sl.servers))
+	for _, r := range sl.servers {
+		records = append(records, *r)
+	}
+	sort.SliceStable(records, func(i, j int) bool {
+		si, sj := records[i].Score(now), records[j].Score(now)
+		if si != sj {
+			return si > sj
+		}
+		return records[i].Addr < records[j].Addr
+	})
+	return records
+}
+
+// Pick returns up to n servers that are not banned, best scored first. Onion
+// servers are left out unless includeOnion is set, as are the excluded
+// addresses.
+func (sl *ServerList) Pick(n int, includeOnion bool, exclude ...string) []ServerAddr {
+	now := sl.now()
+	var picked []ServerAddr
+next:
+	for _, r := range sl.Servers() {
+		if len(picked) == n {
+			break
+		}
+		if r.Banned(now) || (!includeOnion && IsOnion(r.Addr)) {
+			continue
+		}
+		for _, ex := range exclude {
+			if r.Addr == ex {
+				continue next
+			}
+		}
+		picked = append(picked, r.ServerAddr())
+	}
+	return picked
+}
+
+func (sl *ServerList) save() error {
+	if sl.path == "" {
+		return nil
+	}
+	records := make([]*ServerRecord, 0, len(sl.servers))
+	for _, r := range sl.servers {
+		records = append(records, r)
+	}
+	sort.Slice(records, func(i, j int) bool {
+		return records[i].Addr < records[j].Addr
+	})
+	b, err := json.MarshalIndent(records, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := sl.path + ".tmp"
+	if err = os.WriteFile(tmp, b, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, sl.path)
+}
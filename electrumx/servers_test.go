@@ -0,0 +1,132 @@
+package electrumx
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestServerList(t *testing.T) {
+	dir := t.TempDir()
+	seeds := []ServerAddr{
+		{Net: "ssl", Addr: "a.example.com:50002"},
+		{Net: "ssl", Addr: "b.example.com:50002"},
+		{Net: "ssl", Addr: "c.example.com:50002"},
+	}
+	sl, err := NewServerList(dir, seeds)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	sl.now = func() time.Time { return now }
+
+	// untried servers are picked by address
+	if got := sl.Pick(2, false); !reflect.DeepEqual(got, seeds[:2]) {
+		t.Fatalf("picked %v", got)
+	}
+
+	a, b, c := seeds[0], seeds[1], seeds[2]
+	sl.RecordConnect(c, 100*time.Millisecond, "1.4.2")
+	sl.RecordGenesis(c, true)
+	sl.RecordUptime(c, 12*time.Hour)
+	sl.RecordFailure(a)
+	if got := sl.Pick(3, false); !reflect.DeepEqual(got, []ServerAddr{c, b, a}) {
+		t.Fatalf("picked %v", got)
+	}
+	if got := sl.Pick(3, false, c.Addr); !reflect.DeepEqual(got, []ServerAddr{b, a}) {
+		t.Fatalf("picked excluding %v", got)
+	}
+
+	// misbehaving servers are banned for a while
+	sl.Misbehaved(c, "invalid headers")
+	if got := sl.Pick(3, false); !reflect.DeepEqual(got, []ServerAddr{b, a}) {
+		t.Fatalf("picked with ban %v", got)
+	}
+	rec, _ := sl.Get(c.Addr)
+	if !rec.Banned(now) || rec.BanReason != "invalid headers" {
+		t.Fatalf("record %+v", rec)
+	}
+	now = now.Add(BanDuration + time.Minute)
+	if got := sl.Pick(3, false); !reflect.DeepEqual(got, []ServerAddr{c, b, a}) {
+		t.Fatalf("picked after ban %v", got)
+	}
+	if rec, _ = sl.Get(c.Addr); rec.Banned(now) {
+		t.Fatal("ban did not expire")
+	}
+
+	// a server on another chain is banned for good
+	sl.RecordGenesis(b, false)
+	now = now.Add(365 * 24 * time.Hour)
+	for _, addr := range sl.Pick(3, false) {
+		if addr == b {
+			t.Fatal("picked server on another chain")
+		}
+	}
+
+	// peers are added, onion peers only with a proxy
+	peers := []*PeersResult{
+		{Addr: "1.2.3.4", Host: "d.example.com", Feats: []string{"v1.4", "s50002"}},
+		{Addr: "abcdef.onion", Host: "abcdef.onion", Feats: []string{"v1.4", "t50001"}},
+		{Addr: "1.2.3.5", Host: "a.example.com", Feats: []string{"v1.4", "s50002"}},
+	}
+	if n, err := sl.AddPeers(peers, false); err != nil || n != 1 {
+		t.Fatalf("added %d peers: %v", n, err)
+	}
+	if n, err := sl.AddPeers(peers, true); err != nil || n != 1 {
+		t.Fatalf("added %d onion peers: %v", n, err)
+	}
+	rec, ok := sl.Get("abcdef.onion:50001")
+	if !ok || rec.Net != "tcp" || rec.Source != SourcePeer {
+		t.Fatalf("onion record %+v", rec)
+	}
+	for _, addr := range sl.Pick(10, false) {
+		if IsOnion(addr.Addr) {
+			t.Fatal("picked onion server without a proxy")
+		}
+	}
+	if len(sl.Pick(10, true)) != 4 {
+		t.Fatalf("picked %v", sl.Pick(10, true))
+	}
+
+	// the list persists in the data dir
+	reopened, err := NewServerList(dir, seeds)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(reopened.Servers()) != 5 {
+		t.Fatalf("reopened %d servers", len(reopened.Servers()))
+	}
+	rec, _ = reopened.Get(c.Addr)
+	if rec.Proto != "1.4.2" || rec.Connects != 1 || rec.Uptime != 12*time.Hour || rec.Misbehaviour != 1 {
+		t.Fatalf("reopened record %+v", rec)
+	}
+	if rec, _ = reopened.Get(b.Addr); !rec.BannedForever {
+		t.Fatal("ban not persisted")
+	}
+	reopened.Unban(b)
+	if rec, _ = reopened.Get(b.Addr); rec.Banned(time.Now()) {
+		t.Fatal("still banned")
+	}
+}
+
+func TestServerScore(t *testing.T) {
+	now := time.Now()
+	untried := &ServerRecord{}
+	reliable := &ServerRecord{Connects: 10, Latency: 50 * time.Millisecond, Uptime: 48 * time.Hour}
+	slow := &ServerRecord{Connects: 10, Latency: 3 * time.Second}
+	flaky := &ServerRecord{Connects: 2, Failures: 8}
+	failedRecently := &ServerRecord{Connects: 10, LastFailure: now.Add(-time.Minute)}
+	for _, tt := range []struct {
+		name          string
+		better, worse *ServerRecord
+	}{
+		{"reliable over untried", reliable, untried},
+		{"untried over flaky", untried, flaky},
+		{"fast over slow", reliable, slow},
+		{"recent failure", slow, failedRecently},
+	} {
+		if tt.better.Score(now) <= tt.worse.Score(now) {
+			t.Errorf("%s: %v <= %v", tt.name, tt.better.Score(now), tt.worse.Score(now))
+		}
+	}
+}
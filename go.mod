@@ -13,6 +13,7 @@ require (
 	github.com/tyler-smith/go-bip39 v1.1.0
 	golang.org/x/crypto v0.15.0
 	golang.org/x/net v0.18.0
+	golang.org/x/term v0.14.0
 )
 
 require (
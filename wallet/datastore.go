@@ -5,7 +5,6 @@ import (
 	"errors"
 	"time"
 
-	btcec "github.com/btcsuite/btcd/btcec/v2"
 	"github.com/btcsuite/btcd/chaincfg/chainhash"
 	"github.com/btcsuite/btcd/wire"
 )
@@ -94,6 +93,11 @@ type Datastore interface {
 	Txns() Txns
 	Keys() Keys
 	WatchedScripts() WatchedScripts
+	Status() Status
+	History() History
+	Prices() Prices
+	Labels() Labels
+	Proposals() Proposals
 }
 
 type Cfg interface {
@@ -116,6 +120,10 @@ type Utxos interface {
 	// Make a utxo unspendable
 	SetWatchOnly(utxo Utxo) error
 
+	// Freeze or unfreeze a utxo. Put keeps the frozen state of a utxo
+	// already in the db.
+	SetFrozen(utxo Utxo, frozen bool) error
+
 	// Delete a utxo from the db
 	Delete(utxo Utxo) error
 }
@@ -148,23 +156,6 @@ type Txns interface {
 	Delete(txid *chainhash.Hash) error
 }
 
-var ErrKeyImportNotImplemented = errors.New("key import not yet implemented")
-
-// Split off these imported key funcs from interface below. They need to be in
-// database encrypted blob storage.
-type ImportedKeys interface {
-	// Import a loose private key not part of the keychain
-	// ErKeyImportNotImplemented
-	ImportKey(scriptAddress []byte, key *btcec.PrivateKey) error
-
-	// Returns an imported private key given a script address
-	// ErKeyImportNotImplemented
-	GetKey(scriptAddress []byte) (*btcec.PrivateKey, error)
-
-	// Returns all imported keys - ErKeyImportNotImplemented
-	GetImported() ([]*btcec.PrivateKey, error)
-}
-
 // Keys provides a database interface for the wallet to:
 // - Track used keys by key path
 // - Manage the look ahead window.
@@ -209,6 +200,137 @@ type WatchedScripts interface {
 	Delete(scriptPubKey []byte) error
 }
 
+// Status stores the last electrum status hash seen for each subscribed
+// scripthash so unchanged addresses need not be fetched again after a restart
+type Status interface {
+	// Put the status for a scripthash
+	Put(scripthash string, status string) error
+
+	// Fetch the status for a scripthash
+	Get(scripthash string) (string, error)
+
+	// Fetch the status of all scripthashes
+	GetAll() (map[string]string, error)
+
+	// Delete the status for a scripthash
+	Delete(scripthash string) error
+}
+
+// History stores the electrum history of each subscribed scripthash so a sync
+// only needs to fetch the transactions that changed
+type History interface {
+	// Replace the history of a scripthash. The order of the entries is kept.
+	Put(scripthash string, history []HistoryEntry) error
+
+	// Fetch the history of a scripthash in the order it was put
+	Get(scripthash string) ([]HistoryEntry, error)
+
+	// Fetch the history of all scripthashes. A transaction in the history of
+	// more than one scripthash is returned more than once.
+	GetAll() ([]HistoryEntry, error)
+
+	// Delete the history of a scripthash
+	Delete(scripthash string) error
+}
+
+// Prices stores historical coin prices by day and currency for valuing
+// transactions at the time they confirmed. Dates are UTC days and currency
+// codes are upper case.
+type Prices interface {
+	// Put the price of one coin in a currency on the UTC day of date
+	Put(date time.Time, currency string, price float64) error
+
+	// Fetch the price on the last day at or before the UTC day of date.
+	// Returns ErrNoPrice if there is none.
+	Get(date time.Time, currency string) (Price, error)
+
+	// Fetch all prices in a currency ordered by date
+	GetAll(currency string) ([]Price, error)
+
+	// Delete the price on the UTC day of date
+	Delete(date time.Time, currency string) error
+}
+
+// Price is the price of one coin in a currency on a UTC day
+type Price struct {
+	Date     time.Time
+	Currency string
+	Price    float64
+}
+
+// PriceDateLayout formats the UTC day of a Price
+const PriceDateLayout = "2006-01-02"
+
+// ErrNoPrice is returned by Prices when there is no price for the date
+var ErrNoPrice = errors.New("no historical price")
+
+// Labels stores the user's labels of transactions, addresses, outputs and
+// other references, keyed by type and reference as in BIP329
+type Labels interface {
+	// Put a label, replacing any label of the same type and reference
+	Put(label Label) error
+
+	// Fetch the label of a reference
+	Get(labelType LabelType, ref string) (Label, error)
+
+	// Fetch all labels ordered by type and reference
+	GetAll() ([]Label, error)
+
+	// Delete the label of a reference
+	Delete(labelType LabelType, ref string) error
+}
+
+// LabelType is the kind of reference labelled, named as in BIP329
+type LabelType string
+
+const (
+	LabelTx     LabelType = "tx"     // txid
+	LabelAddr   LabelType = "addr"   // address
+	LabelPubkey LabelType = "pubkey" // hex public key
+	LabelInput  LabelType = "input"  // txid:vin of a spending input
+	LabelOutput LabelType = "output" // txid:vout
+	LabelXpub   LabelType = "xpub"   // extended public key
+)
+
+type Label struct {
+	Type  LabelType
+	Ref   string
+	Label string
+
+	// Optional key origin of the reference, e.g. wpkh([d34db33f/84'/0'/0'])
+	Origin string
+}
+
+// Proposals stores the transaction proposals of the wallet with the coins
+// they spend
+type Proposals interface {
+	// Put a proposal, replacing any proposal with the same ID
+	Put(proposal TxProposal) error
+
+	// Fetch a proposal. Returns ErrNoProposal if there is none.
+	Get(id string) (TxProposal, error)
+
+	// Fetch all proposals ordered by creation time
+	GetAll() ([]TxProposal, error)
+
+	// Delete a proposal
+	Delete(id string) error
+}
+
+// ErrNoProposal is returned by Proposals when there is no proposal of the ID
+var ErrNoProposal = errors.New("no such proposal")
+
+type HistoryEntry struct {
+	Txid string
+
+	// Block height, 0 for unconfirmed or -1 for unconfirmed with unconfirmed
+	// parents
+	Height int64
+
+	// Fee in satoshis; only known for unconfirmed transactions
+	Fee int64
+}
+
 type Utxo struct {
 	// Previous txid and output index
 	Op wire.OutPoint
@@ -226,6 +348,10 @@ type Utxo struct {
 	// purpose is track multisig UTXOs which must have separate handling
 	// to spend.
 	WatchOnly bool
+
+	// If true the user has frozen this utxo, e.g. dust sent to track the
+	// wallet, and it is not spent until unfrozen
+	Frozen bool
 }
 
 func (utxo *Utxo) IsEqual(alt *Utxo) bool {
@@ -315,6 +441,13 @@ type Txn struct {
 	// If the Status is Error the ErrorMessage should describe the problem
 	ErrorMessage string
 
+	// Fee in satoshis as reported by the server for an unconfirmed transaction
+	Fee int64
+
+	// An unconfirmed transaction spending outputs of other unconfirmed
+	// transactions. It cannot confirm before its parents do.
+	UnconfirmedParents bool
+
 	// Raw transaction bytes
 	Bytes []byte
 
@@ -20,6 +20,11 @@ type SQLiteDatastore struct {
 	stxos          wallet.Stxos
 	txns           wallet.Txns
 	watchedScripts wallet.WatchedScripts
+	status         wallet.Status
+	history        wallet.History
+	prices         wallet.Prices
+	labels         wallet.Labels
+	proposals      wallet.Proposals
 	db             *sql.DB
 	lock           *sync.RWMutex
 }
@@ -61,6 +66,26 @@ func Create(repoPath string) (*SQLiteDatastore, error) {
 			db:   conn,
 			lock: l,
 		},
+		status: &StatusDB{
+			db:   conn,
+			lock: l,
+		},
+		history: &HistoryDB{
+			db:   conn,
+			lock: l,
+		},
+		prices: &PricesDB{
+			db:   conn,
+			lock: l,
+		},
+		labels: &LabelsDB{
+			db:   conn,
+			lock: l,
+		},
+		proposals: &ProposalsDB{
+			db:   conn,
+			lock: l,
+		},
 		db:   conn,
 		lock: l,
 	}
@@ -90,14 +115,40 @@ func (db *SQLiteDatastore) WatchedScripts() wallet.WatchedScripts {
 	return db.watchedScripts
 }
 
+func (db *SQLiteDatastore) Status() wallet.Status {
+	return db.status
+}
+
+func (db *SQLiteDatastore) History() wallet.History {
+	return db.history
+}
+
+func (db *SQLiteDatastore) Prices() wallet.Prices {
+	return db.prices
+}
+
+func (db *SQLiteDatastore) Labels() wallet.Labels {
+	return db.labels
+}
+
+func (db *SQLiteDatastore) Proposals() wallet.Proposals {
+	return db.proposals
+}
+
 func initDatabaseTables(db *sql.DB) error {
 	var sqlStmt string
 	sqlStmt = sqlStmt + `
 	create table if not exists keys (scriptAddress text primary key not null, purpose integer, keyIndex integer, used integer, key text);
-	create table if not exists utxos (outpoint text primary key not null, value integer, height integer, scriptPubKey text, watchOnly integer);
+	create table if not exists utxos (outpoint text primary key not null, value integer, height integer, scriptPubKey text, watchOnly integer, frozen integer default 0);
 	create table if not exists stxos (outpoint text primary key not null, value integer, height integer, scriptPubKey text, watchOnly integer, spendHeight integer, spendTxid text);
 	create table if not exists txns (txid text primary key not null, value integer, height integer, timestamp integer, watchOnly integer, tx blob);
 	create table if not exists watchedScripts (scriptPubKey text primary key not null);
+	create table if not exists status (scripthash text primary key not null, status text);
+	create table if not exists history (scripthash text not null, pos integer not null, txid text not null, height integer, fee integer, primary key (scripthash, pos));
+	create table if not exists prices (date text not null, currency text not null, price real, primary key (date, currency));
+	create table if not exists labels (type text not null, ref text not null, label text, origin text, primary key (type, ref));
+	create table if not exists proposals (id text primary key not null, tx blob, changeIndex integer, fee integer, vsize integer, feePerByte integer, status text, created integer);
+	create table if not exists proposalInputs (id text not null, pos integer not null, outpoint text, value integer, height integer, scriptPubKey text, primary key (id, pos));
 	create table if not exists config(key text primary key not null, value blob);
 	create table if not exists enc(key text primary key not null, value blob);
 	`
@@ -105,5 +156,29 @@ func initDatabaseTables(db *sql.DB) error {
 	if err != nil {
 		return err
 	}
-	return nil
+	// columns added since the tables were first created
+	return addColumn(db, "utxos", "frozen", "integer default 0")
+}
+
+// addColumn adds a column to a table of an older database that lacks it
+func addColumn(db *sql.DB, table, column, definition string) error {
+	rows, err := db.Query("select name from pragma_table_info(?)", table)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return err
+		}
+		if name == column {
+			return nil
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	_, err = db.Exec("alter table " + table + " add column " + column + " " + definition)
+	return err
 }
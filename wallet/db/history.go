@@ -0,0 +1,89 @@
+package db
+
+import (
+	"database/sql"
+	"sync"
+
+	"main/wallet"
+)
+
+type HistoryDB struct {
+	db   *sql.DB
+	lock *sync.RWMutex
+}
+
+func (h *HistoryDB) Put(scripthash string, history []wallet.HistoryEntry) error {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	tx, err := h.db.Begin()
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec("delete from history where scripthash=?", scripthash)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	stmt, err := tx.Prepare("insert into history(scripthash, pos, txid, height, fee) values(?,?,?,?,?)")
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	defer stmt.Close()
+	for i, e := range history {
+		_, err = stmt.Exec(scripthash, i, e.Txid, e.Height, e.Fee)
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func (h *HistoryDB) Get(scripthash string) ([]wallet.HistoryEntry, error) {
+	h.lock.RLock()
+	defer h.lock.RUnlock()
+	var ret []wallet.HistoryEntry
+	rows, err := h.db.Query("select txid, height, fee from history where scripthash=? order by pos", scripthash)
+	if err != nil {
+		return ret, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var e wallet.HistoryEntry
+		if err := rows.Scan(&e.Txid, &e.Height, &e.Fee); err != nil {
+			continue
+		}
+		ret = append(ret, e)
+	}
+	return ret, nil
+}
+
+func (h *HistoryDB) GetAll() ([]wallet.HistoryEntry, error) {
+	h.lock.RLock()
+	defer h.lock.RUnlock()
+	var ret []wallet.HistoryEntry
+	rows, err := h.db.Query("select txid, height, fee from history order by scripthash, pos")
+	if err != nil {
+		return ret, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var e wallet.HistoryEntry
+		if err := rows.Scan(&e.Txid, &e.Height, &e.Fee); err != nil {
+			continue
+		}
+		ret = append(ret, e)
+	}
+	return ret, nil
+}
+
+func (h *HistoryDB) Delete(scripthash string) error {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	_, err := h.db.Exec("delete from history where scripthash=?", scripthash)
+	if err != nil {
+		return err
+	}
+	return nil
+}
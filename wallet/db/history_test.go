@@ -0,0 +1,88 @@
+package db
+
+import (
+	"database/sql"
+	"sync"
+	"testing"
+
+	"main/wallet"
+)
+
+var hdb HistoryDB
+
+func init() {
+	conn, _ := sql.Open("sqlite3", ":memory:")
+	initDatabaseTables(conn)
+	hdb = HistoryDB{
+		db:   conn,
+		lock: new(sync.RWMutex),
+	}
+}
+
+func TestHistoryDB_PutGet(t *testing.T) {
+	history := []wallet.HistoryEntry{
+		{Txid: "bb", Height: 100},
+		{Txid: "aa", Height: 101},
+		{Txid: "cc", Height: 0, Fee: 250},
+	}
+	err := hdb.Put("sh1", history)
+	if err != nil {
+		t.Error(err)
+	}
+	ret, err := hdb.Get("sh1")
+	if err != nil {
+		t.Error(err)
+	}
+	if len(ret) != len(history) {
+		t.Fatal("Returned incorrect number of history entries")
+	}
+	for i := range history {
+		if ret[i] != history[i] {
+			t.Error("Returned incorrect history entry")
+		}
+	}
+
+	// put replaces the history
+	err = hdb.Put("sh1", history[:1])
+	if err != nil {
+		t.Error(err)
+	}
+	ret, _ = hdb.Get("sh1")
+	if len(ret) != 1 || ret[0] != history[0] {
+		t.Error("Failed to replace history")
+	}
+	ret, _ = hdb.Get("sh2")
+	if len(ret) != 0 {
+		t.Error("Returned history for unknown scripthash")
+	}
+}
+
+func TestHistoryDB_GetAll(t *testing.T) {
+	hdb.Put("sh4", []wallet.HistoryEntry{{Txid: "aa", Height: 1}})
+	hdb.Put("sh5", []wallet.HistoryEntry{{Txid: "aa", Height: 1}, {Txid: "dd", Height: -1, Fee: 100}})
+	ret, err := hdb.GetAll()
+	if err != nil {
+		t.Error(err)
+	}
+	var n int
+	for _, e := range ret {
+		if e.Txid == "aa" || e.Txid == "dd" {
+			n++
+		}
+	}
+	if n != 3 {
+		t.Error("Returned incorrect number of history entries")
+	}
+}
+
+func TestHistoryDB_Delete(t *testing.T) {
+	hdb.Put("sh3", []wallet.HistoryEntry{{Txid: "aa", Height: 1}})
+	err := hdb.Delete("sh3")
+	if err != nil {
+		t.Error(err)
+	}
+	ret, _ := hdb.Get("sh3")
+	if len(ret) != 0 {
+		t.Error("Failed to delete history")
+	}
+}
@@ -0,0 +1,82 @@
+package db
+
+import (
+	"database/sql"
+	"sync"
+
+	"main/wallet"
+)
+
+type LabelsDB struct {
+	db   *sql.DB
+	lock *sync.RWMutex
+}
+
+func (l *LabelsDB) Put(label wallet.Label) error {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	tx, err := l.db.Begin()
+	if err != nil {
+		return err
+	}
+	stmt, err := tx.Prepare("insert or replace into labels(type, ref, label, origin) values(?,?,?,?)")
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	defer stmt.Close()
+	_, err = stmt.Exec(string(label.Type), label.Ref, label.Label, label.Origin)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	tx.Commit()
+	return nil
+}
+
+func (l *LabelsDB) Get(labelType wallet.LabelType, ref string) (wallet.Label, error) {
+	l.lock.RLock()
+	defer l.lock.RUnlock()
+	stmt, err := l.db.Prepare("select label, origin from labels where type=? and ref=?")
+	if err != nil {
+		return wallet.Label{}, err
+	}
+	defer stmt.Close()
+	label := wallet.Label{Type: labelType, Ref: ref}
+	err = stmt.QueryRow(string(labelType), ref).Scan(&label.Label, &label.Origin)
+	if err != nil {
+		return wallet.Label{}, err
+	}
+	return label, nil
+}
+
+func (l *LabelsDB) GetAll() ([]wallet.Label, error) {
+	l.lock.RLock()
+	defer l.lock.RUnlock()
+	var ret []wallet.Label
+	rows, err := l.db.Query("select type, ref, label, origin from labels order by type, ref")
+	if err != nil {
+		return ret, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var label wallet.Label
+		var labelType string
+		if err := rows.Scan(&labelType, &label.Ref, &label.Label, &label.Origin); err != nil {
+			continue
+		}
+		label.Type = wallet.LabelType(labelType)
+		ret = append(ret, label)
+	}
+	return ret, nil
+}
+
+func (l *LabelsDB) Delete(labelType wallet.LabelType, ref string) error {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	_, err := l.db.Exec("delete from labels where type=? and ref=?", string(labelType), ref)
+	if err != nil {
+		return err
+	}
+	return nil
+}
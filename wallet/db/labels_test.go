@@ -0,0 +1,73 @@
+package db
+
+import (
+	"database/sql"
+	"sync"
+	"testing"
+
+	"main/wallet"
+)
+
+var ldb LabelsDB
+
+func init() {
+	conn, _ := sql.Open("sqlite3", ":memory:")
+	initDatabaseTables(conn)
+	ldb = LabelsDB{
+		db:   conn,
+		lock: new(sync.RWMutex),
+	}
+}
+
+func TestLabelsDB_PutGet(t *testing.T) {
+	label := wallet.Label{Type: wallet.LabelAddr, Ref: "addr1", Label: "savings", Origin: "wpkh([d34db33f/84'/0'/0'])"}
+	if err := ldb.Put(label); err != nil {
+		t.Error(err)
+	}
+	got, err := ldb.Get(wallet.LabelAddr, "addr1")
+	if err != nil {
+		t.Error(err)
+	}
+	if got != label {
+		t.Errorf("Returned incorrect label %+v", got)
+	}
+	label.Label = "spending"
+	if err = ldb.Put(label); err != nil {
+		t.Error(err)
+	}
+	got, _ = ldb.Get(wallet.LabelAddr, "addr1")
+	if got.Label != "spending" {
+		t.Error("Failed to replace label")
+	}
+	if _, err = ldb.Get(wallet.LabelTx, "addr1"); err == nil {
+		t.Error("Returned label of another type")
+	}
+}
+
+func TestLabelsDB_GetAll(t *testing.T) {
+	ldb.Put(wallet.Label{Type: wallet.LabelTx, Ref: "tx2", Label: "b"})
+	ldb.Put(wallet.Label{Type: wallet.LabelTx, Ref: "tx1", Label: "a"})
+	all, err := ldb.GetAll()
+	if err != nil {
+		t.Error(err)
+	}
+	var txs []wallet.Label
+	for _, label := range all {
+		if label.Type == wallet.LabelTx {
+			txs = append(txs, label)
+		}
+	}
+	if len(txs) != 2 || txs[0].Ref != "tx1" || txs[1].Label != "b" {
+		t.Errorf("Returned incorrect labels %+v", txs)
+	}
+}
+
+func TestLabelsDB_Delete(t *testing.T) {
+	ldb.Put(wallet.Label{Type: wallet.LabelOutput, Ref: "tx3:0", Label: "dust"})
+	if err := ldb.Delete(wallet.LabelOutput, "tx3:0"); err != nil {
+		t.Error(err)
+	}
+	if _, err := ldb.Get(wallet.LabelOutput, "tx3:0"); err == nil {
+		t.Error("Failed to delete label")
+	}
+}
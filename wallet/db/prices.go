@@ -0,0 +1,101 @@
+package db
+
+import (
+	"database/sql"
+	"errors"
+	"strings"
+	"sync"
+	"time"
+
+	"main/wallet"
+)
+
+type PricesDB struct {
+	db   *sql.DB
+	lock *sync.RWMutex
+}
+
+func priceDate(t time.Time) string {
+	return t.UTC().Format(wallet.PriceDateLayout)
+}
+
+func (p *PricesDB) Put(date time.Time, currency string, price float64) error {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	tx, err := p.db.Begin()
+	if err != nil {
+		return err
+	}
+	stmt, err := tx.Prepare("insert or replace into prices(date, currency, price) values(?,?,?)")
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	defer stmt.Close()
+	_, err = stmt.Exec(priceDate(date), strings.ToUpper(currency), price)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	tx.Commit()
+	return nil
+}
+
+func (p *PricesDB) Get(date time.Time, currency string) (wallet.Price, error) {
+	p.lock.RLock()
+	defer p.lock.RUnlock()
+	stmt, err := p.db.Prepare("select date, price from prices where currency=? and date<=? order by date desc limit 1")
+	if err != nil {
+		return wallet.Price{}, err
+	}
+	defer stmt.Close()
+	var day string
+	var price float64
+	err = stmt.QueryRow(strings.ToUpper(currency), priceDate(date)).Scan(&day, &price)
+	if errors.Is(err, sql.ErrNoRows) {
+		return wallet.Price{}, wallet.ErrNoPrice
+	}
+	if err != nil {
+		return wallet.Price{}, err
+	}
+	d, err := time.Parse(wallet.PriceDateLayout, day)
+	if err != nil {
+		return wallet.Price{}, err
+	}
+	return wallet.Price{Date: d, Currency: strings.ToUpper(currency), Price: price}, nil
+}
+
+func (p *PricesDB) GetAll(currency string) ([]wallet.Price, error) {
+	p.lock.RLock()
+	defer p.lock.RUnlock()
+	var ret []wallet.Price
+	currency = strings.ToUpper(currency)
+	rows, err := p.db.Query("select date, price from prices where currency=? order by date", currency)
+	if err != nil {
+		return ret, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var day string
+		var price float64
+		if err := rows.Scan(&day, &price); err != nil {
+			continue
+		}
+		d, err := time.Parse(wallet.PriceDateLayout, day)
+		if err != nil {
+			continue
+		}
+		ret = append(ret, wallet.Price{Date: d, Currency: currency, Price: price})
+	}
+	return ret, nil
+}
+
+func (p *PricesDB) Delete(date time.Time, currency string) error {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	_, err := p.db.Exec("delete from prices where date=? and currency=?", priceDate(date), strings.ToUpper(currency))
+	if err != nil {
+		return err
+	}
+	return nil
+}
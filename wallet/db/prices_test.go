@@ -0,0 +1,85 @@
+package db
+
+import (
+	"database/sql"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"main/wallet"
+)
+
+var pdb PricesDB
+
+func init() {
+	conn, _ := sql.Open("sqlite3", ":memory:")
+	initDatabaseTables(conn)
+	pdb = PricesDB{
+		db:   conn,
+		lock: new(sync.RWMutex),
+	}
+}
+
+func day(s string) time.Time {
+	d, _ := time.Parse(wallet.PriceDateLayout, s)
+	return d
+}
+
+func TestPricesDB_PutGet(t *testing.T) {
+	if err := pdb.Put(day("2023-01-02"), "usd", 16000); err != nil {
+		t.Error(err)
+	}
+	if err := pdb.Put(day("2023-01-05"), "USD", 17000); err != nil {
+		t.Error(err)
+	}
+	// the time of day does not matter
+	at := day("2023-01-04").Add(23 * time.Hour)
+	price, err := pdb.Get(at, "USD")
+	if err != nil {
+		t.Error(err)
+	}
+	if price.Price != 16000 || !price.Date.Equal(day("2023-01-02")) || price.Currency != "USD" {
+		t.Errorf("Returned incorrect price %+v", price)
+	}
+	price, err = pdb.Get(day("2023-01-05").Add(time.Hour), "usd")
+	if err != nil || price.Price != 17000 {
+		t.Errorf("Returned incorrect price %+v %v", price, err)
+	}
+	if err = pdb.Put(day("2023-01-05"), "USD", 17500); err != nil {
+		t.Error(err)
+	}
+	price, _ = pdb.Get(day("2023-01-05"), "USD")
+	if price.Price != 17500 {
+		t.Error("Failed to replace price")
+	}
+	if _, err = pdb.Get(day("2023-01-01"), "USD"); !errors.Is(err, wallet.ErrNoPrice) {
+		t.Errorf("Returned price before the first day: %v", err)
+	}
+	if _, err = pdb.Get(day("2023-01-05"), "EUR"); !errors.Is(err, wallet.ErrNoPrice) {
+		t.Errorf("Returned price for another currency: %v", err)
+	}
+}
+
+func TestPricesDB_GetAll(t *testing.T) {
+	pdb.Put(day("2022-03-02"), "GBP", 30000)
+	pdb.Put(day("2022-03-01"), "GBP", 29000)
+	pdb.Put(day("2022-03-01"), "CHF", 1)
+	all, err := pdb.GetAll("gbp")
+	if err != nil {
+		t.Error(err)
+	}
+	if len(all) != 2 || all[0].Price != 29000 || all[1].Price != 30000 {
+		t.Errorf("Returned incorrect prices %+v", all)
+	}
+}
+
+func TestPricesDB_Delete(t *testing.T) {
+	pdb.Put(day("2021-06-01"), "JPY", 4000000)
+	if err := pdb.Delete(day("2021-06-01"), "jpy"); err != nil {
+		t.Error(err)
+	}
+	if _, err := pdb.Get(day("2021-06-01"), "JPY"); err == nil {
+		t.Error("Failed to delete price")
+	}
+}
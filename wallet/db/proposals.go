@@ -0,0 +1,180 @@
+package db
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"main/wallet"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/wire"
+)
+
+type ProposalsDB struct {
+	db   *sql.DB
+	lock *sync.RWMutex
+}
+
+func (p *ProposalsDB) Put(proposal wallet.TxProposal) error {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	var buf bytes.Buffer
+	if err := proposal.Tx.Serialize(&buf); err != nil {
+		return err
+	}
+	tx, err := p.db.Begin()
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(`insert or replace into proposals(id, tx, changeIndex, fee, vsize, feePerByte, status, created)
+		values(?,?,?,?,?,?,?,?)`, proposal.ID, buf.Bytes(), proposal.ChangeIndex, proposal.Fee, proposal.Vsize,
+		int64(proposal.FeePerByte), string(proposal.Status), proposal.Created.Unix())
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	_, err = tx.Exec("delete from proposalInputs where id=?", proposal.ID)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	stmt, err := tx.Prepare("insert into proposalInputs(id, pos, outpoint, value, height, scriptPubKey) values(?,?,?,?,?,?)")
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	defer stmt.Close()
+	for i, u := range proposal.Inputs {
+		outpoint := u.Op.Hash.String() + ":" + strconv.Itoa(int(u.Op.Index))
+		_, err = stmt.Exec(proposal.ID, i, outpoint, u.Value, u.AtHeight, hex.EncodeToString(u.ScriptPubkey))
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func (p *ProposalsDB) Get(id string) (wallet.TxProposal, error) {
+	p.lock.RLock()
+	defer p.lock.RUnlock()
+	rows, err := p.db.Query("select id, tx, changeIndex, fee, vsize, feePerByte, status, created from proposals where id=?", id)
+	if err != nil {
+		return wallet.TxProposal{}, err
+	}
+	proposals, err := p.scanProposals(rows)
+	if err != nil {
+		return wallet.TxProposal{}, err
+	}
+	if len(proposals) == 0 {
+		return wallet.TxProposal{}, wallet.ErrNoProposal
+	}
+	return proposals[0], nil
+}
+
+func (p *ProposalsDB) GetAll() ([]wallet.TxProposal, error) {
+	p.lock.RLock()
+	defer p.lock.RUnlock()
+	rows, err := p.db.Query("select id, tx, changeIndex, fee, vsize, feePerByte, status, created from proposals order by created, id")
+	if err != nil {
+		return nil, err
+	}
+	return p.scanProposals(rows)
+}
+
+// scanProposals reads the proposal rows and then the inputs of each
+func (p *ProposalsDB) scanProposals(rows *sql.Rows) ([]wallet.TxProposal, error) {
+	defer rows.Close()
+	var ret []wallet.TxProposal
+	for rows.Next() {
+		var proposal wallet.TxProposal
+		var raw []byte
+		var feePerByte, created int64
+		var status string
+		if err := rows.Scan(&proposal.ID, &raw, &proposal.ChangeIndex, &proposal.Fee, &proposal.Vsize,
+			&feePerByte, &status, &created); err != nil {
+			return nil, err
+		}
+		msgTx := wire.NewMsgTx(wire.TxVersion)
+		if err := msgTx.Deserialize(bytes.NewReader(raw)); err != nil {
+			return nil, fmt.Errorf("proposal %s: %w", proposal.ID, err)
+		}
+		proposal.Tx = msgTx
+		proposal.FeePerByte = uint64(feePerByte)
+		proposal.Status = wallet.ProposalStatus(status)
+		proposal.Created = time.Unix(created, 0)
+		ret = append(ret, proposal)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	// the inputs are queried once the rows are read
+	rows.Close()
+	for i := range ret {
+		inputs, err := p.inputs(ret[i].ID)
+		if err != nil {
+			return nil, err
+		}
+		ret[i].Inputs = inputs
+	}
+	return ret, nil
+}
+
+func (p *ProposalsDB) inputs(id string) ([]wallet.Utxo, error) {
+	rows, err := p.db.Query("select outpoint, value, height, scriptPubKey from proposalInputs where id=? order by pos", id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var ret []wallet.Utxo
+	for rows.Next() {
+		var outpoint, scriptPubKey string
+		var u wallet.Utxo
+		if err := rows.Scan(&outpoint, &u.Value, &u.AtHeight, &scriptPubKey); err != nil {
+			return nil, err
+		}
+		txid, index, ok := strings.Cut(outpoint, ":")
+		if !ok {
+			return nil, errors.New("invalid proposal input outpoint")
+		}
+		hash, err := chainhash.NewHashFromStr(txid)
+		if err != nil {
+			return nil, err
+		}
+		n, err := strconv.ParseUint(index, 10, 32)
+		if err != nil {
+			return nil, err
+		}
+		if u.ScriptPubkey, err = hex.DecodeString(scriptPubKey); err != nil {
+			return nil, err
+		}
+		u.Op = *wire.NewOutPoint(hash, uint32(n))
+		ret = append(ret, u)
+	}
+	return ret, rows.Err()
+}
+
+func (p *ProposalsDB) Delete(id string) error {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	tx, err := p.db.Begin()
+	if err != nil {
+		return err
+	}
+	if _, err = tx.Exec("delete from proposalInputs where id=?", id); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if _, err = tx.Exec("delete from proposals where id=?", id); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,138 @@
+package db
+
+import (
+	"database/sql"
+	"errors"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"main/wallet"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/wire"
+)
+
+var prdb ProposalsDB
+
+func init() {
+	conn, _ := sql.Open("sqlite3", ":memory:")
+	initDatabaseTables(conn)
+	prdb = ProposalsDB{
+		db:   conn,
+		lock: new(sync.RWMutex),
+	}
+}
+
+func testProposal(id string, created time.Time, inputs int) wallet.TxProposal {
+	tx := wire.NewMsgTx(wire.TxVersion)
+	proposal := wallet.TxProposal{
+		ID: id,
+		SpendResult: wallet.SpendResult{
+			Tx:          tx,
+			ChangeIndex: 1,
+			Fee:         1130,
+			Vsize:       226,
+			FeePerByte:  5,
+		},
+		Status:  wallet.ProposalUnsigned,
+		Created: created,
+	}
+	for i := 0; i < inputs; i++ {
+		hash := chainhash.DoubleHashH([]byte(id))
+		op := wire.NewOutPoint(&hash, uint32(i))
+		tx.AddTxIn(wire.NewTxIn(op, nil, nil))
+		proposal.Inputs = append(proposal.Inputs, wallet.Utxo{
+			Op:           *op,
+			AtHeight:     int64(100 + i),
+			Value:        int64(10000 * (i + 1)),
+			ScriptPubkey: []byte{0x00, 0x14, byte(i)},
+		})
+	}
+	tx.AddTxOut(wire.NewTxOut(5000, []byte{0x51}))
+	tx.AddTxOut(wire.NewTxOut(3870, []byte{0x52}))
+	return proposal
+}
+
+func TestProposalsDB_PutGet(t *testing.T) {
+	proposal := testProposal("p1", time.Unix(1700000000, 0), 2)
+	if err := prdb.Put(proposal); err != nil {
+		t.Error(err)
+	}
+	got, err := prdb.Get("p1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Tx.TxHash() != proposal.Tx.TxHash() {
+		t.Error("Returned incorrect transaction")
+	}
+	got.Tx, proposal.Tx = nil, nil
+	if !reflect.DeepEqual(got, proposal) {
+		t.Errorf("Returned incorrect proposal %+v", got)
+	}
+
+	// put replaces the proposal and its inputs
+	proposal = testProposal("p1", time.Unix(1700000000, 0), 1)
+	proposal.Status = wallet.ProposalSigned
+	if err = prdb.Put(proposal); err != nil {
+		t.Error(err)
+	}
+	got, _ = prdb.Get("p1")
+	if got.Status != wallet.ProposalSigned || len(got.Inputs) != 1 {
+		t.Errorf("Failed to replace proposal %+v", got)
+	}
+	if _, err = prdb.Get("p2"); !errors.Is(err, wallet.ErrNoProposal) {
+		t.Errorf("Get of an unknown proposal returned %v", err)
+	}
+}
+
+func TestProposalsDB_GetAll(t *testing.T) {
+	prdb.Put(testProposal("late", time.Unix(1700000200, 0), 1))
+	prdb.Put(testProposal("early", time.Unix(1700000100, 0), 3))
+	all, err := prdb.GetAll()
+	if err != nil {
+		t.Error(err)
+	}
+	var ids []string
+	for _, proposal := range all {
+		if proposal.ID == "early" && len(proposal.Inputs) != 3 {
+			t.Error("Returned incorrect inputs")
+		}
+		ids = append(ids, proposal.ID)
+	}
+	if len(ids) < 2 || ids[len(ids)-2] != "early" || ids[len(ids)-1] != "late" {
+		t.Errorf("Returned proposals out of order %v", ids)
+	}
+}
+
+func TestProposalsDB_Delete(t *testing.T) {
+	prdb.Put(testProposal("gone", time.Unix(1700000300, 0), 2))
+	if err := prdb.Delete("gone"); err != nil {
+		t.Error(err)
+	}
+	if _, err := prdb.Get("gone"); !errors.Is(err, wallet.ErrNoProposal) {
+		t.Error("Failed to delete proposal")
+	}
+	var n int
+	prdb.db.QueryRow("select count(*) from proposalInputs where id=?", "gone").Scan(&n)
+	if n != 0 {
+		t.Error("Failed to delete proposal inputs")
+	}
+}
+
+func TestProposalsDB_Corrupt(t *testing.T) {
+	conn, _ := sql.Open("sqlite3", ":memory:")
+	initDatabaseTables(conn)
+	db := ProposalsDB{db: conn, lock: new(sync.RWMutex)}
+	if err := db.Put(testProposal("bad", time.Unix(1700000400, 0), 1)); err != nil {
+		t.Fatal(err)
+	}
+	conn.Exec("update proposals set tx=? where id=?", []byte{0x01}, "bad")
+	if _, err := db.Get("bad"); err == nil || errors.Is(err, wallet.ErrNoProposal) {
+		t.Errorf("Get of an undecodable proposal %v", err)
+	}
+	if all, err := db.GetAll(); err == nil {
+		t.Errorf("GetAll skipped an undecodable proposal %v", all)
+	}
+}
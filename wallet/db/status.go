@@ -0,0 +1,78 @@
+package db
+
+import (
+	"database/sql"
+	"sync"
+)
+
+type StatusDB struct {
+	db   *sql.DB
+	lock *sync.RWMutex
+}
+
+func (s *StatusDB) Put(scripthash string, status string) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	stmt, err := tx.Prepare("insert or replace into status(scripthash, status) values(?,?)")
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	defer stmt.Close()
+	_, err = stmt.Exec(scripthash, status)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	tx.Commit()
+	return nil
+}
+
+func (s *StatusDB) Get(scripthash string) (string, error) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	stmt, err := s.db.Prepare("select status from status where scripthash=?")
+	if err != nil {
+		return "", err
+	}
+	defer stmt.Close()
+	var status string
+	err = stmt.QueryRow(scripthash).Scan(&status)
+	if err != nil {
+		return "", err
+	}
+	return status, nil
+}
+
+func (s *StatusDB) GetAll() (map[string]string, error) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	ret := make(map[string]string)
+	rows, err := s.db.Query("select scripthash, status from status")
+	if err != nil {
+		return ret, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var scripthash, status string
+		if err := rows.Scan(&scripthash, &status); err != nil {
+			continue
+		}
+		ret[scripthash] = status
+	}
+	return ret, nil
+}
+
+func (s *StatusDB) Delete(scripthash string) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	_, err := s.db.Exec("delete from status where scripthash=?", scripthash)
+	if err != nil {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,71 @@
+package db
+
+import (
+	"database/sql"
+	"sync"
+	"testing"
+)
+
+var sdb StatusDB
+
+func init() {
+	conn, _ := sql.Open("sqlite3", ":memory:")
+	initDatabaseTables(conn)
+	sdb = StatusDB{
+		db:   conn,
+		lock: new(sync.RWMutex),
+	}
+}
+
+func TestStatusDB_PutGet(t *testing.T) {
+	err := sdb.Put("sh1", "status1")
+	if err != nil {
+		t.Error(err)
+	}
+	status, err := sdb.Get("sh1")
+	if err != nil {
+		t.Error(err)
+	}
+	if status != "status1" {
+		t.Error("Returned incorrect status")
+	}
+	err = sdb.Put("sh1", "status2")
+	if err != nil {
+		t.Error(err)
+	}
+	status, err = sdb.Get("sh1")
+	if err != nil {
+		t.Error(err)
+	}
+	if status != "status2" {
+		t.Error("Failed to replace status")
+	}
+	_, err = sdb.Get("none")
+	if err == nil {
+		t.Error("Returned status for unknown scripthash")
+	}
+}
+
+func TestStatusDB_GetAll(t *testing.T) {
+	sdb.Put("sh2", "a")
+	sdb.Put("sh3", "b")
+	all, err := sdb.GetAll()
+	if err != nil {
+		t.Error(err)
+	}
+	if all["sh2"] != "a" || all["sh3"] != "b" {
+		t.Error("Returned incorrect statuses")
+	}
+}
+
+func TestStatusDB_Delete(t *testing.T) {
+	sdb.Put("sh4", "a")
+	err := sdb.Delete("sh4")
+	if err != nil {
+		t.Error(err)
+	}
+	_, err = sdb.Get("sh4")
+	if err == nil {
+		t.Error("Failed to delete status")
+	}
+}
@@ -22,7 +22,9 @@ func (u *UtxoDB) Put(utxo wallet.Utxo) error {
 	u.lock.Lock()
 	defer u.lock.Unlock()
 	tx, _ := u.db.Begin()
-	stmt, err := tx.Prepare("insert or replace into utxos(outpoint, value, height, scriptPubKey, watchOnly) values(?,?,?,?,?)")
+	stmt, err := tx.Prepare(`insert into utxos(outpoint, value, height, scriptPubKey, watchOnly, frozen) values(?,?,?,?,?,?)
+		on conflict(outpoint) do update set value=excluded.value, height=excluded.height,
+		scriptPubKey=excluded.scriptPubKey, watchOnly=excluded.watchOnly`)
 	defer stmt.Close()
 	if err != nil {
 		tx.Rollback()
@@ -33,7 +35,11 @@ func (u *UtxoDB) Put(utxo wallet.Utxo) error {
 	if utxo.WatchOnly {
 		watchOnly = 1
 	}
-	_, err = stmt.Exec(outpoint, int(utxo.Value), int(utxo.AtHeight), hex.EncodeToString(utxo.ScriptPubkey), watchOnly)
+	frozen := 0
+	if utxo.Frozen {
+		frozen = 1
+	}
+	_, err = stmt.Exec(outpoint, int(utxo.Value), int(utxo.AtHeight), hex.EncodeToString(utxo.ScriptPubkey), watchOnly, frozen)
 	if err != nil {
 		tx.Rollback()
 		return err
@@ -46,7 +52,7 @@ func (u *UtxoDB) GetAll() ([]wallet.Utxo, error) {
 	u.lock.RLock()
 	defer u.lock.RUnlock()
 	var ret []wallet.Utxo
-	stm := "select outpoint, value, height, scriptPubKey, watchOnly from utxos"
+	stm := "select outpoint, value, height, scriptPubKey, watchOnly, frozen from utxos"
 	rows, err := u.db.Query(stm)
 	defer rows.Close()
 	if err != nil {
@@ -58,7 +64,8 @@ func (u *UtxoDB) GetAll() ([]wallet.Utxo, error) {
 		var height int
 		var scriptPubKey string
 		var watchOnlyInt int
-		if err := rows.Scan(&outpoint, &value, &height, &scriptPubKey, &watchOnlyInt); err != nil {
+		var frozenInt int
+		if err := rows.Scan(&outpoint, &value, &height, &scriptPubKey, &watchOnlyInt, &frozenInt); err != nil {
 			continue
 		}
 		s := strings.Split(outpoint, ":")
@@ -87,6 +94,7 @@ func (u *UtxoDB) GetAll() ([]wallet.Utxo, error) {
 			Value:        int64(value),
 			ScriptPubkey: scriptBytes,
 			WatchOnly:    watchOnly,
+			Frozen:       frozenInt == 1,
 		})
 	}
 	return ret, nil
@@ -103,6 +111,21 @@ func (u *UtxoDB) SetWatchOnly(utxo wallet.Utxo) error {
 	return nil
 }
 
+func (u *UtxoDB) SetFrozen(utxo wallet.Utxo, frozen bool) error {
+	u.lock.Lock()
+	defer u.lock.Unlock()
+	outpoint := utxo.Op.Hash.String() + ":" + strconv.Itoa(int(utxo.Op.Index))
+	frozenInt := 0
+	if frozen {
+		frozenInt = 1
+	}
+	_, err := u.db.Exec("update utxos set frozen=? where outpoint=?", frozenInt, outpoint)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
 func (u *UtxoDB) Delete(utxo wallet.Utxo) error {
 	u.lock.Lock()
 	defer u.lock.Unlock()
@@ -116,6 +116,65 @@ func TestSetWatchOnlyUtxo(t *testing.T) {
 
 }
 
+func TestSetFrozenUtxo(t *testing.T) {
+	err := uxdb.Put(utxo)
+	if err != nil {
+		t.Error(err)
+	}
+	err = uxdb.SetFrozen(utxo, true)
+	if err != nil {
+		t.Error(err)
+	}
+	// putting the utxo again, as when it confirms, keeps it frozen
+	confirmed := utxo
+	confirmed.AtHeight++
+	err = uxdb.Put(confirmed)
+	if err != nil {
+		t.Error(err)
+	}
+	utxos, err := uxdb.GetAll()
+	if err != nil {
+		t.Error(err)
+	}
+	if len(utxos) != 1 || !utxos[0].Frozen || utxos[0].AtHeight != confirmed.AtHeight {
+		t.Error("Utxo freeze failed")
+	}
+	err = uxdb.SetFrozen(utxo, false)
+	if err != nil {
+		t.Error(err)
+	}
+	utxos, _ = uxdb.GetAll()
+	if len(utxos) != 1 || utxos[0].Frozen {
+		t.Error("Utxo unfreeze failed")
+	}
+}
+
+func TestAddColumn(t *testing.T) {
+	conn, _ := sql.Open("sqlite3", ":memory:")
+	// a utxos table from before utxos could be frozen
+	_, err := conn.Exec("create table utxos (outpoint text primary key not null, value integer, height integer, scriptPubKey text, watchOnly integer)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = initDatabaseTables(conn); err != nil {
+		t.Fatal(err)
+	}
+	old := UtxoDB{db: conn, lock: new(sync.RWMutex)}
+	if err = old.Put(utxo); err != nil {
+		t.Error(err)
+	}
+	if err = old.SetFrozen(utxo, true); err != nil {
+		t.Error(err)
+	}
+	if err = initDatabaseTables(conn); err != nil {
+		t.Error(err)
+	}
+	utxos, err := old.GetAll()
+	if err != nil || len(utxos) != 1 || !utxos[0].Frozen {
+		t.Errorf("Utxo db returned %+v %v", utxos, err)
+	}
+}
+
 func TestDeleteUtxo(t *testing.T) {
 	err := uxdb.Put(utxo)
 	if err != nil {
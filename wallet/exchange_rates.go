@@ -1,5 +1,21 @@
 package wallet
 
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/net/proxy"
+)
+
 type ExchangeRates interface {
 
 	/* Fetch the exchange rate for the given currency
@@ -17,3 +33,273 @@ type ExchangeRates interface {
 	   to the smaller currency unit. */
 	UnitsPerCoin() int64
 }
+
+// How long fetched rates are returned by GetExchangeRate before the sources
+// are asked again
+const rateCacheDuration = 10 * time.Minute
+
+// UnitsPerCoin returns the number of the smallest currency unit in one coin
+func UnitsPerCoin(coin CoinType) int64 {
+	switch coin {
+	case Ethereum, TestnetEthereum:
+		return 1_000_000_000_000_000_000 // wei
+	default:
+		return 100_000_000 // satoshi
+	}
+}
+
+// RateSource supplies the price of one coin keyed by upper case currency code,
+// e.g. {"USD": 43000.5, "EUR": 39500}
+type RateSource interface {
+	Rates() (map[string]float64, error)
+}
+
+// ErrNoRates is returned when no rate source returns rates
+var ErrNoRates = errors.New("no exchange rates available")
+
+// ExchangeRateProvider implements ExchangeRates over a fallback chain of rate
+// sources. The first source to return rates is used. It is safe for
+// concurrent use once configured.
+type ExchangeRateProvider struct {
+	Coin    CoinType
+	Sources []RateSource
+
+	// mtx guards the cache and fetching but is not held while the sources
+	// are asked
+	mtx         sync.Mutex
+	rates       map[string]float64
+	lastUpdated time.Time
+	fetching    *rateFetch
+}
+
+// rateFetch is a fetch from the sources shared by the callers that want
+// rates while it runs. done is closed once rates and err are set.
+type rateFetch struct {
+	done  chan struct{}
+	rates map[string]float64
+	err   error
+}
+
+func NewExchangeRateProvider(coin CoinType, sources []RateSource) *ExchangeRateProvider {
+	return &ExchangeRateProvider{Coin: coin, Sources: sources}
+}
+
+// GetExchangeRate returns the rate from the cache if it is fresh. Otherwise
+// the sources are asked and if they all fail a stale cached rate is returned.
+func (p *ExchangeRateProvider) GetExchangeRate(currencyCode string) (float64, error) {
+	rates, err := p.getRates(true)
+	if err != nil {
+		return 0, err
+	}
+	return lookupRate(rates, currencyCode)
+}
+
+// GetLatestRate asks the sources for the current rate
+func (p *ExchangeRateProvider) GetLatestRate(currencyCode string) (float64, error) {
+	rates, err := p.getRates(false)
+	if err != nil {
+		return 0, err
+	}
+	return lookupRate(rates, currencyCode)
+}
+
+// GetAllRates returns a copy of all rates, from a fresh cache if cacheOK
+func (p *ExchangeRateProvider) GetAllRates(cacheOK bool) (map[string]float64, error) {
+	rates, err := p.getRates(cacheOK)
+	if err != nil {
+		return nil, err
+	}
+	all := make(map[string]float64, len(rates))
+	for code, rate := range rates {
+		all[code] = rate
+	}
+	return all, nil
+}
+
+func (p *ExchangeRateProvider) UnitsPerCoin() int64 {
+	return UnitsPerCoin(p.Coin)
+}
+
+func lookupRate(rates map[string]float64, currencyCode string) (float64, error) {
+	rate, ok := rates[strings.ToUpper(currencyCode)]
+	if !ok {
+		return 0, fmt.Errorf("no exchange rate for %s", currencyCode)
+	}
+	return rate, nil
+}
+
+// getRates returns the cached rates if cacheOK and they are fresh, otherwise
+// fetches them. Callers that want rates while a fetch runs wait for it rather
+// than asking the sources again. A stale cache is only used when cacheOK and
+// the fetch fails.
+func (p *ExchangeRateProvider) getRates(cacheOK bool) (map[string]float64, error) {
+	p.mtx.Lock()
+	if cacheOK && p.rates != nil && time.Since(p.lastUpdated) <= rateCacheDuration {
+		rates := p.rates
+		p.mtx.Unlock()
+		return rates, nil
+	}
+	f := p.fetching
+	if f == nil {
+		f = &rateFetch{done: make(chan struct{})}
+		p.fetching = f
+		p.mtx.Unlock()
+
+		f.rates, f.err = p.fetchRates()
+
+		p.mtx.Lock()
+		if f.err == nil {
+			p.rates = f.rates
+			p.lastUpdated = time.Now()
+		}
+		p.fetching = nil
+		close(f.done)
+	}
+	p.mtx.Unlock()
+	<-f.done
+
+	if f.err != nil && cacheOK {
+		p.mtx.Lock()
+		defer p.mtx.Unlock()
+		if p.rates != nil {
+			return p.rates, nil
+		}
+	}
+	return f.rates, f.err
+}
+
+// fetchRates asks the sources in turn and returns the rates of the first
+// that has them
+func (p *ExchangeRateProvider) fetchRates() (map[string]float64, error) {
+	var errs []error
+	for _, source := range p.Sources {
+		rates, err := source.Rates()
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		return rates, nil
+	}
+	return nil, errors.Join(append([]error{ErrNoRates}, errs...)...)
+}
+
+// HTTPRateSource fetches rates from an HTTP JSON API. RatesPath are the keys
+// leading to the object of rates keyed by currency code, and RateField the
+// field holding the rate when each currency maps to an object. Rates may be
+// numbers or numeric strings. For example:
+//
+//	coingecko      {"bitcoin":{"usd":43000}}     RatesPath ["bitcoin"]
+//	blockchain.com {"USD":{"last":43000}}        RateField "last"
+type HTTPRateSource struct {
+	URL        string
+	RatesPath  []string
+	RateField  string
+	HttpClient HttpClient
+}
+
+// NewHTTPRateSource makes an HTTPRateSource for the URL, dialing through the
+// proxy if it is not nil
+func NewHTTPRateSource(url string, ratesPath []string, rateField string, proxy proxy.Dialer) *HTTPRateSource {
+	dial := net.Dial
+	if proxy != nil {
+		dial = proxy.Dial
+	}
+	return &HTTPRateSource{
+		URL:       url,
+		RatesPath: ratesPath,
+		RateField: rateField,
+		HttpClient: &http.Client{
+			Transport: &http.Transport{Dial: dial},
+			Timeout:   time.Second * 10,
+		},
+	}
+}
+
+func (s *HTTPRateSource) Rates() (map[string]float64, error) {
+	resp, err := s.HttpClient.Get(s.URL)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != 0 && resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("exchange rate api: %s", resp.Status)
+	}
+	var v any
+	dec := json.NewDecoder(resp.Body)
+	dec.UseNumber()
+	if err = dec.Decode(&v); err != nil {
+		return nil, err
+	}
+	for _, key := range s.RatesPath {
+		obj, ok := v.(map[string]any)
+		if !ok {
+			return nil, fmt.Errorf("exchange rate api: no %s object", key)
+		}
+		if v, ok = obj[key]; !ok {
+			return nil, fmt.Errorf("exchange rate api: no %s object", key)
+		}
+	}
+	return parseRates(v, s.RateField)
+}
+
+// FileRateSource reads rates from a JSON file of {"USD": 43000, ...} for
+// offline use. The file is read each time rates are fetched so that it can be
+// updated while the wallet runs.
+type FileRateSource struct {
+	Path string
+}
+
+func NewFileRateSource(path string) *FileRateSource {
+	return &FileRateSource{Path: path}
+}
+
+func (s *FileRateSource) Rates() (map[string]float64, error) {
+	b, err := os.ReadFile(s.Path)
+	if err != nil {
+		return nil, err
+	}
+	var v any
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.UseNumber()
+	if err = dec.Decode(&v); err != nil {
+		return nil, fmt.Errorf("%s: %w", s.Path, err)
+	}
+	return parseRates(v, "")
+}
+
+// parseRates takes the rates from an object keyed by currency code, skipping
+// any that are not positive numbers
+func parseRates(v any, field string) (map[string]float64, error) {
+	obj, ok := v.(map[string]any)
+	if !ok {
+		return nil, errors.New("exchange rates are not an object")
+	}
+	rates := make(map[string]float64, len(obj))
+	for code, value := range obj {
+		if field != "" {
+			fields, ok := value.(map[string]any)
+			if !ok {
+				continue
+			}
+			value = fields[field]
+		}
+		var rate float64
+		var err error
+		switch r := value.(type) {
+		case json.Number:
+			rate, err = r.Float64()
+		case string:
+			rate, err = strconv.ParseFloat(r, 64)
+		default:
+			continue
+		}
+		if err != nil || rate <= 0 {
+			continue
+		}
+		rates[strings.ToUpper(code)] = rate
+	}
+	if len(rates) == 0 {
+		return nil, errors.New("no exchange rates found")
+	}
+	return rates, nil
+}
@@ -0,0 +1,286 @@
+package wallet
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// rateServer serves a JSON body and counts the requests
+type rateServer struct {
+	*httptest.Server
+	body     atomic.Value
+	status   atomic.Int32
+	requests atomic.Int32
+}
+
+func newRateServer(body string) *rateServer {
+	rs := new(rateServer)
+	rs.body.Store(body)
+	rs.status.Store(http.StatusOK)
+	rs.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rs.requests.Add(1)
+		w.WriteHeader(int(rs.status.Load()))
+		fmt.Fprint(w, rs.body.Load().(string))
+	}))
+	return rs
+}
+
+func TestHTTPRateSource(t *testing.T) {
+	tests := []struct {
+		name      string
+		body      string
+		ratesPath []string
+		rateField string
+		want      map[string]float64
+		wantErr   bool
+	}{{
+		name:      "coingecko",
+		body:      `{"bitcoin":{"usd":43000.5,"eur":39500}}`,
+		ratesPath: []string{"bitcoin"},
+		want:      map[string]float64{"USD": 43000.5, "EUR": 39500},
+	}, {
+		name:      "blockchain.com",
+		body:      `{"USD":{"15m":43001,"last":43000,"symbol":"$"},"EUR":{"last":"39500.25"}}`,
+		rateField: "last",
+		want:      map[string]float64{"USD": 43000, "EUR": 39500.25},
+	}, {
+		name: "flat",
+		body: `{"USD":43000,"XYZ":0,"ABC":"n/a","DEF":null}`,
+		want: map[string]float64{"USD": 43000},
+	}, {
+		name:      "missing path",
+		body:      `{"ethereum":{"usd":2000}}`,
+		ratesPath: []string{"bitcoin"},
+		wantErr:   true,
+	}, {
+		name:    "no rates",
+		body:    `{"status":"ok"}`,
+		wantErr: true,
+	}, {
+		name:    "not json",
+		body:    `<html>`,
+		wantErr: true,
+	}}
+	for _, tt := range tests {
+		srv := newRateServer(tt.body)
+		source := NewHTTPRateSource(srv.URL, tt.ratesPath, tt.rateField, nil)
+		rates, err := source.Rates()
+		srv.Close()
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: error %v", tt.name, err)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		if len(rates) != len(tt.want) {
+			t.Errorf("%s: got %v", tt.name, rates)
+		}
+		for code, rate := range tt.want {
+			if rates[code] != rate {
+				t.Errorf("%s: %s rate %v, want %v", tt.name, code, rates[code], rate)
+			}
+		}
+	}
+
+	srv := newRateServer(`{"USD":1}`)
+	defer srv.Close()
+	srv.status.Store(http.StatusTooManyRequests)
+	if _, err := NewHTTPRateSource(srv.URL, nil, "", nil).Rates(); err == nil {
+		t.Error("rates from an error response")
+	}
+}
+
+// recordingDialer is a proxy.Dialer that records the addresses dialed
+type recordingDialer struct {
+	dialed []string
+}
+
+func (d *recordingDialer) Dial(network, addr string) (net.Conn, error) {
+	d.dialed = append(d.dialed, addr)
+	return net.Dial(network, addr)
+}
+
+func TestHTTPRateSourceProxy(t *testing.T) {
+	srv := newRateServer(`{"USD":43000}`)
+	defer srv.Close()
+	dialer := new(recordingDialer)
+	source := NewHTTPRateSource(srv.URL, nil, "", dialer)
+	if _, err := source.Rates(); err != nil {
+		t.Fatal(err)
+	}
+	host := strings.TrimPrefix(srv.URL, "http://")
+	if len(dialer.dialed) != 1 || dialer.dialed[0] != host {
+		t.Fatalf("dialed %v, want %s", dialer.dialed, host)
+	}
+}
+
+func TestFileRateSource(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "rates.json")
+	source := NewFileRateSource(path)
+	if _, err := source.Rates(); err == nil {
+		t.Fatal("rates from a missing file")
+	}
+	if err := os.WriteFile(path, []byte(`{"usd":43000,"EUR":39500.5}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	rates, err := source.Rates()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rates) != 2 || rates["USD"] != 43000 || rates["EUR"] != 39500.5 {
+		t.Fatalf("rates %v", rates)
+	}
+	if err := os.WriteFile(path, []byte(`[1, 2]`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := source.Rates(); err == nil {
+		t.Fatal("rates from a list")
+	}
+}
+
+func TestExchangeRateProvider(t *testing.T) {
+	primary := newRateServer(`{"bitcoin":{"usd":43000}}`)
+	defer primary.Close()
+	backup := newRateServer(`{"USD":{"last":42000},"EUR":{"last":39000}}`)
+	defer backup.Close()
+	p := NewExchangeRateProvider(Bitcoin, []RateSource{
+		NewHTTPRateSource(primary.URL, []string{"bitcoin"}, "", nil),
+		NewHTTPRateSource(backup.URL, nil, "last", nil),
+	})
+
+	rate, err := p.GetExchangeRate("usd")
+	if err != nil || rate != 43000 {
+		t.Fatalf("rate %v %v", rate, err)
+	}
+	// the primary has no EUR rate and its rates are cached
+	if _, err = p.GetExchangeRate("EUR"); err == nil {
+		t.Fatal("rate for a currency the source does not have")
+	}
+	if n := primary.requests.Load(); n != 1 {
+		t.Fatalf("%d requests for cached rates", n)
+	}
+
+	// GetLatestRate always fetches
+	primary.body.Store(`{"bitcoin":{"usd":44000}}`)
+	if rate, err = p.GetLatestRate("USD"); err != nil || rate != 44000 {
+		t.Fatalf("latest rate %v %v", rate, err)
+	}
+	if n := primary.requests.Load(); n != 2 {
+		t.Fatalf("%d requests after GetLatestRate", n)
+	}
+
+	// the backup is used when the primary fails
+	primary.status.Store(http.StatusInternalServerError)
+	all, err := p.GetAllRates(false)
+	if err != nil || len(all) != 2 || all["EUR"] != 39000 {
+		t.Fatalf("all rates %v %v", all, err)
+	}
+	all["EUR"] = 1
+	if rate, _ = p.GetExchangeRate("EUR"); rate != 39000 {
+		t.Fatal("GetAllRates returned the cache")
+	}
+
+	// stale rates are refreshed, and used when all sources fail
+	backup.status.Store(http.StatusInternalServerError)
+	p.lastUpdated = time.Now().Add(-2 * rateCacheDuration)
+	before := backup.requests.Load()
+	if rate, err = p.GetExchangeRate("EUR"); err != nil || rate != 39000 {
+		t.Fatalf("stale rate %v %v", rate, err)
+	}
+	if backup.requests.Load() != before+1 {
+		t.Fatal("stale rates were not refreshed")
+	}
+	if _, err = p.GetLatestRate("EUR"); !errors.Is(err, ErrNoRates) {
+		t.Fatalf("latest rate with failing sources: %v", err)
+	}
+
+	if _, err = NewExchangeRateProvider(Bitcoin, nil).GetExchangeRate("USD"); !errors.Is(err, ErrNoRates) {
+		t.Fatalf("rate without sources: %v", err)
+	}
+}
+
+// blockingSource returns its rates once release is closed and counts the
+// calls
+type blockingSource struct {
+	release chan struct{}
+	calls   atomic.Int32
+}
+
+func (s *blockingSource) Rates() (map[string]float64, error) {
+	s.calls.Add(1)
+	<-s.release
+	return map[string]float64{"USD": 45000}, nil
+}
+
+func TestExchangeRateProviderFetchUnlocked(t *testing.T) {
+	source := &blockingSource{release: make(chan struct{})}
+	p := NewExchangeRateProvider(Bitcoin, []RateSource{source})
+	p.rates = map[string]float64{"USD": 43000}
+	p.lastUpdated = time.Now()
+
+	// a caller that wants the latest rate while a fetch runs waits for it
+	results := make(chan float64, 2)
+	for i := 0; i < 2; i++ {
+		go func() {
+			rate, _ := p.GetLatestRate("USD")
+			results <- rate
+		}()
+	}
+	for source.calls.Load() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	// the cache is read while the fetch runs
+	done := make(chan struct{})
+	go func() {
+		if rate, err := p.GetExchangeRate("USD"); err != nil || rate != 43000 {
+			t.Errorf("cached rate during a fetch %v %v", rate, err)
+		}
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the cache was locked during a fetch")
+	}
+
+	close(source.release)
+	for i := 0; i < 2; i++ {
+		if rate := <-results; rate != 45000 {
+			t.Fatalf("latest rate %v", rate)
+		}
+	}
+	if n := source.calls.Load(); n > 2 {
+		t.Fatalf("%d fetches for two callers", n)
+	}
+	if rate, _ := p.GetExchangeRate("USD"); rate != 45000 {
+		t.Fatalf("cache not updated: %v", rate)
+	}
+}
+
+func TestUnitsPerCoin(t *testing.T) {
+	for _, tt := range []struct {
+		coin  CoinType
+		units int64
+	}{
+		{Bitcoin, 1e8},
+		{TestnetBitcoin, 1e8},
+		{Litecoin, 1e8},
+		{BitcoinCash, 1e8},
+		{Ethereum, 1e18},
+	} {
+		if units := NewExchangeRateProvider(tt.coin, nil).UnitsPerCoin(); units != tt.units {
+			t.Errorf("%d: %d units per coin", tt.coin, units)
+		}
+	}
+}
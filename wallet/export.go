@@ -0,0 +1,180 @@
+package wallet
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/btcsuite/btcd/btcutil"
+)
+
+// ExportFormat is the file format of a history export
+type ExportFormat string
+
+const (
+	ExportCSV  ExportFormat = "csv"
+	ExportJSON ExportFormat = "json"
+)
+
+// ParseExportFormat parses csv or json in any case
+func ParseExportFormat(s string) (ExportFormat, error) {
+	switch f := ExportFormat(strings.ToLower(s)); f {
+	case ExportCSV, ExportJSON:
+		return f, nil
+	}
+	return "", fmt.Errorf("invalid export format %q", s)
+}
+
+// ExportOptions selects the transactions of a history export. Zero values do
+// not filter. Unconfirmed transactions are left out by a height range.
+type ExportOptions struct {
+	Format ExportFormat
+
+	// Block time range, From inclusive and Until exclusive
+	From  time.Time
+	Until time.Time
+
+	// Block height range, inclusive
+	FromHeight int64
+	ToHeight   int64
+
+	// Adds the fiat value at block time from the historical prices when set
+	Currency string
+}
+
+// Match reports if a transaction with the height and block time is selected
+func (o *ExportOptions) Match(height int64, blockTime time.Time) bool {
+	if !o.From.IsZero() && blockTime.Before(o.From) {
+		return false
+	}
+	if !o.Until.IsZero() && !blockTime.Before(o.Until) {
+		return false
+	}
+	if o.FromHeight > 0 || o.ToHeight > 0 {
+		if height <= 0 || height < o.FromHeight {
+			return false
+		}
+		if o.ToHeight > 0 && height > o.ToHeight {
+			return false
+		}
+	}
+	return true
+}
+
+// HistoryRecord is a wallet transaction as exported
+type HistoryRecord struct {
+	Txid          string
+	Height        int64
+	BlockTime     time.Time
+	Confirmations int64
+	Status        StatusCode
+
+	// Net value to the wallet and the fee in satoshis. The fee is 0 when
+	// not known, which is when the wallet did not fund the transaction.
+	Value int64
+	Fee   int64
+
+	// Addresses of the other party: the inputs of a receive or the outputs
+	// not to the wallet of a send
+	Counterparties []string
+
+	// The user's label of the transaction, empty if there is none
+	Label string
+
+	// Set when exporting with a currency and there is a price
+	Currency  string
+	FiatValue *float64
+}
+
+// historyRow is a HistoryRecord formatted for export
+type historyRow struct {
+	Txid           string   `json:"txid"`
+	Height         int64    `json:"height"`
+	BlockTime      string   `json:"block_time"`
+	Confirmations  int64    `json:"confirmations"`
+	Status         string   `json:"status"`
+	Value          string   `json:"value"`
+	Fee            string   `json:"fee"`
+	Counterparties []string `json:"counterparties"`
+	Label          string   `json:"label"`
+	Currency       string   `json:"currency,omitempty"`
+	FiatValue      *string  `json:"fiat_value,omitempty"`
+}
+
+var historyCSVHeader = []string{"txid", "height", "block_time", "confirmations", "status",
+	"value", "fee", "counterparties", "label"}
+
+// formatCoins formats satoshis as a decimal coin amount with 8 places
+func formatCoins(sats int64) string {
+	return strconv.FormatFloat(btcutil.Amount(sats).ToBTC(), 'f', 8, 64)
+}
+
+func makeHistoryRow(r *HistoryRecord, currency string) historyRow {
+	row := historyRow{
+		Txid:           r.Txid,
+		Height:         r.Height,
+		BlockTime:      r.BlockTime.UTC().Format(time.RFC3339),
+		Confirmations:  r.Confirmations,
+		Status:         string(r.Status),
+		Value:          formatCoins(r.Value),
+		Fee:            formatCoins(r.Fee),
+		Counterparties: r.Counterparties,
+		Label:          r.Label,
+		Currency:       currency,
+	}
+	if row.Counterparties == nil {
+		row.Counterparties = []string{}
+	}
+	if r.FiatValue != nil {
+		v := strconv.FormatFloat(*r.FiatValue, 'f', 2, 64)
+		row.FiatValue = &v
+	}
+	return row
+}
+
+// WriteHistory writes the records as CSV with a header row, or as a JSON
+// array. Amounts are in coins with 8 decimal places and fiat values have 2.
+// The currency and fiat value columns are written when currency is set.
+func WriteHistory(w io.Writer, records []HistoryRecord, format ExportFormat, currency string) error {
+	currency = strings.ToUpper(currency)
+	rows := make([]historyRow, 0, len(records))
+	for i := range records {
+		rows = append(rows, makeHistoryRow(&records[i], currency))
+	}
+	switch format {
+	case ExportJSON:
+		b, err := json.MarshalIndent(rows, "", "  ")
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintln(w, string(b))
+		return err
+	case ExportCSV:
+		cw := csv.NewWriter(w)
+		header := historyCSVHeader
+		if currency != "" {
+			header = append(header[:len(header):len(header)], "currency", "fiat_value")
+		}
+		cw.Write(header)
+		for _, row := range rows {
+			record := []string{row.Txid, strconv.FormatInt(row.Height, 10), row.BlockTime,
+				strconv.FormatInt(row.Confirmations, 10), row.Status, row.Value, row.Fee,
+				strings.Join(row.Counterparties, " "), row.Label}
+			if currency != "" {
+				fiat := ""
+				if row.FiatValue != nil {
+					fiat = *row.FiatValue
+				}
+				record = append(record, currency, fiat)
+			}
+			cw.Write(record)
+		}
+		cw.Flush()
+		return cw.Error()
+	}
+	return fmt.Errorf("invalid export format %q", format)
+}
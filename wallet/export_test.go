@@ -0,0 +1,98 @@
+package wallet
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestExportOptionsMatch(t *testing.T) {
+	at := date("2023-06-15")
+	tests := []struct {
+		name   string
+		opts   ExportOptions
+		height int64
+		want   bool
+	}{
+		{"no filter", ExportOptions{}, 100, true},
+		{"no filter unconfirmed", ExportOptions{}, 0, true},
+		{"from", ExportOptions{From: at}, 100, true},
+		{"before from", ExportOptions{From: at.Add(time.Second)}, 100, false},
+		{"until", ExportOptions{Until: at.Add(time.Second)}, 100, true},
+		{"at until", ExportOptions{Until: at}, 100, false},
+		{"height range", ExportOptions{FromHeight: 100, ToHeight: 100}, 100, true},
+		{"below from height", ExportOptions{FromHeight: 101}, 100, false},
+		{"above to height", ExportOptions{ToHeight: 99}, 100, false},
+		{"unconfirmed in height range", ExportOptions{ToHeight: 99}, 0, false},
+	}
+	for _, tt := range tests {
+		if got := tt.opts.Match(tt.height, at); got != tt.want {
+			t.Errorf("%s: got %v", tt.name, got)
+		}
+	}
+}
+
+func TestWriteHistory(t *testing.T) {
+	fiat := 1234.5
+	records := []HistoryRecord{{
+		Txid:           "aa",
+		Height:         100,
+		BlockTime:      time.Date(2023, 6, 15, 12, 0, 0, 0, time.UTC),
+		Confirmations:  6,
+		Status:         StatusConfirmed,
+		Value:          150000,
+		Counterparties: []string{"addr1", "addr2"},
+		Label:          "salary, june",
+		Currency:       "USD",
+		FiatValue:      &fiat,
+	}, {
+		Txid:   "bb",
+		Status: StatusUnconfirmed,
+		Value:  -20000,
+		Fee:    250,
+	}}
+
+	var b bytes.Buffer
+	if err := WriteHistory(&b, records, ExportCSV, ""); err != nil {
+		t.Fatal(err)
+	}
+	want := "txid,height,block_time,confirmations,status,value,fee,counterparties,label\n" +
+		"aa,100,2023-06-15T12:00:00Z,6,CONFIRMED,0.00150000,0.00000000,addr1 addr2,\"salary, june\"\n" +
+		"bb,0,0001-01-01T00:00:00Z,0,UNCONFIRMED,-0.00020000,0.00000250,,\n"
+	if b.String() != want {
+		t.Errorf("csv:\n%s", b.String())
+	}
+
+	b.Reset()
+	if err := WriteHistory(&b, records, ExportCSV, "usd"); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(b.String(), "\n")
+	if !strings.HasSuffix(lines[0], ",counterparties,label,currency,fiat_value") ||
+		!strings.HasSuffix(lines[1], ",USD,1234.50") || !strings.HasSuffix(lines[2], ",USD,") {
+		t.Errorf("csv with fiat:\n%s", b.String())
+	}
+
+	b.Reset()
+	if err := WriteHistory(&b, records, ExportJSON, "USD"); err != nil {
+		t.Fatal(err)
+	}
+	var rows []map[string]any
+	if err := json.Unmarshal(b.Bytes(), &rows); err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 2 || rows[0]["value"] != "0.00150000" || rows[0]["fiat_value"] != "1234.50" ||
+		rows[0]["label"] != "salary, june" ||
+		rows[1]["fee"] != "0.00000250" || rows[1]["fiat_value"] != nil {
+		t.Errorf("json %v", rows)
+	}
+	if cps, ok := rows[1]["counterparties"].([]any); !ok || len(cps) != 0 {
+		t.Errorf("json counterparties %v", rows[1]["counterparties"])
+	}
+
+	if err := WriteHistory(&b, records, "xml", ""); err == nil {
+		t.Error("wrote xml")
+	}
+}
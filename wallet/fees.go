@@ -2,8 +2,12 @@ package wallet
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
 	"net"
 	"net/http"
+	"sort"
+	"sync"
 	"time"
 
 	"golang.org/x/net/proxy"
@@ -13,9 +17,25 @@ type HttpClient interface {
 	Get(string) (*http.Response, error)
 }
 
+// How long fetched fee estimates are used before asking the sources again
+const feeCacheDuration = time.Minute
+
+// How long the default fees are used after all sources failed before asking
+// them again
+const feeRetryDuration = 10 * time.Second
+
+// feeCache holds the estimates of the last fetch, nil if it failed, until
+// expires
 type feeCache struct {
-	fees        *Fees
-	lastUpdated time.Time
+	estimates FeeEstimates
+	expires   time.Time
+}
+
+// feeFetch is a fetch from the sources shared by the callers that want
+// estimates while it runs. done is closed once estimates is set.
+type feeFetch struct {
+	done      chan struct{}
+	estimates FeeEstimates
 }
 
 type Fees struct {
@@ -24,6 +44,54 @@ type Fees struct {
 	Economic uint64 `json:"economic"`
 }
 
+// Estimates returns the fees keyed by the confirmation target of their level
+func (f *Fees) Estimates() FeeEstimates {
+	return FeeEstimates{
+		PRIOIRTY.Target(): f.Priority,
+		NORMAL.Target():   f.Normal,
+		ECONOMIC.Target(): f.Economic,
+	}
+}
+
+// FeeEstimates maps a confirmation target in blocks to a fee-per-byte. A zero
+// rate means there is no estimate for that target.
+type FeeEstimates map[int]uint64
+
+// ForTarget returns the estimate for the largest target not above the given
+// target, which confirms at least as fast as wanted. If all targets are larger
+// the estimate of the smallest is returned. Zero estimates are skipped.
+func (e FeeEstimates) ForTarget(target int) uint64 {
+	targets := make([]int, 0, len(e))
+	for t, fee := range e {
+		if fee > 0 {
+			targets = append(targets, t)
+		}
+	}
+	if len(targets) == 0 {
+		return 0
+	}
+	sort.Ints(targets)
+	best := targets[0]
+	for _, t := range targets {
+		if t > target {
+			break
+		}
+		best = t
+	}
+	return e[best]
+}
+
+// FeeSource supplies fee-per-byte estimates for confirmation targets
+type FeeSource interface {
+	Fees() (FeeEstimates, error)
+}
+
+// ErrNoFeeSource is returned by a FeeSource that cannot currently provide
+// fees, e.g. when it has no server connection.
+var ErrNoFeeSource = errors.New("fee source unavailable")
+
+// FeeProvider returns fee-per-byte rates for fee levels and confirmation
+// targets. It is safe for concurrent use once configured.
 type FeeProvider struct {
 	MaxFee      uint64
 	PriorityFee uint64
@@ -31,9 +99,17 @@ type FeeProvider struct {
 	EconomicFee uint64
 	FeeAPI      string
 
+	// Fee sources tried in order until one returns fees. The FeeAPI, if set,
+	// is tried after them. The default fees are used if all fail.
+	Sources []FeeSource
+
 	HttpClient HttpClient
 
-	cache *feeCache
+	// mtx guards the cache and fetching but is not held while the sources
+	// are asked
+	mtx      sync.Mutex
+	cache    *feeCache
+	fetching *feeFetch
 }
 
 func NewFeeProvider(maxFee, priorityFee, normalFee, economicFee uint64, feeAPI string, proxy proxy.Dialer) *FeeProvider {
@@ -55,42 +131,101 @@ func NewFeeProvider(maxFee, priorityFee, normalFee, economicFee uint64, feeAPI s
 	return &fp
 }
 
+// GetFeePerByte returns the fee-per-byte estimate for the confirmation target
+// of the fee level, clamped to MaxFee
 func (fp *FeeProvider) GetFeePerByte(feeLevel FeeLevel) uint64 {
-	if fp.FeeAPI == "" {
-		return fp.defaultFee(feeLevel)
+	return fp.selectFee(fp.estimates().ForTarget(feeLevel.Target()), feeLevel)
+}
+
+// GetFeePerByteForTarget returns the fee-per-byte estimate to confirm within
+// the given number of blocks, clamped to MaxFee
+func (fp *FeeProvider) GetFeePerByteForTarget(blocks int) uint64 {
+	return fp.selectFee(fp.estimates().ForTarget(blocks), levelForTarget(blocks))
+}
+
+// CustomFeePerByte checks an explicit fee-per-byte chosen by the user. It must
+// be at least 1 and no more than MaxFee.
+func (fp *FeeProvider) CustomFeePerByte(satPerByte uint64) (uint64, error) {
+	if satPerByte == 0 {
+		return 0, errors.New("fee per byte must be at least 1")
 	}
-	fees := new(Fees)
-	if time.Since(fp.cache.lastUpdated) > time.Minute {
-		resp, err := fp.HttpClient.Get(fp.FeeAPI)
-		if err != nil {
-			return fp.defaultFee(feeLevel)
+	if satPerByte > fp.MaxFee {
+		return 0, fmt.Errorf("fee per byte %d is above the maximum %d", satPerByte, fp.MaxFee)
+	}
+	return satPerByte, nil
+}
+
+// estimates returns the cached estimates, asking the sources again if they
+// have expired. While a fetch runs other callers get the expired estimates,
+// or wait for the fetch if there are none, rather than asking the sources
+// again. It returns nil if there are no sources or all fail.
+func (fp *FeeProvider) estimates() FeeEstimates {
+	sources := fp.sources()
+	if len(sources) == 0 {
+		return nil
+	}
+	fp.mtx.Lock()
+	if fp.cache == nil {
+		fp.cache = new(feeCache)
+	}
+	cached := fp.cache.estimates
+	if time.Now().Before(fp.cache.expires) {
+		fp.mtx.Unlock()
+		return cached
+	}
+	f := fp.fetching
+	if f != nil {
+		fp.mtx.Unlock()
+		if cached != nil {
+			return cached
 		}
+		<-f.done
+		return f.estimates
+	}
+	f = &feeFetch{done: make(chan struct{})}
+	fp.fetching = f
+	fp.mtx.Unlock()
 
-		defer resp.Body.Close()
+	f.estimates = fetchFees(sources)
 
-		err = json.NewDecoder(resp.Body).Decode(&fees)
+	fp.mtx.Lock()
+	defer fp.mtx.Unlock()
+	fp.cache.estimates = f.estimates
+	if f.estimates != nil {
+		fp.cache.expires = time.Now().Add(feeCacheDuration)
+	} else {
+		fp.cache.expires = time.Now().Add(feeRetryDuration)
+	}
+	fp.fetching = nil
+	close(f.done)
+	return f.estimates
+}
+
+// fetchFees asks the sources in turn and returns the estimates of the first
+// that has them
+func fetchFees(sources []FeeSource) FeeEstimates {
+	for _, source := range sources {
+		estimates, err := source.Fees()
 		if err != nil {
-			return fp.defaultFee(feeLevel)
+			continue
 		}
-		fp.cache.lastUpdated = time.Now()
-		fp.cache.fees = fees
-	} else {
-		fees = fp.cache.fees
+		return estimates
 	}
-	switch feeLevel {
-	case PRIOIRTY:
-		return fp.selectFee(fees.Priority, PRIOIRTY)
-	case NORMAL:
-		return fp.selectFee(fees.Normal, PRIOIRTY)
-	case ECONOMIC:
-		return fp.selectFee(fees.Economic, PRIOIRTY)
-	case FEE_BUMP:
-		return fp.selectFee(fees.Priority, PRIOIRTY)
-	default:
-		return fp.NormalFee
+	return nil
+}
+
+// sources returns the fallback chain of fee sources
+func (fp *FeeProvider) sources() []FeeSource {
+	sources := fp.Sources
+	if fp.FeeAPI != "" {
+		api := &APIFeeSource{URL: fp.FeeAPI, HttpClient: fp.HttpClient}
+		sources = append(sources[:len(sources):len(sources)], api)
 	}
+	return sources
 }
 
+// selectFee clamps an estimate to MaxFee, using the configured default of the
+// fee level if there is no estimate
 func (fp *FeeProvider) selectFee(fee uint64, feeLevel FeeLevel) uint64 {
 	if fee > fp.MaxFee {
 		return fp.MaxFee
@@ -103,15 +238,90 @@ func (fp *FeeProvider) selectFee(fee uint64, feeLevel FeeLevel) uint64 {
 
 func (fp *FeeProvider) defaultFee(feeLevel FeeLevel) uint64 {
 	switch feeLevel {
-	case PRIOIRTY:
+	case PRIOIRTY, FEE_BUMP:
 		return fp.PriorityFee
 	case NORMAL:
 		return fp.NormalFee
-	case ECONOMIC:
+	case ECONOMIC, SUPER_ECONOMIC:
 		return fp.EconomicFee
-	case FEE_BUMP:
-		return fp.PriorityFee
 	default:
 		return fp.NormalFee
 	}
 }
+
+// Target returns the number of blocks a transaction paying the fee level aims
+// to confirm within
+func (l FeeLevel) Target() int {
+	switch l {
+	case PRIOIRTY, FEE_BUMP:
+		return 2
+	case NORMAL:
+		return 6
+	case ECONOMIC:
+		return 12
+	case SUPER_ECONOMIC:
+		return 25
+	default:
+		return 6
+	}
+}
+
+// levelForTarget returns the fee level whose default fee applies to a target
+func levelForTarget(blocks int) FeeLevel {
+	switch {
+	case blocks <= PRIOIRTY.Target():
+		return PRIOIRTY
+	case blocks <= NORMAL.Target():
+		return NORMAL
+	default:
+		return ECONOMIC
+	}
+}
+
+// FeeTargets are the confirmation targets of all fee levels, fastest first
+var FeeTargets = []int{
+	PRIOIRTY.Target(),
+	NORMAL.Target(),
+	ECONOMIC.Target(),
+	SUPER_ECONOMIC.Target(),
+}
+
+// APIFeeSource fetches fees from an HTTP API returning the Fees JSON object,
+// e.g. {"priority":45,"normal":20,"economic":10}
+type APIFeeSource struct {
+	URL        string
+	HttpClient HttpClient
+}
+
+// NewAPIFeeSource makes an APIFeeSource for the URL, dialing through the
+// proxy if it is not nil
+func NewAPIFeeSource(url string, proxy proxy.Dialer) *APIFeeSource {
+	dial := net.Dial
+	if proxy != nil {
+		dial = proxy.Dial
+	}
+	return &APIFeeSource{
+		URL: url,
+		HttpClient: &http.Client{
+			Transport: &http.Transport{Dial: dial},
+			Timeout:   time.Second * 10,
+		},
+	}
+}
+
+func (s *APIFeeSource) Fees() (FeeEstimates, error) {
+	resp, err := s.HttpClient.Get(s.URL)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != 0 && resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("fee api: %s", resp.Status)
+	}
+	fees := new(Fees)
+	err = json.NewDecoder(resp.Body).Decode(fees)
+	if err != nil {
+		return nil, err
+	}
+	return fees.Estimates(), nil
+}
@@ -0,0 +1,309 @@
+package wallet
+
+import (
+	"bytes"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+)
+
+type ClosingBuffer struct {
+	*bytes.Buffer
+}
+
+func (cb *ClosingBuffer) Close() (err error) {
+	return
+}
+
+type mockHttpClient struct{}
+
+func (m *mockHttpClient) Get(url string) (*http.Response, error) {
+	data := `{"priority":450,"normal":420,"economic":390}`
+	cb := &ClosingBuffer{bytes.NewBufferString(data)}
+	resp := &http.Response{
+		Body: cb,
+	}
+	return resp, nil
+}
+
+func TestFeeProvider_GetFeePerByte(t *testing.T) {
+	fp := NewFeeProvider(2000, 360, 320, 280, "https://btc.fees.openbazaar.org", nil)
+	fp.HttpClient = new(mockHttpClient)
+
+	// Test fetch from API
+	if fp.GetFeePerByte(PRIOIRTY) != 450 {
+		t.Error("Returned incorrect fee per byte")
+	}
+	if fp.GetFeePerByte(NORMAL) != 420 {
+		t.Error("Returned incorrect fee per byte")
+	}
+	if fp.GetFeePerByte(ECONOMIC) != 390 {
+		t.Error("Returned incorrect fee per byte")
+	}
+	if fp.GetFeePerByte(FEE_BUMP) != 450 {
+		t.Error("Returned incorrect fee per byte")
+	}
+
+	// Test return over max
+	fp.MaxFee = 100
+	if fp.GetFeePerByte(PRIOIRTY) != 100 {
+		t.Error("Returned incorrect fee per byte")
+	}
+	if fp.GetFeePerByte(NORMAL) != 100 {
+		t.Error("Returned incorrect fee per byte")
+	}
+	if fp.GetFeePerByte(ECONOMIC) != 100 {
+		t.Error("Returned incorrect fee per byte")
+	}
+	if fp.GetFeePerByte(FEE_BUMP) != 100 {
+		t.Error("Returned incorrect fee per byte")
+	}
+
+	// Test no API provided
+	fp.FeeAPI = ""
+	if fp.GetFeePerByte(PRIOIRTY) != 360 {
+		t.Error("Returned incorrect fee per byte")
+	}
+	if fp.GetFeePerByte(NORMAL) != 320 {
+		t.Error("Returned incorrect fee per byte")
+	}
+	if fp.GetFeePerByte(ECONOMIC) != 280 {
+		t.Error("Returned incorrect fee per byte")
+	}
+	if fp.GetFeePerByte(FEE_BUMP) != 360 {
+		t.Error("Returned incorrect fee per byte")
+	}
+}
+
+type stubFeeSource struct {
+	fees  FeeEstimates
+	calls int
+}
+
+func (s *stubFeeSource) Fees() (FeeEstimates, error) {
+	s.calls++
+	if s.fees == nil {
+		return nil, ErrNoFeeSource
+	}
+	return s.fees, nil
+}
+
+func TestFeeProvider_Sources(t *testing.T) {
+	failing := &stubFeeSource{}
+	server := &stubFeeSource{fees: FeeEstimates{2: 60, 6: 30, 12: 0}}
+	fp := NewFeeProvider(50, 360, 320, 280, "https://btc.fees.openbazaar.org", nil)
+	fp.HttpClient = new(mockHttpClient)
+	fp.Sources = []FeeSource{failing, server}
+
+	// The first source that returns fees is used and its fees are cached
+	if fee := fp.GetFeePerByte(NORMAL); fee != 30 {
+		t.Errorf("normal fee %d", fee)
+	}
+	if fee := fp.GetFeePerByte(PRIOIRTY); fee != 50 {
+		t.Errorf("priority fee %d", fee)
+	}
+	if failing.calls != 1 || server.calls != 1 {
+		t.Errorf("fees not cached: %d %d calls", failing.calls, server.calls)
+	}
+
+	// The fee API is tried after the sources
+	fp = NewFeeProvider(2000, 360, 320, 280, "https://btc.fees.openbazaar.org", nil)
+	fp.HttpClient = new(mockHttpClient)
+	fp.Sources = []FeeSource{&stubFeeSource{}}
+	if fee := fp.GetFeePerByte(ECONOMIC); fee != 390 {
+		t.Errorf("economic fee %d", fee)
+	}
+
+	// All sources failing gives the defaults
+	fp = NewFeeProvider(2000, 360, 320, 280, "", nil)
+	fp.Sources = []FeeSource{&stubFeeSource{}}
+	if fee := fp.GetFeePerByte(NORMAL); fee != 320 {
+		t.Errorf("normal fee %d", fee)
+	}
+}
+
+func TestFeeProvider_Levels(t *testing.T) {
+	full := FeeEstimates{2: 90, 6: 40, 12: 20, 25: 8}
+	tests := []struct {
+		name      string
+		estimates FeeEstimates
+		maxFee    uint64
+		level     FeeLevel
+		want      uint64
+	}{
+		{"priority", full, 2000, PRIOIRTY, 90},
+		{"normal", full, 2000, NORMAL, 40},
+		{"economic", full, 2000, ECONOMIC, 20},
+		{"fee bump", full, 2000, FEE_BUMP, 90},
+		{"super economic", full, 2000, SUPER_ECONOMIC, 8},
+		{"priority clamped", full, 50, PRIOIRTY, 50},
+		{"normal clamped", full, 30, NORMAL, 30},
+		{"economic clamped", full, 10, ECONOMIC, 10},
+		{"fee bump clamped", full, 50, FEE_BUMP, 50},
+		{"super economic clamped", full, 5, SUPER_ECONOMIC, 5},
+		// a missing target uses the next faster estimate
+		{"super economic from economic", FeeEstimates{2: 90, 6: 40, 12: 20}, 2000, SUPER_ECONOMIC, 20},
+		{"normal from priority", FeeEstimates{2: 90, 12: 20}, 2000, NORMAL, 90},
+		// a zero estimate is skipped
+		{"economic zero", FeeEstimates{2: 90, 6: 40, 12: 0}, 2000, ECONOMIC, 40},
+		// no faster estimate uses the fastest there is
+		{"priority from normal", FeeEstimates{6: 40}, 2000, PRIOIRTY, 40},
+		// no estimates at all uses the default of the level
+		{"priority default", FeeEstimates{}, 2000, PRIOIRTY, 360},
+		{"normal default", FeeEstimates{}, 2000, NORMAL, 320},
+		{"economic default", FeeEstimates{}, 2000, ECONOMIC, 280},
+		{"fee bump default", FeeEstimates{}, 2000, FEE_BUMP, 360},
+		{"super economic default", FeeEstimates{}, 2000, SUPER_ECONOMIC, 280},
+	}
+	for _, tt := range tests {
+		fp := NewFeeProvider(tt.maxFee, 360, 320, 280, "", nil)
+		fp.Sources = []FeeSource{&stubFeeSource{fees: tt.estimates}}
+		if got := fp.GetFeePerByte(tt.level); got != tt.want {
+			t.Errorf("%s: got %d, want %d", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestFeeProvider_Target(t *testing.T) {
+	fp := NewFeeProvider(2000, 360, 320, 280, "", nil)
+	fp.Sources = []FeeSource{&stubFeeSource{fees: FeeEstimates{2: 90, 6: 40, 12: 20, 25: 8}}}
+	tests := []struct {
+		blocks int
+		want   uint64
+	}{{1, 90}, {2, 90}, {3, 90}, {6, 40}, {11, 40}, {12, 20}, {25, 8}, {144, 8}}
+	for _, tt := range tests {
+		if got := fp.GetFeePerByteForTarget(tt.blocks); got != tt.want {
+			t.Errorf("target %d: got %d, want %d", tt.blocks, got, tt.want)
+		}
+	}
+
+	// without estimates the default of the nearest level is used
+	fp.Sources = nil
+	for _, tt := range []struct {
+		blocks int
+		want   uint64
+	}{{1, 360}, {6, 320}, {100, 280}} {
+		if got := fp.GetFeePerByteForTarget(tt.blocks); got != tt.want {
+			t.Errorf("default target %d: got %d, want %d", tt.blocks, got, tt.want)
+		}
+	}
+}
+
+func TestFeeProvider_Custom(t *testing.T) {
+	fp := NewFeeProvider(200, 360, 320, 280, "", nil)
+	tests := []struct {
+		fee     uint64
+		wantErr bool
+	}{{0, true}, {1, false}, {55, false}, {200, false}, {201, true}}
+	for _, tt := range tests {
+		fee, err := fp.CustomFeePerByte(tt.fee)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("custom fee %d: error %v", tt.fee, err)
+			continue
+		}
+		if err == nil && fee != tt.fee {
+			t.Errorf("custom fee %d: got %d", tt.fee, fee)
+		}
+	}
+}
+
+// concurrentFeeSource counts calls from concurrent fee requests
+type concurrentFeeSource struct {
+	mtx   sync.Mutex
+	calls int
+}
+
+func (s *concurrentFeeSource) Fees() (FeeEstimates, error) {
+	s.mtx.Lock()
+	s.calls++
+	s.mtx.Unlock()
+	return FeeEstimates{2: 90, 6: 40, 12: 20, 25: 8}, nil
+}
+
+func TestFeeProvider_Concurrent(t *testing.T) {
+	source := new(concurrentFeeSource)
+	fp := NewFeeProvider(2000, 360, 320, 280, "", nil)
+	fp.Sources = []FeeSource{source}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func(level FeeLevel) {
+			defer wg.Done()
+			fp.GetFeePerByte(level)
+			fp.GetFeePerByteForTarget(int(level) * 5)
+		}(FeeLevel(i % 5))
+	}
+	wg.Wait()
+	if source.calls != 1 {
+		t.Fatalf("fee source called %d times", source.calls)
+	}
+}
+
+func TestFeeProvider_SourcesFail(t *testing.T) {
+	failing := &stubFeeSource{}
+	fp := NewFeeProvider(2000, 360, 320, 280, "", nil)
+	fp.Sources = []FeeSource{failing}
+
+	// The defaults are used for a while before the sources are asked again
+	for i := 0; i < 3; i++ {
+		if fee := fp.GetFeePerByte(NORMAL); fee != 320 {
+			t.Errorf("normal fee %d", fee)
+		}
+	}
+	if failing.calls != 1 {
+		t.Fatalf("failing source called %d times", failing.calls)
+	}
+	fp.cache.expires = time.Now()
+	failing.fees = FeeEstimates{6: 30}
+	if fee := fp.GetFeePerByte(NORMAL); fee != 30 || failing.calls != 2 {
+		t.Fatalf("normal fee %d after %d calls", fee, failing.calls)
+	}
+}
+
+// blockingFeeSource returns fees once release is closed
+type blockingFeeSource struct {
+	asked   chan struct{}
+	release chan struct{}
+}
+
+func (s *blockingFeeSource) Fees() (FeeEstimates, error) {
+	close(s.asked)
+	<-s.release
+	return FeeEstimates{6: 40}, nil
+}
+
+func TestFeeProvider_SlowSource(t *testing.T) {
+	source := &blockingFeeSource{asked: make(chan struct{}), release: make(chan struct{})}
+	fp := NewFeeProvider(2000, 360, 320, 280, "", nil)
+	fp.Sources = []FeeSource{source}
+	fp.cache = &feeCache{estimates: FeeEstimates{6: 30}}
+
+	fetched := make(chan uint64)
+	go func() {
+		fetched <- fp.GetFeePerByte(NORMAL)
+	}()
+	<-source.asked
+
+	// Other callers get the expired estimates while the fetch runs
+	got := make(chan uint64)
+	go func() {
+		got <- fp.GetFeePerByte(NORMAL)
+	}()
+	select {
+	case fee := <-got:
+		if fee != 30 {
+			t.Errorf("normal fee %d during the fetch", fee)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("waited for the fee source")
+	}
+	close(source.release)
+	if fee := <-fetched; fee != 40 {
+		t.Errorf("normal fee %d after the fetch", fee)
+	}
+	if fee := fp.GetFeePerByte(NORMAL); fee != 40 {
+		t.Errorf("normal fee %d cached", fee)
+	}
+}
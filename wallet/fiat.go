@@ -0,0 +1,334 @@
+package wallet
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Fiat valuation of the wallet history for tax reporting. Transactions are
+// valued with the historical Prices at the time of their block. Coins
+// received are lots with a cost basis and coins sent are disposals matched
+// against the lots FIFO or LIFO to give the realised gain.
+
+// FiatTxn is a wallet transaction valued in a fiat currency at its block time
+type FiatTxn struct {
+	Txn
+
+	// The block header timestamp, or the Txn Timestamp when the transaction
+	// is unconfirmed or the header is not known
+	BlockTime time.Time
+
+	Currency string
+
+	// The price of one coin on the last day with a price at or before the
+	// block time. Zero when there is no price.
+	Price     float64
+	PriceDate time.Time
+
+	// Value and Fee in the currency
+	FiatValue float64
+	FiatFee   float64
+}
+
+// Priced is true if a price was found for the transaction
+func (t *FiatTxn) Priced() bool {
+	return t.Price > 0
+}
+
+// ToFiat converts an amount in the smallest unit of the coin to the currency
+func ToFiat(amount int64, price float64, unitsPerCoin int64) float64 {
+	return float64(amount) * price / float64(unitsPerCoin)
+}
+
+// ValueTransactions values the transactions at their block time, ordered by
+// block time. A transaction without a price is returned unpriced, as are all
+// of them when currency is empty.
+func ValueTransactions(txns []Txn, prices Prices, blockTimes BlockTimes, currency string, unitsPerCoin int64) ([]FiatTxn, error) {
+	currency = strings.ToUpper(currency)
+	valued := make([]FiatTxn, 0, len(txns))
+	for _, txn := range txns {
+		ft := FiatTxn{Txn: txn, BlockTime: txn.Timestamp, Currency: currency}
+		if txn.Height > 0 && blockTimes != nil {
+			if t, ok := blockTimes.BlockTime(int32(txn.Height)); ok {
+				ft.BlockTime = t
+			}
+		}
+		if currency == "" {
+			valued = append(valued, ft)
+			continue
+		}
+		price, err := prices.Get(ft.BlockTime, currency)
+		if err != nil && !errors.Is(err, ErrNoPrice) {
+			return nil, err
+		}
+		if err == nil {
+			ft.Price = price.Price
+			ft.PriceDate = price.Date
+			ft.FiatValue = ToFiat(txn.Value, price.Price, unitsPerCoin)
+			ft.FiatFee = ToFiat(txn.Fee, price.Price, unitsPerCoin)
+		}
+		valued = append(valued, ft)
+	}
+	sort.SliceStable(valued, func(i, j int) bool {
+		return valued[i].BlockTime.Before(valued[j].BlockTime)
+	})
+	return valued, nil
+}
+
+// LotMethod is the order lots are matched against disposals
+type LotMethod string
+
+const (
+	// First in, first out: the oldest coins are disposed of first
+	FIFO LotMethod = "FIFO"
+	// Last in, first out: the newest coins are disposed of first
+	LIFO LotMethod = "LIFO"
+)
+
+// ParseLotMethod parses fifo or lifo in any case
+func ParseLotMethod(s string) (LotMethod, error) {
+	switch m := LotMethod(strings.ToUpper(s)); m {
+	case FIFO, LIFO:
+		return m, nil
+	}
+	return "", fmt.Errorf("invalid lot method %q", s)
+}
+
+// Lot is coins acquired in a wallet output and what they cost in the currency
+type Lot struct {
+	Txid      string
+	Index     uint32
+	Height    int64
+	Acquired  time.Time
+	Amount    int64
+	CostBasis float64
+}
+
+// Disposal is the coins leaving the wallet in a transaction, fee included,
+// and the parts of the lots they came from
+type Disposal struct {
+	Txid      string
+	Height    int64
+	Disposed  time.Time
+	Amount    int64
+	Proceeds  float64
+	CostBasis float64
+	Gain      float64
+	Lots      []Lot
+}
+
+// Period is the length of the periods totals are given for
+type Period string
+
+const (
+	PeriodDay     Period = "day"
+	PeriodMonth   Period = "month"
+	PeriodQuarter Period = "quarter"
+	PeriodYear    Period = "year"
+)
+
+// ParsePeriod parses day, month, quarter or year in any case
+func ParsePeriod(s string) (Period, error) {
+	switch p := Period(strings.ToLower(s)); p {
+	case PeriodDay, PeriodMonth, PeriodQuarter, PeriodYear:
+		return p, nil
+	}
+	return "", fmt.Errorf("invalid period %q", s)
+}
+
+// Bounds returns the UTC start of the period holding t and the start of the
+// next period
+func (p Period) Bounds(t time.Time) (start, end time.Time) {
+	t = t.UTC()
+	y, m, d := t.Date()
+	switch p {
+	case PeriodDay:
+		start = time.Date(y, m, d, 0, 0, 0, 0, time.UTC)
+		return start, start.AddDate(0, 0, 1)
+	case PeriodMonth:
+		start = time.Date(y, m, 1, 0, 0, 0, 0, time.UTC)
+		return start, start.AddDate(0, 1, 0)
+	case PeriodQuarter:
+		start = time.Date(y, m-(m-1)%3, 1, 0, 0, 0, 0, time.UTC)
+		return start, start.AddDate(0, 3, 0)
+	default:
+		start = time.Date(y, 1, 1, 0, 0, 0, 0, time.UTC)
+		return start, start.AddDate(1, 0, 0)
+	}
+}
+
+// PeriodTotal sums the confirmed transactions and disposals in a period.
+// Sent is the coins leaving the wallet, fees included.
+type PeriodTotal struct {
+	Start         time.Time
+	End           time.Time
+	Transactions  int
+	Received      int64
+	Sent          int64
+	ReceivedValue float64
+	SentValue     float64
+	Proceeds      float64
+	CostBasis     float64
+	Gain          float64
+}
+
+// GainsReport is the realised gains of the wallet in a currency
+type GainsReport struct {
+	Currency  string
+	Method    LotMethod
+	Period    Period
+	Disposals []Disposal
+	// Lots, or the parts of them, not yet disposed of
+	Holdings []Lot
+	Totals   []PeriodTotal
+	Gain     float64
+}
+
+// CalculateGains matches the coins sent by confirmed transactions against
+// the lots received before them. Each wallet output of a transaction that
+// increased the balance is a lot. When the transaction also spent wallet
+// coins only the outputs making up the increase are lots, in output order,
+// as the rest is change. Every confirmed transaction must be priced.
+func CalculateGains(txns []FiatTxn, outputs []Utxo, method LotMethod, period Period, unitsPerCoin int64) (*GainsReport, error) {
+	byTxid := make(map[string][]Utxo)
+	for _, u := range outputs {
+		txid := u.Op.Hash.String()
+		byTxid[txid] = append(byTxid[txid], u)
+	}
+	var confirmed []FiatTxn
+	var lots []Lot
+	for _, txn := range txns {
+		if txn.Height <= 0 || txn.Value == 0 {
+			continue
+		}
+		if !txn.Priced() {
+			return nil, fmt.Errorf("%w in %s on %s for %s", ErrNoPrice, txn.Currency,
+				txn.BlockTime.UTC().Format(PriceDateLayout), txn.Txid)
+		}
+		confirmed = append(confirmed, txn)
+		if txn.Value < 0 {
+			continue
+		}
+		outs := byTxid[txn.Txid]
+		sort.Slice(outs, func(i, j int) bool { return outs[i].Op.Index < outs[j].Op.Index })
+		remaining := txn.Value
+		for _, out := range outs {
+			if remaining == 0 {
+				break
+			}
+			amount := min(out.Value, remaining)
+			remaining -= amount
+			lots = append(lots, Lot{
+				Txid:      txn.Txid,
+				Index:     out.Op.Index,
+				Height:    txn.Height,
+				Acquired:  txn.BlockTime,
+				Amount:    amount,
+				CostBasis: ToFiat(amount, txn.Price, unitsPerCoin),
+			})
+		}
+	}
+	sort.SliceStable(confirmed, func(i, j int) bool {
+		return confirmed[i].Height < confirmed[j].Height
+	})
+	sort.SliceStable(lots, func(i, j int) bool {
+		return lots[i].Height < lots[j].Height
+	})
+
+	report := &GainsReport{
+		Method: method,
+		Period: period,
+	}
+	if len(txns) > 0 {
+		report.Currency = txns[0].Currency
+	}
+	// the lots acquired so far, oldest first
+	var pool []Lot
+	next := 0
+	for _, txn := range confirmed {
+		if txn.Value > 0 {
+			continue
+		}
+		// lots in the same block as the disposal may be spent by it
+		for ; next < len(lots) && lots[next].Height <= txn.Height; next++ {
+			pool = append(pool, lots[next])
+		}
+		d := Disposal{
+			Txid:     txn.Txid,
+			Height:   txn.Height,
+			Disposed: txn.BlockTime,
+			Amount:   -txn.Value,
+			Proceeds: -txn.FiatValue,
+		}
+		remaining := d.Amount
+		for remaining > 0 && len(pool) > 0 {
+			i := 0
+			if method == LIFO {
+				i = len(pool) - 1
+			}
+			lot := pool[i]
+			used := lot
+			if lot.Amount > remaining {
+				used.Amount = remaining
+				used.CostBasis = lot.CostBasis * float64(remaining) / float64(lot.Amount)
+				pool[i].Amount -= used.Amount
+				pool[i].CostBasis -= used.CostBasis
+			} else {
+				pool = append(pool[:i], pool[i+1:]...)
+			}
+			remaining -= used.Amount
+			d.CostBasis += used.CostBasis
+			d.Lots = append(d.Lots, used)
+		}
+		if remaining > 0 {
+			return nil, fmt.Errorf("%s sends %d more than the wallet received before it", txn.Txid, remaining)
+		}
+		d.Gain = d.Proceeds - d.CostBasis
+		report.Gain += d.Gain
+		report.Disposals = append(report.Disposals, d)
+	}
+	report.Holdings = append(pool, lots[next:]...)
+	report.Totals = periodTotals(confirmed, report.Disposals, period)
+	return report, nil
+}
+
+// periodTotals sums the transactions and disposals by period, giving only
+// the periods with transactions in time order
+func periodTotals(txns []FiatTxn, disposals []Disposal, period Period) []PeriodTotal {
+	totals := make(map[time.Time]*PeriodTotal)
+	get := func(t time.Time) *PeriodTotal {
+		start, end := period.Bounds(t)
+		pt, ok := totals[start]
+		if !ok {
+			pt = &PeriodTotal{Start: start, End: end}
+			totals[start] = pt
+		}
+		return pt
+	}
+	for _, txn := range txns {
+		pt := get(txn.BlockTime)
+		pt.Transactions++
+		if txn.Value > 0 {
+			pt.Received += txn.Value
+			pt.ReceivedValue += txn.FiatValue
+		} else {
+			pt.Sent -= txn.Value
+			pt.SentValue -= txn.FiatValue
+		}
+	}
+	for _, d := range disposals {
+		pt := get(d.Disposed)
+		pt.Proceeds += d.Proceeds
+		pt.CostBasis += d.CostBasis
+		pt.Gain += d.Gain
+	}
+	ret := make([]PeriodTotal, 0, len(totals))
+	for _, pt := range totals {
+		ret = append(ret, *pt)
+	}
+	sort.Slice(ret, func(i, j int) bool { return ret[i].Start.Before(ret[j].Start) })
+	return ret
+}
@@ -0,0 +1,214 @@
+package wallet
+
+import (
+	"errors"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/wire"
+)
+
+// blockTimes are header timestamps by height
+type blockTimes map[int32]time.Time
+
+func (b blockTimes) BlockTime(height int32) (time.Time, bool) {
+	t, ok := b[height]
+	return t, ok
+}
+
+const sats = 100_000_000
+
+func near(a, b float64) bool {
+	return math.Abs(a-b) < 1e-6
+}
+
+func output(txid string, index uint32, value int64) Utxo {
+	h, _ := chainhash.NewHashFromStr(txid)
+	return Utxo{Op: *wire.NewOutPoint(h, index), Value: value}
+}
+
+// A wallet receiving 1 BTC at 20000, 1 BTC at 30000, then sending 1.5 BTC
+// at 40000 with 0.5 BTC change, and receiving 0.2 BTC in 2024
+var (
+	recv1 = "1111111111111111111111111111111111111111111111111111111111111111"
+	recv2 = "2222222222222222222222222222222222222222222222222222222222222222"
+	send  = "3333333333333333333333333333333333333333333333333333333333333333"
+	recv3 = "4444444444444444444444444444444444444444444444444444444444444444"
+	mined = blockTimes{
+		10: date("2023-01-10").Add(time.Hour),
+		20: date("2023-02-10").Add(time.Hour),
+		30: date("2023-05-10").Add(time.Hour),
+		40: date("2024-01-03").Add(time.Hour),
+	}
+	walletTxns = []Txn{
+		{Txid: send, Value: -1.5 * sats, Height: 30, Timestamp: date("2023-05-01")},
+		{Txid: recv1, Value: 1 * sats, Height: 10, Timestamp: date("2023-01-01")},
+		{Txid: recv2, Value: 1 * sats, Height: 20, Timestamp: date("2023-02-01")},
+		{Txid: recv3, Value: 0.2 * sats, Height: 40, Timestamp: date("2024-01-01")},
+		{Txid: "5555555555555555555555555555555555555555555555555555555555555555",
+			Value: 0.1 * sats, Height: 0, Timestamp: date("2024-06-01")},
+	}
+	walletOutputs = []Utxo{
+		output(recv1, 0, 1*sats),
+		output(recv2, 1, 1*sats),
+		output(send, 1, 0.5*sats),
+		output(recv3, 0, 0.2*sats),
+	}
+)
+
+func walletPrices() *memPrices {
+	prices := new(memPrices)
+	prices.Put(date("2023-01-10"), "USD", 20000)
+	prices.Put(date("2023-02-09"), "USD", 30000)
+	prices.Put(date("2023-05-10"), "USD", 40000)
+	prices.Put(date("2024-01-03"), "USD", 45000)
+	return prices
+}
+
+func TestValueTransactions(t *testing.T) {
+	txns, err := ValueTransactions(walletTxns, walletPrices(), mined, "usd", sats)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(txns) != len(walletTxns) {
+		t.Fatalf("%d transactions", len(txns))
+	}
+	for i, want := range []struct {
+		txid      string
+		value     float64
+		priceDate time.Time
+	}{
+		{recv1, 20000, date("2023-01-10")},
+		{recv2, 30000, date("2023-02-09")},
+		{send, -60000, date("2023-05-10")},
+		{recv3, 9000, date("2024-01-03")},
+		{walletTxns[4].Txid, 4500, date("2024-01-03")},
+	} {
+		txn := txns[i]
+		if txn.Txid != want.txid || !near(txn.FiatValue, want.value) ||
+			!txn.PriceDate.Equal(want.priceDate) || txn.Currency != "USD" {
+			t.Errorf("%d: got %s %v %v", i, txn.Txid, txn.FiatValue, txn.PriceDate)
+		}
+	}
+	if !txns[0].BlockTime.Equal(mined[10]) {
+		t.Errorf("block time %v", txns[0].BlockTime)
+	}
+	if !txns[4].BlockTime.Equal(walletTxns[4].Timestamp) {
+		t.Errorf("unconfirmed block time %v", txns[4].BlockTime)
+	}
+
+	txns, err = ValueTransactions(walletTxns, walletPrices(), nil, "EUR", sats)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, txn := range txns {
+		if txn.Priced() || txn.FiatValue != 0 {
+			t.Errorf("%s priced without EUR prices", txn.Txid)
+		}
+	}
+}
+
+func TestCalculateGains(t *testing.T) {
+	txns, err := ValueTransactions(walletTxns, walletPrices(), mined, "USD", sats)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		method    LotMethod
+		costBasis float64
+		lots      []Lot
+		holdings  []Lot
+	}{{
+		method:    FIFO,
+		costBasis: 35000,
+		lots:      []Lot{{Txid: recv1, Amount: 1 * sats}, {Txid: recv2, Index: 1, Amount: 0.5 * sats}},
+		holdings:  []Lot{{Txid: recv2, Index: 1, Amount: 0.5 * sats}, {Txid: recv3, Amount: 0.2 * sats}},
+	}, {
+		method:    LIFO,
+		costBasis: 40000,
+		lots:      []Lot{{Txid: recv2, Index: 1, Amount: 1 * sats}, {Txid: recv1, Amount: 0.5 * sats}},
+		holdings:  []Lot{{Txid: recv1, Amount: 0.5 * sats}, {Txid: recv3, Amount: 0.2 * sats}},
+	}}
+	for _, tt := range tests {
+		report, err := CalculateGains(txns, walletOutputs, tt.method, PeriodYear, sats)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(report.Disposals) != 1 {
+			t.Fatalf("%s: %d disposals", tt.method, len(report.Disposals))
+		}
+		d := report.Disposals[0]
+		if d.Txid != send || d.Amount != 1.5*sats || !near(d.Proceeds, 60000) ||
+			!near(d.CostBasis, tt.costBasis) || !near(d.Gain, 60000-tt.costBasis) ||
+			!near(report.Gain, d.Gain) {
+			t.Errorf("%s: disposal %+v", tt.method, d)
+		}
+		sameLots := func(what string, got, want []Lot) {
+			if len(got) != len(want) {
+				t.Errorf("%s: %s %+v", tt.method, what, got)
+				return
+			}
+			for i := range want {
+				if got[i].Txid != want[i].Txid || got[i].Index != want[i].Index || got[i].Amount != want[i].Amount {
+					t.Errorf("%s: %s %d %+v", tt.method, what, i, got[i])
+				}
+			}
+		}
+		sameLots("lots", d.Lots, tt.lots)
+		sameLots("holdings", report.Holdings, tt.holdings)
+
+		if len(report.Totals) != 2 {
+			t.Fatalf("%s: totals %+v", tt.method, report.Totals)
+		}
+		y2023, y2024 := report.Totals[0], report.Totals[1]
+		if !y2023.Start.Equal(date("2023-01-01")) || !y2023.End.Equal(date("2024-01-01")) ||
+			y2023.Transactions != 3 || y2023.Received != 2*sats || y2023.Sent != 1.5*sats ||
+			!near(y2023.ReceivedValue, 50000) || !near(y2023.SentValue, 60000) ||
+			!near(y2023.Proceeds, 60000) || !near(y2023.Gain, 60000-tt.costBasis) {
+			t.Errorf("%s: 2023 totals %+v", tt.method, y2023)
+		}
+		if y2024.Transactions != 1 || y2024.Received != 0.2*sats || y2024.Gain != 0 {
+			t.Errorf("%s: 2024 totals %+v", tt.method, y2024)
+		}
+	}
+
+	// a confirmed transaction without a price
+	prices := walletPrices()
+	prices.Delete(date("2023-01-10"), "USD")
+	txns, _ = ValueTransactions(walletTxns, prices, mined, "USD", sats)
+	if _, err = CalculateGains(txns, walletOutputs, FIFO, PeriodYear, sats); !errors.Is(err, ErrNoPrice) {
+		t.Errorf("gains without a price: %v", err)
+	}
+
+	// sending more than was received
+	txns, _ = ValueTransactions(walletTxns[:2], walletPrices(), mined, "USD", sats)
+	if _, err = CalculateGains(txns, walletOutputs, FIFO, PeriodYear, sats); err == nil {
+		t.Error("gains sending more than was received")
+	}
+}
+
+func TestPeriodBounds(t *testing.T) {
+	at := time.Date(2023, 8, 15, 13, 0, 0, 0, time.FixedZone("", 3600))
+	for _, tt := range []struct {
+		period     Period
+		start, end time.Time
+	}{
+		{PeriodDay, date("2023-08-15"), date("2023-08-16")},
+		{PeriodMonth, date("2023-08-01"), date("2023-09-01")},
+		{PeriodQuarter, date("2023-07-01"), date("2023-10-01")},
+		{PeriodYear, date("2023-01-01"), date("2024-01-01")},
+	} {
+		start, end := tt.period.Bounds(at)
+		if !start.Equal(tt.start) || !end.Equal(tt.end) {
+			t.Errorf("%s: %v %v", tt.period, start, end)
+		}
+	}
+	if _, err := ParsePeriod("week"); err == nil {
+		t.Error("parsed week")
+	}
+	if m, err := ParseLotMethod("lifo"); err != nil || m != LIFO {
+		t.Errorf("lifo parsed as %q %v", m, err)
+	}
+}
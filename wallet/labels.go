@@ -0,0 +1,135 @@
+package wallet
+
+import (
+	"bufio"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/btcsuite/btcd/btcutil"
+	hd "github.com/btcsuite/btcd/btcutil/hdkeychain"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+)
+
+// Labels are moved between wallets in the BIP329 format: JSON lines of
+//
+//	{"type":"tx","ref":"f91d0a8a78462bc59398f2c5d7a84fcff491c26ba54c4833478b202796c8aafd","label":"Transaction"}
+//	{"type":"addr","ref":"bc1q34aq5drpuwy3wgl9lhup9892qp6svr8ldzyy7c","label":"Address"}
+//	{"type":"output","ref":"f91d0a8a78462bc59398f2c5d7a84fcff491c26ba54c4833478b202796c8aafd:1","label":"Output"}
+
+// bip329Record is a line of a BIP329 export
+type bip329Record struct {
+	Type   LabelType `json:"type"`
+	Ref    string    `json:"ref"`
+	Label  string    `json:"label"`
+	Origin string    `json:"origin,omitempty"`
+}
+
+// ParseLabelType parses a BIP329 label type in any case
+func ParseLabelType(s string) (LabelType, error) {
+	switch t := LabelType(strings.ToLower(s)); t {
+	case LabelTx, LabelAddr, LabelPubkey, LabelInput, LabelOutput, LabelXpub:
+		return t, nil
+	}
+	return "", fmt.Errorf("invalid label type %q", s)
+}
+
+// ValidateLabelRef checks a reference is well formed for the label type.
+// Addresses must be for the network of params.
+func ValidateLabelRef(labelType LabelType, ref string, params *chaincfg.Params) error {
+	switch labelType {
+	case LabelTx:
+		if len(ref) != chainhash.MaxHashStringSize {
+			return fmt.Errorf("invalid txid %q", ref)
+		}
+		if _, err := chainhash.NewHashFromStr(ref); err != nil {
+			return fmt.Errorf("invalid txid %q", ref)
+		}
+	case LabelAddr:
+		addr, err := btcutil.DecodeAddress(ref, params)
+		if err != nil || !addr.IsForNet(params) {
+			return fmt.Errorf("invalid address %q", ref)
+		}
+	case LabelPubkey:
+		b, err := hex.DecodeString(ref)
+		if err != nil || (len(b) != 33 && len(b) != 65) {
+			return fmt.Errorf("invalid public key %q", ref)
+		}
+	case LabelInput, LabelOutput:
+		txid, index, ok := strings.Cut(ref, ":")
+		if !ok || ValidateLabelRef(LabelTx, txid, params) != nil {
+			return fmt.Errorf("invalid outpoint %q", ref)
+		}
+		if _, err := strconv.ParseUint(index, 10, 32); err != nil {
+			return fmt.Errorf("invalid outpoint %q", ref)
+		}
+	case LabelXpub:
+		key, err := hd.NewKeyFromString(ref)
+		if err != nil || key.IsPrivate() {
+			return fmt.Errorf("invalid xpub %q", ref)
+		}
+	default:
+		return fmt.Errorf("invalid label type %q", labelType)
+	}
+	return nil
+}
+
+// ImportLabels reads BIP329 labels into the store and returns the number
+// imported. Records of a type this wallet does not use and records without a
+// label are skipped as BIP329 asks. A label replaces any existing label of
+// the same reference. Every record is checked before any is stored so that a
+// bad line imports nothing.
+func ImportLabels(labels Labels, r io.Reader, params *chaincfg.Params) (int, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	var imports []Label
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" {
+			continue
+		}
+		var record bip329Record
+		if err := json.Unmarshal([]byte(text), &record); err != nil {
+			return 0, fmt.Errorf("line %d: %w", line, err)
+		}
+		labelType, err := ParseLabelType(string(record.Type))
+		if err != nil || record.Label == "" {
+			continue
+		}
+		if err = ValidateLabelRef(labelType, record.Ref, params); err != nil {
+			return 0, fmt.Errorf("line %d: %w", line, err)
+		}
+		imports = append(imports, Label{Type: labelType, Ref: record.Ref, Label: record.Label, Origin: record.Origin})
+	}
+	if err := scanner.Err(); err != nil {
+		return 0, err
+	}
+	for i, label := range imports {
+		if err := labels.Put(label); err != nil {
+			return i, err
+		}
+	}
+	return len(imports), nil
+}
+
+// ExportLabels writes all the labels in the store as BIP329 JSON lines and
+// returns the number written
+func ExportLabels(labels Labels, w io.Writer) (int, error) {
+	all, err := labels.GetAll()
+	if err != nil {
+		return 0, err
+	}
+	enc := json.NewEncoder(w)
+	enc.SetEscapeHTML(false)
+	for i, label := range all {
+		record := bip329Record{Type: label.Type, Ref: label.Ref, Label: label.Label, Origin: label.Origin}
+		if err = enc.Encode(&record); err != nil {
+			return i, err
+		}
+	}
+	return len(all), nil
+}
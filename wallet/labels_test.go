@@ -0,0 +1,126 @@
+package wallet
+
+import (
+	"bytes"
+	"errors"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/btcsuite/btcd/chaincfg"
+)
+
+// memLabels is a Labels in memory
+type memLabels struct {
+	labels map[string]Label
+}
+
+func (m *memLabels) Put(label Label) error {
+	m.labels[string(label.Type)+" "+label.Ref] = label
+	return nil
+}
+
+func (m *memLabels) Get(labelType LabelType, ref string) (Label, error) {
+	label, ok := m.labels[string(labelType)+" "+ref]
+	if !ok {
+		return label, errors.New("not found")
+	}
+	return label, nil
+}
+
+func (m *memLabels) GetAll() ([]Label, error) {
+	var ret []Label
+	for _, label := range m.labels {
+		ret = append(ret, label)
+	}
+	sort.Slice(ret, func(i, j int) bool {
+		if ret[i].Type != ret[j].Type {
+			return ret[i].Type < ret[j].Type
+		}
+		return ret[i].Ref < ret[j].Ref
+	})
+	return ret, nil
+}
+
+func (m *memLabels) Delete(labelType LabelType, ref string) error {
+	delete(m.labels, string(labelType)+" "+ref)
+	return nil
+}
+
+const bip329Example = `{"type":"tx","ref":"f91d0a8a78462bc59398f2c5d7a84fcff491c26ba54c4833478b202796c8aafd","label":"Transaction","origin":"wpkh([d34db33f/84'/0'/0'])"}
+{"type":"addr","ref":"bc1q34aq5drpuwy3wgl9lhup9892qp6svr8ldzyy7c","label":"Address"}
+{"type":"pubkey","ref":"0283409659355b6d1cc3c32decd5d561abaac86c37a353b52895a5e6c196d6f448","label":"Public Key"}
+{"type":"input","ref":"f91d0a8a78462bc59398f2c5d7a84fcff491c26ba54c4833478b202796c8aafd:0","label":"Input"}
+{"type":"output","ref":"f91d0a8a78462bc59398f2c5d7a84fcff491c26ba54c4833478b202796c8aafd:1","label":"Output","spendable":false}
+{"type":"xpub","ref":"xpub661MyMwAqRbcFtXgS5sYJABqqG9YLmC4Q1Rdap9gSE8NqtwybGhePY2gZ29ESFjqJoCu1Rupje8YtGqsefD265TMg7usUDFdp6W1EGMcet8","label":"Extended Public Key"}
+
+{"type":"bip32","ref":"m/84'","label":"unknown type"}
+{"type":"output","ref":"f91d0a8a78462bc59398f2c5d7a84fcff491c26ba54c4833478b202796c8aafd:2","spendable":true}
+`
+
+func TestImportExportLabels(t *testing.T) {
+	labels := &memLabels{make(map[string]Label)}
+	n, err := ImportLabels(labels, strings.NewReader(bip329Example), &chaincfg.MainNetParams)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 6 {
+		t.Errorf("Imported %d labels, want 6", n)
+	}
+	label, err := labels.Get(LabelTx, "f91d0a8a78462bc59398f2c5d7a84fcff491c26ba54c4833478b202796c8aafd")
+	if err != nil || label.Label != "Transaction" || label.Origin != "wpkh([d34db33f/84'/0'/0'])" {
+		t.Errorf("Imported incorrect label %+v", label)
+	}
+
+	var b bytes.Buffer
+	n, err = ExportLabels(labels, &b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(b.String()), "\n")
+	if n != 6 || len(lines) != 6 {
+		t.Fatalf("Exported %d labels in %d lines, want 6", n, len(lines))
+	}
+	if lines[0] != `{"type":"addr","ref":"bc1q34aq5drpuwy3wgl9lhup9892qp6svr8ldzyy7c","label":"Address"}` {
+		t.Errorf("Exported incorrect line %s", lines[0])
+	}
+
+	// the exported labels import the same
+	again := &memLabels{make(map[string]Label)}
+	if _, err = ImportLabels(again, &b, &chaincfg.MainNetParams); err != nil {
+		t.Fatal(err)
+	}
+	all, _ := labels.GetAll()
+	allAgain, _ := again.GetAll()
+	if len(all) != len(allAgain) {
+		t.Fatal("Labels differ after a round trip")
+	}
+	for i := range all {
+		if all[i] != allAgain[i] {
+			t.Errorf("Label %+v is %+v after a round trip", all[i], allAgain[i])
+		}
+	}
+}
+
+func TestImportLabels_Invalid(t *testing.T) {
+	tests := []string{
+		`{"type":"tx","ref":"f91d"`,
+		`{"type":"tx","ref":"not a txid","label":"a"}`,
+		`{"type":"addr","ref":"bc1q34aq5drpuwy3wgl9lhup9892qp6svr8ldzyy7c","label":"wrong network"}`,
+		`{"type":"output","ref":"f91d0a8a78462bc59398f2c5d7a84fcff491c26ba54c4833478b202796c8aafd","label":"no index"}`,
+	}
+	for _, test := range tests {
+		labels := &memLabels{make(map[string]Label)}
+		if _, err := ImportLabels(labels, strings.NewReader(test), &chaincfg.TestNet3Params); err == nil {
+			t.Errorf("Imported invalid line %s", test)
+		}
+	}
+
+	// a bad line after good ones imports nothing
+	labels := &memLabels{make(map[string]Label)}
+	file := `{"type":"tx","ref":"f91d0a8a78462bc59398f2c5d7a84fcff491c26ba54c4833478b202796c8aafd","label":"good"}
+` + tests[1]
+	if n, err := ImportLabels(labels, strings.NewReader(file), &chaincfg.TestNet3Params); err == nil || n != 0 || len(labels.labels) != 0 {
+		t.Errorf("Partial import of %d labels: %v", n, err)
+	}
+}
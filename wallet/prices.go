@@ -0,0 +1,123 @@
+package wallet
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Layouts accepted for the dates of imported prices. A date may also be unix
+// seconds.
+var priceDateLayouts = []string{
+	PriceDateLayout,
+	time.RFC3339,
+	"2006-01-02 15:04:05 MST",
+	"2006-01-02 15:04:05",
+	"2006/01/02",
+}
+
+// ImportPricesCSV reads daily coin prices from CSV into the store and returns
+// the number of prices imported. A header row names the columns: the date is
+// "date", "time", "timestamp" or "snapped_at", the price is "price" or
+// "close" and the currency is "currency". Without a header the columns are
+// date,currency,price. When the rows have no currency column the currency
+// argument is used, e.g. for a coingecko export:
+//
+//	snapped_at,price,market_cap,total_volume
+//	2023-01-01 00:00:00 UTC,16547.49,318649627018.1,11569604137.34
+func ImportPricesCSV(prices Prices, r io.Reader, currency string) (int, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	cr.TrimLeadingSpace = true
+	dateCol, currencyCol, priceCol := 0, 1, 2
+	n := 0
+	for line := 1; ; line++ {
+		record, err := cr.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return n, err
+		}
+		if line == 1 {
+			if _, err = parsePriceDate(record[0]); err != nil {
+				if dateCol, currencyCol, priceCol, err = priceColumns(record); err != nil {
+					return n, err
+				}
+				continue
+			}
+			if len(record) == 2 {
+				// date,price without a header
+				currencyCol, priceCol = -1, 1
+			}
+		}
+		code := currency
+		if currencyCol >= 0 {
+			if currencyCol >= len(record) {
+				return n, fmt.Errorf("line %d: no currency", line)
+			}
+			code = record[currencyCol]
+		}
+		code = strings.ToUpper(strings.TrimSpace(code))
+		if code == "" {
+			return n, fmt.Errorf("line %d: no currency", line)
+		}
+		if dateCol >= len(record) || priceCol >= len(record) {
+			return n, fmt.Errorf("line %d: too few columns", line)
+		}
+		date, err := parsePriceDate(record[dateCol])
+		if err != nil {
+			return n, fmt.Errorf("line %d: %w", line, err)
+		}
+		price, err := strconv.ParseFloat(strings.TrimSpace(record[priceCol]), 64)
+		if err != nil || price <= 0 {
+			return n, fmt.Errorf("line %d: invalid price %q", line, record[priceCol])
+		}
+		if err = prices.Put(date, code, price); err != nil {
+			return n, err
+		}
+		n++
+	}
+	return n, nil
+}
+
+// priceColumns finds the date, currency and price columns of a header row.
+// The currency column is -1 if there is none.
+func priceColumns(header []string) (dateCol, currencyCol, priceCol int, err error) {
+	dateCol, currencyCol, priceCol = -1, -1, -1
+	for i, name := range header {
+		switch strings.ToLower(strings.TrimSpace(name)) {
+		case "date", "time", "timestamp", "snapped_at":
+			if dateCol < 0 {
+				dateCol = i
+			}
+		case "currency":
+			currencyCol = i
+		case "price", "close":
+			if priceCol < 0 {
+				priceCol = i
+			}
+		}
+	}
+	if dateCol < 0 || priceCol < 0 {
+		return 0, 0, 0, fmt.Errorf("prices csv header %q has no date or price column", strings.Join(header, ","))
+	}
+	return dateCol, currencyCol, priceCol, nil
+}
+
+func parsePriceDate(s string) (time.Time, error) {
+	s = strings.TrimSpace(s)
+	for _, layout := range priceDateLayouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t.UTC(), nil
+		}
+	}
+	if secs, err := strconv.ParseInt(s, 10, 64); err == nil && secs > 0 {
+		return time.Unix(secs, 0).UTC(), nil
+	}
+	return time.Time{}, fmt.Errorf("invalid date %q", s)
+}
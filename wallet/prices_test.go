@@ -0,0 +1,123 @@
+package wallet
+
+import (
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+// memPrices is a Prices in memory
+type memPrices struct {
+	prices []Price
+}
+
+func (m *memPrices) Put(date time.Time, currency string, price float64) error {
+	m.Delete(date, currency)
+	day, _ := time.Parse(PriceDateLayout, date.UTC().Format(PriceDateLayout))
+	m.prices = append(m.prices, Price{Date: day, Currency: strings.ToUpper(currency), Price: price})
+	sort.Slice(m.prices, func(i, j int) bool { return m.prices[i].Date.Before(m.prices[j].Date) })
+	return nil
+}
+
+func (m *memPrices) Get(date time.Time, currency string) (Price, error) {
+	all, _ := m.GetAll(currency)
+	for i := len(all) - 1; i >= 0; i-- {
+		if !all[i].Date.After(date) {
+			return all[i], nil
+		}
+	}
+	return Price{}, ErrNoPrice
+}
+
+func (m *memPrices) GetAll(currency string) ([]Price, error) {
+	var ret []Price
+	for _, p := range m.prices {
+		if p.Currency == strings.ToUpper(currency) {
+			ret = append(ret, p)
+		}
+	}
+	return ret, nil
+}
+
+func (m *memPrices) Delete(date time.Time, currency string) error {
+	for i, p := range m.prices {
+		if p.Currency == strings.ToUpper(currency) && p.Date.Format(PriceDateLayout) == date.UTC().Format(PriceDateLayout) {
+			m.prices = append(m.prices[:i], m.prices[i+1:]...)
+			return nil
+		}
+	}
+	return nil
+}
+
+func date(s string) time.Time {
+	t, err := time.Parse(PriceDateLayout, s)
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
+
+func TestImportPricesCSV(t *testing.T) {
+	tests := []struct {
+		name     string
+		csv      string
+		currency string
+		want     []Price
+		wantErr  bool
+	}{{
+		name: "no header",
+		csv:  "2023-01-01,usd,16500.5\n2023-01-02, EUR ,15500\n",
+		want: []Price{{date("2023-01-01"), "USD", 16500.5}, {date("2023-01-02"), "EUR", 15500}},
+	}, {
+		name:     "date and price",
+		csv:      "2023-01-01,16500\n1672617600,16700\n",
+		currency: "usd",
+		want:     []Price{{date("2023-01-01"), "USD", 16500}, {date("2023-01-02"), "USD", 16700}},
+	}, {
+		name:     "coingecko",
+		csv:      "snapped_at,price,market_cap,total_volume\n2023-01-01 00:00:00 UTC,16547.49,318649627018.1,11569604137.34\n",
+		currency: "GBP",
+		want:     []Price{{date("2023-01-01"), "GBP", 16547.49}},
+	}, {
+		name: "header",
+		csv:  "Currency,Close,Date\nUSD,17000,2023-01-03T12:00:00Z\n",
+		want: []Price{{date("2023-01-03"), "USD", 17000}},
+	}, {
+		name:    "no currency",
+		csv:     "date,price\n2023-01-01,16500\n",
+		wantErr: true,
+	}, {
+		name:    "bad header",
+		csv:     "day,value\n2023-01-01,16500\n",
+		wantErr: true,
+	}, {
+		name:    "bad price",
+		csv:     "2023-01-01,USD,-1\n",
+		wantErr: true,
+	}, {
+		name:    "bad date",
+		csv:     "2023-01-01,USD,1\nyesterday,USD,2\n",
+		wantErr: true,
+	}}
+	for _, tt := range tests {
+		prices := new(memPrices)
+		n, err := ImportPricesCSV(prices, strings.NewReader(tt.csv), tt.currency)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: error %v", tt.name, err)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		if n != len(tt.want) {
+			t.Errorf("%s: imported %d", tt.name, n)
+		}
+		for _, want := range tt.want {
+			got, err := prices.Get(want.Date, want.Currency)
+			if err != nil || got != want {
+				t.Errorf("%s: got %+v %v, want %+v", tt.name, got, err, want)
+			}
+		}
+	}
+}
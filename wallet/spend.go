@@ -0,0 +1,92 @@
+package wallet
+
+import (
+	"time"
+
+	"github.com/btcsuite/btcd/wire"
+)
+
+// SpendOptions change how SpendMany builds a transaction. The zero value
+// selects coins and adds the fee at the fee level to the amount spent.
+type SpendOptions struct {
+	// Spend exactly these wallet coins instead of selecting them
+	Coins []wire.OutPoint
+
+	// SendMax pays all that is left after the other outputs and the fee to
+	// the output at index MaxOutput, whose value is ignored. Every
+	// spendable coin, or all of Coins, is spent.
+	SendMax   bool
+	MaxOutput int
+
+	// SubtractFee takes the fee out of the output at index FeeOutput rather
+	// than adding it to the amount spent
+	SubtractFee bool
+	FeeOutput   int
+
+	// Data for a zero value OP_RETURN output, at most 80 bytes
+	OpReturn []byte
+
+	// Fee rate in satoshis per vbyte used instead of the fee level when set
+	FeePerByte uint64
+
+	// Fee in satoshis paid whatever the size of the transaction, used
+	// instead of a fee rate when set
+	Fee int64
+}
+
+// SpendResult is a transaction built by the wallet for review before it is
+// broadcast
+type SpendResult struct {
+	// Signed when built by SpendMany, unsigned in a new TxProposal
+	Tx *wire.MsgTx
+
+	// The coins spent in the order of the inputs
+	Inputs []Utxo
+
+	// Index of the change output, -1 when there is none
+	ChangeIndex int
+
+	// Fee in satoshis, estimated virtual size and the fee rate used
+	Fee        int64
+	Vsize      int64
+	FeePerByte uint64
+}
+
+// ProposalStatus is how far a TxProposal has got
+type ProposalStatus string
+
+const (
+	ProposalUnsigned  ProposalStatus = "unsigned"
+	ProposalSigned    ProposalStatus = "signed"
+	ProposalBroadcast ProposalStatus = "broadcast"
+)
+
+// TxProposal is a transaction built by the wallet to be inspected, signed
+// and broadcast in separate steps. Until it is broadcast or cancelled it
+// locks the coins it spends so that no other spend selects them.
+type TxProposal struct {
+	// The txid of the unsigned transaction, which does not change when it
+	// is signed elsewhere
+	ID string
+
+	SpendResult
+
+	Status  ProposalStatus
+	Created time.Time
+}
+
+// ProposalID returns the ID of the proposal of a transaction, the txid of the
+// transaction without its input scripts
+func ProposalID(tx *wire.MsgTx) string {
+	unsigned := tx.Copy()
+	for _, in := range unsigned.TxIn {
+		in.SignatureScript = nil
+		in.Witness = nil
+	}
+	return unsigned.TxHash().String()
+}
+
+// Open is true while the proposal locks its coins
+func (p *TxProposal) Open() bool {
+	return p.Status != ProposalBroadcast
+}
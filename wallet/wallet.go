@@ -2,6 +2,7 @@ package wallet
 
 import (
 	"errors"
+	"io"
 	"math/big"
 	"time"
 
@@ -9,6 +10,8 @@ import (
 	hd "github.com/btcsuite/btcd/btcutil/hdkeychain"
 	"github.com/btcsuite/btcd/chaincfg"
 	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/wire"
+	"golang.org/x/net/proxy"
 )
 
 type WalletConfig struct {
@@ -35,10 +38,51 @@ type WalletConfig struct {
 	// The highest allowable fee-per-byte
 	MaxFee uint64
 
+	// Fee sources tried in order for current fees. The default fees are used
+	// if there are none or all fail.
+	FeeSources []FeeSource
+
+	// Dials through a proxy, such as Tor, for HTTP fetches like exchange rates.
+	// Nil means direct connections.
+	Proxy proxy.Dialer
+
+	// Exchange rate sources tried in order. No sources disables exchange
+	// rates.
+	RateSources []RateSource
+
+	// Sends signed transactions to the network. The wallet has no node
+	// connection of its own so the client supplies this.
+	Broadcaster Broadcaster
+
+	// The client's headers give the chain tip for confirmations and block
+	// times for valuing transactions. Without them the tip is 0 and the time
+	// a transaction was added is used.
+	Headers Headers
+
 	// If not testing do not overwrite existing wallet files
 	Testing bool
 }
 
+// Broadcaster sends a hex encoded serialized transaction to the network and
+// returns the txid as a hex string.
+type Broadcaster interface {
+	Broadcast(rawTx string) (string, error)
+}
+
+// BlockTimes returns the timestamp of the block header at a height if it is
+// known
+type BlockTimes interface {
+	BlockTime(height int32) (time.Time, bool)
+}
+
+// Headers is the client's copy of the chain headers
+type Headers interface {
+	BlockTimes
+
+	// Tip returns the height of the best header, 0 before the headers sync
+	Tip() int32
+}
+
 type ElectrumWallet interface {
 
 	// Start the wallet
@@ -82,9 +126,49 @@ type ElectrumWallet interface {
 	// should be also counted as confirmed even if the spending transaction is unconfirmed.
 	Balance() (confirmed, unconfirmed int64)
 
-	// Returns a list of addresses for this wallet
+	// Returns a list of addresses for this wallet including those of any
+	// imported keys
 	ListAddresses() []btcutil.Address
 
+	// ImportKey imports a WIF encoded private key that is not part of the
+	// wallet keychain. Imported keys are kept in the encrypted storage so the
+	// wallet password is required. The P2PKH and P2WPKH addresses of the key
+	// are watched and their coins are spendable. An uncompressed key only has
+	// a P2PKH address.
+	ImportKey(wif string, pw string) error
+
+	// ListImported returns the addresses of all imported keys
+	ListImported() []btcutil.Address
+
+	// DeleteImported removes the imported key for the given address from the
+	// encrypted storage. Any coins still held by the key become watch only.
+	DeleteImported(addr btcutil.Address, pw string) error
+
+	// ListUnspent returns the unspent outputs of the wallet, including watch
+	// only coins
+	ListUnspent() ([]Utxo, error)
+
+	// ListUnspentOutputs returns the spendable and frozen utxos of the wallet
+	// with their address, label and confirmations for coin control. Watch
+	// only coins are left out.
+	ListUnspentOutputs() ([]UnspentOutput, error)
+
+	// FreezeCoin freezes or unfreezes a wallet utxo. Frozen coins are not
+	// spent until unfrozen.
+	FreezeCoin(op wire.OutPoint, frozen bool) error
+
+	// FreezeAddress freezes or unfreezes the utxos at an address and returns
+	// the number of them. Coins received at the address later are not frozen.
+	FreezeAddress(addr btcutil.Address, frozen bool) (int, error)
+
+	// SignMessage signs a message with the key of a wallet address in the
+	// Bitcoin signed message format. The signature is 65 bytes.
+	SignMessage(addr btcutil.Address, message string) ([]byte, error)
+
+	// VerifyMessage checks a signed message signature was made by the key of
+	// the address. The address need not belong to the wallet.
+	VerifyMessage(addr btcutil.Address, sig []byte, message string) (bool, error)
+
 	// Returns a list of transactions for this wallet
 	Transactions() ([]Txn, error)
 
@@ -103,9 +187,99 @@ type ElectrumWallet interface {
 	// Get the current fee per byte
 	GetFeePerByte(feeLevel FeeLevel) uint64
 
+	// Get the current fee per byte to confirm within the number of blocks
+	GetFeePerByteForTarget(blocks int) uint64
+
+	// Check a fee per byte chosen by the user is within the allowed range
+	CustomFeePerByte(satPerByte uint64) (uint64, error)
+
+	// ExchangeRates returns the fiat exchange rates of the coin, or nil if
+	// exchange rates are disabled
+	ExchangeRates() ExchangeRates
+
+	// HistoryRecords returns the transactions selected by the options with
+	// their block time, fee, counterparties and optional fiat value
+	HistoryRecords(opts ExportOptions) ([]HistoryRecord, error)
+
+	// ExportHistory writes the HistoryRecords in the options format and
+	// returns the number written
+	ExportHistory(w io.Writer, opts ExportOptions) (int, error)
+
+	// SetLabel labels a transaction, address, output or other BIP329
+	// reference. An empty label removes it.
+	SetLabel(labelType LabelType, ref string, label string) error
+
+	// Label returns the label of a reference, empty if there is none
+	Label(labelType LabelType, ref string) string
+
+	// Labels returns all the labels ordered by type and reference
+	Labels() ([]Label, error)
+
+	// ImportLabels reads labels in the BIP329 format and returns the number
+	// imported. Nothing is imported if a record is invalid.
+	ImportLabels(r io.Reader) (int, error)
+
+	// ExportLabels writes all the labels in the BIP329 format and returns the
+	// number written
+	ExportLabels(w io.Writer) (int, error)
+
+	// HistoricalPrices returns the store of daily coin prices used to value
+	// transactions, see ImportPricesCSV
+	HistoricalPrices() Prices
+
+	// FiatTransactions returns Transactions valued in the currency at their
+	// block time, ordered by block time
+	FiatTransactions(currency string) ([]FiatTxn, error)
+
+	// RealisedGains matches the coins sent against the coins received with
+	// the lot method and totals them per period. Every confirmed
+	// transaction must have a historical price.
+	RealisedGains(currency string, method LotMethod, period Period) (*GainsReport, error)
+
 	// Send bitcoins to an external wallet
 	Spend(amount int64, addr btcutil.Address, feeLevel FeeLevel) (*chainhash.Hash, error)
 
+	// SpendCoins sends bitcoins spending exactly the given wallet utxos,
+	// bypassing coin selection. Any change returns to the wallet.
+	SpendCoins(amount int64, addr btcutil.Address, feeLevel FeeLevel, coins []wire.OutPoint) (*chainhash.Hash, error)
+
+	// SpendMany builds and signs a transaction paying all of the outputs in
+	// one and returns it for review without broadcasting it. It is saved as a
+	// signed proposal, with the ID given by ProposalID, that locks its coins
+	// until it is broadcast or cancelled.
+	SpendMany(outs []TransactionOutput, feeLevel FeeLevel, opts SpendOptions) (*SpendResult, error)
+
+	// BroadcastTx sends a signed transaction to the network and adds it to
+	// the wallet, marking its proposal broadcast if it has one. If it is sent
+	// but not added the txid is returned with ErrTxNotAdded.
+	BroadcastTx(tx *wire.MsgTx) (*chainhash.Hash, error)
+
+	// CreateProposal builds an unsigned transaction paying the outputs as
+	// SpendMany does and saves it as a proposal, locking its coins
+	CreateProposal(outs []TransactionOutput, feeLevel FeeLevel, opts SpendOptions) (*TxProposal, error)
+
+	// Proposals returns the saved proposals ordered by creation time. A
+	// broadcast proposal is kept until its transaction confirms or dies, and
+	// an open one until a wallet transaction spends one of its coins.
+	Proposals() ([]TxProposal, error)
+
+	// Proposal returns a saved proposal
+	Proposal(id string) (*TxProposal, error)
+
+	// SignProposal signs an open proposal with the wallet keys
+	SignProposal(id string) (*TxProposal, error)
+
+	// ImportSignedProposal replaces the transaction of an open proposal with
+	// the same transaction signed elsewhere, once its signatures verify
+	ImportSignedProposal(id string, signed *wire.MsgTx) (*TxProposal, error)
+
+	// BroadcastProposal broadcasts a signed proposal, which unlocks its coins
+	// as they are spent
+	BroadcastProposal(id string) (*chainhash.Hash, error)
+
+	// CancelProposal deletes an open proposal and unlocks its coins
+	CancelProposal(id string) error
+
 	// BumpFee should attempt to bump the fee on a given unconfirmed transaction (if possible) to
 	// try to get it confirmed and return the txid of the new transaction (if one exists).
 	// Since this method is only called in response to user action, it is acceptable to
@@ -121,17 +295,30 @@ type ElectrumWallet interface {
 	// Add a script to the wallet and get notifications back when coins are received or spent from it
 	AddWatchedScript(script []byte) error
 
-	// Add a callback for incoming transactions
-	AddTransactionListener(func(TransactionCallback))
+	// Add a callback for wallet transaction events. The callback is not called while
+	// the wallet holds any lock so it may call back into the wallet. The returned
+	// function removes the listener.
+	AddTransactionListener(func(TransactionCallback)) (unsubscribe func())
 
-	// NotifyTransactionListners
+	// NotifyTransactionListners sends cb to all transaction listeners
 	NotifyTransactionListners(cb TransactionCallback)
 
-	// ReSyncBlockchain is called in response to a user action to rescan transactions. API based
-	// wallets should do another scan of their addresses to find anything missing. Full node, or SPV
-	// wallets should rescan/re-download blocks starting at the fromTime.
-	// Get info from chain manager
-	ReSyncBlockchain(fromHeight uint64)
+	// Return the output scripts added with AddWatchedScript
+	ListWatchedScripts() ([][]byte, error)
+
+	// ReSyncBlockchain is called in response to a user action to rescan transactions. The wallet
+	// drops its transactions, utxos and stxos at or above fromHeight and any unconfirmed
+	// transactions. The client then queries the server for the history of every wallet and
+	// watched script and adds the transactions back with AddTransaction.
+	ReSyncBlockchain(fromHeight uint64) error
+
+	// AddTransaction ingests a transaction found in the history of a wallet or watched
+	// script. Height is 0 for an unconfirmed transaction.
+	AddTransaction(tx *wire.MsgTx, height int64, timestamp time.Time) error
+
+	// MarkTransactionDead is called when the server no longer knows a transaction. Coins
+	// it spent become spendable again and any transactions spending its outputs also die.
+	MarkTransactionDead(txid chainhash.Hash) error
 
 	// Generate a multisig script from public keys. If a timeout is included the returned script should be a timelocked
 	// escrow which releases using the timeoutKey.
@@ -161,6 +348,34 @@ var (
 	// This is due to a concrete wallet not implementing the finctionality or
 	// temporarily during development.
 	ErrWalletFnNotImplemented = errors.New("wallet function is not implemented")
+
+	// ErrNoBroadcaster is returned when the wallet tries to send a transaction
+	// but was not configured with a Broadcaster.
+	ErrNoBroadcaster = errors.New("no broadcaster configured for wallet")
+
+	// ErrCoinFrozen is returned when spending a frozen utxo
+	ErrCoinFrozen = errors.New("coin is frozen")
+
+	// ErrCoinLocked is returned when spending a utxo locked by an open
+	// transaction proposal
+	ErrCoinLocked = errors.New("coin is locked by a proposal")
+
+	// ErrBumpFeeConfirmed is returned when bumping the fee of a confirmed
+	// transaction
+	ErrBumpFeeConfirmed = errors.New("transaction is already confirmed")
+
+	// ErrBumpFeeDead is returned when bumping the fee of a transaction that
+	// was double spent or dropped
+	ErrBumpFeeDead = errors.New("transaction is dead")
+
+	// ErrBumpFeeNotFound is returned when the transaction has no spendable
+	// wallet output to bump the fee with
+	ErrBumpFeeNotFound = errors.New("no spendable wallet output of the transaction to bump the fee")
+
+	// ErrTxNotAdded is returned with the txid when a transaction was
+	// broadcast but could not be added to the wallet. The server
+	// notification adds it later.
+	ErrTxNotAdded = errors.New("transaction was broadcast but not added to the wallet")
 )
 
 type FeeLevel int
@@ -184,9 +399,26 @@ const (
 	INTERNAL KeyPurpose = 1
 )
 
+// TransactionEvent says why a TransactionCallback was sent
+type TransactionEvent string
+
+const (
+	// First time the wallet has seen the transaction
+	TxEventNew TransactionEvent = "NEW"
+	// An unconfirmed transaction was mined
+	TxEventConfirmed TransactionEvent = "CONFIRMED"
+	// The transaction was double spent by another and is now dead
+	TxEventDoubleSpent TransactionEvent = "DOUBLE_SPENT"
+	// A confirmed transaction moved to another height or back to the mempool
+	TxEventReorged TransactionEvent = "REORGED"
+	// The transaction is no longer in the mempool or the chain
+	TxEventDropped TransactionEvent = "DROPPED"
+)
+
 // This callback is passed to any registered transaction listeners when a transaction is detected
 // for the wallet.
 type TransactionCallback struct {
+	Event     TransactionEvent
 	Txid      string
 	Outputs   []TransactionOutput
 	Inputs    []TransactionInput
@@ -204,6 +436,23 @@ type TransactionOutput struct {
 	OrderID string
 }
 
+// UnspentOutput is a wallet utxo as listed for coin control
+type UnspentOutput struct {
+	Utxo
+
+	// Nil if the output script has no address
+	Address btcutil.Address
+
+	// The label of the output, else of its address
+	Label string
+
+	// 0 for unconfirmed
+	Confirmations int64
+
+	// The ID of the open proposal spending the coin, empty if none
+	LockedBy string
+}
+
 type TransactionInput struct {
 	OutpointHash  []byte
 	OutpointIndex uint32
@@ -0,0 +1,112 @@
+package wltbtc
+
+import (
+	"bytes"
+
+	"main/wallet"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/wire"
+)
+
+// BumpFee speeds up an unconfirmed transaction by child pays for parent. The
+// spendable wallet outputs of the transaction are spent back to the wallet
+// with a fee that brings the transaction and its child together to the
+// FEE_BUMP fee rate. The txid of the child is returned.
+func (w *BtcElectrumWallet) BumpFee(txid chainhash.Hash) (*chainhash.Hash, error) {
+	txn, err := w.GetTransaction(txid)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case txn.Height > 0:
+		return nil, wallet.ErrBumpFeeConfirmed
+	case txn.Height < 0:
+		return nil, wallet.ErrBumpFeeDead
+	}
+	parent := wire.NewMsgTx(wire.TxVersion)
+	if err = parent.Deserialize(bytes.NewReader(txn.Bytes)); err != nil {
+		return nil, err
+	}
+
+	w.lock()
+	defer w.unlock()
+
+	coins, err := w.spendableCoins()
+	if err != nil {
+		return nil, err
+	}
+	var outputs []wallet.Utxo
+	var prevScripts [][]byte
+	for _, u := range coins {
+		if u.Op.Hash == txid {
+			outputs = append(outputs, u)
+			prevScripts = append(prevScripts, u.ScriptPubkey)
+		}
+	}
+	if len(outputs) == 0 {
+		return nil, wallet.ErrBumpFeeNotFound
+	}
+	script, err := w.AddressToScript(w.CurrentAddress(wallet.INTERNAL))
+	if err != nil {
+		return nil, err
+	}
+	out := wire.NewTxOut(0, script)
+	childVsize, err := EstimateTxVsize(prevScripts, nil, []*wire.TxOut{out})
+	if err != nil {
+		return nil, err
+	}
+	parentFee, err := w.parentFee(parent, txn.Fee)
+	if err != nil {
+		return nil, err
+	}
+
+	// the child pays what the parent is short of the fee rate as well as
+	// its own fee
+	feePerByte := w.GetFeePerByte(wallet.FEE_BUMP)
+	packageFee := int64(feePerByte)*int64(txVsize(parent)+childVsize) - parentFee
+	if childRate := (packageFee + int64(childVsize) - 1) / int64(childVsize); childRate > int64(feePerByte) {
+		feePerByte = uint64(childRate)
+	}
+	built, err := w.buildTx(&spendRequest{
+		outs:       []*wire.TxOut{out},
+		coins:      outputs,
+		feePerByte: feePerByte,
+		maxOut:     0,
+		feeOut:     -1,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err = w.signTx(built.tx, built.spent); err != nil {
+		return nil, err
+	}
+	return w.sendTx(built.tx)
+}
+
+// parentFee is the fee the server reported for an unconfirmed transaction,
+// else its fee if it spends only wallet coins, else 0
+func (w *BtcElectrumWallet) parentFee(tx *wire.MsgTx, reported int64) (int64, error) {
+	if reported > 0 {
+		return reported, nil
+	}
+	stxos, err := w.txstore.Stxos().GetAll()
+	if err != nil {
+		return 0, err
+	}
+	txid := tx.TxHash()
+	var spent []wallet.Utxo
+	for _, s := range stxos {
+		if s.SpendTxid == txid {
+			spent = append(spent, s.Utxo)
+		}
+	}
+	fee, _ := walletFee(tx, spent)
+	return fee, nil
+}
+
+// txVsize is the virtual size of a transaction
+func txVsize(tx *wire.MsgTx) int {
+	weight := tx.SerializeSizeStripped()*3 + tx.SerializeSize()
+	return (weight + 3) / 4
+}
@@ -0,0 +1,81 @@
+package wltbtc
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"main/wallet"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/wire"
+)
+
+func TestBtcElectrumWallet_BumpFee(t *testing.T) {
+	w, _ := createTestWallet(t)
+	b := &mockBroadcaster{}
+	w.broadcaster = b
+	confirmed := fundTestWallet(t, w, 100000)
+	payee, _ := testPayee(t, w)
+
+	// an unconfirmed payment to the wallet with an unknown fee
+	script, _ := w.AddressToScript(w.CurrentAddress(wallet.EXTERNAL))
+	other, _ := chainhash.NewHashFromStr("b3c1ab4ac5a7dc1a2e24c8b29d4ed34d6a4a2d9b1c7b7f4ae0a50ba3c1d2e3f4")
+	incoming := wire.NewMsgTx(wire.TxVersion)
+	incoming.AddTxIn(wire.NewTxIn(wire.NewOutPoint(other, 1), nil, nil))
+	incoming.AddTxOut(wire.NewTxOut(50000, script))
+	if err := w.AddTransaction(incoming, 0, time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	txid, err := w.BumpFee(incoming.TxHash())
+	if err != nil {
+		t.Fatal(err)
+	}
+	child := b.tx
+	if *txid != child.TxHash() || len(child.TxIn) != 1 || child.TxIn[0].PreviousOutPoint.Hash != incoming.TxHash() ||
+		len(child.TxOut) != 1 {
+		t.Fatalf("Bumped with an incorrect child %v", child)
+	}
+	vsize, _ := EstimateTxVsize([][]byte{script}, nil, child.TxOut)
+	rate := int64(w.GetFeePerByte(wallet.FEE_BUMP))
+	if fee := 50000 - child.TxOut[0].Value; fee < rate*int64(txVsize(incoming)+vsize) {
+		t.Errorf("Child fee %d does not pay for the parent", fee)
+	}
+	if _, err = w.BumpFee(incoming.TxHash()); !errors.Is(err, wallet.ErrBumpFeeNotFound) {
+		t.Errorf("Bumped a spent output: %v", err)
+	}
+
+	// the fee already paid by a wallet spend counts towards the package
+	sent, err := w.Spend(40000, payee, wallet.ECONOMIC)
+	if err != nil {
+		t.Fatal(err)
+	}
+	parent := b.tx
+	if _, err = w.BumpFee(*sent); err != nil {
+		t.Fatal(err)
+	}
+	var change, paid int64
+	for _, out := range parent.TxOut {
+		paid += out.Value
+		if out.Value != 40000 {
+			change = out.Value
+		}
+	}
+	parentFee := 100000 - paid
+	changeScript := parent.TxOut[0].PkScript
+	if parent.TxOut[0].Value == 40000 {
+		changeScript = parent.TxOut[1].PkScript
+	}
+	vsize, _ = EstimateTxVsize([][]byte{changeScript}, nil, b.tx.TxOut)
+	packageFee := rate*int64(txVsize(parent)+vsize) - parentFee
+	if fee := change - b.tx.TxOut[0].Value; fee < packageFee || fee >= packageFee+int64(vsize) {
+		t.Errorf("Child fee %d, want %d", fee, packageFee)
+	}
+
+	if _, err = w.BumpFee(confirmed[0].Hash); !errors.Is(err, wallet.ErrBumpFeeConfirmed) {
+		t.Errorf("Bumped a confirmed transaction: %v", err)
+	}
+	if _, err = w.BumpFee(*other); err == nil {
+		t.Error("Bumped a transaction not in the wallet")
+	}
+}
@@ -0,0 +1,86 @@
+package wltbtc
+
+import (
+	"bytes"
+	"fmt"
+
+	"main/wallet"
+
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/wire"
+)
+
+// Coin control: the user freezes utxos, such as dust sent to link their
+// addresses, so they are not spent, and may choose the exact coins to spend.
+
+// ListUnspentOutputs returns the wallet utxos that are not watch only, with
+// the label of each output or else of its address and any proposal locking it
+func (w *BtcElectrumWallet) ListUnspentOutputs() ([]wallet.UnspentOutput, error) {
+	utxos, err := w.txstore.Utxos().GetAll()
+	if err != nil {
+		return nil, err
+	}
+	locked, err := w.lockedCoins()
+	if err != nil {
+		return nil, err
+	}
+	labels := w.txstore.Labels()
+	tip := w.ChainTip()
+	var coins []wallet.UnspentOutput
+	for _, u := range utxos {
+		if u.WatchOnly {
+			continue
+		}
+		coin := wallet.UnspentOutput{Utxo: u, LockedBy: locked[u.Op]}
+		if addr, err := w.ScriptToAddress(u.ScriptPubkey); err == nil {
+			coin.Address = addr
+		}
+		if label, err := labels.Get(wallet.LabelOutput, u.Op.String()); err == nil {
+			coin.Label = label.Label
+		} else if coin.Address != nil {
+			if label, err := labels.Get(wallet.LabelAddr, coin.Address.String()); err == nil {
+				coin.Label = label.Label
+			}
+		}
+		if u.AtHeight > 0 && tip >= u.AtHeight {
+			coin.Confirmations = tip - u.AtHeight + 1
+		}
+		coins = append(coins, coin)
+	}
+	return coins, nil
+}
+
+func (w *BtcElectrumWallet) FreezeCoin(op wire.OutPoint, frozen bool) error {
+	utxos, err := w.txstore.Utxos().GetAll()
+	if err != nil {
+		return err
+	}
+	for _, u := range utxos {
+		if u.Op == op && !u.WatchOnly {
+			return w.txstore.Utxos().SetFrozen(u, frozen)
+		}
+	}
+	return fmt.Errorf("coin %s not in wallet", op)
+}
+
+func (w *BtcElectrumWallet) FreezeAddress(addr btcutil.Address, frozen bool) (int, error) {
+	script, err := w.AddressToScript(addr)
+	if err != nil {
+		return 0, err
+	}
+	utxos, err := w.txstore.Utxos().GetAll()
+	if err != nil {
+		return 0, err
+	}
+	n := 0
+	for _, u := range utxos {
+		if u.WatchOnly || !bytes.Equal(u.ScriptPubkey, script) {
+			continue
+		}
+		if err := w.txstore.Utxos().SetFrozen(u, frozen); err != nil {
+			return n, err
+		}
+		n++
+	}
+	return n, nil
+}
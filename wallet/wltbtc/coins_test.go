@@ -0,0 +1,72 @@
+package wltbtc
+
+import (
+	"testing"
+	"time"
+
+	"main/wallet"
+)
+
+func TestBtcElectrumWallet_ListUnspentOutputs(t *testing.T) {
+	w, _ := createTestWallet(t)
+	addr := w.CurrentAddress(wallet.EXTERNAL)
+	ops := fundTestWallet(t, w, 100000, 546)
+	w.headers = testHeaders{12: time.Now()}
+	w.SetLabel(wallet.LabelAddr, addr.String(), "shop")
+	w.SetLabel(wallet.LabelOutput, ops[1].String(), "dust attack")
+	if err := w.FreezeCoin(ops[1], true); err != nil {
+		t.Fatal(err)
+	}
+
+	coins, err := w.ListUnspentOutputs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(coins) != 2 {
+		t.Fatalf("Returned %d coins", len(coins))
+	}
+	for _, coin := range coins {
+		if coin.Address.String() != addr.String() || coin.Confirmations != 3 {
+			t.Errorf("Returned incorrect coin %+v", coin)
+		}
+		switch coin.Op {
+		case ops[0]:
+			if coin.Frozen || coin.Label != "shop" {
+				t.Errorf("Returned incorrect coin %+v", coin)
+			}
+		case ops[1]:
+			if !coin.Frozen || coin.Label != "dust attack" {
+				t.Errorf("Returned incorrect coin %+v", coin)
+			}
+		}
+	}
+}
+
+func TestBtcElectrumWallet_FreezeAddress(t *testing.T) {
+	w, _ := createTestWallet(t)
+	addr := w.CurrentAddress(wallet.EXTERNAL)
+	fundTestWallet(t, w, 100000, 200000)
+
+	n, err := w.FreezeAddress(addr, true)
+	if err != nil || n != 2 {
+		t.Fatalf("Froze %d coins %v", n, err)
+	}
+	coins, _ := w.ListUnspentOutputs()
+	for _, coin := range coins {
+		if !coin.Frozen {
+			t.Errorf("Coin %s not frozen", coin.Op)
+		}
+	}
+	if n, err = w.FreezeAddress(addr, false); err != nil || n != 2 {
+		t.Fatalf("Unfroze %d coins %v", n, err)
+	}
+	coins, _ = w.ListUnspentOutputs()
+	for _, coin := range coins {
+		if coin.Frozen {
+			t.Errorf("Coin %s still frozen", coin.Op)
+		}
+	}
+	if n, _ = w.FreezeAddress(w.CurrentAddress(wallet.INTERNAL), true); n != 0 {
+		t.Errorf("Froze %d coins of an unused address", n)
+	}
+}
@@ -0,0 +1,174 @@
+package wltbtc
+
+import (
+	"bytes"
+	"io"
+
+	"main/wallet"
+
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+)
+
+// HistoryRecords returns the transactions selected by opts in block time
+// order for export with their labels
+func (w *BtcElectrumWallet) HistoryRecords(opts wallet.ExportOptions) ([]wallet.HistoryRecord, error) {
+	txns, err := w.Transactions()
+	if err != nil {
+		return nil, err
+	}
+	valued, err := wallet.ValueTransactions(txns, w.txstore.Prices(), w.headers, opts.Currency,
+		wallet.UnitsPerCoin(wallet.Bitcoin))
+	if err != nil {
+		return nil, err
+	}
+	utxos, err := w.txstore.Utxos().GetAll()
+	if err != nil {
+		return nil, err
+	}
+	stxos, err := w.txstore.Stxos().GetAll()
+	if err != nil {
+		return nil, err
+	}
+	labels, err := w.txstore.Labels().GetAll()
+	if err != nil {
+		return nil, err
+	}
+	txLabels := make(map[string]string)
+	for _, label := range labels {
+		if label.Type == wallet.LabelTx {
+			txLabels[label.Ref] = label.Label
+		}
+	}
+	// the wallet outputs of each transaction and the wallet coins it spent
+	ownOutputs := make(map[wire.OutPoint]bool)
+	for _, u := range utxos {
+		ownOutputs[u.Op] = true
+	}
+	spent := make(map[string][]wallet.Utxo)
+	for _, s := range stxos {
+		ownOutputs[s.Utxo.Op] = true
+		txid := s.SpendTxid.String()
+		spent[txid] = append(spent[txid], s.Utxo)
+	}
+
+	var records []wallet.HistoryRecord
+	for _, txn := range valued {
+		if !opts.Match(txn.Height, txn.BlockTime) {
+			continue
+		}
+		r := wallet.HistoryRecord{
+			Txid:          txn.Txid,
+			Height:        txn.Height,
+			BlockTime:     txn.BlockTime,
+			Confirmations: txn.Confirmations,
+			Status:        txn.Status,
+			Value:         txn.Value,
+			Fee:           txn.Fee,
+			Label:         txLabels[txn.Txid],
+		}
+		if txn.Priced() {
+			fiatValue := txn.FiatValue
+			r.Currency = txn.Currency
+			r.FiatValue = &fiatValue
+		}
+		tx := wire.NewMsgTx(wire.TxVersion)
+		if err := tx.BtcDecode(bytes.NewReader(txn.Bytes), wire.ProtocolVersion, wire.WitnessEncoding); err == nil {
+			if fee, ok := walletFee(tx, spent[txn.Txid]); ok {
+				r.Fee = fee
+			}
+			r.Counterparties = counterparties(tx, txn.Value, ownOutputs, w.params)
+		}
+		records = append(records, r)
+	}
+	return records, nil
+}
+
+// ExportHistory writes the transactions selected by opts and returns how
+// many were written
+func (w *BtcElectrumWallet) ExportHistory(out io.Writer, opts wallet.ExportOptions) (int, error) {
+	records, err := w.HistoryRecords(opts)
+	if err != nil {
+		return 0, err
+	}
+	return len(records), wallet.WriteHistory(out, records, opts.Format, opts.Currency)
+}
+
+// walletFee is the fee of a transaction funded only by wallet coins
+func walletFee(tx *wire.MsgTx, spent []wallet.Utxo) (int64, bool) {
+	if len(spent) == 0 || len(spent) != len(tx.TxIn) {
+		return 0, false
+	}
+	var fee int64
+	for _, u := range spent {
+		fee += u.Value
+	}
+	for _, out := range tx.TxOut {
+		fee -= out.Value
+	}
+	return fee, fee >= 0
+}
+
+// counterparties returns the addresses of the outputs not to the wallet when
+// the wallet sent coins, else the addresses of the inputs as far as they can
+// be told from the input scripts
+func counterparties(tx *wire.MsgTx, value int64, ownOutputs map[wire.OutPoint]bool, params *chaincfg.Params) []string {
+	var addrs []string
+	seen := make(map[string]bool)
+	add := func(addr btcutil.Address) {
+		if s := addr.String(); !seen[s] {
+			seen[s] = true
+			addrs = append(addrs, s)
+		}
+	}
+	if value < 0 {
+		txid := tx.TxHash()
+		for i, out := range tx.TxOut {
+			if ownOutputs[wire.OutPoint{Hash: txid, Index: uint32(i)}] {
+				continue
+			}
+			if addr, err := scriptToAddress(out.PkScript, params); err == nil {
+				add(addr)
+			}
+		}
+		return addrs
+	}
+	for _, in := range tx.TxIn {
+		if ownOutputs[in.PreviousOutPoint] {
+			continue
+		}
+		if addr := inputAddress(in, params); addr != nil {
+			add(addr)
+		}
+	}
+	return addrs
+}
+
+// inputAddress tells the address spent by a p2pkh, p2wpkh or p2sh-p2wpkh
+// input from its signature script and witness, or returns nil
+func inputAddress(in *wire.TxIn, params *chaincfg.Params) btcutil.Address {
+	pushes, err := txscript.PushedData(in.SignatureScript)
+	if err != nil {
+		return nil
+	}
+	switch {
+	case len(in.Witness) == 2 && len(in.Witness[1]) == 33 && len(pushes) == 0:
+		addr, err := btcutil.NewAddressWitnessPubKeyHash(btcutil.Hash160(in.Witness[1]), params)
+		if err == nil {
+			return addr
+		}
+	case len(in.Witness) == 2 && len(pushes) == 1 && len(pushes[0]) == 22:
+		addr, err := btcutil.NewAddressScriptHash(pushes[0], params)
+		if err == nil {
+			return addr
+		}
+	case len(in.Witness) == 0 && len(pushes) == 2 && (len(pushes[1]) == 33 || len(pushes[1]) == 65):
+		addr, err := btcutil.NewAddressPubKeyHash(btcutil.Hash160(pushes[1]), params)
+		if err == nil {
+			return addr
+		}
+	}
+	return nil
+}
@@ -0,0 +1,106 @@
+package wltbtc
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"main/wallet"
+
+	"github.com/btcsuite/btcd/btcec/v2"
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+)
+
+func TestHistoryRecords(t *testing.T) {
+	w, _ := createTestWallet(t)
+	params := &chaincfg.RegressionNetParams
+	day := func(s string) time.Time {
+		d, _ := time.Parse(wallet.PriceDateLayout, s)
+		return d
+	}
+	w.headers = testHeaders{10: day("2023-01-10"), 20: day("2023-06-10"), 25: day("2023-06-20")}
+	script, err := w.AddressToScript(w.CurrentAddress(wallet.EXTERNAL))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// received at 10 from a p2wpkh input
+	sender, _ := btcec.NewPrivateKey()
+	senderAddr, _ := btcutil.NewAddressWitnessPubKeyHash(btcutil.Hash160(sender.PubKey().SerializeCompressed()), params)
+	other, _ := chainhash.NewHashFromStr("a2d6fc5cbe6d43ddd1b36b2dba2e6b4d80e0a8e1cd5ad2d42a6a7f69f83b7b8d")
+	recv := wire.NewMsgTx(wire.TxVersion)
+	recv.AddTxIn(wire.NewTxIn(wire.NewOutPoint(other, 0), nil,
+		wire.TxWitness{make([]byte, 71), sender.PubKey().SerializeCompressed()}))
+	recv.AddTxOut(wire.NewTxOut(1000000, script))
+	recvHash := recv.TxHash()
+
+	// sent at 20 to a payee with change and a 10000 fee
+	payee, _ := btcutil.NewAddressPubKeyHash(make([]byte, 20), params)
+	payeeScript, _ := txscript.PayToAddrScript(payee)
+	spend := wire.NewMsgTx(wire.TxVersion)
+	spend.AddTxIn(wire.NewTxIn(wire.NewOutPoint(&recvHash, 0), nil, nil))
+	spend.AddTxOut(wire.NewTxOut(590000, payeeScript))
+	spend.AddTxOut(wire.NewTxOut(400000, script))
+
+	if err = w.AddTransaction(recv, 10, day("2024-01-01")); err != nil {
+		t.Fatal(err)
+	}
+	if err = w.AddTransaction(spend, 20, day("2024-01-01")); err != nil {
+		t.Fatal(err)
+	}
+	w.HistoricalPrices().Put(day("2023-01-01"), "USD", 20000)
+	if err = w.SetLabel(wallet.LabelTx, spend.TxHash().String(), "rent"); err != nil {
+		t.Fatal(err)
+	}
+
+	records, err := w.HistoryRecords(wallet.ExportOptions{Currency: "usd"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 2 {
+		t.Fatalf("%d records", len(records))
+	}
+	r := records[0]
+	if r.Txid != recvHash.String() || r.Value != 1000000 || r.Fee != 0 || r.Confirmations != 16 ||
+		r.Status != wallet.StatusConfirmed || !r.BlockTime.Equal(day("2023-01-10")) ||
+		len(r.Counterparties) != 1 || r.Counterparties[0] != senderAddr.String() ||
+		r.FiatValue == nil || *r.FiatValue != 200 {
+		t.Errorf("receive %+v", r)
+	}
+	r = records[1]
+	if r.Txid != spend.TxHash().String() || r.Value != -600000 || r.Fee != 10000 || r.Confirmations != 6 ||
+		r.Label != "rent" || len(r.Counterparties) != 1 || r.Counterparties[0] != payee.String() {
+		t.Errorf("send %+v", r)
+	}
+
+	for _, tt := range []struct {
+		opts wallet.ExportOptions
+		want int
+	}{
+		{wallet.ExportOptions{From: day("2023-02-01")}, 1},
+		{wallet.ExportOptions{Until: day("2023-02-01")}, 1},
+		{wallet.ExportOptions{FromHeight: 11, ToHeight: 19}, 0},
+		{wallet.ExportOptions{ToHeight: 20}, 2},
+	} {
+		records, err := w.HistoryRecords(tt.opts)
+		if err != nil || len(records) != tt.want {
+			t.Errorf("%+v: %d records %v", tt.opts, len(records), err)
+		}
+	}
+
+	var b bytes.Buffer
+	n, err := w.ExportHistory(&b, wallet.ExportOptions{Format: wallet.ExportCSV, FromHeight: 20})
+	if err != nil || n != 1 {
+		t.Fatalf("exported %d %v", n, err)
+	}
+	if lines := strings.Split(strings.TrimSpace(b.String()), "\n"); len(lines) != 2 ||
+		!strings.HasPrefix(lines[1], spend.TxHash().String()+",20,2023-06-10T00:00:00Z,6,CONFIRMED,-0.00600000,0.00010000,") ||
+		!strings.HasSuffix(lines[1], ",rent") {
+		t.Errorf("csv export:\n%s", b.String())
+	}
+}
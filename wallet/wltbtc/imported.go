@@ -0,0 +1,124 @@
+package wltbtc
+
+import (
+	"errors"
+
+	"github.com/btcsuite/btcd/btcutil"
+)
+
+// Imported keys are loose private keys that are not part of the HD keychain.
+// They are stored WIF encoded in the encrypted storage blob and held in memory
+// by the key manager once the wallet is loaded.
+
+// loadImported decodes the imported keys from the decrypted storage into the
+// key manager.
+func (w *BtcElectrumWallet) loadImported() error {
+	for _, s := range w.storageManager.store.Imported {
+		wif, err := btcutil.DecodeWIF(s)
+		if err != nil {
+			return err
+		}
+		w.keyManager.addImported(wif)
+	}
+	return nil
+}
+
+// ImportKey imports a WIF encoded private key into the encrypted storage and
+// starts watching its P2PKH and P2WPKH addresses, or only its P2PKH address
+// for an uncompressed key.
+func (w *BtcElectrumWallet) ImportKey(wifStr string, pw string) error {
+	wif, err := btcutil.DecodeWIF(wifStr)
+	if err != nil {
+		return err
+	}
+	if !wif.IsForNet(w.params) {
+		return errors.New("key is for the wrong network")
+	}
+	pkHash := btcutil.Hash160(wif.SerializePubKey())
+
+	w.lock()
+	defer w.unlock()
+
+	if w.keyManager.getImported(pkHash) != nil {
+		return errors.New("key already imported")
+	}
+	if _, err := w.keyManager.datastore.GetPathForKey(pkHash); err == nil {
+		return errors.New("key is already part of the wallet keychain")
+	}
+	sm := w.storageManager
+	if err := sm.CheckPassword(pw); err != nil {
+		return err
+	}
+	prev := sm.store.Imported
+	sm.store.Imported = append(append([]string{}, prev...), wif.String())
+	if err := sm.Put(pw); err != nil {
+		sm.store.Imported = prev
+		return err
+	}
+
+	w.keyManager.addImported(wif)
+	return w.txstore.PopulateAdrs()
+}
+
+// ListImported returns the P2PKH and P2WPKH addresses of all imported keys
+func (w *BtcElectrumWallet) ListImported() []btcutil.Address {
+	return w.keyManager.GetImportedAddresses()
+}
+
+// DeleteImported removes the imported key for addr from the encrypted storage.
+// Utxos still held by the key are kept but made watch only.
+func (w *BtcElectrumWallet) DeleteImported(addr btcutil.Address, pw string) error {
+	pkHash := addr.ScriptAddress()
+
+	w.lock()
+	defer w.unlock()
+
+	wif := w.keyManager.getImported(pkHash)
+	if wif == nil {
+		return errors.New("no imported key for address")
+	}
+
+	sm := w.storageManager
+	if err := sm.CheckPassword(pw); err != nil {
+		return err
+	}
+	prev := sm.store.Imported
+	var remaining []string
+	for _, s := range prev {
+		if s != wif.String() {
+			remaining = append(remaining, s)
+		}
+	}
+	sm.store.Imported = remaining
+	if err := sm.Put(pw); err != nil {
+		sm.store.Imported = prev
+		return err
+	}
+
+	w.keyManager.removeImported(pkHash)
+
+	addrs, err := importedAddresses(wif, w.params)
+	if err != nil {
+		return err
+	}
+	scripts := make(map[string]bool, len(addrs))
+	for _, a := range addrs {
+		script, err := w.AddressToScript(a)
+		if err != nil {
+			return err
+		}
+		scripts[string(script)] = true
+	}
+	utxos, err := w.txstore.Utxos().GetAll()
+	if err != nil {
+		return err
+	}
+	for _, u := range utxos {
+		if scripts[string(u.ScriptPubkey)] {
+			if err := w.txstore.Utxos().SetWatchOnly(u); err != nil {
+				return err
+			}
+		}
+	}
+	return w.txstore.PopulateAdrs()
+}
@@ -0,0 +1,182 @@
+package wltbtc
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"main/wallet"
+
+	"github.com/btcsuite/btcd/btcec/v2"
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+)
+
+func TestImportKey(t *testing.T) {
+	w, _ := createTestWallet(t)
+
+	priv, err := btcec.NewPrivateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	wif, err := btcutil.NewWIF(priv, w.params, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := w.ImportKey(wif.String(), "wrong"); err == nil {
+		t.Fatal("imported key with wrong password")
+	}
+	mainWif, _ := btcutil.NewWIF(priv, &chaincfg.MainNetParams, true)
+	if err := w.ImportKey(mainWif.String(), pw); err == nil {
+		t.Fatal("imported key for wrong network")
+	}
+	if err := w.ImportKey(wif.String(), pw); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.ImportKey(wif.String(), pw); err == nil {
+		t.Fatal("imported key twice")
+	}
+
+	imported := w.ListImported()
+	if len(imported) != 2 {
+		t.Fatalf("expected 2 imported addresses, got %d", len(imported))
+	}
+	n := len(w.ListAddresses())
+	if n != LOOKAHEADWINDOW*2+2 {
+		t.Fatalf("ListAddresses returned %d addresses", n)
+	}
+	for _, addr := range imported {
+		if !w.HasKey(addr) {
+			t.Fatalf("no key for imported address %s", addr)
+		}
+		key, err := w.GetKey(addr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !key.Key.Equals(&priv.Key) {
+			t.Fatal("wrong imported key returned")
+		}
+	}
+
+	// The key survives a reload of the encrypted storage
+	sm := NewStorageManager(w.storageManager.datastore, w.params)
+	if err := sm.Get(pw); err != nil {
+		t.Fatal(err)
+	}
+	if len(sm.store.Imported) != 1 || sm.store.Imported[0] != wif.String() {
+		t.Fatal("imported key not in encrypted storage")
+	}
+
+	// Coins received by the segwit address count in the balance
+	script, _ := txscript.PayToAddrScript(imported[1])
+	h, _ := chainhash.NewHashFromStr("a2d6fc5cbe6d43ddd1b36b2dba2e6b4d80e0a8e1cd5ad2d42a6a7f69f83b7b8d")
+	tx := wire.NewMsgTx(wire.TxVersion)
+	tx.AddTxIn(wire.NewTxIn(wire.NewOutPoint(h, 0), nil, nil))
+	tx.AddTxOut(wire.NewTxOut(50000, script))
+	if _, err := w.txstore.Ingest(tx, 10, time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	confirmed, _ := w.Balance()
+	if confirmed != 50000 {
+		t.Fatalf("imported key utxo not in balance: %d", confirmed)
+	}
+
+	// Deleting makes the coins watch only
+	if err := w.DeleteImported(imported[0], "wrong"); err == nil {
+		t.Fatal("deleted key with wrong password")
+	}
+	if err := w.DeleteImported(imported[0], pw); err != nil {
+		t.Fatal(err)
+	}
+	if len(w.ListImported()) != 0 {
+		t.Fatal("imported key not deleted")
+	}
+	if w.HasKey(imported[1]) {
+		t.Fatal("deleted key still in wallet")
+	}
+	confirmed, _ = w.Balance()
+	if confirmed != 0 {
+		t.Fatal("deleted key utxo still in balance")
+	}
+	sm = NewStorageManager(w.storageManager.datastore, w.params)
+	if err := sm.Get(pw); err != nil {
+		t.Fatal(err)
+	}
+	if len(sm.store.Imported) != 0 {
+		t.Fatal("deleted key still in encrypted storage")
+	}
+}
+
+func TestImportKeyUncompressed(t *testing.T) {
+	w, _ := createTestWallet(t)
+	w.broadcaster = &mockBroadcaster{}
+	priv, _ := btcec.NewPrivateKey()
+	wif, _ := btcutil.NewWIF(priv, w.params, false)
+	if err := w.ImportKey(wif.String(), pw); err != nil {
+		t.Fatal(err)
+	}
+	imported := w.ListImported()
+	want, _ := btcutil.NewAddressPubKeyHash(btcutil.Hash160(priv.PubKey().SerializeUncompressed()), w.params)
+	if len(imported) != 1 || imported[0].String() != want.String() {
+		t.Fatalf("imported addresses %v", imported)
+	}
+
+	// its coins are spent with the uncompressed key
+	script, _ := txscript.PayToAddrScript(imported[0])
+	h, _ := chainhash.NewHashFromStr("a2d6fc5cbe6d43ddd1b36b2dba2e6b4d80e0a8e1cd5ad2d42a6a7f69f83b7b8d")
+	tx := wire.NewMsgTx(wire.TxVersion)
+	tx.AddTxIn(wire.NewTxIn(wire.NewOutPoint(h, 0), nil, nil))
+	tx.AddTxOut(wire.NewTxOut(50000, script))
+	if _, err := w.txstore.Ingest(tx, 10, time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	payee, _ := testPayee(t, w)
+	fundTxid := tx.TxHash()
+	res, err := w.SpendMany([]wallet.TransactionOutput{{Address: payee, Value: 20000}}, wallet.NORMAL,
+		wallet.SpendOptions{Coins: []wire.OutPoint{*wire.NewOutPoint(&fundTxid, 0)}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if actual := int64(res.Tx.SerializeSize()); res.Vsize < actual {
+		t.Errorf("vsize estimate %d below the actual %d", res.Vsize, actual)
+	}
+
+	sig, err := w.SignMessage(imported[0], "hello")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ok, _ := w.VerifyMessage(imported[0], sig, "hello"); !ok {
+		t.Error("message signed with the uncompressed key does not verify")
+	}
+}
+
+func TestImportKeyConcurrent(t *testing.T) {
+	w, _ := createTestWallet(t)
+	priv, _ := btcec.NewPrivateKey()
+	wif, _ := btcutil.NewWIF(priv, w.params, true)
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 4)
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs <- w.ImportKey(wif.String(), pw)
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	imported := 0
+	for err := range errs {
+		if err == nil {
+			imported++
+		}
+	}
+	if imported != 1 || len(w.storageManager.store.Imported) != 1 {
+		t.Fatalf("key imported %d times, %d stored", imported, len(w.storageManager.store.Imported))
+	}
+}
@@ -1,11 +1,14 @@
 package wltbtc
 
 import (
+	"encoding/hex"
 	"errors"
+	"sync"
 
 	"main/client"
 	"main/wallet"
 
+	"github.com/btcsuite/btcd/btcutil"
 	hd "github.com/btcsuite/btcd/btcutil/hdkeychain"
 	"github.com/btcsuite/btcd/chaincfg"
 )
@@ -19,6 +22,11 @@ type KeyManager struct {
 
 	internalKey *hd.ExtendedKey
 	externalKey *hd.ExtendedKey
+
+	// Loose keys not part of the keychain keyed by hex hash160 of the public
+	// key. They are persisted in the encrypted storage, not the datastore.
+	importedMtx sync.RWMutex
+	imported    map[string]*btcutil.WIF
 }
 
 func NewKeyManager(db wallet.Keys, params *chaincfg.Params, masterPrivKey *hd.ExtendedKey) (*KeyManager, error) {
@@ -31,6 +39,7 @@ func NewKeyManager(db wallet.Keys, params *chaincfg.Params, masterPrivKey *hd.Ex
 		params:      params,
 		internalKey: internal,
 		externalKey: external,
+		imported:    make(map[string]*btcutil.WIF),
 	}
 	if err := km.lookahead(); err != nil {
 		return nil, err
@@ -129,25 +138,23 @@ func (km *KeyManager) GetKeys() []*hd.ExtendedKey {
 }
 
 func (km *KeyManager) GetKeyForScript(scriptAddress []byte) (*hd.ExtendedKey, error) {
-	// keyPath, err := km.datastore.GetPathForKey(scriptAddress)
-	// if err != nil {
-	// 	key, err := km.datastore.GetKey(scriptAddress)
-	// 	if err != nil {
-	// 		return nil, err
-	// 	}
-	// 		hdKey := hd.NewExtendedKey(
-	// 			km.params.HDPrivateKeyID[:],
-	// 			key.Serialize(),
-	// 			make([]byte, 32),
-	// 			[]byte{0x00, 0x00, 0x00, 0x00},
-	// 			0,
-	// 			0,
-	// 			true)
-	// 		return hdKey, nil
-	// 	}
-	// return km.generateChildKey(keyPath.Purpose, uint32(keyPath.Index))
-
-	return nil, wallet.ErrKeyImportNotImplemented
+	keyPath, err := km.datastore.GetPathForKey(scriptAddress)
+	if err == nil {
+		return km.generateChildKey(keyPath.Purpose, uint32(keyPath.Index))
+	}
+	wif := km.getImported(scriptAddress)
+	if wif == nil {
+		return nil, errors.New("key not found")
+	}
+	hdKey := hd.NewExtendedKey(
+		km.params.HDPrivateKeyID[:],
+		wif.PrivKey.Serialize(),
+		make([]byte, 32),
+		[]byte{0x00, 0x00, 0x00, 0x00},
+		0,
+		0,
+		true)
+	return hdKey, nil
 }
 
 // Mark the given key as used and extend the lookahead window
@@ -181,3 +188,63 @@ func (km *KeyManager) lookahead() error {
 	}
 	return nil
 }
+
+// importedAddresses returns the P2PKH and P2WPKH addresses of an imported key.
+// An uncompressed key only has a P2PKH address as segwit needs compressed
+// keys.
+func importedAddresses(wif *btcutil.WIF, params *chaincfg.Params) ([]btcutil.Address, error) {
+	pkHash := btcutil.Hash160(wif.SerializePubKey())
+	p2pkh, err := btcutil.NewAddressPubKeyHash(pkHash, params)
+	if err != nil {
+		return nil, err
+	}
+	if !wif.CompressPubKey {
+		return []btcutil.Address{p2pkh}, nil
+	}
+	p2wpkh, err := btcutil.NewAddressWitnessPubKeyHash(pkHash, params)
+	if err != nil {
+		return nil, err
+	}
+	return []btcutil.Address{p2pkh, p2wpkh}, nil
+}
+
+func (km *KeyManager) addImported(wif *btcutil.WIF) {
+	pkHash := btcutil.Hash160(wif.SerializePubKey())
+	km.importedMtx.Lock()
+	km.imported[hex.EncodeToString(pkHash)] = wif
+	km.importedMtx.Unlock()
+}
+
+func (km *KeyManager) removeImported(scriptAddress []byte) {
+	km.importedMtx.Lock()
+	delete(km.imported, hex.EncodeToString(scriptAddress))
+	km.importedMtx.Unlock()
+}
+
+func (km *KeyManager) getImported(scriptAddress []byte) *btcutil.WIF {
+	km.importedMtx.RLock()
+	defer km.importedMtx.RUnlock()
+	return km.imported[hex.EncodeToString(scriptAddress)]
+}
+
+// uncompressed reports whether the key of scriptAddress is an imported
+// uncompressed key, whose signatures carry the 65 byte public key
+func (km *KeyManager) uncompressed(scriptAddress []byte) bool {
+	wif := km.getImported(scriptAddress)
+	return wif != nil && !wif.CompressPubKey
+}
+
+// GetImportedAddresses returns the addresses of all imported keys
+func (km *KeyManager) GetImportedAddresses() []btcutil.Address {
+	km.importedMtx.RLock()
+	defer km.importedMtx.RUnlock()
+	var addrs []btcutil.Address
+	for _, wif := range km.imported {
+		a, err := importedAddresses(wif, km.params)
+		if err != nil {
+			continue
+		}
+		addrs = append(addrs, a...)
+	}
+	return addrs
+}
@@ -11,7 +11,6 @@ import (
 	"github.com/btcsuite/btcd/btcutil"
 	"github.com/btcsuite/btcd/btcutil/hdkeychain"
 	"github.com/btcsuite/btcd/chaincfg"
-	"github.com/btcsuite/btcd/txscript"
 )
 
 func createKeyManager() (*KeyManager, error) {
@@ -238,11 +237,6 @@ func TestKeyManager_GetKeys(t *testing.T) {
 }
 
 func TestKeyManager_GetKeyForScript(t *testing.T) {
-	t.Log(wallet.ErrKeyImportNotImplemented)
-	if true {
-		return
-	}
-	// Old test
 	masterPrivKey, err := hdkeychain.NewKeyFromString("xprv9s21ZrQH143K25QhxbucbDDuQ4naNntJRi4KUfWT7xo4EKsHt2QJDu7KXp1A3u7Bi1j8ph3EGsZ9Xvz9dGuVrtHHs7pXeTzjuxBrCmmhgC6")
 	if err != nil {
 		t.Error(err)
@@ -274,21 +268,15 @@ func TestKeyManager_GetKeyForScript(t *testing.T) {
 	if err != nil {
 		t.Error(err)
 	}
-	importAddr, err := key.Address(&chaincfg.MainNetParams)
-	if err != nil {
-		t.Error(err)
-	}
-	importScript, err := txscript.PayToAddrScript(importAddr)
+	wif, err := btcutil.NewWIF(importKey, &chaincfg.MainNetParams, true)
 	if err != nil {
 		t.Error(err)
 	}
-	// err = km.datastore.ImportKey(importScript, importKey)
-	// if err != nil {
-	// 	t.Error(err)
-	// }
+	km.addImported(wif)
+	importScript := btcutil.Hash160(importKey.PubKey().SerializeCompressed())
 	retKey, err := km.GetKeyForScript(importScript)
 	if err != nil {
-		t.Error(err)
+		t.Fatal(err)
 	}
 	retECKey, err := retKey.ECPrivKey()
 	if err != nil {
@@ -297,4 +285,12 @@ func TestKeyManager_GetKeyForScript(t *testing.T) {
 	if !bytes.Equal(retECKey.Serialize(), importKey.Serialize()) {
 		t.Error("Failed to return imported key")
 	}
+	if len(km.GetImportedAddresses()) != 2 {
+		t.Error("Returned incorrect number of imported addresses")
+	}
+	km.removeImported(importScript)
+	_, err = km.GetKeyForScript(importScript)
+	if err == nil {
+		t.Error("Returned removed imported key")
+	}
 }
@@ -0,0 +1,37 @@
+package wltbtc
+
+import (
+	"io"
+
+	"main/wallet"
+)
+
+func (w *BtcElectrumWallet) SetLabel(labelType wallet.LabelType, ref string, label string) error {
+	if err := wallet.ValidateLabelRef(labelType, ref, w.params); err != nil {
+		return err
+	}
+	if label == "" {
+		return w.txstore.Labels().Delete(labelType, ref)
+	}
+	return w.txstore.Labels().Put(wallet.Label{Type: labelType, Ref: ref, Label: label})
+}
+
+func (w *BtcElectrumWallet) Label(labelType wallet.LabelType, ref string) string {
+	label, err := w.txstore.Labels().Get(labelType, ref)
+	if err != nil {
+		return ""
+	}
+	return label.Label
+}
+
+func (w *BtcElectrumWallet) Labels() ([]wallet.Label, error) {
+	return w.txstore.Labels().GetAll()
+}
+
+func (w *BtcElectrumWallet) ImportLabels(r io.Reader) (int, error) {
+	return wallet.ImportLabels(w.txstore.Labels(), r, w.params)
+}
+
+func (w *BtcElectrumWallet) ExportLabels(out io.Writer) (int, error) {
+	return wallet.ExportLabels(w.txstore.Labels(), out)
+}
@@ -0,0 +1,46 @@
+package wltbtc
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"main/wallet"
+)
+
+func TestBtcElectrumWallet_SetLabel(t *testing.T) {
+	w, _ := createTestWallet(t)
+	addr := w.CurrentAddress(wallet.EXTERNAL).String()
+	if err := w.SetLabel(wallet.LabelAddr, addr, "donations"); err != nil {
+		t.Fatal(err)
+	}
+	if label := w.Label(wallet.LabelAddr, addr); label != "donations" {
+		t.Errorf("Returned incorrect label %q", label)
+	}
+	if err := w.SetLabel(wallet.LabelAddr, "bc1q34aq5drpuwy3wgl9lhup9892qp6svr8ldzyy7c", "mainnet"); err == nil {
+		t.Error("Labelled an address of another network")
+	}
+	if err := w.SetLabel(wallet.LabelOutput, "abc:0", "bad"); err == nil {
+		t.Error("Labelled an invalid outpoint")
+	}
+
+	var b bytes.Buffer
+	n, err := w.ExportLabels(&b)
+	if err != nil || n != 1 {
+		t.Fatalf("Exported %d labels %v", n, err)
+	}
+	if err = w.SetLabel(wallet.LabelAddr, addr, ""); err != nil {
+		t.Fatal(err)
+	}
+	if label := w.Label(wallet.LabelAddr, addr); label != "" {
+		t.Errorf("Failed to remove label %q", label)
+	}
+	n, err = w.ImportLabels(strings.NewReader(b.String()))
+	if err != nil || n != 1 || w.Label(wallet.LabelAddr, addr) != "donations" {
+		t.Errorf("Imported %d labels %v", n, err)
+	}
+	labels, err := w.Labels()
+	if err != nil || len(labels) != 1 {
+		t.Errorf("Returned %d labels %v", len(labels), err)
+	}
+}
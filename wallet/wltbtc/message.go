@@ -0,0 +1,88 @@
+package wltbtc
+
+import (
+	"bytes"
+	"errors"
+
+	"github.com/btcsuite/btcd/btcec/v2/ecdsa"
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+)
+
+// Messages are signed as by Electrum and Bitcoin Core: a compact recoverable
+// signature of the double sha256 of the prefixed message. Electrum uses the
+// same compressed key header byte for legacy and segwit addresses and checks
+// the address against each script type of the recovered key.
+
+const messageMagic = "Bitcoin Signed Message:\n"
+
+func messageHash(message string) []byte {
+	var buf bytes.Buffer
+	wire.WriteVarString(&buf, 0, messageMagic)
+	wire.WriteVarString(&buf, 0, message)
+	return chainhash.DoubleHashB(buf.Bytes())
+}
+
+// SignMessage signs a message with the key of a wallet address. The signature
+// is 65 bytes, usually shown base64 encoded.
+func (w *BtcElectrumWallet) SignMessage(addr btcutil.Address, message string) ([]byte, error) {
+	key, err := w.GetKey(addr)
+	if err != nil {
+		return nil, err
+	}
+	return ecdsa.SignCompact(key, messageHash(message), !w.keyManager.uncompressed(addr.ScriptAddress()))
+}
+
+// VerifyMessage checks a message signature was made by the key of an address
+func (w *BtcElectrumWallet) VerifyMessage(addr btcutil.Address, sig []byte, message string) (bool, error) {
+	return verifyMessage(addr, sig, message, w.params)
+}
+
+func verifyMessage(addr btcutil.Address, sig []byte, message string, params *chaincfg.Params) (bool, error) {
+	if len(sig) != 65 {
+		return false, errors.New("invalid signature length")
+	}
+	pubKey, compressed, err := ecdsa.RecoverCompact(sig, messageHash(message))
+	if err != nil {
+		return false, nil
+	}
+	var serialized []byte
+	if compressed {
+		serialized = pubKey.SerializeCompressed()
+	} else {
+		serialized = pubKey.SerializeUncompressed()
+	}
+	pkHash := btcutil.Hash160(serialized)
+
+	var candidates []btcutil.Address
+	p2pkh, err := btcutil.NewAddressPubKeyHash(pkHash, params)
+	if err != nil {
+		return false, err
+	}
+	candidates = append(candidates, p2pkh)
+	if compressed {
+		p2wpkh, err := btcutil.NewAddressWitnessPubKeyHash(pkHash, params)
+		if err != nil {
+			return false, err
+		}
+		candidates = append(candidates, p2wpkh)
+		redeem, err := txscript.PayToAddrScript(p2wpkh)
+		if err != nil {
+			return false, err
+		}
+		p2sh, err := btcutil.NewAddressScriptHash(redeem, params)
+		if err != nil {
+			return false, err
+		}
+		candidates = append(candidates, p2sh)
+	}
+	for _, c := range candidates {
+		if c.EncodeAddress() == addr.EncodeAddress() {
+			return true, nil
+		}
+	}
+	return false, nil
+}
@@ -0,0 +1,56 @@
+package wltbtc
+
+import (
+	"testing"
+
+	"main/wallet"
+
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/txscript"
+)
+
+func TestSignMessage(t *testing.T) {
+	w, _ := createTestWallet(t)
+	addr := w.CurrentAddress(wallet.EXTERNAL)
+	sig, err := w.SignMessage(addr, "hello goele")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sig) != 65 {
+		t.Fatalf("signature length %d", len(sig))
+	}
+	ok, err := w.VerifyMessage(addr, sig, "hello goele")
+	if err != nil || !ok {
+		t.Fatalf("signature did not verify: %v", err)
+	}
+	if ok, _ = w.VerifyMessage(addr, sig, "hello goele!"); ok {
+		t.Fatal("verified a different message")
+	}
+	other := w.NewAddress(wallet.EXTERNAL)
+	if ok, _ = w.VerifyMessage(other, sig, "hello goele"); ok {
+		t.Fatal("verified against another address")
+	}
+	if _, err = w.VerifyMessage(addr, sig[1:], "hello goele"); err == nil {
+		t.Fatal("verified a short signature")
+	}
+
+	// the same key verifies for its legacy and nested segwit addresses
+	key, err := w.GetKey(addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pkHash := btcutil.Hash160(key.PubKey().SerializeCompressed())
+	p2pkh, _ := btcutil.NewAddressPubKeyHash(pkHash, w.params)
+	p2wpkh, _ := btcutil.NewAddressWitnessPubKeyHash(pkHash, w.params)
+	redeem, _ := txscript.PayToAddrScript(p2wpkh)
+	p2sh, _ := btcutil.NewAddressScriptHash(redeem, w.params)
+	for _, a := range []btcutil.Address{p2pkh, p2wpkh, p2sh} {
+		if ok, _ = w.VerifyMessage(a, sig, "hello goele"); !ok {
+			t.Fatalf("signature did not verify for %s", a)
+		}
+	}
+
+	if _, err = w.SignMessage(p2pkh, "legacy"); err != nil {
+		t.Fatal("cannot sign with the legacy address of a wallet key:", err)
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"errors"
 	"sort"
 	"strconv"
+	"strings"
 	"testing"
 	"time"
 
@@ -17,12 +18,39 @@ import (
 )
 
 type MockDatastore struct {
+	cfg            wallet.Cfg
 	enc            wallet.Enc
 	keys           wallet.Keys
 	utxos          wallet.Utxos
 	stxos          wallet.Stxos
 	txns           wallet.Txns
 	watchedScripts wallet.WatchedScripts
+	status         wallet.Status
+	history        wallet.History
+	prices         wallet.Prices
+	labels         wallet.Labels
+	proposals      wallet.Proposals
+}
+
+func NewMockDatastore() *MockDatastore {
+	return &MockDatastore{
+		cfg:            &mockCfg{},
+		enc:            &mockStorage{},
+		keys:           &mockKeyStore{make(map[string]*keyStoreEntry)},
+		utxos:          &mockUtxoStore{make(map[string]*wallet.Utxo)},
+		stxos:          &mockStxoStore{make(map[string]*wallet.Stxo)},
+		txns:           &mockTxnStore{make(map[string]*wallet.Txn)},
+		watchedScripts: &mockWatchedScriptsStore{make(map[string][]byte)},
+		status:         &mockStatusStore{make(map[string]string)},
+		history:        &mockHistoryStore{make(map[string][]wallet.HistoryEntry)},
+		prices:         &mockPricesStore{make(map[string]float64)},
+		labels:         &mockLabelsStore{make(map[string]wallet.Label)},
+		proposals:      &mockProposalsStore{make(map[string]wallet.TxProposal)},
+	}
+}
+
+func (m *MockDatastore) Cfg() wallet.Cfg {
+	return m.cfg
 }
 
 func (m *MockDatastore) Enc() wallet.Enc {
@@ -45,10 +73,43 @@ func (m *MockDatastore) Txns() wallet.Txns {
 	return m.txns
 }
 
+func (m *MockDatastore) Status() wallet.Status {
+	return m.status
+}
+
+func (m *MockDatastore) History() wallet.History {
+	return m.history
+}
+
+func (m *MockDatastore) Prices() wallet.Prices {
+	return m.prices
+}
+
+func (m *MockDatastore) Labels() wallet.Labels {
+	return m.labels
+}
+
+func (m *MockDatastore) Proposals() wallet.Proposals {
+	return m.proposals
+}
+
 func (m *MockDatastore) WatchedScripts() wallet.WatchedScripts {
 	return m.watchedScripts
 }
 
+type mockCfg struct {
+	creationDate time.Time
+}
+
+func (m *mockCfg) PutCreationDate(date time.Time) error {
+	m.creationDate = date
+	return nil
+}
+
+func (m *mockCfg) GetCreationDate() (time.Time, error) {
+	return m.creationDate, nil
+}
+
 // encrypted blob
 type mockStorage struct {
 	blob []byte
@@ -203,6 +264,9 @@ type mockUtxoStore struct {
 
 func (m *mockUtxoStore) Put(utxo wallet.Utxo) error {
 	key := utxo.Op.Hash.String() + ":" + strconv.Itoa(int(utxo.Op.Index))
+	if u, ok := m.utxos[key]; ok {
+		utxo.Frozen = u.Frozen
+	}
 	m.utxos[key] = &utxo
 	return nil
 }
@@ -225,6 +289,16 @@ func (m *mockUtxoStore) SetWatchOnly(utxo wallet.Utxo) error {
 	return nil
 }
 
+func (m *mockUtxoStore) SetFrozen(utxo wallet.Utxo, frozen bool) error {
+	key := utxo.Op.Hash.String() + ":" + strconv.Itoa(int(utxo.Op.Index))
+	u, ok := m.utxos[key]
+	if !ok {
+		return errors.New("not found")
+	}
+	u.Frozen = frozen
+	return nil
+}
+
 func (m *mockUtxoStore) Delete(utxo wallet.Utxo) error {
 	key := utxo.Op.Hash.String() + ":" + strconv.Itoa(int(utxo.Op.Index))
 	_, ok := m.utxos[key]
@@ -265,10 +339,10 @@ type mockTxnStore struct {
 	txns map[string]*wallet.Txn
 }
 
-func (m *mockTxnStore) Put(raw []byte, txid string, value, height int, timestamp time.Time, watchOnly bool) error {
+func (m *mockTxnStore) Put(raw []byte, txid string, value int64, height int, timestamp time.Time, watchOnly bool) error {
 	m.txns[txid] = &wallet.Txn{
 		Txid:      txid,
-		Value:     int64(value),
+		Value:     value,
 		Height:    int64(height),
 		Timestamp: timestamp,
 		WatchOnly: watchOnly,
@@ -349,6 +423,194 @@ func (m *mockWatchedScriptsStore) Delete(scriptPubKey []byte) error {
 	return nil
 }
 
+type mockStatusStore struct {
+	status map[string]string
+}
+
+func (m *mockStatusStore) Put(scripthash string, status string) error {
+	m.status[scripthash] = status
+	return nil
+}
+
+func (m *mockStatusStore) Get(scripthash string) (string, error) {
+	status, ok := m.status[scripthash]
+	if !ok {
+		return "", errors.New("not found")
+	}
+	return status, nil
+}
+
+func (m *mockStatusStore) GetAll() (map[string]string, error) {
+	ret := make(map[string]string, len(m.status))
+	for k, v := range m.status {
+		ret[k] = v
+	}
+	return ret, nil
+}
+
+func (m *mockStatusStore) Delete(scripthash string) error {
+	_, ok := m.status[scripthash]
+	if !ok {
+		return errors.New("not found")
+	}
+	delete(m.status, scripthash)
+	return nil
+}
+
+type mockHistoryStore struct {
+	history map[string][]wallet.HistoryEntry
+}
+
+func (m *mockHistoryStore) Put(scripthash string, history []wallet.HistoryEntry) error {
+	m.history[scripthash] = append([]wallet.HistoryEntry{}, history...)
+	return nil
+}
+
+func (m *mockHistoryStore) Get(scripthash string) ([]wallet.HistoryEntry, error) {
+	return append([]wallet.HistoryEntry{}, m.history[scripthash]...), nil
+}
+
+func (m *mockHistoryStore) GetAll() ([]wallet.HistoryEntry, error) {
+	var ret []wallet.HistoryEntry
+	for _, h := range m.history {
+		ret = append(ret, h...)
+	}
+	return ret, nil
+}
+
+func (m *mockHistoryStore) Delete(scripthash string) error {
+	delete(m.history, scripthash)
+	return nil
+}
+
+type mockPricesStore struct {
+	prices map[string]float64 // by currency and date
+}
+
+func priceKey(date time.Time, currency string) string {
+	return strings.ToUpper(currency) + " " + date.UTC().Format(wallet.PriceDateLayout)
+}
+
+func (m *mockPricesStore) Put(date time.Time, currency string, price float64) error {
+	m.prices[priceKey(date, currency)] = price
+	return nil
+}
+
+func (m *mockPricesStore) Get(date time.Time, currency string) (wallet.Price, error) {
+	var ret wallet.Price
+	at := priceKey(date, currency)
+	prefix := strings.ToUpper(currency) + " "
+	for key, price := range m.prices {
+		if strings.HasPrefix(key, prefix) && key <= at && key > priceKey(ret.Date, currency) {
+			ret.Date, _ = time.Parse(wallet.PriceDateLayout, strings.TrimPrefix(key, prefix))
+			ret.Price = price
+		}
+	}
+	if ret.Price == 0 {
+		return ret, wallet.ErrNoPrice
+	}
+	ret.Currency = strings.ToUpper(currency)
+	return ret, nil
+}
+
+func (m *mockPricesStore) GetAll(currency string) ([]wallet.Price, error) {
+	var ret []wallet.Price
+	prefix := strings.ToUpper(currency) + " "
+	for key, price := range m.prices {
+		if !strings.HasPrefix(key, prefix) {
+			continue
+		}
+		date, _ := time.Parse(wallet.PriceDateLayout, strings.TrimPrefix(key, prefix))
+		ret = append(ret, wallet.Price{Date: date, Currency: strings.ToUpper(currency), Price: price})
+	}
+	sort.Slice(ret, func(i, j int) bool { return ret[i].Date.Before(ret[j].Date) })
+	return ret, nil
+}
+
+func (m *mockPricesStore) Delete(date time.Time, currency string) error {
+	delete(m.prices, priceKey(date, currency))
+	return nil
+}
+
+type mockLabelsStore struct {
+	labels map[string]wallet.Label // by type and ref
+}
+
+func (m *mockLabelsStore) Put(label wallet.Label) error {
+	m.labels[string(label.Type)+" "+label.Ref] = label
+	return nil
+}
+
+func (m *mockLabelsStore) Get(labelType wallet.LabelType, ref string) (wallet.Label, error) {
+	label, ok := m.labels[string(labelType)+" "+ref]
+	if !ok {
+		return label, errors.New("not found")
+	}
+	return label, nil
+}
+
+func (m *mockLabelsStore) GetAll() ([]wallet.Label, error) {
+	var ret []wallet.Label
+	for _, label := range m.labels {
+		ret = append(ret, label)
+	}
+	sort.Slice(ret, func(i, j int) bool {
+		if ret[i].Type != ret[j].Type {
+			return ret[i].Type < ret[j].Type
+		}
+		return ret[i].Ref < ret[j].Ref
+	})
+	return ret, nil
+}
+
+func (m *mockLabelsStore) Delete(labelType wallet.LabelType, ref string) error {
+	delete(m.labels, string(labelType)+" "+ref)
+	return nil
+}
+
+type mockProposalsStore struct {
+	proposals map[string]wallet.TxProposal
+}
+
+// copyProposal copies the transaction and inputs as the db would
+func copyProposal(proposal wallet.TxProposal) wallet.TxProposal {
+	proposal.Tx = proposal.Tx.Copy()
+	proposal.Inputs = append([]wallet.Utxo(nil), proposal.Inputs...)
+	return proposal
+}
+
+func (m *mockProposalsStore) Put(proposal wallet.TxProposal) error {
+	m.proposals[proposal.ID] = copyProposal(proposal)
+	return nil
+}
+
+func (m *mockProposalsStore) Get(id string) (wallet.TxProposal, error) {
+	proposal, ok := m.proposals[id]
+	if !ok {
+		return proposal, wallet.ErrNoProposal
+	}
+	return copyProposal(proposal), nil
+}
+
+func (m *mockProposalsStore) GetAll() ([]wallet.TxProposal, error) {
+	var ret []wallet.TxProposal
+	for _, proposal := range m.proposals {
+		ret = append(ret, copyProposal(proposal))
+	}
+	sort.Slice(ret, func(i, j int) bool {
+		if !ret[i].Created.Equal(ret[j].Created) {
+			return ret[i].Created.Before(ret[j].Created)
+		}
+		return ret[i].ID < ret[j].ID
+	})
+	return ret, nil
+}
+
+func (m *mockProposalsStore) Delete(id string) error {
+	delete(m.proposals, id)
+	return nil
+}
+
 func TestUtxo_IsEqual(t *testing.T) {
 	h, err := chainhash.NewHashFromStr("16bed6368b8b1542cd6eb87f5bc20dc830b41a2258dde40438a75fa701d24e9a")
 	if err != nil {
@@ -0,0 +1,259 @@
+package wltbtc
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"main/wallet"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+)
+
+// Transaction proposals split a spend into steps: the unsigned transaction
+// is built and saved, inspected, signed here or elsewhere and then broadcast.
+// An open proposal locks the coins it spends so that concurrent spends do not
+// select them too. SpendMany saves its signed transaction as a proposal for
+// the same reason.
+
+// CreateProposal builds an unsigned transaction paying the outputs and saves
+// it as a proposal. Its change key is marked used so that the next proposal
+// pays change to another address.
+func (w *BtcElectrumWallet) CreateProposal(outs []wallet.TransactionOutput, feeLevel wallet.FeeLevel, opts wallet.SpendOptions) (*wallet.TxProposal, error) {
+	req, err := w.spendManyRequest(outs, feeLevel, &opts)
+	if err != nil {
+		return nil, err
+	}
+	w.lock()
+	defer w.unlock()
+	res, err := w.buildSpend(req, opts.Coins)
+	if err != nil {
+		return nil, err
+	}
+	return w.saveProposal(res, wallet.ProposalUnsigned)
+}
+
+// saveProposal saves a built transaction as a proposal, locking its coins, and
+// reserves its change key
+func (w *BtcElectrumWallet) saveProposal(res *wallet.SpendResult, status wallet.ProposalStatus) (*wallet.TxProposal, error) {
+	proposal := &wallet.TxProposal{
+		ID:          wallet.ProposalID(res.Tx),
+		SpendResult: *res,
+		Status:      status,
+		Created:     time.Now().Truncate(time.Second),
+	}
+	if err := w.txstore.Proposals().Put(*proposal); err != nil {
+		return nil, err
+	}
+	if err := w.reserveChange(res); err != nil {
+		return nil, err
+	}
+	return proposal, nil
+}
+
+// reserveChange marks the key of the change output used. Until then the
+// current internal address stays the same and every transaction built pays
+// change to it.
+func (w *BtcElectrumWallet) reserveChange(res *wallet.SpendResult) error {
+	if res.ChangeIndex < 0 {
+		return nil
+	}
+	addr, err := w.ScriptToAddress(res.Tx.TxOut[res.ChangeIndex].PkScript)
+	if err != nil {
+		return err
+	}
+	if err = w.keyManager.MarkKeyAsUsed(addr.ScriptAddress()); err != nil {
+		return err
+	}
+	return w.txstore.PopulateAdrs()
+}
+
+func (w *BtcElectrumWallet) Proposals() ([]wallet.TxProposal, error) {
+	return w.txstore.Proposals().GetAll()
+}
+
+func (w *BtcElectrumWallet) Proposal(id string) (*wallet.TxProposal, error) {
+	proposal, err := w.txstore.Proposals().Get(id)
+	if err != nil {
+		return nil, fmt.Errorf("proposal %s: %w", id, err)
+	}
+	return &proposal, nil
+}
+
+// openProposal returns a proposal that has not been broadcast
+func (w *BtcElectrumWallet) openProposal(id string) (*wallet.TxProposal, error) {
+	proposal, err := w.Proposal(id)
+	if err != nil {
+		return nil, err
+	}
+	if !proposal.Open() {
+		return nil, fmt.Errorf("proposal %s was broadcast", id)
+	}
+	return proposal, nil
+}
+
+func (w *BtcElectrumWallet) SignProposal(id string) (*wallet.TxProposal, error) {
+	w.lock()
+	defer w.unlock()
+	proposal, err := w.openProposal(id)
+	if err != nil {
+		return nil, err
+	}
+	if err = w.signTx(proposal.Tx, proposal.Inputs); err != nil {
+		return nil, err
+	}
+	proposal.Status = wallet.ProposalSigned
+	if err = w.txstore.Proposals().Put(*proposal); err != nil {
+		return nil, err
+	}
+	return proposal, nil
+}
+
+// ImportSignedProposal takes the transaction of a proposal signed by another
+// signer. It must be the proposal transaction with only the signatures added.
+func (w *BtcElectrumWallet) ImportSignedProposal(id string, signed *wire.MsgTx) (*wallet.TxProposal, error) {
+	w.lock()
+	defer w.unlock()
+	proposal, err := w.openProposal(id)
+	if err != nil {
+		return nil, err
+	}
+	if wallet.ProposalID(signed) != proposal.ID {
+		return nil, fmt.Errorf("transaction %s is not proposal %s", signed.TxHash(), id)
+	}
+	prevOuts := make(map[wire.OutPoint]*wire.TxOut, len(proposal.Inputs))
+	for _, u := range proposal.Inputs {
+		prevOuts[u.Op] = wire.NewTxOut(u.Value, u.ScriptPubkey)
+	}
+	fetcher := txscript.NewMultiPrevOutFetcher(prevOuts)
+	if err = verifyTx(signed, prevOuts, fetcher, txscript.NewTxSigHashes(signed, fetcher)); err != nil {
+		return nil, err
+	}
+	proposal.Tx = signed
+	proposal.Status = wallet.ProposalSigned
+	if err = w.txstore.Proposals().Put(*proposal); err != nil {
+		return nil, err
+	}
+	return proposal, nil
+}
+
+func (w *BtcElectrumWallet) BroadcastProposal(id string) (*chainhash.Hash, error) {
+	w.lock()
+	defer w.unlock()
+	proposal, err := w.openProposal(id)
+	if err != nil {
+		return nil, err
+	}
+	if proposal.Status != wallet.ProposalSigned {
+		return nil, fmt.Errorf("proposal %s is not signed", id)
+	}
+	return w.sendTx(proposal.Tx)
+}
+
+// proposalSent marks the proposal of a transaction that was broadcast, if it
+// has one, which unlocks its coins
+func (w *BtcElectrumWallet) proposalSent(tx *wire.MsgTx) error {
+	proposal, err := w.txstore.Proposals().Get(wallet.ProposalID(tx))
+	if errors.Is(err, wallet.ErrNoProposal) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if !proposal.Open() {
+		return nil
+	}
+	proposal.Tx = tx
+	proposal.Status = wallet.ProposalBroadcast
+	return w.txstore.Proposals().Put(proposal)
+}
+
+func (w *BtcElectrumWallet) CancelProposal(id string) error {
+	w.lock()
+	defer w.unlock()
+	if _, err := w.openProposal(id); err != nil {
+		return err
+	}
+	return w.txstore.Proposals().Delete(id)
+}
+
+// lockedCoins returns the coins spent by open proposals and the proposal ID
+// of each. Broadcast proposals lock nothing.
+func (w *BtcElectrumWallet) lockedCoins() (map[wire.OutPoint]string, error) {
+	proposals, err := w.txstore.Proposals().GetAll()
+	if err != nil {
+		return nil, err
+	}
+	locked := make(map[wire.OutPoint]string)
+	for _, proposal := range proposals {
+		if !proposal.Open() {
+			continue
+		}
+		for _, u := range proposal.Inputs {
+			locked[u.Op] = proposal.ID
+		}
+	}
+	return locked, nil
+}
+
+// updateProposals brings the proposals up to date with a wallet transaction
+// ingested at height, so that they do not pile up or lock coins for ever. The
+// proposal of the transaction is marked broadcast, and deleted once it
+// confirms. A proposal spending a coin the transaction spends can no longer
+// be broadcast: it is deleted, unlocking its other coins, if open, or once the
+// transaction confirms if broadcast.
+func (ts *TxStore) updateProposals(tx *wire.MsgTx, height int64) error {
+	proposals, err := ts.Proposals().GetAll()
+	if err != nil {
+		return err
+	}
+	id := wallet.ProposalID(tx)
+	spent := make(map[wire.OutPoint]bool)
+	for _, in := range tx.TxIn {
+		spent[in.PreviousOutPoint] = true
+	}
+	for _, proposal := range proposals {
+		switch {
+		case proposal.ID == id && height > 0:
+			err = ts.Proposals().Delete(proposal.ID)
+		case proposal.ID == id && proposal.Open():
+			proposal.Tx = tx
+			proposal.Status = wallet.ProposalBroadcast
+			err = ts.Proposals().Put(proposal)
+		case proposal.ID != id && (proposal.Open() || height > 0) && spendsAny(proposal.Tx, spent):
+			err = ts.Proposals().Delete(proposal.ID)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// deadProposals deletes the broadcast proposals of a dead transaction
+func (ts *TxStore) deadProposals(txid chainhash.Hash) error {
+	proposals, err := ts.Proposals().GetAll()
+	if err != nil {
+		return err
+	}
+	for _, proposal := range proposals {
+		if !proposal.Open() && proposal.Tx.TxHash() == txid {
+			if err = ts.Proposals().Delete(proposal.ID); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// spendsAny is true if the transaction spends one of the outpoints
+func spendsAny(tx *wire.MsgTx, outpoints map[wire.OutPoint]bool) bool {
+	for _, in := range tx.TxIn {
+		if outpoints[in.PreviousOutPoint] {
+			return true
+		}
+	}
+	return false
+}
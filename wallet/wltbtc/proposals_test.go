@@ -0,0 +1,283 @@
+package wltbtc
+
+import (
+	"bytes"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"main/wallet"
+
+	"github.com/btcsuite/btcd/wire"
+)
+
+func TestBtcElectrumWallet_Proposal(t *testing.T) {
+	w, _ := createTestWallet(t)
+	b := &mockBroadcaster{}
+	w.broadcaster = b
+	ops := fundTestWallet(t, w, 100000, 200000)
+	payee, _ := testPayee(t, w)
+
+	proposal, err := w.CreateProposal([]wallet.TransactionOutput{{Address: payee, Value: 150000}},
+		wallet.NORMAL, wallet.SpendOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkSpendResult(t, &proposal.SpendResult)
+	if proposal.Status != wallet.ProposalUnsigned || proposal.ID != proposal.Tx.TxHash().String() ||
+		len(proposal.Inputs) != 1 || proposal.Inputs[0].Op != ops[1] || proposal.Tx.TxIn[0].SignatureScript != nil {
+		t.Fatalf("Proposal %+v", proposal)
+	}
+	saved, err := w.Proposal(proposal.ID)
+	if err != nil || saved.Tx.TxHash() != proposal.Tx.TxHash() {
+		t.Fatalf("Saved proposal %+v %v", saved, err)
+	}
+
+	// the coin is locked until the proposal is broadcast
+	coins, _ := w.ListUnspentOutputs()
+	for _, coin := range coins {
+		if (coin.Op == ops[1]) != (coin.LockedBy == proposal.ID) {
+			t.Errorf("Coin %s locked by %q", coin.Op, coin.LockedBy)
+		}
+	}
+	if _, err = w.Spend(150000, payee, wallet.NORMAL); !errors.Is(err, wallet.ErrInsufficientFunds) {
+		t.Errorf("Spent a locked coin: %v", err)
+	}
+	if _, err = w.SpendCoins(50000, payee, wallet.NORMAL, ops[1:]); !errors.Is(err, wallet.ErrCoinLocked) {
+		t.Errorf("Spent a locked coin: %v", err)
+	}
+	if _, err = w.BroadcastProposal(proposal.ID); err == nil || b.tx != nil {
+		t.Fatal("Broadcast an unsigned proposal")
+	}
+
+	signed, err := w.SignProposal(proposal.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if signed.Status != wallet.ProposalSigned || signed.ID != proposal.ID || signed.Tx.TxIn[0].SignatureScript == nil {
+		t.Fatalf("Signed proposal %+v", signed)
+	}
+	txid, err := w.BroadcastProposal(proposal.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b.tx == nil || *txid != b.tx.TxHash() || *txid != signed.Tx.TxHash() {
+		t.Fatal("Proposal not broadcast")
+	}
+	if saved, _ = w.Proposal(proposal.ID); saved.Status != wallet.ProposalBroadcast || saved.Open() {
+		t.Errorf("Proposal status %s", saved.Status)
+	}
+	utxos, _ := w.ListUnspent()
+	for _, u := range utxos {
+		if u.Op == ops[1] {
+			t.Error("Broadcast coin still unspent")
+		}
+	}
+	if err = w.CancelProposal(proposal.ID); err == nil {
+		t.Error("Cancelled a broadcast proposal")
+	}
+	if _, err = w.SignProposal(proposal.ID); err == nil {
+		t.Error("Signed a broadcast proposal")
+	}
+
+	// the broadcast proposal is kept until its transaction confirms
+	if err = w.AddTransaction(b.tx, 10, time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = w.Proposal(proposal.ID); !errors.Is(err, wallet.ErrNoProposal) {
+		t.Errorf("Confirmed proposal not deleted: %v", err)
+	}
+	if _, err = w.Proposal("nosuchproposal"); !errors.Is(err, wallet.ErrNoProposal) {
+		t.Errorf("Proposal of an unknown ID returned %v", err)
+	}
+}
+
+func TestBtcElectrumWallet_ProposalChange(t *testing.T) {
+	w, _ := createTestWallet(t)
+	fundTestWallet(t, w, 100000, 200000)
+	payee, _ := testPayee(t, w)
+	outs := []wallet.TransactionOutput{{Address: payee, Value: 50000}}
+
+	// open proposals pay change to different addresses
+	first, err := w.CreateProposal(outs, wallet.NORMAL, wallet.SpendOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := w.CreateProposal(outs, wallet.NORMAL, wallet.SpendOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first.ChangeIndex < 0 || second.ChangeIndex < 0 {
+		t.Fatal("Proposals without change")
+	}
+	change := first.Tx.TxOut[first.ChangeIndex].PkScript
+	if bytes.Equal(change, second.Tx.TxOut[second.ChangeIndex].PkScript) {
+		t.Error("Proposals pay change to the same address")
+	}
+	if script, _ := w.AddressToScript(w.CurrentAddress(wallet.INTERNAL)); bytes.Equal(script, change) {
+		t.Error("Change address of a proposal is still current")
+	}
+}
+
+func TestBtcElectrumWallet_CancelProposal(t *testing.T) {
+	w, _ := createTestWallet(t)
+	ops := fundTestWallet(t, w, 100000)
+	payee, _ := testPayee(t, w)
+	outs := []wallet.TransactionOutput{{Address: payee, Value: 50000}}
+
+	proposal, err := w.CreateProposal(outs, wallet.NORMAL, wallet.SpendOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = w.CreateProposal(outs, wallet.NORMAL, wallet.SpendOptions{}); !errors.Is(err, wallet.ErrInsufficientFunds) {
+		t.Fatalf("Proposed spending a locked coin: %v", err)
+	}
+	if err = w.CancelProposal(proposal.ID); err != nil {
+		t.Fatal(err)
+	}
+	if proposals, _ := w.Proposals(); len(proposals) != 0 {
+		t.Errorf("Proposals after cancel %+v", proposals)
+	}
+	if _, err = w.CreateProposal(outs, wallet.NORMAL, wallet.SpendOptions{Coins: ops}); err != nil {
+		t.Errorf("Coin still locked after cancel: %v", err)
+	}
+}
+
+func TestBtcElectrumWallet_ProposalCleanup(t *testing.T) {
+	w, _ := createTestWallet(t)
+	w.broadcaster = &mockBroadcaster{}
+	ops := fundTestWallet(t, w, 100000, 100000, 100000)
+	payee, script := testPayee(t, w)
+	propose := func(op wire.OutPoint) *wallet.TxProposal {
+		t.Helper()
+		proposal, err := w.CreateProposal([]wallet.TransactionOutput{{Address: payee, Value: 50000}},
+			wallet.NORMAL, wallet.SpendOptions{Coins: []wire.OutPoint{op}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return proposal
+	}
+
+	// signed and broadcast elsewhere, then seen by the server
+	sent := propose(ops[0])
+	signed, err := w.SignProposal(sent.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = w.AddTransaction(signed.Tx, 0, time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	if saved, err := w.Proposal(sent.ID); err != nil || saved.Status != wallet.ProposalBroadcast {
+		t.Errorf("Proposal of a server transaction %+v %v", saved, err)
+	}
+
+	// its coin was spent by another transaction so it can never be broadcast
+	conflicted := propose(ops[1])
+	other := wire.NewMsgTx(wire.TxVersion)
+	other.AddTxIn(wire.NewTxIn(&ops[1], nil, nil))
+	other.AddTxOut(wire.NewTxOut(90000, script))
+	if err = w.AddTransaction(other, 0, time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = w.Proposal(conflicted.ID); !errors.Is(err, wallet.ErrNoProposal) {
+		t.Errorf("Proposal of a spent coin kept: %v", err)
+	}
+
+	// broadcast but dropped from the mempool
+	dropped := propose(ops[2])
+	if _, err = w.SignProposal(dropped.ID); err != nil {
+		t.Fatal(err)
+	}
+	txid, err := w.BroadcastProposal(dropped.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = w.MarkTransactionDead(*txid); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = w.Proposal(dropped.ID); !errors.Is(err, wallet.ErrNoProposal) {
+		t.Errorf("Proposal of a dead transaction kept: %v", err)
+	}
+
+	// and deleted once confirmed
+	if err = w.AddTransaction(signed.Tx, 10, time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	if proposals, _ := w.Proposals(); len(proposals) != 0 {
+		t.Errorf("Proposals left %+v", proposals)
+	}
+}
+
+func TestBtcElectrumWallet_ImportSignedProposal(t *testing.T) {
+	w, _ := createTestWallet(t)
+	fundTestWallet(t, w, 100000, 200000)
+	payee, _ := testPayee(t, w)
+	proposal, err := w.CreateProposal([]wallet.TransactionOutput{{Address: payee, Value: 250000}},
+		wallet.NORMAL, wallet.SpendOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// another signer with the keys signs a copy of the transaction
+	signed := proposal.Tx.Copy()
+	if err = w.signTx(signed, proposal.Inputs); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = w.ImportSignedProposal(proposal.ID, proposal.Tx); err == nil {
+		t.Error("Imported an unsigned transaction")
+	}
+	changed := signed.Copy()
+	changed.TxOut[0].Value--
+	if _, err = w.ImportSignedProposal(proposal.ID, changed); err == nil {
+		t.Error("Imported a different transaction")
+	}
+	badSig := signed.Copy()
+	badSig.TxIn[0].SignatureScript, badSig.TxIn[1].SignatureScript = signed.TxIn[1].SignatureScript, signed.TxIn[0].SignatureScript
+	if _, err = w.ImportSignedProposal(proposal.ID, badSig); err == nil {
+		t.Error("Imported a transaction with invalid signatures")
+	}
+
+	imported, err := w.ImportSignedProposal(proposal.ID, signed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if imported.Status != wallet.ProposalSigned || imported.Tx.TxHash() != signed.TxHash() {
+		t.Errorf("Imported proposal %+v", imported)
+	}
+}
+
+func TestBtcElectrumWallet_ConcurrentProposals(t *testing.T) {
+	w, _ := createTestWallet(t)
+	fundTestWallet(t, w, 100000, 100000, 100000, 100000)
+	payee, _ := testPayee(t, w)
+
+	var wg sync.WaitGroup
+	results := make([]*wallet.TxProposal, 5)
+	for i := range results {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			results[i], _ = w.CreateProposal([]wallet.TransactionOutput{{Address: payee, Value: 90000}},
+				wallet.NORMAL, wallet.SpendOptions{})
+		}(i)
+	}
+	wg.Wait()
+	spent := make(map[wire.OutPoint]bool)
+	n := 0
+	for _, proposal := range results {
+		if proposal == nil {
+			continue
+		}
+		n++
+		for _, u := range proposal.Inputs {
+			if spent[u.Op] {
+				t.Errorf("Coin %s selected twice", u.Op)
+			}
+			spent[u.Op] = true
+		}
+	}
+	if n != 4 {
+		t.Errorf("Created %d proposals from 4 coins", n)
+	}
+}
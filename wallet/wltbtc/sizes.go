@@ -0,0 +1,114 @@
+package wltbtc
+
+import (
+	"errors"
+
+	"github.com/btcsuite/btcd/blockchain"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+)
+
+// Worst case transaction size estimates. Signatures are assumed to be the
+// largest DER encoding (72 bytes + 1 byte sighash) and public keys are always
+// compressed.
+
+const (
+	// outpoint 32+4, sequence 4
+	inputBaseSize = 32 + 4 + 4
+
+	// push of a maximum length signature plus sighash byte
+	sigPushSize = 1 + 73
+
+	// push of a compressed public key
+	pubKeyPushSize = 1 + 33
+
+	// extra bytes of an uncompressed public key, 65 bytes, over a compressed
+	// one
+	uncompressedPubKeyExtra = 65 - 33
+
+	// version 4, locktime 4
+	txBaseSize = 4 + 4
+
+	// segwit marker and flag bytes, counted in weight units
+	witnessHeaderWeight = 2
+)
+
+// inputWeight returns the estimated weight in weight units of a signed input
+// spending prevScript. For p2sh and p2wsh outputs the redeem script must be
+// provided and must be a standard multisig script.
+func inputWeight(prevScript, redeemScript []byte) (int, error) {
+	switch txscript.GetScriptClass(prevScript) {
+	case txscript.PubKeyHashTy:
+		sigScriptSize := sigPushSize + pubKeyPushSize
+		size := inputBaseSize + wire.VarIntSerializeSize(uint64(sigScriptSize)) + sigScriptSize
+		return size * blockchain.WitnessScaleFactor, nil
+
+	case txscript.WitnessV0PubKeyHashTy:
+		size := inputBaseSize + 1
+		witnessSize := 1 + sigPushSize + pubKeyPushSize
+		return size*blockchain.WitnessScaleFactor + witnessSize, nil
+
+	case txscript.ScriptHashTy:
+		_, numSigs, err := txscript.CalcMultiSigStats(redeemScript)
+		if err != nil {
+			return 0, err
+		}
+		sigScriptSize := 1 + numSigs*sigPushSize + pushDataSize(len(redeemScript))
+		size := inputBaseSize + wire.VarIntSerializeSize(uint64(sigScriptSize)) + sigScriptSize
+		return size * blockchain.WitnessScaleFactor, nil
+
+	case txscript.WitnessV0ScriptHashTy:
+		_, numSigs, err := txscript.CalcMultiSigStats(redeemScript)
+		if err != nil {
+			return 0, err
+		}
+		size := inputBaseSize + 1
+		witnessSize := wire.VarIntSerializeSize(uint64(numSigs+2)) + 1 + numSigs*sigPushSize +
+			wire.VarIntSerializeSize(uint64(len(redeemScript))) + len(redeemScript)
+		return size*blockchain.WitnessScaleFactor + witnessSize, nil
+	}
+	return 0, errors.New("unsupported input script type")
+}
+
+// pushDataSize is the size of the script opcodes needed to push n bytes
+func pushDataSize(n int) int {
+	switch {
+	case n <= txscript.OP_DATA_75:
+		return 1 + n
+	case n <= 0xff:
+		return 2 + n
+	case n <= 0xffff:
+		return 3 + n
+	}
+	return 5 + n
+}
+
+// EstimateTxVsize returns the estimated virtual size of a transaction spending
+// outputs with the given prevScripts to txOuts once it has been signed.
+func EstimateTxVsize(prevScripts [][]byte, redeemScript []byte, txOuts []*wire.TxOut) (int, error) {
+	weight := (txBaseSize +
+		wire.VarIntSerializeSize(uint64(len(prevScripts))) +
+		wire.VarIntSerializeSize(uint64(len(txOuts)))) * blockchain.WitnessScaleFactor
+
+	hasWitness := false
+	for _, prevScript := range prevScripts {
+		w, err := inputWeight(prevScript, redeemScript)
+		if err != nil {
+			return 0, err
+		}
+		weight += w
+		if txscript.IsWitnessProgram(prevScript) {
+			hasWitness = true
+		}
+	}
+	if hasWitness {
+		weight += witnessHeaderWeight
+	}
+
+	for _, txOut := range txOuts {
+		weight += txOut.SerializeSize() * blockchain.WitnessScaleFactor
+	}
+
+	// round up
+	return (weight + blockchain.WitnessScaleFactor - 1) / blockchain.WitnessScaleFactor, nil
+}
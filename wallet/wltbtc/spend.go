@@ -0,0 +1,502 @@
+package wltbtc
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"main/wallet"
+
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/btcutil/txsort"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+)
+
+// Spend sends amount to addr from coins selected among the spendable wallet
+// utxos. Watch only and frozen coins are never selected.
+func (w *BtcElectrumWallet) Spend(amount int64, addr btcutil.Address, feeLevel wallet.FeeLevel) (*chainhash.Hash, error) {
+	return w.spend(amount, addr, feeLevel, nil)
+}
+
+// SpendCoins sends amount to addr spending all of the given coins. Frozen
+// coins must be unfrozen first.
+func (w *BtcElectrumWallet) SpendCoins(amount int64, addr btcutil.Address, feeLevel wallet.FeeLevel, coins []wire.OutPoint) (*chainhash.Hash, error) {
+	if len(coins) == 0 {
+		return nil, errors.New("no coins to spend")
+	}
+	return w.spend(amount, addr, feeLevel, coins)
+}
+
+func (w *BtcElectrumWallet) spend(amount int64, addr btcutil.Address, feeLevel wallet.FeeLevel, coins []wire.OutPoint) (*chainhash.Hash, error) {
+	if w.IsDust(amount) {
+		return nil, wallet.ErrorDustAmount
+	}
+	script, err := w.AddressToScript(addr)
+	if err != nil {
+		return nil, err
+	}
+
+	// one spend at a time so concurrent spends do not select the same coins
+	w.lock()
+	defer w.unlock()
+
+	req := &spendRequest{
+		outs:       []*wire.TxOut{wire.NewTxOut(amount, script)},
+		feePerByte: w.GetFeePerByte(feeLevel),
+		maxOut:     -1,
+		feeOut:     -1,
+	}
+	res, err := w.buildSpend(req, coins)
+	if err != nil {
+		return nil, err
+	}
+	if err = w.signTx(res.Tx, res.Inputs); err != nil {
+		return nil, err
+	}
+	return w.sendTx(res.Tx)
+}
+
+// SpendMany pays all the outputs in one transaction. The transaction is
+// signed but not broadcast so it can be reviewed first. It is saved as a
+// signed proposal that locks its coins, so that other spends do not select
+// them, until it is broadcast or the proposal is cancelled. Its change key is
+// reserved as for CreateProposal.
+func (w *BtcElectrumWallet) SpendMany(outs []wallet.TransactionOutput, feeLevel wallet.FeeLevel, opts wallet.SpendOptions) (*wallet.SpendResult, error) {
+	req, err := w.spendManyRequest(outs, feeLevel, &opts)
+	if err != nil {
+		return nil, err
+	}
+	w.lock()
+	defer w.unlock()
+	res, err := w.buildSpend(req, opts.Coins)
+	if err != nil {
+		return nil, err
+	}
+	if err = w.signTx(res.Tx, res.Inputs); err != nil {
+		return nil, err
+	}
+	if _, err = w.saveProposal(res, wallet.ProposalSigned); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// spendManyRequest checks the outputs and options of SpendMany
+func (w *BtcElectrumWallet) spendManyRequest(outs []wallet.TransactionOutput, feeLevel wallet.FeeLevel, opts *wallet.SpendOptions) (*spendRequest, error) {
+	if len(outs) == 0 {
+		return nil, errors.New("no outputs to pay")
+	}
+	req := &spendRequest{
+		feePerByte: w.GetFeePerByte(feeLevel),
+		maxOut:     -1,
+		feeOut:     -1,
+	}
+	switch {
+	case opts.Fee < 0:
+		return nil, fmt.Errorf("invalid fee %d", opts.Fee)
+	case opts.Fee > 0 && opts.FeePerByte > 0:
+		return nil, errors.New("set a fee or a fee rate, not both")
+	case opts.Fee > 0:
+		req.fee = opts.Fee
+	}
+	if opts.FeePerByte > 0 {
+		feePerByte, err := w.CustomFeePerByte(opts.FeePerByte)
+		if err != nil {
+			return nil, err
+		}
+		req.feePerByte = feePerByte
+	}
+	if opts.SendMax {
+		if opts.MaxOutput < 0 || opts.MaxOutput >= len(outs) {
+			return nil, fmt.Errorf("no output %d to send the maximum to", opts.MaxOutput)
+		}
+		req.maxOut = opts.MaxOutput
+	}
+	if opts.SubtractFee {
+		if opts.FeeOutput < 0 || opts.FeeOutput >= len(outs) {
+			return nil, fmt.Errorf("no output %d to subtract the fee from", opts.FeeOutput)
+		}
+		if opts.SendMax {
+			return nil, errors.New("the fee is always taken from the output of a send max")
+		}
+		req.feeOut = opts.FeeOutput
+	}
+	for i, out := range outs {
+		if out.Address == nil || !out.Address.IsForNet(w.params) {
+			return nil, fmt.Errorf("output %d: invalid address", i)
+		}
+		script, err := w.AddressToScript(out.Address)
+		if err != nil {
+			return nil, fmt.Errorf("output %d: %w", i, err)
+		}
+		if i != req.maxOut && w.IsDust(out.Value) {
+			return nil, fmt.Errorf("output %d: %w", i, wallet.ErrorDustAmount)
+		}
+		req.outs = append(req.outs, wire.NewTxOut(out.Value, script))
+	}
+	if opts.OpReturn != nil {
+		script, err := txscript.NullDataScript(opts.OpReturn)
+		if err != nil {
+			return nil, err
+		}
+		req.outs = append(req.outs, wire.NewTxOut(0, script))
+	}
+	return req, nil
+}
+
+// BroadcastTx sends a signed transaction and adds it to the wallet at once
+// rather than when the server notifies it, so its coins are marked spent.
+// The server notification adds it again if that fails, and the txid is
+// returned with wallet.ErrTxNotAdded. The proposal of the transaction, as
+// saved by SpendMany, is marked broadcast.
+func (w *BtcElectrumWallet) BroadcastTx(tx *wire.MsgTx) (*chainhash.Hash, error) {
+	w.lock()
+	defer w.unlock()
+	return w.sendTx(tx)
+}
+
+// sendTx is BroadcastTx for callers holding the wallet lock
+func (w *BtcElectrumWallet) sendTx(tx *wire.MsgTx) (*chainhash.Hash, error) {
+	txid, err := w.broadcastTx(tx)
+	if err != nil {
+		return nil, err
+	}
+	// sent even if not added to the wallet
+	if err = w.proposalSent(tx); err != nil {
+		return txid, err
+	}
+	if _, err = w.txstore.Ingest(tx, 0, time.Now()); err != nil {
+		return txid, fmt.Errorf("%w: %s: %v", wallet.ErrTxNotAdded, txid, err)
+	}
+	return txid, nil
+}
+
+// buildSpend makes the unsigned transaction of a request spending the given
+// coins, or coins it selects when there are none given. The caller holds
+// w.mutex.
+func (w *BtcElectrumWallet) buildSpend(req *spendRequest, coins []wire.OutPoint) (*wallet.SpendResult, error) {
+	var err error
+	if req.coins, req.selectCoins, err = w.candidateCoins(coins); err != nil {
+		return nil, err
+	}
+	built, err := w.buildTx(req)
+	if err != nil {
+		return nil, err
+	}
+	feePerByte := req.feePerByte
+	if req.fee > 0 {
+		feePerByte = uint64(built.fee) / uint64(built.vsize)
+	}
+	return &wallet.SpendResult{
+		Tx:          built.tx,
+		Inputs:      built.spent,
+		ChangeIndex: built.changeIndex,
+		Fee:         built.fee,
+		Vsize:       int64(built.vsize),
+		FeePerByte:  feePerByte,
+	}, nil
+}
+
+// candidateCoins returns the given coins to spend them all, or the
+// spendable coins to select from when there are none given
+func (w *BtcElectrumWallet) candidateCoins(ops []wire.OutPoint) (coins []wallet.Utxo, selectCoins bool, err error) {
+	if ops != nil {
+		coins, err = w.lookupCoins(ops)
+		return coins, false, err
+	}
+	coins, err = w.spendableCoins()
+	return coins, true, err
+}
+
+// spendableCoins returns the utxos that are not watch only, frozen or
+// locked by a proposal, confirmed coins first and the largest first
+func (w *BtcElectrumWallet) spendableCoins() ([]wallet.Utxo, error) {
+	utxos, err := w.txstore.Utxos().GetAll()
+	if err != nil {
+		return nil, err
+	}
+	locked, err := w.lockedCoins()
+	if err != nil {
+		return nil, err
+	}
+	var coins []wallet.Utxo
+	for _, u := range utxos {
+		if _, ok := locked[u.Op]; !ok && !u.WatchOnly && !u.Frozen {
+			coins = append(coins, u)
+		}
+	}
+	sort.Slice(coins, func(i, j int) bool {
+		ci, cj := coins[i].AtHeight > 0, coins[j].AtHeight > 0
+		if ci != cj {
+			return ci
+		}
+		return coins[i].Value > coins[j].Value
+	})
+	return coins, nil
+}
+
+// lookupCoins returns the wallet utxos of the outpoints, which must be
+// spendable and not locked
+func (w *BtcElectrumWallet) lookupCoins(ops []wire.OutPoint) ([]wallet.Utxo, error) {
+	utxos, err := w.txstore.Utxos().GetAll()
+	if err != nil {
+		return nil, err
+	}
+	locked, err := w.lockedCoins()
+	if err != nil {
+		return nil, err
+	}
+	byOp := make(map[wire.OutPoint]wallet.Utxo, len(utxos))
+	for _, u := range utxos {
+		byOp[u.Op] = u
+	}
+	coins := make([]wallet.Utxo, 0, len(ops))
+	seen := make(map[wire.OutPoint]bool, len(ops))
+	for _, op := range ops {
+		u, ok := byOp[op]
+		switch {
+		case seen[op]:
+			return nil, fmt.Errorf("duplicate coin %s", op)
+		case !ok || u.WatchOnly:
+			return nil, fmt.Errorf("coin %s not in wallet", op)
+		case u.Frozen:
+			return nil, fmt.Errorf("%w: %s", wallet.ErrCoinFrozen, op)
+		case locked[op] != "":
+			return nil, fmt.Errorf("%w: %s by %s", wallet.ErrCoinLocked, op, locked[op])
+		}
+		seen[op] = true
+		coins = append(coins, u)
+	}
+	return coins, nil
+}
+
+// spendRequest is a transaction for buildTx to make
+type spendRequest struct {
+	outs []*wire.TxOut
+
+	// The coins to spend in the order they are selected
+	coins []wallet.Utxo
+
+	// Take from coins only what is needed, else spend all of them
+	selectCoins bool
+
+	feePerByte uint64
+
+	// Fixed fee paid instead of feePerByte when above zero
+	fee int64
+
+	// Index of the output paid all that is left, or -1
+	maxOut int
+
+	// Index of the output the fee is taken from, or -1
+	feeOut int
+}
+
+// rbfSequence is the input sequence that signals the transaction can be
+// replaced by one paying a higher fee (BIP 125), as Electrum sets it
+const rbfSequence = wire.MaxTxInSequenceNum - 2
+
+// builtTx is an unsigned transaction made by buildTx
+type builtTx struct {
+	tx          *wire.MsgTx
+	spent       []wallet.Utxo
+	changeIndex int
+	fee         int64
+	vsize       int
+}
+
+// buildTx makes an unsigned transaction paying the request outputs. When
+// selectCoins is set the inputs are taken from the coins in order until they
+// cover the outputs and fee, else all the coins are spent. Change that is
+// not dust goes to the current internal address, otherwise it adds to the
+// fee. The inputs signal replace by fee and the inputs and outputs are
+// sorted by BIP 69.
+func (w *BtcElectrumWallet) buildTx(req *spendRequest) (*builtTx, error) {
+	outs := make([]*wire.TxOut, 0, len(req.outs)+1)
+	var target int64
+	for i, out := range req.outs {
+		outs = append(outs, wire.NewTxOut(out.Value, out.PkScript))
+		if i != req.maxOut {
+			target += out.Value
+		}
+	}
+	// the estimate assumes compressed keys, extra is the size of the
+	// uncompressed imported keys of the inputs
+	var extra int
+	estimate := func(prevScripts [][]byte, txOuts []*wire.TxOut) (int64, int, error) {
+		vsize, err := EstimateTxVsize(prevScripts, nil, txOuts)
+		vsize += extra
+		if req.fee > 0 {
+			return req.fee, vsize, err
+		}
+		return int64(vsize) * int64(req.feePerByte), vsize, err
+	}
+	// the amount the inputs must cover given the fee
+	needed := func(fee int64) int64 {
+		if req.feeOut >= 0 {
+			return target
+		}
+		return target + fee
+	}
+
+	var spent []wallet.Utxo
+	var prevScripts [][]byte
+	var total, fee int64
+	var vsize int
+	var err error
+	for _, u := range req.coins {
+		spent = append(spent, u)
+		prevScripts = append(prevScripts, u.ScriptPubkey)
+		total += u.Value
+		if txscript.GetScriptClass(u.ScriptPubkey) == txscript.PubKeyHashTy &&
+			w.keyManager.uncompressed(u.ScriptPubkey[3:23]) {
+			extra += uncompressedPubKeyExtra
+		}
+		if fee, vsize, err = estimate(prevScripts, outs); err != nil {
+			return nil, err
+		}
+		if req.selectCoins && req.maxOut < 0 && total >= needed(fee) {
+			break
+		}
+	}
+	if len(spent) == 0 || total < needed(fee) {
+		return nil, wallet.ErrInsufficientFunds
+	}
+
+	var change *wire.TxOut
+	if req.maxOut >= 0 {
+		outs[req.maxOut].Value = total - target - fee
+	} else {
+		changeScript, err := w.AddressToScript(w.CurrentAddress(wallet.INTERNAL))
+		if err != nil {
+			return nil, err
+		}
+		withChange := append(outs[:len(outs):len(outs)], wire.NewTxOut(0, changeScript))
+		changeFee, changeVsize, err := estimate(prevScripts, withChange)
+		if err != nil {
+			return nil, err
+		}
+		if value := total - needed(changeFee); value > 0 && !w.IsDust(value) {
+			change = withChange[len(outs)]
+			change.Value = value
+			outs, fee, vsize = withChange, changeFee, changeVsize
+		}
+		if req.feeOut >= 0 {
+			outs[req.feeOut].Value -= fee
+		}
+	}
+	for i, out := range outs {
+		if txscript.GetScriptClass(out.PkScript) != txscript.NullDataTy && w.IsDust(out.Value) {
+			if i == req.maxOut || i == req.feeOut {
+				return nil, fmt.Errorf("output %d: %w after the fee", i, wallet.ErrorDustAmount)
+			}
+			return nil, fmt.Errorf("output %d: %w", i, wallet.ErrorDustAmount)
+		}
+	}
+
+	tx := wire.NewMsgTx(wire.TxVersion)
+	for _, u := range spent {
+		op := u.Op
+		in := wire.NewTxIn(&op, nil, nil)
+		in.Sequence = rbfSequence
+		tx.AddTxIn(in)
+	}
+	var paid int64
+	for _, out := range outs {
+		tx.AddTxOut(out)
+		paid += out.Value
+	}
+
+	// BIP 69 sorting
+	txsort.InPlaceSort(tx)
+
+	built := &builtTx{
+		tx:          tx,
+		spent:       make([]wallet.Utxo, 0, len(spent)),
+		changeIndex: -1,
+		fee:         total - paid,
+		vsize:       vsize,
+	}
+	byOp := make(map[wire.OutPoint]wallet.Utxo, len(spent))
+	for _, u := range spent {
+		byOp[u.Op] = u
+	}
+	for _, in := range tx.TxIn {
+		built.spent = append(built.spent, byOp[in.PreviousOutPoint])
+	}
+	for i, out := range tx.TxOut {
+		if out == change {
+			built.changeIndex = i
+		}
+	}
+	return built, nil
+}
+
+// signTx signs the p2pkh and p2wpkh inputs of tx spending the wallet coins
+// with the wallet keys
+func (w *BtcElectrumWallet) signTx(tx *wire.MsgTx, coins []wallet.Utxo) error {
+	prevOuts := make(map[wire.OutPoint]*wire.TxOut, len(coins))
+	for _, u := range coins {
+		prevOuts[u.Op] = wire.NewTxOut(u.Value, u.ScriptPubkey)
+	}
+	fetcher := txscript.NewMultiPrevOutFetcher(prevOuts)
+	sigHashes := txscript.NewTxSigHashes(tx, fetcher)
+
+	for i, txIn := range tx.TxIn {
+		prevOut, ok := prevOuts[txIn.PreviousOutPoint]
+		if !ok {
+			return fmt.Errorf("input %d does not spend a wallet coin", i)
+		}
+		addr, err := w.ScriptToAddress(prevOut.PkScript)
+		if err != nil {
+			return err
+		}
+		privKey, err := w.GetKey(addr)
+		if err != nil {
+			return fmt.Errorf("no key for input %d: %w", i, err)
+		}
+
+		switch txscript.GetScriptClass(prevOut.PkScript) {
+		case txscript.PubKeyHashTy:
+			compress := !w.keyManager.uncompressed(addr.ScriptAddress())
+			sigScript, err := txscript.SignatureScript(tx, i, prevOut.PkScript,
+				txscript.SigHashAll, privKey, compress)
+			if err != nil {
+				return err
+			}
+			txIn.SignatureScript = sigScript
+
+		case txscript.WitnessV0PubKeyHashTy:
+			witness, err := txscript.WitnessSignature(tx, sigHashes, i,
+				prevOut.Value, prevOut.PkScript, txscript.SigHashAll, privKey, true)
+			if err != nil {
+				return err
+			}
+			txIn.Witness = witness
+
+		default:
+			return fmt.Errorf("cannot sign input %d: unsupported script type", i)
+		}
+	}
+	return verifyTx(tx, prevOuts, fetcher, sigHashes)
+}
+
+// verifyTx runs each input through the script engine to be sure it is
+// spendable
+func verifyTx(tx *wire.MsgTx, prevOuts map[wire.OutPoint]*wire.TxOut, fetcher txscript.PrevOutputFetcher, sigHashes *txscript.TxSigHashes) error {
+	for i, txIn := range tx.TxIn {
+		prevOut := prevOuts[txIn.PreviousOutPoint]
+		vm, err := txscript.NewEngine(prevOut.PkScript, tx, i,
+			txscript.StandardVerifyFlags, nil, sigHashes, prevOut.Value, fetcher)
+		if err != nil {
+			return err
+		}
+		if err := vm.Execute(); err != nil {
+			return fmt.Errorf("input %d failed to verify: %w", i, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,463 @@
+package wltbtc
+
+import (
+	"bytes"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"main/wallet"
+
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+)
+
+// fundTestWallet gives the wallet a confirmed coin of each value at its
+// current external address and returns their outpoints
+func fundTestWallet(t *testing.T, w *BtcElectrumWallet, values ...int64) []wire.OutPoint {
+	script, err := w.AddressToScript(w.CurrentAddress(wallet.EXTERNAL))
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, _ := chainhash.NewHashFromStr("a2d6fc5cbe6d43ddd1b36b2dba2e6b4d80e0a8e1cd5ad2d42a6a7f69f83b7b8d")
+	fund := wire.NewMsgTx(wire.TxVersion)
+	fund.AddTxIn(wire.NewTxIn(wire.NewOutPoint(other, 0), nil, nil))
+	for _, value := range values {
+		fund.AddTxOut(wire.NewTxOut(value, script))
+	}
+	if err = w.AddTransaction(fund, 10, time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	hash := fund.TxHash()
+	ops := make([]wire.OutPoint, len(values))
+	for i := range values {
+		ops[i] = *wire.NewOutPoint(&hash, uint32(i))
+	}
+	return ops
+}
+
+// testPayee is an address outside the wallet
+func testPayee(t *testing.T, w *BtcElectrumWallet) (btcutil.Address, []byte) {
+	payee, err := btcutil.NewAddressWitnessPubKeyHash(make([]byte, 20), w.params)
+	if err != nil {
+		t.Fatal(err)
+	}
+	script, _ := txscript.PayToAddrScript(payee)
+	return payee, script
+}
+
+// spentOutpoints returns the inputs of tx
+func spentOutpoints(tx *wire.MsgTx) map[wire.OutPoint]bool {
+	ops := make(map[wire.OutPoint]bool)
+	for _, in := range tx.TxIn {
+		ops[in.PreviousOutPoint] = true
+	}
+	return ops
+}
+
+func TestBtcElectrumWallet_Spend(t *testing.T) {
+	w, _ := createTestWallet(t)
+	b := &mockBroadcaster{}
+	w.broadcaster = b
+	ops := fundTestWallet(t, w, 100000, 200000, 50000)
+	payee, payeeScript := testPayee(t, w)
+
+	txid, err := w.Spend(150000, payee, wallet.NORMAL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b.tx == nil || *txid != b.tx.TxHash() {
+		t.Fatal("Transaction not broadcast")
+	}
+	// the largest coin covers it
+	if spent := spentOutpoints(b.tx); len(spent) != 1 || !spent[ops[1]] {
+		t.Errorf("Spent the wrong coins %v", spent)
+	}
+	if len(b.tx.TxOut) != 2 {
+		t.Fatalf("Transaction has %d outputs", len(b.tx.TxOut))
+	}
+	var paid, change int64
+	for _, out := range b.tx.TxOut {
+		if string(out.PkScript) == string(payeeScript) {
+			paid += out.Value
+		} else {
+			change += out.Value
+		}
+	}
+	coinScript, _ := w.AddressToScript(w.CurrentAddress(wallet.EXTERNAL))
+	vsize, _ := EstimateTxVsize([][]byte{coinScript}, nil, b.tx.TxOut)
+	if fee := 200000 - paid - change; paid != 150000 || fee != int64(vsize)*int64(w.GetFeePerByte(wallet.NORMAL)) {
+		t.Errorf("Paid %d with change %d", paid, change)
+	}
+
+	// the coin is spent and the change is a new utxo
+	utxos, _ := w.ListUnspent()
+	if len(utxos) != 3 {
+		t.Errorf("%d utxos after the spend", len(utxos))
+	}
+	for _, u := range utxos {
+		if u.Op == ops[1] {
+			t.Error("Spent coin still unspent")
+		}
+	}
+
+	if _, err = w.Spend(1000000, payee, wallet.NORMAL); !errors.Is(err, wallet.ErrInsufficientFunds) {
+		t.Errorf("Spent more than the balance: %v", err)
+	}
+	if _, err = w.Spend(100, payee, wallet.NORMAL); !errors.Is(err, wallet.ErrorDustAmount) {
+		t.Errorf("Spent dust: %v", err)
+	}
+}
+
+func TestSpendListenerCallsWallet(t *testing.T) {
+	w, _ := createTestWallet(t)
+	w.broadcaster = &mockBroadcaster{}
+	fundTestWallet(t, w, 100000, 200000)
+	payee, _ := testPayee(t, w)
+
+	// the listener spends again from inside the callback, which deadlocks
+	// if it is called with the wallet locked
+	calls := 0
+	unsubscribe := w.AddTransactionListener(func(cb wallet.TransactionCallback) {
+		if cb.Event != wallet.TxEventNew {
+			return
+		}
+		if calls++; calls > 1 {
+			return
+		}
+		if _, err := w.Spend(50000, payee, wallet.NORMAL); err != nil {
+			t.Error(err)
+		}
+	})
+	defer unsubscribe()
+
+	done := make(chan error)
+	go func() {
+		_, err := w.Spend(50000, payee, wallet.NORMAL)
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("listener deadlocked the wallet")
+	}
+	if calls != 2 {
+		t.Fatalf("listener called %d times", calls)
+	}
+}
+
+func TestBtcElectrumWallet_SpendFrozen(t *testing.T) {
+	w, _ := createTestWallet(t)
+	b := &mockBroadcaster{}
+	w.broadcaster = b
+	ops := fundTestWallet(t, w, 100000, 200000, 50000)
+	payee, _ := testPayee(t, w)
+
+	if err := w.FreezeCoin(ops[1], true); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.Spend(200000, payee, wallet.NORMAL); !errors.Is(err, wallet.ErrInsufficientFunds) {
+		t.Errorf("Spent a frozen coin: %v", err)
+	}
+	if _, err := w.SpendCoins(50000, payee, wallet.NORMAL, []wire.OutPoint{ops[1]}); !errors.Is(err, wallet.ErrCoinFrozen) {
+		t.Errorf("Spent a frozen coin: %v", err)
+	}
+	if _, err := w.Spend(120000, payee, wallet.NORMAL); err != nil {
+		t.Fatal(err)
+	}
+	if spent := spentOutpoints(b.tx); len(spent) != 2 || !spent[ops[0]] || !spent[ops[2]] {
+		t.Errorf("Spent the wrong coins %v", spent)
+	}
+}
+
+func TestBtcElectrumWallet_SpendCoins(t *testing.T) {
+	w, _ := createTestWallet(t)
+	b := &mockBroadcaster{}
+	w.broadcaster = b
+	ops := fundTestWallet(t, w, 100000, 200000, 50000)
+	payee, _ := testPayee(t, w)
+
+	// both coins are spent although the larger one alone would do
+	if _, err := w.SpendCoins(40000, payee, wallet.NORMAL, []wire.OutPoint{ops[1], ops[2]}); err != nil {
+		t.Fatal(err)
+	}
+	if spent := spentOutpoints(b.tx); len(spent) != 2 || !spent[ops[1]] || !spent[ops[2]] {
+		t.Errorf("Spent the wrong coins %v", spent)
+	}
+	if _, err := w.SpendCoins(40000, payee, wallet.NORMAL, []wire.OutPoint{ops[1]}); err == nil {
+		t.Error("Spent a coin twice")
+	}
+	if _, err := w.SpendCoins(150000, payee, wallet.NORMAL, []wire.OutPoint{ops[0]}); !errors.Is(err, wallet.ErrInsufficientFunds) {
+		t.Errorf("Spent more than the coins: %v", err)
+	}
+	if _, err := w.SpendCoins(40000, payee, wallet.NORMAL, []wire.OutPoint{ops[0], ops[0]}); err == nil {
+		t.Error("Spent a duplicate coin")
+	}
+}
+
+// testPayees returns n distinct addresses outside the wallet
+func testPayees(t *testing.T, w *BtcElectrumWallet, n int) []btcutil.Address {
+	var addrs []btcutil.Address
+	for i := 0; i < n; i++ {
+		addr, err := btcutil.NewAddressWitnessPubKeyHash(bytes.Repeat([]byte{byte(i + 1)}, 20), w.params)
+		if err != nil {
+			t.Fatal(err)
+		}
+		addrs = append(addrs, addr)
+	}
+	return addrs
+}
+
+// paid returns the value of the outputs of tx to addr
+func paid(tx *wire.MsgTx, addr btcutil.Address) int64 {
+	script, _ := txscript.PayToAddrScript(addr)
+	var value int64
+	for _, out := range tx.TxOut {
+		if bytes.Equal(out.PkScript, script) {
+			value += out.Value
+		}
+	}
+	return value
+}
+
+// checkSpendResult checks the result fee, inputs and estimated size agree
+// with its transaction
+func checkSpendResult(t *testing.T, res *wallet.SpendResult) {
+	t.Helper()
+	var in, out int64
+	for i, u := range res.Inputs {
+		if res.Tx.TxIn[i].PreviousOutPoint != u.Op {
+			t.Errorf("Input %d is not %s", i, u.Op)
+		}
+		if res.Tx.TxIn[i].Sequence != 0xfffffffd {
+			t.Errorf("Input %d sequence %x does not signal replace by fee", i, res.Tx.TxIn[i].Sequence)
+		}
+		in += u.Value
+	}
+	for _, o := range res.Tx.TxOut {
+		out += o.Value
+	}
+	if res.Fee != in-out || res.Fee < res.Vsize*int64(res.FeePerByte) {
+		t.Errorf("Fee %d for %d in and %d out at %d sat/vB", res.Fee, in, out, res.FeePerByte)
+	}
+	scripts := make([][]byte, len(res.Inputs))
+	for i, u := range res.Inputs {
+		scripts[i] = u.ScriptPubkey
+	}
+	if vsize, _ := EstimateTxVsize(scripts, nil, res.Tx.TxOut); int64(vsize) != res.Vsize {
+		t.Errorf("Vsize %d, want %d", res.Vsize, vsize)
+	}
+}
+
+func TestBtcElectrumWallet_SpendMany(t *testing.T) {
+	w, _ := createTestWallet(t)
+	b := &mockBroadcaster{}
+	w.broadcaster = b
+	ops := fundTestWallet(t, w, 100000, 200000, 50000)
+	payees := testPayees(t, w, 3)
+	outs := []wallet.TransactionOutput{
+		{Address: payees[0], Value: 120000},
+		{Address: payees[1], Value: 60000},
+		{Address: payees[2], Value: 30000},
+	}
+
+	res, err := w.SpendMany(outs, wallet.NORMAL, wallet.SpendOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkSpendResult(t, res)
+	if b.tx != nil {
+		t.Fatal("SpendMany broadcast the transaction")
+	}
+	for i, out := range outs {
+		if v := paid(res.Tx, out.Address); v != out.Value {
+			t.Errorf("Output %d paid %d", i, v)
+		}
+	}
+	if len(res.Inputs) != 2 || len(res.Tx.TxOut) != 4 || res.ChangeIndex < 0 ||
+		res.Fee != res.Vsize*int64(w.GetFeePerByte(wallet.NORMAL)) {
+		t.Errorf("Result %+v", res)
+	}
+	if res.Tx.TxOut[res.ChangeIndex].Value != 300000-210000-res.Fee {
+		t.Errorf("Change %d", res.Tx.TxOut[res.ChangeIndex].Value)
+	}
+
+	txid, err := w.BroadcastTx(res.Tx)
+	if err != nil || b.tx == nil || *txid != res.Tx.TxHash() {
+		t.Fatalf("Broadcast %v", err)
+	}
+
+	// the server took a transaction without outputs the wallet cannot add
+	empty := wire.NewMsgTx(wire.TxVersion)
+	empty.AddTxIn(wire.NewTxIn(&ops[2], nil, nil))
+	if txid, err := w.BroadcastTx(empty); !errors.Is(err, wallet.ErrTxNotAdded) || txid == nil || *txid != empty.TxHash() {
+		t.Errorf("Broadcast of a transaction not added %v %v", txid, err)
+	}
+	utxos, _ := w.ListUnspent()
+	for _, u := range utxos {
+		if u.Op == ops[0] || u.Op == ops[1] {
+			t.Errorf("Spent coin %s still unspent", u.Op)
+		}
+	}
+}
+
+// cancelSpendMany releases the coins of a transaction of SpendMany
+func cancelSpendMany(t *testing.T, w *BtcElectrumWallet, res *wallet.SpendResult) {
+	t.Helper()
+	if err := w.CancelProposal(wallet.ProposalID(res.Tx)); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestBtcElectrumWallet_SpendManyLocksCoins(t *testing.T) {
+	w, _ := createTestWallet(t)
+	w.broadcaster = &mockBroadcaster{}
+	fundTestWallet(t, w, 100000, 100000)
+	payee, _ := testPayee(t, w)
+
+	// concurrent payouts each take their own coin and change key
+	results := make([]*wallet.SpendResult, 2)
+	errs := make([]error, 2)
+	var wg sync.WaitGroup
+	for i := range results {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			results[i], errs[i] = w.SpendMany([]wallet.TransactionOutput{{Address: payee, Value: 50000}},
+				wallet.NORMAL, wallet.SpendOptions{})
+		}(i)
+	}
+	wg.Wait()
+	for i, err := range errs {
+		if err != nil {
+			t.Fatalf("SpendMany %d %v", i, err)
+		}
+		checkSpendResult(t, results[i])
+	}
+	first, second := results[0], results[1]
+	if first.Inputs[0].Op == second.Inputs[0].Op {
+		t.Errorf("Both spend %s", first.Inputs[0].Op)
+	}
+	if first.ChangeIndex < 0 || second.ChangeIndex < 0 ||
+		bytes.Equal(first.Tx.TxOut[first.ChangeIndex].PkScript, second.Tx.TxOut[second.ChangeIndex].PkScript) {
+		t.Error("Both pay change to the same address")
+	}
+	if _, err := w.SpendMany([]wallet.TransactionOutput{{Address: payee, Value: 50000}},
+		wallet.NORMAL, wallet.SpendOptions{}); err == nil {
+		t.Fatal("Spent locked coins")
+	}
+
+	// broadcasting unlocks the coins as the wallet now has them spent
+	if _, err := w.BroadcastTx(first.Tx); err != nil {
+		t.Fatal(err)
+	}
+	proposal, err := w.Proposal(wallet.ProposalID(first.Tx))
+	if err != nil || proposal.Status != wallet.ProposalBroadcast {
+		t.Fatalf("Broadcast proposal %+v %v", proposal, err)
+	}
+
+	// cancelling releases the coin for the next payout
+	cancelSpendMany(t, w, second)
+	res, err := w.SpendMany([]wallet.TransactionOutput{{Address: payee, Value: 50000}},
+		wallet.NORMAL, wallet.SpendOptions{Coins: []wire.OutPoint{second.Inputs[0].Op}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkSpendResult(t, res)
+}
+
+func TestBtcElectrumWallet_SpendManyOptions(t *testing.T) {
+	w, _ := createTestWallet(t)
+	ops := fundTestWallet(t, w, 100000, 200000, 50000)
+	payees := testPayees(t, w, 2)
+
+	// send max to the second output, spending every coin
+	res, err := w.SpendMany([]wallet.TransactionOutput{
+		{Address: payees[0], Value: 10000},
+		{Address: payees[1]},
+	}, wallet.NORMAL, wallet.SpendOptions{SendMax: true, MaxOutput: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkSpendResult(t, res)
+	if len(res.Inputs) != 3 || res.ChangeIndex != -1 || len(res.Tx.TxOut) != 2 ||
+		paid(res.Tx, payees[1]) != 350000-10000-res.Fee {
+		t.Errorf("Send max %+v", res)
+	}
+	cancelSpendMany(t, w, res)
+
+	// the fee comes out of the recipient's amount
+	res, err = w.SpendMany([]wallet.TransactionOutput{{Address: payees[0], Value: 100000}}, wallet.NORMAL,
+		wallet.SpendOptions{SubtractFee: true, Coins: []wire.OutPoint{ops[1]}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkSpendResult(t, res)
+	if paid(res.Tx, payees[0]) != 100000-res.Fee || res.ChangeIndex < 0 ||
+		res.Tx.TxOut[res.ChangeIndex].Value != 100000 {
+		t.Errorf("Subtract fee %+v", res)
+	}
+	cancelSpendMany(t, w, res)
+
+	// an OP_RETURN output at a custom fee rate
+	res, err = w.SpendMany([]wallet.TransactionOutput{{Address: payees[0], Value: 100000}}, wallet.NORMAL,
+		wallet.SpendOptions{OpReturn: []byte("payout 42"), FeePerByte: 20})
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkSpendResult(t, res)
+	var data [][]byte
+	for _, out := range res.Tx.TxOut {
+		if txscript.GetScriptClass(out.PkScript) == txscript.NullDataTy {
+			data, _ = txscript.PushedData(out.PkScript)
+			if out.Value != 0 {
+				t.Errorf("OP_RETURN value %d", out.Value)
+			}
+		}
+	}
+	if len(data) != 1 || string(data[0]) != "payout 42" || res.FeePerByte != 20 ||
+		res.Fee != res.Vsize*20 {
+		t.Errorf("OP_RETURN %+v", res)
+	}
+	cancelSpendMany(t, w, res)
+
+	// a fixed fee whatever the size
+	res, err = w.SpendMany([]wallet.TransactionOutput{{Address: payees[0], Value: 100000}}, wallet.NORMAL,
+		wallet.SpendOptions{Fee: 5000})
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkSpendResult(t, res)
+	if res.Fee != 5000 || res.FeePerByte != uint64(5000/res.Vsize) || res.ChangeIndex < 0 {
+		t.Errorf("Fixed fee %+v", res)
+	}
+	cancelSpendMany(t, w, res)
+
+	for _, tt := range []struct {
+		name string
+		outs []wallet.TransactionOutput
+		opts wallet.SpendOptions
+	}{
+		{"no outputs", nil, wallet.SpendOptions{}},
+		{"dust", []wallet.TransactionOutput{{Address: payees[0], Value: 100}}, wallet.SpendOptions{}},
+		{"no address", []wallet.TransactionOutput{{Value: 10000}}, wallet.SpendOptions{}},
+		{"max out of range", []wallet.TransactionOutput{{Address: payees[0]}}, wallet.SpendOptions{SendMax: true, MaxOutput: 1}},
+		{"fee out of range", []wallet.TransactionOutput{{Address: payees[0], Value: 10000}}, wallet.SpendOptions{SubtractFee: true, FeeOutput: -1}},
+		{"max and subtract fee", []wallet.TransactionOutput{{Address: payees[0]}}, wallet.SpendOptions{SendMax: true, SubtractFee: true}},
+		{"large OP_RETURN", []wallet.TransactionOutput{{Address: payees[0], Value: 10000}}, wallet.SpendOptions{OpReturn: make([]byte, 81)}},
+		{"too much", []wallet.TransactionOutput{{Address: payees[0], Value: 350000}}, wallet.SpendOptions{}},
+		{"fee above the output", []wallet.TransactionOutput{{Address: payees[0], Value: 1000}}, wallet.SpendOptions{SubtractFee: true}},
+		{"fee and fee rate", []wallet.TransactionOutput{{Address: payees[0], Value: 10000}}, wallet.SpendOptions{Fee: 1000, FeePerByte: 5}},
+		{"negative fee", []wallet.TransactionOutput{{Address: payees[0], Value: 10000}}, wallet.SpendOptions{Fee: -1}},
+	} {
+		if _, err := w.SpendMany(tt.outs, wallet.NORMAL, tt.opts); err == nil {
+			t.Errorf("%s: no error", tt.name)
+		}
+	}
+}
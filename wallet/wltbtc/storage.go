@@ -75,3 +75,13 @@ func (sm *StorageManager) Get(pw string) error {
 
 	return json.Unmarshal(b, sm.store)
 }
+
+// CheckPassword returns an error if pw does not decrypt the stored blob. Check
+// before a Put to avoid re-encrypting the storage with a mistyped password.
+func (sm *StorageManager) CheckPassword(pw string) error {
+	if len(pw) == 0 {
+		return errors.New("no password")
+	}
+	_, err := sm.datastore.GetDecrypted(pw)
+	return err
+}
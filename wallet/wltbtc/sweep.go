@@ -0,0 +1,232 @@
+package wltbtc
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"fmt"
+
+	"main/wallet"
+
+	"github.com/btcsuite/btcd/btcec/v2"
+	"github.com/btcsuite/btcd/btcutil"
+	hd "github.com/btcsuite/btcd/btcutil/hdkeychain"
+	"github.com/btcsuite/btcd/btcutil/txsort"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+)
+
+// SweepAddress builds, signs and broadcasts a transaction that spends all the
+// given utxos to a single output. If address is nil the coins are swept to a
+// fresh internal wallet address.
+//
+// The utxos may be P2PKH or P2WPKH outputs of key, or P2SH/P2WSH multisig
+// outputs in which case the redeemScript must be included. P2PKH outputs may
+// pay the compressed or the uncompressed public key, as old paper wallets do. Only multisig
+// scripts that can be satisfied by key alone (1-of-n) can be swept.
+func (w *BtcElectrumWallet) SweepAddress(utxos []wallet.Utxo, address *btcutil.Address, key *hd.ExtendedKey, redeemScript *[]byte, feeLevel wallet.FeeLevel) (*chainhash.Hash, error) {
+	if len(utxos) == 0 {
+		return nil, errors.New("no utxos to sweep")
+	}
+	if key == nil {
+		return nil, errors.New("no key to sign sweep")
+	}
+	privKey, err := key.ECPrivKey()
+	if err != nil {
+		return nil, err
+	}
+	var rs []byte
+	if redeemScript != nil {
+		rs = *redeemScript
+	}
+
+	var sweepAddr btcutil.Address
+	if address != nil {
+		sweepAddr = *address
+	} else {
+		sweepAddr = w.CurrentAddress(wallet.INTERNAL)
+	}
+	sweepScript, err := txscript.PayToAddrScript(sweepAddr)
+	if err != nil {
+		return nil, err
+	}
+
+	tx := wire.NewMsgTx(wire.TxVersion)
+	prevOuts := make(map[wire.OutPoint]*wire.TxOut, len(utxos))
+	prevScripts := make([][]byte, 0, len(utxos))
+	var total int64
+	for _, u := range utxos {
+		op := u.Op
+		if _, dup := prevOuts[op]; dup {
+			return nil, fmt.Errorf("duplicate utxo %s", op.String())
+		}
+		tx.AddTxIn(wire.NewTxIn(&op, nil, nil))
+		prevOuts[op] = wire.NewTxOut(u.Value, u.ScriptPubkey)
+		prevScripts = append(prevScripts, u.ScriptPubkey)
+		total += u.Value
+	}
+	out := wire.NewTxOut(total, sweepScript)
+	tx.AddTxOut(out)
+
+	vsize, err := EstimateTxVsize(prevScripts, rs, tx.TxOut)
+	if err != nil {
+		return nil, err
+	}
+	// the estimate assumes compressed public keys
+	for _, script := range prevScripts {
+		if compressed, ok := p2pkhKeyFormat(script, privKey); ok && !compressed {
+			vsize += uncompressedPubKeyExtra
+		}
+	}
+	fee := int64(vsize) * int64(w.GetFeePerByte(feeLevel))
+	out.Value = total - fee
+	if out.Value <= 0 {
+		return nil, wallet.ErrInsufficientFunds
+	}
+	if w.IsDust(out.Value) {
+		return nil, wallet.ErrorDustAmount
+	}
+
+	// BIP 69 sorting
+	txsort.InPlaceSort(tx)
+
+	err = signSweep(tx, prevOuts, rs, privKey)
+	if err != nil {
+		return nil, err
+	}
+
+	return w.broadcastTx(tx)
+}
+
+// signSweep signs every input of tx with privKey. prevOuts holds the output
+// being spent by each input.
+func signSweep(tx *wire.MsgTx, prevOuts map[wire.OutPoint]*wire.TxOut, redeemScript []byte, privKey *btcec.PrivateKey) error {
+	fetcher := txscript.NewMultiPrevOutFetcher(prevOuts)
+	sigHashes := txscript.NewTxSigHashes(tx, fetcher)
+	pubKeyHash := btcutil.Hash160(privKey.PubKey().SerializeCompressed())
+
+	for i, txIn := range tx.TxIn {
+		prevOut := prevOuts[txIn.PreviousOutPoint]
+		pkScript := prevOut.PkScript
+
+		switch txscript.GetScriptClass(pkScript) {
+		case txscript.PubKeyHashTy:
+			compressed, ok := p2pkhKeyFormat(pkScript, privKey)
+			if !ok {
+				return fmt.Errorf("key does not match input %d", i)
+			}
+			sigScript, err := txscript.SignatureScript(tx, i, pkScript,
+				txscript.SigHashAll, privKey, compressed)
+			if err != nil {
+				return err
+			}
+			txIn.SignatureScript = sigScript
+
+		case txscript.WitnessV0PubKeyHashTy:
+			if !bytes.Equal(pkScript[2:22], pubKeyHash) {
+				return fmt.Errorf("key does not match input %d", i)
+			}
+			witness, err := txscript.WitnessSignature(tx, sigHashes, i,
+				prevOut.Value, pkScript, txscript.SigHashAll, privKey, true)
+			if err != nil {
+				return err
+			}
+			txIn.Witness = witness
+
+		case txscript.ScriptHashTy:
+			if err := checkRedeemScript(pkScript, redeemScript); err != nil {
+				return err
+			}
+			sig, err := txscript.RawTxInSignature(tx, i, redeemScript,
+				txscript.SigHashAll, privKey)
+			if err != nil {
+				return err
+			}
+			// OP_0 is the extra item consumed by OP_CHECKMULTISIG
+			sigScript, err := txscript.NewScriptBuilder().
+				AddOp(txscript.OP_0).
+				AddData(sig).
+				AddData(redeemScript).
+				Script()
+			if err != nil {
+				return err
+			}
+			txIn.SignatureScript = sigScript
+
+		case txscript.WitnessV0ScriptHashTy:
+			if err := checkRedeemScript(pkScript, redeemScript); err != nil {
+				return err
+			}
+			sig, err := txscript.RawTxInWitnessSignature(tx, sigHashes, i,
+				prevOut.Value, redeemScript, txscript.SigHashAll, privKey)
+			if err != nil {
+				return err
+			}
+			txIn.Witness = wire.TxWitness{[]byte{}, sig, redeemScript}
+
+		default:
+			return fmt.Errorf("cannot sweep input %d: unsupported script type", i)
+		}
+	}
+
+	return verifyTx(tx, prevOuts, fetcher, sigHashes)
+}
+
+// p2pkhKeyFormat reports whether a P2PKH pkScript pays the compressed or the
+// uncompressed public key of privKey. ok is false if it pays neither.
+func p2pkhKeyFormat(pkScript []byte, privKey *btcec.PrivateKey) (compressed, ok bool) {
+	if txscript.GetScriptClass(pkScript) != txscript.PubKeyHashTy {
+		return false, false
+	}
+	pubKey := privKey.PubKey()
+	switch hash := pkScript[3:23]; {
+	case bytes.Equal(hash, btcutil.Hash160(pubKey.SerializeCompressed())):
+		return true, true
+	case bytes.Equal(hash, btcutil.Hash160(pubKey.SerializeUncompressed())):
+		return false, true
+	}
+	return false, false
+}
+
+// checkRedeemScript checks redeemScript is a 1-of-n multisig script paid to
+// by the p2sh or p2wsh pkScript.
+func checkRedeemScript(pkScript, redeemScript []byte) error {
+	if len(redeemScript) == 0 {
+		return errors.New("redeem script required for script hash input")
+	}
+	_, numSigs, err := txscript.CalcMultiSigStats(redeemScript)
+	if err != nil {
+		return err
+	}
+	if numSigs != 1 {
+		return fmt.Errorf("redeem script needs %d signatures - cannot sweep with one key", numSigs)
+	}
+	var match bool
+	if txscript.GetScriptClass(pkScript) == txscript.ScriptHashTy {
+		match = bytes.Equal(pkScript[2:22], btcutil.Hash160(redeemScript))
+	} else {
+		match = bytes.Equal(pkScript[2:34], chainhash.HashB(redeemScript))
+	}
+	if !match {
+		return errors.New("redeem script does not match input")
+	}
+	return nil
+}
+
+// broadcastTx sends a signed transaction to the network through the wallet's
+// broadcaster.
+func (w *BtcElectrumWallet) broadcastTx(tx *wire.MsgTx) (*chainhash.Hash, error) {
+	if w.broadcaster == nil {
+		return nil, wallet.ErrNoBroadcaster
+	}
+	var buf bytes.Buffer
+	if err := tx.Serialize(&buf); err != nil {
+		return nil, err
+	}
+	txid, err := w.broadcaster.Broadcast(hex.EncodeToString(buf.Bytes()))
+	if err != nil {
+		return nil, err
+	}
+	return chainhash.NewHashFromStr(txid)
+}
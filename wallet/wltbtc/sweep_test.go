@@ -0,0 +1,195 @@
+package wltbtc
+
+import (
+	"bytes"
+	"encoding/hex"
+	"testing"
+
+	"main/wallet"
+
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/btcutil/hdkeychain"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+)
+
+type mockBroadcaster struct {
+	tx *wire.MsgTx
+}
+
+func (m *mockBroadcaster) Broadcast(rawTx string) (string, error) {
+	b, err := hex.DecodeString(rawTx)
+	if err != nil {
+		return "", err
+	}
+	m.tx = wire.NewMsgTx(wire.TxVersion)
+	err = m.tx.Deserialize(bytes.NewReader(b))
+	if err != nil {
+		return "", err
+	}
+	return m.tx.TxHash().String(), nil
+}
+
+func createSweepWallet() (*BtcElectrumWallet, *mockBroadcaster) {
+	b := &mockBroadcaster{}
+	w := &BtcElectrumWallet{
+		params:      &chaincfg.RegressionNetParams,
+		feeProvider: wallet.NewFeeProvider(200, 10, 5, 2, "", nil),
+		broadcaster: b,
+	}
+	return w, b
+}
+
+func sweepKey(t *testing.T) *hdkeychain.ExtendedKey {
+	seed := bytes.Repeat([]byte{0x01}, 32)
+	key, err := hdkeychain.NewMaster(seed, &chaincfg.RegressionNetParams)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+func sweepUtxo(index uint32, value int64, script []byte) wallet.Utxo {
+	h, _ := chainhash.NewHashFromStr("16bed6368b8b1542cd6eb87f5bc20dc830b41a2258dde40438a75fa701d24e9a")
+	return wallet.Utxo{
+		Op:           *wire.NewOutPoint(h, index),
+		AtHeight:     100,
+		Value:        value,
+		ScriptPubkey: script,
+	}
+}
+
+func TestSweepAddress(t *testing.T) {
+	w, b := createSweepWallet()
+	params := w.params
+	key := sweepKey(t)
+	priv, _ := key.ECPrivKey()
+	pkHash := btcutil.Hash160(priv.PubKey().SerializeCompressed())
+
+	p2pkh, _ := btcutil.NewAddressPubKeyHash(pkHash, params)
+	p2pkhScript, _ := txscript.PayToAddrScript(p2pkh)
+	p2wpkh, _ := btcutil.NewAddressWitnessPubKeyHash(pkHash, params)
+	p2wpkhScript, _ := txscript.PayToAddrScript(p2wpkh)
+
+	dest, _ := btcutil.DecodeAddress("bcrt1q3fx029uese6mrhvq68u4l6me49refj8maqxvfv", params)
+	utxos := []wallet.Utxo{
+		sweepUtxo(0, 100000, p2pkhScript),
+		sweepUtxo(1, 200000, p2wpkhScript),
+	}
+
+	txid, err := w.SweepAddress(utxos, &dest, key, nil, wallet.NORMAL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b.tx == nil || b.tx.TxHash() != *txid {
+		t.Fatal("swept transaction was not broadcast")
+	}
+	if len(b.tx.TxIn) != 2 || len(b.tx.TxOut) != 1 {
+		t.Fatal("sweep has wrong number of inputs or outputs")
+	}
+	vsize, _ := EstimateTxVsize([][]byte{p2pkhScript, p2wpkhScript}, nil, b.tx.TxOut)
+	if b.tx.TxOut[0].Value != 300000-int64(vsize)*5 {
+		t.Fatalf("wrong sweep output value %d", b.tx.TxOut[0].Value)
+	}
+	actual := (b.tx.SerializeSizeStripped()*3 + b.tx.SerializeSize() + 3) / 4
+	if actual > vsize {
+		t.Fatalf("vsize estimate %d is less than actual vsize %d", vsize, actual)
+	}
+}
+
+func TestSweepUncompressed(t *testing.T) {
+	w, b := createSweepWallet()
+	key := sweepKey(t)
+	priv, _ := key.ECPrivKey()
+
+	// a paper wallet paying the uncompressed public key
+	addr, _ := btcutil.NewAddressPubKeyHash(btcutil.Hash160(priv.PubKey().SerializeUncompressed()), w.params)
+	script, _ := txscript.PayToAddrScript(addr)
+	dest, _ := btcutil.DecodeAddress("bcrt1q3fx029uese6mrhvq68u4l6me49refj8maqxvfv", w.params)
+	if _, err := w.SweepAddress([]wallet.Utxo{sweepUtxo(0, 100000, script)}, &dest, key, nil, wallet.NORMAL); err != nil {
+		t.Fatal(err)
+	}
+	data, err := txscript.PushedData(b.tx.TxIn[0].SignatureScript)
+	if err != nil || len(data) != 2 || len(data[1]) != 65 {
+		t.Fatalf("signature script %x", b.tx.TxIn[0].SignatureScript)
+	}
+	paid := 100000 - b.tx.TxOut[0].Value
+	if actual := int64(b.tx.SerializeSize()); paid < actual*5 {
+		t.Fatalf("fee %d for %d vbytes", paid, actual)
+	}
+}
+
+func TestSweepMultisig(t *testing.T) {
+	w, b := createSweepWallet()
+	params := w.params
+	key := sweepKey(t)
+	priv, _ := key.ECPrivKey()
+	other, _ := key.Derive(1)
+	otherPub, _ := other.ECPubKey()
+
+	pub1, _ := btcutil.NewAddressPubKey(priv.PubKey().SerializeCompressed(), params)
+	pub2, _ := btcutil.NewAddressPubKey(otherPub.SerializeCompressed(), params)
+	redeemScript, err := txscript.MultiSigScript([]*btcutil.AddressPubKey{pub1, pub2}, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p2sh, _ := btcutil.NewAddressScriptHash(redeemScript, params)
+	p2shScript, _ := txscript.PayToAddrScript(p2sh)
+	wsh := chainhash.HashB(redeemScript)
+	p2wsh, _ := btcutil.NewAddressWitnessScriptHash(wsh, params)
+	p2wshScript, _ := txscript.PayToAddrScript(p2wsh)
+
+	dest, _ := btcutil.DecodeAddress("mvP2UeXooRghYvsX7H7XVj78FY49jJw6Sq", params)
+
+	for _, script := range [][]byte{p2shScript, p2wshScript} {
+		utxos := []wallet.Utxo{sweepUtxo(0, 500000, script)}
+		_, err = w.SweepAddress(utxos, &dest, key, &redeemScript, wallet.PRIOIRTY)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if b.tx.TxOut[0].Value >= 500000 {
+			t.Fatal("no fee paid")
+		}
+	}
+
+	// a 2-of-2 needs another signature
+	redeemScript2, _ := txscript.MultiSigScript([]*btcutil.AddressPubKey{pub1, pub2}, 2)
+	p2sh2, _ := btcutil.NewAddressScriptHash(redeemScript2, params)
+	p2shScript2, _ := txscript.PayToAddrScript(p2sh2)
+	utxos := []wallet.Utxo{sweepUtxo(0, 500000, p2shScript2)}
+	_, err = w.SweepAddress(utxos, &dest, key, &redeemScript2, wallet.PRIOIRTY)
+	if err == nil {
+		t.Fatal("expected error sweeping 2-of-2 with one key")
+	}
+}
+
+func TestSweepErrors(t *testing.T) {
+	w, _ := createSweepWallet()
+	key := sweepKey(t)
+	dest, _ := btcutil.DecodeAddress("mvP2UeXooRghYvsX7H7XVj78FY49jJw6Sq", w.params)
+	destScript, _ := txscript.PayToAddrScript(dest)
+
+	// not our key
+	utxos := []wallet.Utxo{sweepUtxo(0, 100000, destScript)}
+	if _, err := w.SweepAddress(utxos, &dest, key, nil, wallet.NORMAL); err == nil {
+		t.Fatal("expected error for wrong key")
+	}
+
+	// fee more than value
+	priv, _ := key.ECPrivKey()
+	addr, _ := btcutil.NewAddressPubKeyHash(btcutil.Hash160(priv.PubKey().SerializeCompressed()), w.params)
+	script, _ := txscript.PayToAddrScript(addr)
+	utxos = []wallet.Utxo{sweepUtxo(0, 500, script)}
+	if _, err := w.SweepAddress(utxos, &dest, key, nil, wallet.NORMAL); err != wallet.ErrInsufficientFunds {
+		t.Fatalf("expected insufficient funds, got %v", err)
+	}
+
+	// no broadcaster
+	w.broadcaster = nil
+	utxos = []wallet.Utxo{sweepUtxo(0, 100000, script)}
+	if _, err := w.SweepAddress(utxos, &dest, key, nil, wallet.NORMAL); err != wallet.ErrNoBroadcaster {
+		t.Fatalf("expected no broadcaster error, got %v", err)
+	}
+}
@@ -28,7 +28,15 @@ type TxStore struct {
 
 	params *chaincfg.Params
 
-	listeners []func(wallet.TransactionCallback)
+	// Transaction listeners and the events waiting to be sent to them. Events
+	// are queued while the store is locked and sent after it is unlocked.
+	// While held is non-zero the wallet holds its own lock and events wait
+	// for releaseEvents.
+	listenersMtx sync.Mutex
+	listeners    map[int]func(wallet.TransactionCallback)
+	nextListener int
+	events       []wallet.TransactionCallback
+	held         int
 
 	wallet.Datastore
 }
@@ -41,6 +49,7 @@ func NewTxStore(p *chaincfg.Params, db wallet.Datastore, keyManager *KeyManager)
 		cbMutex:    new(sync.Mutex),
 		txidsMutex: new(sync.RWMutex),
 		txids:      make(map[string]int64),
+		listeners:  make(map[int]func(wallet.TransactionCallback)),
 		Datastore:  db,
 	}
 	err := txs.PopulateAdrs()
@@ -62,6 +71,7 @@ func (ts *TxStore) PopulateAdrs() error {
 		}
 		ts.adrs = append(ts.adrs, addr)
 	}
+	ts.adrs = append(ts.adrs, ts.keyManager.GetImportedAddresses()...)
 	ts.addrMutex.Unlock()
 
 	ts.watchedScripts, _ = ts.WatchedScripts().GetAll()
@@ -92,6 +102,12 @@ func (ts *TxStore) Ingest(tx *wire.MsgTx, height int64, timestamp time.Time) (ui
 	ts.txidsMutex.RLock()
 	sh, ok := ts.txids[tx.TxHash().String()]
 	ts.txidsMutex.RUnlock()
+	if ok && sh > 0 && height > 0 && height != sh {
+		// The server moved a confirmed transaction to another block. A
+		// confirmed transaction is never reset to the mempool here, see
+		// below; ClearFromHeight drops blocks that were reorged out.
+		return 1, ts.reorg(tx.TxHash(), height)
+	}
 	if ok && (sh > 0 || (sh == 0 && height == 0)) {
 		return 1, nil
 	}
@@ -108,8 +124,9 @@ func (ts *TxStore) Ingest(tx *wire.MsgTx, height int64, timestamp time.Time) (ui
 		} else {
 			// Mark any unconfirmed doubles as dead
 			for _, double := range doubleSpends {
-				ts.markAsDead(*double)
+				ts.markAsDead(*double, wallet.TxEventDoubleSpent)
 			}
+			defer ts.sendEvents()
 		}
 	}
 
@@ -129,7 +146,7 @@ func (ts *TxStore) Ingest(tx *wire.MsgTx, height int64, timestamp time.Time) (ui
 
 	// Iterate through all outputs of this tx, see if we gain
 	cachedSha := tx.TxHash()
-	cb := wallet.TransactionCallback{Txid: cachedSha.String(), Height: height}
+	cb := wallet.TransactionCallback{Event: wallet.TxEventNew, Txid: cachedSha.String(), Height: height}
 	value := int64(0)
 	matchesWatchOnly := false
 	for i, txout := range tx.TxOut {
@@ -244,6 +261,7 @@ func (ts *TxStore) Ingest(tx *wire.MsgTx, height int64, timestamp time.Time) (ui
 		shouldCallback := false
 		if err != nil {
 			cb.Value = value
+			cb.WatchOnly = hits == 0
 			txn.Timestamp = timestamp
 			shouldCallback = true
 			var buf bytes.Buffer
@@ -257,40 +275,106 @@ func (ts *TxStore) Ingest(tx *wire.MsgTx, height int64, timestamp time.Time) (ui
 			ts.Txns().UpdateHeight(tx.TxHash(), int(height), txn.Timestamp)
 			ts.txids[tx.TxHash().String()] = height
 			if height > 0 {
+				cb.Event = wallet.TxEventConfirmed
 				cb.Value = txn.Value
+				cb.WatchOnly = txn.WatchOnly
 				shouldCallback = true
 			}
 		}
+		cb.Timestamp = txn.Timestamp
 		cb.BlockTime = timestamp
 		ts.txidsMutex.Unlock()
 		if shouldCallback {
-			// Callback on listeners
-			for _, listener := range ts.listeners {
-				listener(cb)
-			}
+			ts.queueEvent(cb)
 		}
 		ts.cbMutex.Unlock()
+		if err := ts.updateProposals(tx, height); err != nil {
+			return hits, err
+		}
 		ts.PopulateAdrs()
+		ts.sendEvents()
 		hits++
 	}
 	return hits, err
 }
 
-func (ts *TxStore) markAsDead(txid chainhash.Hash) error {
+// ClearFromHeight removes all transactions at or above height, along with any
+// unconfirmed or dead transactions, and the utxos and stxos they created. Coins
+// spent by a removed transaction but created below height become unspent again.
+// The removed history is expected to be re-ingested by a rescan.
+func (ts *TxStore) ClearFromHeight(height int64) error {
+	ts.cbMutex.Lock()
+	defer ts.cbMutex.Unlock()
+
+	removed := func(h int64) bool {
+		return h <= 0 || h >= height
+	}
+
 	stxos, err := ts.Stxos().GetAll()
 	if err != nil {
 		return err
 	}
-	markStxoAsDead := func(s wallet.Stxo) error {
-		err := ts.Stxos().Delete(s)
+	for _, s := range stxos {
+		if !removed(s.SpendHeight) {
+			continue
+		}
+		if err := ts.Stxos().Delete(s); err != nil {
+			return err
+		}
+		if !removed(s.Utxo.AtHeight) {
+			if err := ts.Utxos().Put(s.Utxo); err != nil {
+				return err
+			}
+		}
+	}
+
+	utxos, err := ts.Utxos().GetAll()
+	if err != nil {
+		return err
+	}
+	for _, u := range utxos {
+		if removed(u.AtHeight) {
+			if err := ts.Utxos().Delete(u); err != nil {
+				return err
+			}
+		}
+	}
+
+	txns, err := ts.Txns().GetAll(true)
+	if err != nil {
+		return err
+	}
+	ts.txidsMutex.Lock()
+	defer ts.txidsMutex.Unlock()
+	for _, t := range txns {
+		if !removed(t.Height) {
+			continue
+		}
+		txid, err := chainhash.NewHashFromStr(t.Txid)
 		if err != nil {
 			return err
 		}
-		err = ts.Txns().UpdateHeight(s.SpendTxid, -1, time.Now())
+		if err := ts.Txns().Delete(txid); err != nil {
+			return err
+		}
+		delete(ts.txids, t.Txid)
+	}
+	return nil
+}
+
+// markAsDead marks a transaction and any that depend on it as dead, returning
+// the coins it spent to the utxos. event is sent for each dead transaction.
+func (ts *TxStore) markAsDead(txid chainhash.Hash, event wallet.TransactionEvent) error {
+	stxos, err := ts.Stxos().GetAll()
+	if err != nil {
+		return err
+	}
+	markStxoAsDead := func(s wallet.Stxo) error {
+		err := ts.Stxos().Delete(s)
 		if err != nil {
 			return err
 		}
-		return nil
+		return ts.setDead(s.SpendTxid, event)
 	}
 	for _, s := range stxos {
 		// If an stxo is marked dead, move it back into the utxo table
@@ -307,7 +391,7 @@ func (ts *TxStore) markAsDead(txid chainhash.Hash) error {
 			if err := markStxoAsDead(s); err != nil {
 				return err
 			}
-			if err := ts.markAsDead(s.SpendTxid); err != nil {
+			if err := ts.markAsDead(s.SpendTxid, event); err != nil {
 				return err
 			}
 		}
@@ -325,10 +409,165 @@ func (ts *TxStore) markAsDead(txid chainhash.Hash) error {
 			}
 		}
 	}
-	ts.Txns().UpdateHeight(txid, -1, time.Now())
+	return ts.setDead(txid, event)
+}
+
+// setDead sets the height of a transaction to -1 and queues event the first
+// time it dies
+func (ts *TxStore) setDead(txid chainhash.Hash, event wallet.TransactionEvent) error {
+	txn, err := ts.Txns().Get(txid)
+	if err != nil {
+		// not a wallet transaction
+		return nil
+	}
+	if txn.Height < 0 {
+		return nil
+	}
+	err = ts.Txns().UpdateHeight(txid, -1, time.Now())
+	if err != nil {
+		return err
+	}
+	if err = ts.deadProposals(txid); err != nil {
+		return err
+	}
+	ts.txidsMutex.Lock()
+	ts.txids[txid.String()] = -1
+	ts.txidsMutex.Unlock()
+	ts.queueEvent(wallet.TransactionCallback{
+		Event:     event,
+		Txid:      txid.String(),
+		Height:    -1,
+		Value:     txn.Value,
+		WatchOnly: txn.WatchOnly,
+		Timestamp: txn.Timestamp,
+	})
+	return nil
+}
+
+// reorg moves a confirmed transaction to a new confirmed height along with the
+// utxos and stxos it created or spent.
+func (ts *TxStore) reorg(txid chainhash.Hash, height int64) error {
+	ts.cbMutex.Lock()
+	defer ts.sendEvents()
+	defer ts.cbMutex.Unlock()
+
+	txn, err := ts.Txns().Get(txid)
+	if err != nil {
+		return err
+	}
+	err = ts.Txns().UpdateHeight(txid, int(height), txn.Timestamp)
+	if err != nil {
+		return err
+	}
+	utxos, err := ts.Utxos().GetAll()
+	if err != nil {
+		return err
+	}
+	for _, u := range utxos {
+		if u.Op.Hash.IsEqual(&txid) {
+			u.AtHeight = height
+			if err := ts.Utxos().Put(u); err != nil {
+				return err
+			}
+		}
+	}
+	stxos, err := ts.Stxos().GetAll()
+	if err != nil {
+		return err
+	}
+	for _, s := range stxos {
+		changed := false
+		if s.Utxo.Op.Hash.IsEqual(&txid) {
+			s.Utxo.AtHeight = height
+			changed = true
+		}
+		if s.SpendTxid.IsEqual(&txid) {
+			s.SpendHeight = height
+			changed = true
+		}
+		if changed {
+			if err := ts.Stxos().Put(s); err != nil {
+				return err
+			}
+		}
+	}
+	ts.txidsMutex.Lock()
+	ts.txids[txid.String()] = height
+	ts.txidsMutex.Unlock()
+
+	ts.queueEvent(wallet.TransactionCallback{
+		Event:     wallet.TxEventReorged,
+		Txid:      txid.String(),
+		Height:    height,
+		Value:     txn.Value,
+		WatchOnly: txn.WatchOnly,
+		Timestamp: txn.Timestamp,
+	})
 	return nil
 }
 
+// AddListener registers a transaction listener and returns a function that
+// removes it
+func (ts *TxStore) AddListener(listener func(wallet.TransactionCallback)) func() {
+	ts.listenersMtx.Lock()
+	defer ts.listenersMtx.Unlock()
+	id := ts.nextListener
+	ts.nextListener++
+	ts.listeners[id] = listener
+	return func() {
+		ts.listenersMtx.Lock()
+		delete(ts.listeners, id)
+		ts.listenersMtx.Unlock()
+	}
+}
+
+// queueEvent holds an event until sendEvents is called
+func (ts *TxStore) queueEvent(cb wallet.TransactionCallback) {
+	ts.listenersMtx.Lock()
+	ts.events = append(ts.events, cb)
+	ts.listenersMtx.Unlock()
+}
+
+// holdEvents keeps queued events from being sent until releaseEvents
+func (ts *TxStore) holdEvents() {
+	ts.listenersMtx.Lock()
+	ts.held++
+	ts.listenersMtx.Unlock()
+}
+
+// releaseEvents undoes holdEvents and sends the events queued meanwhile
+func (ts *TxStore) releaseEvents() {
+	ts.listenersMtx.Lock()
+	ts.held--
+	ts.listenersMtx.Unlock()
+	ts.sendEvents()
+}
+
+// sendEvents sends all queued events to the listeners. It must not be called
+// with any store lock held so listeners are free to call into the wallet.
+// Events stay queued while they are held.
+func (ts *TxStore) sendEvents() {
+	ts.listenersMtx.Lock()
+	if ts.held > 0 {
+		ts.listenersMtx.Unlock()
+		return
+	}
+	events := ts.events
+	ts.events = nil
+	listeners := make([]func(wallet.TransactionCallback), 0, len(ts.listeners))
+	for i := 0; i < ts.nextListener; i++ {
+		if l, ok := ts.listeners[i]; ok {
+			listeners = append(listeners, l)
+		}
+	}
+	ts.listenersMtx.Unlock()
+	for _, cb := range events {
+		for _, listener := range listeners {
+			listener(cb)
+		}
+	}
+}
+
 // CheckDoubleSpends takes a transaction and compares it with
 // all transactions in the db.  It returns a slice of all txids in the db
 // which are double spent by the received tx.
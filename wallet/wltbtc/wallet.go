@@ -6,6 +6,7 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"strings"
 	"sync"
 	"time"
 
@@ -41,6 +42,15 @@ type BtcElectrumWallet struct {
 
 	feeProvider *wallet.FeeProvider
 
+	// nil if exchange rates are disabled
+	exchangeRates wallet.ExchangeRates
+
+	// the client sends our transactions to the network
+	broadcaster wallet.Broadcaster
+
+	// the client headers for the chain tip and block times
+	headers wallet.Headers
+
 	repoPath string
 
 	// TODO: maybe a scaled down blockchain with headers of interest to wallet?
@@ -125,13 +135,16 @@ func makeBtcElectrumWallet(config *wallet.WalletConfig, pw string, seed []byte)
 			config.HighFee,
 			config.MediumFee,
 			config.LowFee,
-			// move to client
 			"",
-			nil,
-			// config.FeeAPI.String(),
-			// config.Proxy,
+			config.Proxy,
 		),
-		mutex: new(sync.RWMutex),
+		broadcaster: config.Broadcaster,
+		headers:     config.Headers,
+		mutex:       new(sync.RWMutex),
+	}
+	w.feeProvider.Sources = config.FeeSources
+	if len(config.RateSources) > 0 {
+		w.exchangeRates = wallet.NewExchangeRateProvider(config.Chain, config.RateSources)
 	}
 
 	sm := NewStorageManager(config.DB.Enc(), config.Params)
@@ -207,13 +220,16 @@ func loadBtcElectrumWallet(config *wallet.WalletConfig, pw string) (*BtcElectrum
 			config.HighFee,
 			config.MediumFee,
 			config.LowFee,
-			// move to client
 			"",
-			nil,
-			// config.FeeAPI.String(),
-			// config.Proxy,
+			config.Proxy,
 		),
-		mutex: new(sync.RWMutex),
+		broadcaster: config.Broadcaster,
+		headers:     config.Headers,
+		mutex:       new(sync.RWMutex),
+	}
+	w.feeProvider.Sources = config.FeeSources
+	if len(config.RateSources) > 0 {
+		w.exchangeRates = wallet.NewExchangeRateProvider(config.Chain, config.RateSources)
 	}
 
 	w.keyManager, err = NewKeyManager(config.DB.Keys(), w.params, w.masterPrivateKey)
@@ -221,6 +237,11 @@ func loadBtcElectrumWallet(config *wallet.WalletConfig, pw string) (*BtcElectrum
 		return nil, err
 	}
 
+	err = w.loadImported()
+	if err != nil {
+		return nil, err
+	}
+
 	w.txstore, err = NewTxStore(w.params, config.DB, w.keyManager)
 	if err != nil {
 		return nil, err
@@ -364,6 +385,7 @@ func (w *BtcElectrumWallet) ListAddresses() []btcutil.Address {
 		}
 		addrs = append(addrs, addr)
 	}
+	addrs = append(addrs, w.keyManager.GetImportedAddresses()...)
 	return addrs
 }
 
@@ -399,12 +421,18 @@ func (w *BtcElectrumWallet) Balance() (confirmed, unconfirmed int64) {
 	return confirmed, unconfirmed
 }
 
+// ListUnspent returns the wallet utxos, including watch only coins
+func (w *BtcElectrumWallet) ListUnspent() ([]wallet.Utxo, error) {
+	return w.txstore.Utxos().GetAll()
+}
+
 func (w *BtcElectrumWallet) Transactions() ([]wallet.Txn, error) {
 	height := w.ChainTip()
 	txns, err := w.txstore.Txns().GetAll(false)
 	if err != nil {
 		return txns, err
 	}
+	mempool := w.mempoolHistory()
 	for i, tx := range txns {
 		var confirmations int64
 		var status wallet.StatusCode
@@ -414,11 +442,12 @@ func (w *BtcElectrumWallet) Transactions() ([]wallet.Txn, error) {
 		}
 		switch {
 		case confs < 0:
+			// dead transactions were double spent or dropped from the mempool
 			status = wallet.StatusDead
-		case confs == 0 && time.Since(tx.Timestamp) <= time.Hour*6:
+		case confs == 0:
+			// alive for as long as the server has it in the mempool
 			status = wallet.StatusUnconfirmed
-		case confs == 0 && time.Since(tx.Timestamp) > time.Hour*6:
-			status = wallet.StatusDead
+			setMempoolInfo(&tx, mempool)
 		case confs > 0 && confs < 6:
 			status = wallet.StatusPending
 			confirmations = confs
@@ -432,6 +461,34 @@ func (w *BtcElectrumWallet) Transactions() ([]wallet.Txn, error) {
 	}
 	return txns, nil
 }
+
+// mempoolHistory returns the stored server history of unconfirmed
+// transactions by txid
+func (w *BtcElectrumWallet) mempoolHistory() map[string]wallet.HistoryEntry {
+	mempool := make(map[string]wallet.HistoryEntry)
+	history, err := w.txstore.History().GetAll()
+	if err != nil {
+		return mempool
+	}
+	for _, h := range history {
+		if h.Height <= 0 {
+			mempool[h.Txid] = h
+		}
+	}
+	return mempool
+}
+
+// setMempoolInfo sets the fee and unconfirmed parents state of an unconfirmed
+// transaction from the server history
+func setMempoolInfo(txn *wallet.Txn, mempool map[string]wallet.HistoryEntry) {
+	h, ok := mempool[txn.Txid]
+	if !ok {
+		return
+	}
+	txn.Fee = h.Fee
+	txn.UnconfirmedParents = h.Height < 0
+}
+
 func (w *BtcElectrumWallet) HasTransaction(txid chainhash.Hash) bool {
 	_, err := w.txstore.Txns().Get(txid)
 	// error only for 'no rows in rowset'
@@ -468,6 +525,9 @@ func (w *BtcElectrumWallet) GetTransaction(txid chainhash.Hash) (wallet.Txn, err
 			outs = append(outs, tout)
 		}
 		txn.Outputs = outs
+		if txn.Height == 0 {
+			setMempoolInfo(&txn, w.mempoolHistory())
+		}
 	}
 	return txn, err
 }
@@ -510,30 +570,76 @@ func (w *BtcElectrumWallet) Params() *chaincfg.Params {
 }
 
 func (w *BtcElectrumWallet) ChainTip() int64 {
-	// not yet implemented - Get from ElectrumX
-	return 0
+	if w.headers == nil {
+		return 0
+	}
+	return int64(w.headers.Tip())
 }
 
 func (w *BtcElectrumWallet) ExchangeRates() wallet.ExchangeRates {
-	// not yet implemented
-	return nil
+	return w.exchangeRates
+}
+
+func (w *BtcElectrumWallet) HistoricalPrices() wallet.Prices {
+	return w.txstore.Prices()
+}
+
+func (w *BtcElectrumWallet) FiatTransactions(currency string) ([]wallet.FiatTxn, error) {
+	txns, err := w.Transactions()
+	if err != nil {
+		return nil, err
+	}
+	return wallet.ValueTransactions(txns, w.txstore.Prices(), w.headers, currency,
+		wallet.UnitsPerCoin(wallet.Bitcoin))
+}
+
+// RealisedGains takes the lots from the wallet outputs, spent or not. Watch
+// only coins are left out.
+func (w *BtcElectrumWallet) RealisedGains(currency string, method wallet.LotMethod, period wallet.Period) (*wallet.GainsReport, error) {
+	txns, err := w.FiatTransactions(currency)
+	if err != nil {
+		return nil, err
+	}
+	utxos, err := w.txstore.Utxos().GetAll()
+	if err != nil {
+		return nil, err
+	}
+	stxos, err := w.txstore.Stxos().GetAll()
+	if err != nil {
+		return nil, err
+	}
+	var outputs []wallet.Utxo
+	for _, u := range utxos {
+		if !u.WatchOnly {
+			outputs = append(outputs, u)
+		}
+	}
+	for _, s := range stxos {
+		if !s.Utxo.WatchOnly {
+			outputs = append(outputs, s.Utxo)
+		}
+	}
+	report, err := wallet.CalculateGains(txns, outputs, method, period, wallet.UnitsPerCoin(wallet.Bitcoin))
+	if err != nil {
+		return nil, err
+	}
+	report.Currency = strings.ToUpper(currency)
+	return report, nil
 }
 
 // Get the current fee per byte
 func (w *BtcElectrumWallet) GetFeePerByte(feeLevel wallet.FeeLevel) uint64 {
-	// not yet implemented
-	return 0
+	return w.feeProvider.GetFeePerByte(feeLevel)
 }
 
-// Send bitcoins to an external wallet
-func (w *BtcElectrumWallet) Spend(amount int64, addr btcutil.Address, feeLevel wallet.FeeLevel) (*chainhash.Hash, error) {
-	// not yet implemented
-	return nil, wallet.ErrWalletFnNotImplemented
+// Get the current fee per byte to confirm within the number of blocks
+func (w *BtcElectrumWallet) GetFeePerByteForTarget(blocks int) uint64 {
+	return w.feeProvider.GetFeePerByteForTarget(blocks)
 }
 
-// Bump the fee for the given transaction
-func (w *BtcElectrumWallet) BumpFee(txid chainhash.Hash) (*chainhash.Hash, error) {
-	return nil, wallet.ErrWalletFnNotImplemented
+// Check a fee per byte chosen by the user is within the allowed range
+func (w *BtcElectrumWallet) CustomFeePerByte(satPerByte uint64) (uint64, error) {
+	return w.feeProvider.CustomFeePerByte(satPerByte)
 }
 
 // Calculates the estimated size of the transaction and returns the total fee for the given feePerByte
@@ -542,12 +648,6 @@ func (w *BtcElectrumWallet) EstimateFee(ins []wallet.TransactionInput, outs []wa
 	return 0
 }
 
-// Build and broadcast a transaction that sweeps all coins from an address. If it is a p2sh multisig, the redeemScript must be included
-func (w *BtcElectrumWallet) SweepAddress(utxos []wallet.Utxo, address *btcutil.Address, key *hdkeychain.ExtendedKey, redeemScript *[]byte, feeLevel wallet.FeeLevel) (*chainhash.Hash, error) {
-	// not yet implemented
-	return nil, wallet.ErrWalletFnNotImplemented
-}
-
 // Create a signature for a multisig transaction
 func (w *BtcElectrumWallet) CreateMultisigSignature(ins []wallet.TransactionInput, outs []wallet.TransactionOutput, key *hdkeychain.ExtendedKey, redeemScript []byte, feePerByte uint64) ([]wallet.Signature, error) {
 	// not yet implemented
@@ -580,18 +680,70 @@ func (w *BtcElectrumWallet) AddWatchedScript(script []byte) error {
 	return nil
 }
 
-// AddTransactionListener
-func (w *BtcElectrumWallet) AddTransactionListener(listener func(wallet.TransactionCallback)) {
-	// not yet implemented
+// lock takes the wallet lock. Transaction events raised while it is held are
+// sent by unlock once the lock is released, so listeners can call back into
+// the wallet.
+func (w *BtcElectrumWallet) lock() {
+	w.mutex.Lock()
+	w.txstore.holdEvents()
 }
 
-// NotifyTransactionListners
+// unlock releases the wallet lock and sends the held transaction events
+func (w *BtcElectrumWallet) unlock() {
+	w.mutex.Unlock()
+	w.txstore.releaseEvents()
+}
+
+// AddTransactionListener adds a listener for new, confirmed, double spent and
+// reorged wallet transactions. Call the returned function to remove it.
+func (w *BtcElectrumWallet) AddTransactionListener(listener func(wallet.TransactionCallback)) func() {
+	return w.txstore.AddListener(listener)
+}
+
+// NotifyTransactionListners sends cb to all transaction listeners
 func (w *BtcElectrumWallet) NotifyTransactionListners(cb wallet.TransactionCallback) {
-	// not yet implemented
+	w.txstore.queueEvent(cb)
+	w.txstore.sendEvents()
+}
+
+// ReSyncBlockchain drops all wallet history at or above fromHeight together
+// with any unconfirmed transactions. The wallet has no node so the client then
+// re-queries the history of every wallet and watched script and adds the
+// transactions back with AddTransaction.
+func (w *BtcElectrumWallet) ReSyncBlockchain(fromHeight uint64) error {
+	w.lock()
+	defer w.unlock()
+	err := w.txstore.ClearFromHeight(int64(fromHeight))
+	if err != nil {
+		return err
+	}
+	return w.txstore.PopulateAdrs()
+}
+
+// AddTransaction ingests a transaction from the server into the wallet. The
+// height is 0 for transactions in the mempool. It takes the wallet lock as it
+// changes the coins and proposals a spend selects from.
+func (w *BtcElectrumWallet) AddTransaction(tx *wire.MsgTx, height int64, timestamp time.Time) error {
+	w.lock()
+	defer w.unlock()
+	_, err := w.txstore.Ingest(tx, height, timestamp)
+	return err
+}
+
+// MarkTransactionDead marks a transaction that has dropped out of the mempool
+// or the chain as dead
+func (w *BtcElectrumWallet) MarkTransactionDead(txid chainhash.Hash) error {
+	if !w.HasTransaction(txid) {
+		return errors.New("transaction not found")
+	}
+	w.lock()
+	defer w.unlock()
+	return w.txstore.markAsDead(txid, wallet.TxEventDropped)
 }
 
-func (w *BtcElectrumWallet) ReSyncBlockchain(fromHeight uint64) {
-	panic("ReSyncBlockchain: Not implemented - Non-SPV wallet")
+// ListWatchedScripts returns the output scripts being watched by the wallet
+func (w *BtcElectrumWallet) ListWatchedScripts() ([][]byte, error) {
+	return w.txstore.WatchedScripts().GetAll()
 }
 
 func (w *BtcElectrumWallet) AddWatchedAddresses(addrs ...btcutil.Address) error {
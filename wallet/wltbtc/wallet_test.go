@@ -0,0 +1,332 @@
+package wltbtc
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"main/wallet"
+
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+)
+
+func createTestWallet(t *testing.T) (*BtcElectrumWallet, *MockDatastore) {
+	db := NewMockDatastore()
+	cfg := &wallet.WalletConfig{
+		Chain:     wallet.Bitcoin,
+		Params:    &chaincfg.RegressionNetParams,
+		DB:        db,
+		LowFee:    2,
+		MediumFee: 5,
+		HighFee:   10,
+		MaxFee:    200,
+		Testing:   true,
+	}
+	seed := bytes.Repeat([]byte{0x02}, 32)
+	w, err := makeBtcElectrumWallet(cfg, pw, seed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return w, db
+}
+
+func TestReSyncBlockchain(t *testing.T) {
+	w, _ := createTestWallet(t)
+	script, err := w.AddressToScript(w.CurrentAddress(wallet.EXTERNAL))
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, _ := chainhash.NewHashFromStr("a2d6fc5cbe6d43ddd1b36b2dba2e6b4d80e0a8e1cd5ad2d42a6a7f69f83b7b8d")
+
+	// received at 10
+	recv := wire.NewMsgTx(wire.TxVersion)
+	recv.AddTxIn(wire.NewTxIn(wire.NewOutPoint(other, 0), nil, nil))
+	recv.AddTxOut(wire.NewTxOut(100000, script))
+	// spent at 20 to ourself
+	recvHash := recv.TxHash()
+	spend := wire.NewMsgTx(wire.TxVersion)
+	spend.AddTxIn(wire.NewTxIn(wire.NewOutPoint(&recvHash, 0), nil, nil))
+	spend.AddTxOut(wire.NewTxOut(90000, script))
+	// unconfirmed receive
+	mempool := wire.NewMsgTx(wire.TxVersion)
+	mempool.AddTxIn(wire.NewTxIn(wire.NewOutPoint(other, 1), nil, nil))
+	mempool.AddTxOut(wire.NewTxOut(5000, script))
+
+	for _, tx := range []struct {
+		tx     *wire.MsgTx
+		height int64
+	}{{recv, 10}, {spend, 20}, {mempool, 0}} {
+		if err := w.AddTransaction(tx.tx, tx.height, time.Now()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	confirmed, unconfirmed := w.Balance()
+	if confirmed != 90000 || unconfirmed != 5000 {
+		t.Fatalf("wrong balance %d %d", confirmed, unconfirmed)
+	}
+
+	if err := w.ReSyncBlockchain(15); err != nil {
+		t.Fatal(err)
+	}
+	txns, _ := w.txstore.Txns().GetAll(true)
+	if len(txns) != 1 || txns[0].Txid != recvHash.String() {
+		t.Fatal("expected only the transaction below the rescan height")
+	}
+	stxos, _ := w.txstore.Stxos().GetAll()
+	if len(stxos) != 0 {
+		t.Fatal("stxo above the rescan height not removed")
+	}
+	utxos, _ := w.txstore.Utxos().GetAll()
+	if len(utxos) != 1 || utxos[0].Op.Hash != recvHash {
+		t.Fatal("utxo spent above the rescan height not restored")
+	}
+	confirmed, unconfirmed = w.Balance()
+	if confirmed != 100000 || unconfirmed != 0 {
+		t.Fatalf("wrong balance after resync %d %d", confirmed, unconfirmed)
+	}
+
+	// re-ingesting the history gets back to where we were
+	if err := w.AddTransaction(spend, 20, time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.AddTransaction(mempool, 0, time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	confirmed, unconfirmed = w.Balance()
+	if confirmed != 90000 || unconfirmed != 5000 {
+		t.Fatalf("wrong balance after re-ingest %d %d", confirmed, unconfirmed)
+	}
+}
+
+func TestTransactionListeners(t *testing.T) {
+	w, _ := createTestWallet(t)
+	script, err := w.AddressToScript(w.CurrentAddress(wallet.EXTERNAL))
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, _ := chainhash.NewHashFromStr("a2d6fc5cbe6d43ddd1b36b2dba2e6b4d80e0a8e1cd5ad2d42a6a7f69f83b7b8d")
+	otherScript := []byte{txscript.OP_TRUE}
+
+	var events []wallet.TransactionCallback
+	unsubscribe := w.AddTransactionListener(func(cb wallet.TransactionCallback) {
+		if !w.txstore.cbMutex.TryLock() {
+			t.Error("listener called with the store locked")
+		} else {
+			w.txstore.cbMutex.Unlock()
+		}
+		events = append(events, cb)
+	})
+
+	recv := wire.NewMsgTx(wire.TxVersion)
+	recv.AddTxIn(wire.NewTxIn(wire.NewOutPoint(other, 0), nil, nil))
+	recv.AddTxOut(wire.NewTxOut(100000, script))
+	recvHash := recv.TxHash()
+	spendA := wire.NewMsgTx(wire.TxVersion)
+	spendA.AddTxIn(wire.NewTxIn(wire.NewOutPoint(&recvHash, 0), nil, nil))
+	spendA.AddTxOut(wire.NewTxOut(90000, otherScript))
+	spendB := wire.NewMsgTx(wire.TxVersion)
+	spendB.AddTxIn(wire.NewTxIn(wire.NewOutPoint(&recvHash, 0), nil, nil))
+	spendB.AddTxOut(wire.NewTxOut(80000, otherScript))
+
+	for _, tx := range []struct {
+		tx     *wire.MsgTx
+		height int64
+	}{{recv, 0}, {recv, 10}, {recv, 12}, {recv, 0}, {spendA, 0}, {spendB, 13}} {
+		if err := w.AddTransaction(tx.tx, tx.height, time.Now()); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	expected := []struct {
+		event  wallet.TransactionEvent
+		txid   chainhash.Hash
+		height int64
+	}{
+		{wallet.TxEventNew, recvHash, 0},
+		{wallet.TxEventConfirmed, recvHash, 10},
+		{wallet.TxEventReorged, recvHash, 12},
+		{wallet.TxEventNew, spendA.TxHash(), 0},
+		{wallet.TxEventDoubleSpent, spendA.TxHash(), -1},
+		{wallet.TxEventNew, spendB.TxHash(), 13},
+	}
+	if len(events) != len(expected) {
+		t.Fatalf("expected %d events, got %d", len(expected), len(events))
+	}
+	// a confirmed transaction sent again from the mempool keeps its height
+	if txn, err := w.txstore.Txns().Get(recvHash); err != nil || txn.Height != 12 {
+		t.Fatal("confirmed transaction reset to the mempool")
+	}
+	for i, e := range expected {
+		if events[i].Event != e.event || events[i].Txid != e.txid.String() || events[i].Height != e.height {
+			t.Fatalf("event %d: expected %s %s at %d, got %s %s at %d", i, e.event, e.txid,
+				e.height, events[i].Event, events[i].Txid, events[i].Height)
+		}
+	}
+	if events[0].Value != 100000 || events[3].Value != -100000 {
+		t.Fatal("wrong event value")
+	}
+
+	w.NotifyTransactionListners(wallet.TransactionCallback{Txid: "abc"})
+	if len(events) != len(expected)+1 || events[len(expected)].Txid != "abc" {
+		t.Fatal("NotifyTransactionListners did not call listener")
+	}
+
+	unsubscribe()
+	w.NotifyTransactionListners(wallet.TransactionCallback{Txid: "abc"})
+	if len(events) != len(expected)+1 {
+		t.Fatal("listener called after unsubscribe")
+	}
+}
+
+func TestTransactionsMempool(t *testing.T) {
+	w, db := createTestWallet(t)
+	script, err := w.AddressToScript(w.CurrentAddress(wallet.EXTERNAL))
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, _ := chainhash.NewHashFromStr("a2d6fc5cbe6d43ddd1b36b2dba2e6b4d80e0a8e1cd5ad2d42a6a7f69f83b7b8d")
+	tx := wire.NewMsgTx(wire.TxVersion)
+	tx.AddTxIn(wire.NewTxIn(wire.NewOutPoint(other, 0), nil, nil))
+	tx.AddTxOut(wire.NewTxOut(100000, script))
+
+	// long unconfirmed transactions stay alive
+	err = w.AddTransaction(tx, 0, time.Now().Add(-time.Hour*24))
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.History().Put("sh", []wallet.HistoryEntry{{Txid: tx.TxHash().String(), Height: -1, Fee: 300}})
+
+	txns, err := w.Transactions()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(txns) != 1 || txns[0].Status != wallet.StatusUnconfirmed {
+		t.Fatal("expected unconfirmed transaction")
+	}
+	if txns[0].Fee != 300 || !txns[0].UnconfirmedParents {
+		t.Fatal("mempool state not set")
+	}
+
+	err = w.MarkTransactionDead(tx.TxHash())
+	if err != nil {
+		t.Fatal(err)
+	}
+	txns, _ = w.Transactions()
+	if txns[0].Status != wallet.StatusDead {
+		t.Fatal("expected dead transaction")
+	}
+}
+
+func TestExchangeRates(t *testing.T) {
+	w, _ := createTestWallet(t)
+	if w.ExchangeRates() != nil {
+		t.Fatal("exchange rates without rate sources")
+	}
+
+	path := filepath.Join(t.TempDir(), "rates.json")
+	if err := os.WriteFile(path, []byte(`{"USD":43000}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	cfg := &wallet.WalletConfig{
+		Chain:       wallet.Bitcoin,
+		Params:      &chaincfg.RegressionNetParams,
+		DB:          NewMockDatastore(),
+		MaxFee:      200,
+		RateSources: []wallet.RateSource{wallet.NewFileRateSource(path)},
+		Testing:     true,
+	}
+	w, err := makeBtcElectrumWallet(cfg, pw, bytes.Repeat([]byte{0x02}, 32))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rates := w.ExchangeRates()
+	if rates == nil {
+		t.Fatal("no exchange rates")
+	}
+	if rate, err := rates.GetExchangeRate("USD"); err != nil || rate != 43000 {
+		t.Fatalf("rate %v %v", rate, err)
+	}
+	if rates.UnitsPerCoin() != 1e8 {
+		t.Fatalf("%d units per coin", rates.UnitsPerCoin())
+	}
+}
+
+// testHeaders are header timestamps by height
+type testHeaders map[int32]time.Time
+
+func (h testHeaders) BlockTime(height int32) (time.Time, bool) {
+	t, ok := h[height]
+	return t, ok
+}
+
+func (h testHeaders) Tip() int32 {
+	var tip int32
+	for height := range h {
+		tip = max(tip, height)
+	}
+	return tip
+}
+
+func TestRealisedGains(t *testing.T) {
+	w, _ := createTestWallet(t)
+	day := func(s string) time.Time {
+		d, _ := time.Parse(wallet.PriceDateLayout, s)
+		return d
+	}
+	w.headers = testHeaders{10: day("2023-01-10"), 20: day("2023-06-10")}
+	script, err := w.AddressToScript(w.CurrentAddress(wallet.EXTERNAL))
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, _ := chainhash.NewHashFromStr("a2d6fc5cbe6d43ddd1b36b2dba2e6b4d80e0a8e1cd5ad2d42a6a7f69f83b7b8d")
+	otherScript := bytes.Repeat([]byte{0x51}, 1)
+
+	// 0.01 received at 10, 0.006 sent at 20 with 0.004 change
+	recv := wire.NewMsgTx(wire.TxVersion)
+	recv.AddTxIn(wire.NewTxIn(wire.NewOutPoint(other, 0), nil, nil))
+	recv.AddTxOut(wire.NewTxOut(1000000, script))
+	recvHash := recv.TxHash()
+	spend := wire.NewMsgTx(wire.TxVersion)
+	spend.AddTxIn(wire.NewTxIn(wire.NewOutPoint(&recvHash, 0), nil, nil))
+	spend.AddTxOut(wire.NewTxOut(590000, otherScript))
+	spend.AddTxOut(wire.NewTxOut(400000, script))
+	// added long after they were mined
+	if err = w.AddTransaction(recv, 10, day("2024-01-01")); err != nil {
+		t.Fatal(err)
+	}
+	if err = w.AddTransaction(spend, 20, day("2024-01-01")); err != nil {
+		t.Fatal(err)
+	}
+
+	prices := w.HistoricalPrices()
+	prices.Put(day("2023-01-10"), "USD", 20000)
+	prices.Put(day("2023-06-10"), "USD", 30000)
+	prices.Put(day("2024-01-01"), "USD", 40000)
+
+	txns, err := w.FiatTransactions("usd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(txns) != 2 || txns[0].Txid != recvHash.String() || txns[0].FiatValue != 200 ||
+		txns[1].FiatValue != -180 || !txns[1].BlockTime.Equal(day("2023-06-10")) {
+		t.Fatalf("fiat transactions %+v", txns)
+	}
+
+	report, err := w.RealisedGains("usd", wallet.FIFO, wallet.PeriodYear)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Currency != "USD" || len(report.Disposals) != 1 || report.Disposals[0].CostBasis != 120 ||
+		report.Gain != 60 || len(report.Holdings) != 1 || report.Holdings[0].Amount != 400000 {
+		t.Fatalf("gains %+v", report)
+	}
+	if _, err = w.RealisedGains("EUR", wallet.FIFO, wallet.PeriodYear); !errors.Is(err, wallet.ErrNoPrice) {
+		t.Fatalf("gains without prices: %v", err)
+	}
+}